@@ -0,0 +1,84 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a SpireRegistration.
+const (
+	// ConditionReady is True when the SPIRE entry matches the ServiceAccount.
+	ConditionReady = "Ready"
+	// ConditionSyncing is True while the SPIRE entry is being created or updated.
+	ConditionSyncing = "Syncing"
+	// ConditionError is True when the last SPIRE sync failed.
+	ConditionError = "Error"
+)
+
+// SpireRegistrationSpec defines the desired state of SpireRegistration
+type SpireRegistrationSpec struct {
+	// ServiceAccountName is the ServiceAccount, in the same namespace, registered with SPIRE.
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+}
+
+// SpireRegistrationStatus defines the observed state of SpireRegistration
+type SpireRegistrationStatus struct {
+	// ObservedGeneration is the generation of the SpireRegistration last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// EntryID is the ID of the SPIRE entry of the ServiceAccount.
+	// +optional
+	EntryID string `json:"entryID,omitempty"`
+
+	// Conditions are the Ready, Syncing and Error conditions of the registration.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="ServiceAccount",type=string,JSONPath=`.spec.serviceAccountName`
+//+kubebuilder:printcolumn:name="Entry ID",type=string,JSONPath=`.status.entryID`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SpireRegistration reports the SPIRE registration of a managed ServiceAccount
+type SpireRegistration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SpireRegistrationSpec   `json:"spec,omitempty"`
+	Status SpireRegistrationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SpireRegistrationList contains a list of SpireRegistration
+type SpireRegistrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SpireRegistration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SpireRegistration{}, &SpireRegistrationList{})
+}
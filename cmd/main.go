@@ -17,23 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	spirev1alpha1 "github.com/shanmugara/spire-registrar/api/v1alpha1"
 	"github.com/shanmugara/spire-registrar/internal/controller"
 	//+kubebuilder:scaffold:imports
 )
@@ -46,31 +62,414 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(spirev1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "register" || os.Args[1] == "deregister") {
+		if err := runEntryCommand(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-state" {
+		if err := runMigrateState(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var x509SvidTTL int
+	var jwtSvidTTL int
+	var federatesWith string
+	var spireHealthPath string
+	var spireHealthTimeout time.Duration
+	var enablePodRegistration bool
+	var enableOrphanCleanup bool
+	var enableNamespaceCleanup bool
+	var orphanCleanupInterval time.Duration
+	var enableAudit bool
+	var auditInterval time.Duration
+	var reregisterInterval time.Duration
+	var dryRun bool
+	var maxConcurrentReconciles int
+	var spireAPIServers string
+	var spireAPIPort int
+	var spireAPICooldown time.Duration
+	var circuitFailureThreshold int
+	var circuitOpenDuration time.Duration
+	var batchWindow time.Duration
+	var manageFinalizers bool
+	var requeueJitterFraction float64
+	var maxRequeueInterval time.Duration
+	var compressKubeConfig bool
+	var sendKubeConfig bool
+	var selectorTemplate string
+	var failFastOnSpireUnreachable bool
+	var failFastOnInvalidClusterInfo bool
+	var enableRegistrationStatus bool
+	var enableValidatingWebhook bool
+	var enableResync bool
+	var resyncToken string
+	var resyncTokenFile string
+	var enableSpireCallbacks bool
+	var callbackToken string
+	var podNodeSelector string
+	var enableDebug bool
+	var debugToken string
+	var debugTokenFile string
+	var reconcileHistorySize int
+	var adoptExistingEntries bool
+	var annotateSpiffeID bool
+	var requireKubeConfig bool
+	var kubeConfigEncoding string
+	var clusterName string
+	var clusterNameOverride string
+	var clusterNameKeys string
+	var trustDomainSource string
+	var trustDomainConfigMap string
+	var trustDomainKey string
+	var shutdownGracePeriod time.Duration
+	var failureLogInterval time.Duration
+	var watchNamespace string
+	var ignoreServiceAccounts string
+	var logSkipped bool
+	var managedLabel string
+	var entryStateConfigMap string
+	var spireAPIProxy string
+	var spireAPINoProxy string
+	var spireAPITimeout time.Duration
+	var spireAPICA string
+	var spireAPIClientCert string
+	var spireAPIClientKey string
+	var spireAPITLSReloadInterval time.Duration
+	var spireAPIDeleteStyle string
+	var spireAPICreateMethod string
+	var spireAPIUpsert bool
+	var spireAPIJobTimeout time.Duration
+	var spireAPIJobPollInterval time.Duration
+	var backend string
+	var spireGRPCAddress string
+	var spireGRPCParentIDPath string
+	spireAPIPaths := controller.DefaultSpireAPIPaths()
+	spireAPIHeaders := headerFlag{}
+	kubeConfigSecrets := controller.KubeConfigSecrets{}
+	parentIDs := controller.ParentIDs{}
+	spireAPISensitiveHeaders := headerFlag{}
+	var correlationHeader string
+	var idempotencyHeader string
+	var spireAPIContentType string
+	var spireAPIAccept string
+	var spireAPIMaxResponseBytes int64
+	var spireAPIStrictDecoding bool
+	var maxEntrySize int
+	var spireAPIToken string
+	var spireAPITokenFile string
+	var otelEndpoint string
+	var otelInsecure bool
+	var rateLimiterBaseDelay time.Duration
+	var rateLimiterMaxDelay time.Duration
+	flag.StringVar(&configFile, "config", "",
+		"YAML or JSON file of controller options, keyed by flag name without the dashes. A list gives the values "+
+			"of a repeatable flag. Flags given on the command line override the file.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&watchNamespace, "namespace", "",
+		"If set, only the ServiceAccounts and Pods of this namespace are registered, so that the controller can run "+
+			"with a Role there instead of a ClusterRole. It still reads the "+controller.ClusterInfoCmNamespace+"/"+
+			controller.ClusterInfoCm+" ConfigMap and the kubeconfig Secrets, which must be granted in their namespaces, "+
+			"see config/rbac/namespace_scoped_role.yaml.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
-			"Enabling this will ensure there is only one active controller manager.")
+			"Enabling this will ensure there is only one active controller manager. The periodic orphan cleanup, "+
+			"audit and entry state pruning only run on the leader, and stop with the manager when it loses the lease.")
 	flag.BoolVar(&secureMetrics, "metrics-secure", false,
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&x509SvidTTL, "x509-svid-ttl", 0,
+		"Default X509-SVID TTL in seconds for created SPIRE entries. 0 uses the SPIRE server default.")
+	flag.IntVar(&jwtSvidTTL, "jwt-svid-ttl", 0,
+		"Default JWT-SVID TTL in seconds for created SPIRE entries. 0 uses the SPIRE server default.")
+	flag.StringVar(&federatesWith, "federates-with", "",
+		"Comma-separated list of spiffe:// trust domains that created SPIRE entries federate with.")
+	flag.StringVar(&spireHealthPath, "spire-health-path", controller.DefaultSpireHealthPath,
+		"The SPIRE API path probed by the health and readiness checks.")
+	flag.DurationVar(&spireHealthTimeout, "spire-health-timeout", controller.DefaultSpireHealthTimeout,
+		"Timeout for the SPIRE API health and readiness probe.")
+	flag.BoolVar(&failFastOnSpireUnreachable, "fail-fast-on-spire-unreachable", false,
+		"If set, the manager exits at startup when no SPIRE API server is reachable, which points at a "+
+			"misconfiguration. Otherwise it starts and reports not ready until the SPIRE API can be reached.")
+	flag.BoolVar(&failFastOnInvalidClusterInfo, "fail-fast-on-invalid-cluster-info", false,
+		"If set, the manager exits at startup when the "+controller.ClusterInfoCmNamespace+"/"+controller.ClusterInfoCm+
+			" ConfigMap lacks the "+controller.SpireTrustDomainAnnotation+" annotation or a cluster name. "+
+			"Otherwise the problem is logged and every registration fails until it is fixed.")
+	flag.BoolVar(&enablePodRegistration, "enable-pod-registration", false,
+		"If set, annotated Pods are registered as SPIRE entries with selectors derived from their labels and node.")
+	flag.StringVar(&podNodeSelector, "pod-node-selector", "none",
+		"Node attestor selector added to Pod entries, scoping them to the Pod's node: none, name for "+
+			"k8s_psat:agent_node_name or uid for k8s_psat:agent_node_uid.")
+	flag.BoolVar(&enableOrphanCleanup, "enable-orphan-cleanup", false,
+		"If set, SPIRE entries of this cluster without a managed ServiceAccount are periodically deleted.")
+	flag.BoolVar(&enableNamespaceCleanup, "enable-namespace-cleanup", false,
+		"If set, all SPIRE entries of a namespace of this cluster are deleted in bulk when the namespace is deleted.")
+	flag.DurationVar(&orphanCleanupInterval, "orphan-cleanup-interval", controller.DefaultOrphanCleanupInterval,
+		"How often to look for orphaned SPIRE entries when --enable-orphan-cleanup is set.")
+	flag.BoolVar(&enableAudit, "enable-audit", false,
+		"If set, the SPIRE entries of managed ServiceAccounts are periodically checked and the number of "+
+			"entries ok, missing and mismatched is logged and exported as the spire_registrar_audit_entries metric. "+
+			"The audit only reports; it does not change any entry.")
+	flag.DurationVar(&auditInterval, "audit-interval", controller.DefaultAuditInterval,
+		"How often to audit the SPIRE entries when --enable-audit is set.")
+	flag.DurationVar(&reregisterInterval, "reregister-interval", 0,
+		"If set, the leader checks this often, with 10% jitter, that the entry recorded on each managed "+
+			"ServiceAccount still exists in SPIRE and registers the ServiceAccounts whose entry is gone again, "+
+			"e.g. after the SPIRE server lost its datastore. Zero disables it.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"If set, SPIRE entries are rendered and logged but not sent to the SPIRE API, and no "+
+			"annotations or finalizers are written to ServiceAccounts or Pods.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Number of ServiceAccounts reconciled in parallel. Each worker makes at most one SPIRE API "+
+			"call at a time, so throughput stops improving past about twice the requests the SPIRE server "+
+			"serves concurrently; further workers only queue there.")
+	flag.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", 0,
+		"Initial per-item back-off for failed reconciles. 0 with --rate-limiter-max-delay=0 uses the default.")
+	flag.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", 0,
+		"Maximum per-item back-off for failed reconciles. 0 with --rate-limiter-base-delay=0 uses the default.")
+	flag.DurationVar(&maxRequeueInterval, "max-requeue-interval", 0,
+		"Cap of the exponential per-ServiceAccount back-off of failed reconciles, which starts at "+
+			"--rate-limiter-base-delay (default 1s) and resets on success. 0 leaves failed reconciles "+
+			"to the work queue rate limiter.")
+	flag.Float64Var(&requeueJitterFraction, "requeue-jitter-fraction", controller.DefaultRequeueJitterFraction,
+		"Randomizes requeue delays such as SPIRE Retry-After back-offs by up to plus or minus this fraction, "+
+			"so that ServiceAccounts do not hit the SPIRE API in synchronized bursts. Must be in [0, 1).")
+	defaultSpireAPI := controller.DefaultSpireAPI()
+	flag.StringVar(&spireAPIServers, "spire-api-servers", defaultSpireAPI.GetServerURL(),
+		"Comma-separated list of SPIRE API server URLs, tried in order until one succeeds.")
+	flag.IntVar(&spireAPIPort, "spire-api-port", 0,
+		"Port of the SPIRE API servers whose URL in --spire-api-servers has none. 0 uses the scheme's default port.")
+	flag.IntVar(&circuitFailureThreshold, "spire-api-circuit-failure-threshold", 0,
+		"Number of consecutive transport or server errors of a SPIRE API server after which requests to it "+
+			"fail right away, requeuing the reconciles, for --spire-api-circuit-open-duration. A single probe "+
+			"request then decides whether the circuit closes again. 0 disables the circuit breaker.")
+	flag.DurationVar(&circuitOpenDuration, "spire-api-circuit-open-duration", controller.DefaultCircuitOpenDuration,
+		"How long the circuit of a failing SPIRE API server stays open before it is probed.")
+	flag.DurationVar(&spireAPICooldown, "spire-api-cooldown", controller.DefaultSpireAPICooldown,
+		"How long a SPIRE API server that failed is skipped before it is tried again.")
+	flag.StringVar(&ignoreServiceAccounts, "ignore-service-accounts", "",
+		"Comma-separated namespace/name ServiceAccounts that are never registered, even when annotated. "+
+			"The controller's own ServiceAccount, from the POD_NAMESPACE and POD_SERVICE_ACCOUNT environment, is always ignored.")
+	flag.BoolVar(&logSkipped, "log-skipped", false,
+		"Log the skipped reconciles of unmanaged ServiceAccounts at info level rather than at debug verbosity.")
+	flag.StringVar(&managedLabel, "managed-label", "",
+		"Label, as key=value or a bare key for key=true, also selecting managed ServiceAccounts, e.g. "+
+			"spire.omega.k8s.io/managed=true. The "+controller.ManagedSpireAnnotation+" annotation takes precedence "+
+			"when present: \"true\" selects a ServiceAccount and any other value deselects it, whatever its labels.")
+	flag.StringVar(&entryStateConfigMap, "entry-state-configmap", controller.DefaultEntryStateConfigMap,
+		"ConfigMap, in the controller's namespace, recording created SPIRE entry IDs for crash recovery. Empty disables it.")
+	flag.BoolVar(&manageFinalizers, "manage-finalizers", true,
+		"If set, a finalizer on managed ServiceAccounts guarantees their SPIRE entry is deleted before they go away. "+
+			"When false, no finalizer is added and entries are deleted best-effort when a ServiceAccount delete is "+
+			"observed; deletes missed while the controller is down or failed SPIRE calls leave orphaned entries, "+
+			"so combine it with --enable-orphan-cleanup or an external cleanup.")
+	flag.BoolVar(&enableRegistrationStatus, "enable-registration-status", false,
+		"If set, a SpireRegistration named after each managed ServiceAccount reports its SPIRE entry ID and "+
+			"Ready, Syncing and Error conditions. Requires the SpireRegistration CRD.")
+	flag.BoolVar(&requireKubeConfig, "require-kubeconfig", false,
+		"If set, registrations fail while the admin kubeconfig Secret is missing or invalid. Otherwise entries "+
+			"are sent without a kubeconfig, as tracked by the spire_registrar_recent_entries_without_kubeconfig metric.")
+	flag.BoolVar(&adoptExistingEntries, "adopt-existing-entries", false,
+		"If set, a managed ServiceAccount without an entry ID adopts a SPIRE entry already registered for it, "+
+			"e.g. created manually before migrating the cluster, instead of registering a duplicate.")
+	flag.BoolVar(&annotateSpiffeID, "annotate-spiffe-id", false,
+		"If set, registered ServiceAccounts are annotated with "+controller.SpiffeIDAnnotation+", the SPIFFE ID "+
+			"reported by the SPIRE API or else spiffe://<trust domain>/ns/<namespace>/sa/<name>.")
+	flag.BoolVar(&enableValidatingWebhook, "enable-validating-webhook", false,
+		"If set, serve the admission webhook rejecting ServiceAccounts with invalid SPIRE annotations. "+
+			"Requires a serving certificate and the ValidatingWebhookConfiguration from config/webhook.")
+	flag.BoolVar(&enableResync, "enable-resync", false,
+		"If set, SIGUSR1 or a POST to "+controller.DefaultResyncPath+" on the metrics listener re-reconciles all "+
+			"managed ServiceAccounts, verifying each SPIRE entry regardless of its entry ID annotation and "+
+			"recreating the missing ones, e.g. after the SPIRE server lost its data.")
+	flag.StringVar(&resyncToken, "resync-token", "",
+		"Bearer token required by the resync endpoint. The endpoint is unauthenticated when neither this nor "+
+			"--resync-token-file is set.")
+	flag.StringVar(&resyncTokenFile, "resync-token-file", "",
+		"File holding the bearer token required by the resync endpoint, re-read when it changes.")
+	flag.BoolVar(&enableSpireCallbacks, "enable-spire-callbacks", false,
+		"If set, the SPIRE server may POST {\"entryID\": ..., \"event\": \"expiring\"|\"pruned\"} to "+
+			controller.DefaultCallbackPath+" on the metrics listener to reconcile the ServiceAccount of the entry "+
+			"right away. Requires --callback-token.")
+	flag.StringVar(&callbackToken, "callback-token", "",
+		"Shared secret the SPIRE server presents as a bearer token to the callback endpoint.")
+	flag.BoolVar(&enableDebug, "enable-debug-endpoint", false,
+		"If set, a GET to "+controller.DefaultDebugPath+" on the metrics listener returns the effective "+
+			"configuration, secrets redacted, and the recent reconcile outcomes of each ServiceAccount.")
+	flag.StringVar(&debugToken, "debug-token", "",
+		"Bearer token required by the debug endpoint. The endpoint is unauthenticated when neither this nor "+
+			"--debug-token-file is set.")
+	flag.StringVar(&debugTokenFile, "debug-token-file", "",
+		"File holding the bearer token required by the debug endpoint, re-read when it changes.")
+	flag.IntVar(&reconcileHistorySize, "reconcile-history-size", controller.DefaultReconcileHistorySize,
+		"Number of reconcile outcomes per ServiceAccount kept for the debug endpoint.")
+	flag.StringVar(&kubeConfigEncoding, "kubeconfig-encoding", controller.KubeConfigEncodingBase64,
+		"Wire format of the kubeconfig sent with SPIRE entries: base64 or raw YAML. "+
+			"--compress-kubeconfig always sends it base64-encoded.")
+	flag.BoolVar(&compressKubeConfig, "compress-kubeconfig", false,
+		"If set, the kubeconfig sent with SPIRE entries is gzip-compressed and marked with kubeConfigEncoding=gzip. "+
+			"Only enable it when the SPIRE API understands compressed kubeconfigs.")
+	flag.StringVar(&selectorTemplate, "selector-template", "",
+		"Go template rendering the selectors of ServiceAccounts without a "+controller.SelectorsAnnotation+" or "+
+			controller.SelectorTemplateAnnotation+" annotation from .Name, .Namespace, .Labels and .Annotations, as "+
+			"comma or newline separated type:value selectors, e.g. k8s:ns:{{.Namespace}},k8s:sa:{{.Name}}. "+
+			"ServiceAccounts it fails to render for fall back to the SPIRE server default selectors.")
+	flag.BoolVar(&sendKubeConfig, "send-kubeconfig", true,
+		"If false, SPIRE entries carry no kubeconfig field at all and the kubeconfig Secrets are never read, for "+
+			"SPIRE servers with their own access to the cluster.")
+	flag.Var(kubeConfigSecretFlag{kubeConfigSecrets}, "cluster-kubeconfig-secret",
+		"Secret holding the kubeconfig sent with the SPIRE entries of a cluster, as Cluster=Namespace/Name, for "+
+			"registering the workloads of several clusters. May be repeated. Once any cluster is mapped, entries "+
+			"of an unmapped cluster fail; by default every entry carries kube-system/"+controller.AdminKubeConfigSecret+".")
+	flag.Var(parentIDFlag{parentIDs}, "cluster-parent-id",
+		"Parent SPIFFE ID of the SPIRE entries of a cluster, as Cluster=spiffe://<trust-domain>/<path>, e.g. its node "+
+			"alias for delegated registration. May be repeated. Entries of an unmapped cluster leave the parent to the "+
+			"SPIRE server, or with --backend=grpc take it from --spire-grpc-parent-id-path.")
+	flag.StringVar(&clusterNameKeys, "cluster-name-keys", "",
+		"Comma-separated keys tried in order when the ClusterConfiguration has no top-level clusterName. "+
+			"Each is a key of the cluster info ConfigMap data or a dot-separated path into the ClusterConfiguration.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"Cluster name used when it is not found in the cluster info ConfigMap.")
+	flag.StringVar(&clusterNameOverride, "cluster-name-override", "",
+		"Cluster name of SPIRE entries, used instead of the cluster info ConfigMap, e.g. a friendly alias. "+
+			"The "+controller.ClusterNameAnnotation+" annotation overrides it per ServiceAccount.")
+	flag.StringVar(&trustDomainSource, "trust-domain-source", controller.TrustDomainSourceAnnotation,
+		"Where the trust domain of SPIRE entries is read: annotation reads the "+controller.SpireTrustDomainAnnotation+
+			" annotation of the "+controller.ClusterInfoCmNamespace+"/"+controller.ClusterInfoCm+" ConfigMap, configmap "+
+			"reads --trust-domain-key of --trust-domain-configmap and falls back to the annotation while it is missing.")
+	flag.StringVar(&trustDomainConfigMap, "trust-domain-configmap",
+		controller.ClusterInfoCmNamespace+"/"+controller.DefaultTrustDomainConfigMap,
+		"Namespace/name of the ConfigMap holding the trust domain with --trust-domain-source=configmap.")
+	flag.StringVar(&trustDomainKey, "trust-domain-key", controller.DefaultTrustDomainKey,
+		"Key of --trust-domain-configmap holding the trust domain.")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", controller.DefaultShutdownGracePeriod,
+		"How long SPIRE entry deletions in flight at shutdown may run to completion. The pod's "+
+			"terminationGracePeriodSeconds must exceed it by more than 5s. Registrations are "+
+			"abandoned at shutdown and retried after restart. Zero cancels all reconciles right away.")
+	flag.DurationVar(&failureLogInterval, "failure-log-interval", controller.DefaultFailureLogInterval,
+		"How often a repeated identical SPIRE sync failure of a ServiceAccount is logged. The first occurrence "+
+			"is logged right away; later ones are counted and summarized once the interval has passed. "+
+			"Zero logs every failure.")
+	flag.DurationVar(&batchWindow, "batch-window", 0,
+		"If positive, entry registrations issued within this window are sent to the SPIRE API as a single "+
+			"batch, falling back to one request per entry when the API has no batch endpoint.")
+	flag.StringVar(&spireAPIProxy, "spire-api-proxy", "",
+		"Forward proxy URL for SPIRE API requests. When empty, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY "+
+			"environment variables are used.")
+	flag.StringVar(&spireAPINoProxy, "spire-api-no-proxy", "",
+		"Comma-separated hosts, domains or CIDRs, in NO_PROXY syntax, reached directly instead of through the proxy.")
+	flag.DurationVar(&spireAPITimeout, "spire-api-timeout", controller.DefaultSpireRequestTimeout,
+		"Timeout of a single SPIRE API request. A server that does not answer in time counts as failed and the "+
+			"request is tried on the next server, unless it is a creation without an idempotency key.")
+	flag.StringVar(&spireAPICA, "spire-api-ca", "",
+		"PEM bundle of the CAs verifying the SPIRE API servers, instead of the system roots: a file, "+
+			"secret:namespace/name[:key] or configmap:namespace/name[:key], the key defaulting to "+controller.DefaultTLSCAKey+
+			". Reading the object must be granted.")
+	flag.StringVar(&spireAPIClientCert, "spire-api-client-cert", "",
+		"PEM client certificate presented to the SPIRE API servers, like --spire-api-ca, the key defaulting to "+
+			controller.DefaultTLSCertKey+".")
+	flag.StringVar(&spireAPIClientKey, "spire-api-client-key", "",
+		"PEM private key of --spire-api-client-cert: a file or secret:namespace/name[:key], the key defaulting to "+
+			controller.DefaultTLSKeyKey+".")
+	flag.DurationVar(&spireAPITLSReloadInterval, "spire-api-tls-reload-interval", controller.DefaultTLSReloadInterval,
+		"How often --spire-api-ca, --spire-api-client-cert and --spire-api-client-key are checked for rotation.")
+	flag.StringVar(&spireAPIPaths.Base, "spire-api-base-path", controller.DefaultSpireAPIBasePath,
+		"Path below which the SPIRE API serves its entry operations.")
+	flag.Var(apiPathFlag{&spireAPIPaths}, "spire-api-path",
+		"Sub-path of a SPIRE API entry operation below --spire-api-base-path, as Operation=Path, where the "+
+			"operation is add, delete, update, list, batch-add or jobs. May be repeated.")
+	flag.StringVar(&spireAPIDeleteStyle, "spire-api-delete-style", controller.DeleteStylePost,
+		"How SPIRE entries are deleted: post sends the entry to the delete path, rest sends DELETE to the entry "+
+			"ID below --spire-api-base-path, e.g. DELETE /v1/entries/{id}. Entries without a recorded ID are "+
+			"always deleted with post.")
+	flag.StringVar(&spireAPICreateMethod, "spire-api-create-method", "POST",
+		"HTTP method of SPIRE entry creations, POST or PUT, sent to the add path. Combine PUT with "+
+			"--spire-api-path add= to create entries with PUT on --spire-api-base-path, e.g. PUT /v1/entries.")
+	flag.BoolVar(&spireAPIUpsert, "spire-api-upsert", false,
+		"If set, entry updates are sent like creations, with the entry ID, for SPIRE APIs whose creation call "+
+			"also updates an existing entry. The update path is then unused.")
+	flag.DurationVar(&spireAPIJobTimeout, "spire-api-job-timeout", controller.DefaultJobTimeout,
+		"How long the job of a creation the SPIRE API accepted asynchronously, with 202 Accepted and a job ID, "+
+			"may stay pending. The controller records the job on the ServiceAccount and polls its status at the jobs "+
+			"path on later reconciles, reporting the sync as failed past this timeout without sending the creation "+
+			"again. The register subcommand and pod entries wait for the job up to this long.")
+	flag.DurationVar(&spireAPIJobPollInterval, "spire-api-job-poll-interval", controller.DefaultJobPollInterval,
+		"How often the status of an asynchronous entry creation is polled.")
+	flag.StringVar(&backend, "backend", "http",
+		"How entries are registered: http sends them to the SPIRE API front-end at --spire-api-servers, grpc "+
+			"calls the SPIRE server Entry API on its admin socket at --spire-grpc-address.")
+	flag.StringVar(&spireGRPCAddress, "spire-grpc-address", controller.DefaultGRPCAddress,
+		"unix:// URL of the SPIRE server admin socket used by --backend=grpc.")
+	flag.StringVar(&spireGRPCParentIDPath, "spire-grpc-parent-id-path", controller.DefaultGRPCParentIDPath,
+		"Path of the parent ID of the entries registered by --backend=grpc, below their trust domain, for "+
+			"clusters without --cluster-parent-id. {cluster} is replaced with the cluster name.")
+	flag.Var(spireAPIHeaders, "spire-api-header",
+		"Header added to every SPIRE API request, as Name=Value. May be repeated.")
+	flag.Var(spireAPISensitiveHeaders, "spire-api-sensitive-header",
+		"Like --spire-api-header, but the value is never logged. May be repeated.")
+	flag.StringVar(&correlationHeader, "spire-api-correlation-header", "X-Correlation-ID",
+		"Header carrying the reconcile ID on SPIRE API requests, for tracing a request to its reconcile. Empty disables it.")
+	flag.StringVar(&idempotencyHeader, "spire-api-idempotency-header", "Idempotency-Key",
+		"Header carrying a key derived from the ServiceAccount UID and the entry on SPIRE entry creations, reused by "+
+			"retries so that the server can deduplicate them. Empty disables it; creations are then not retried on "+
+			"another server when one fails.")
+	flag.StringVar(&spireAPIContentType, "spire-api-content-type", controller.DefaultMediaType,
+		"Content-Type of SPIRE API request bodies, e.g. a versioned media type such as application/vnd.spire.v1+json "+
+			"required by a gateway.")
+	flag.StringVar(&spireAPIAccept, "spire-api-accept", controller.DefaultMediaType,
+		"Accept header sent on SPIRE API requests. Responses must still be JSON.")
+	flag.Int64Var(&spireAPIMaxResponseBytes, "spire-api-max-response-bytes", controller.DefaultMaxResponseBytes,
+		"Largest SPIRE API response body read. Longer responses fail the request.")
+	flag.BoolVar(&spireAPIStrictDecoding, "spire-api-strict-decoding", false,
+		"If set, SPIRE API responses with unknown fields are rejected, e.g. to catch an API version mismatch.")
+	flag.IntVar(&maxEntrySize, "max-entry-size", 0,
+		"Largest SPIRE entry payload in bytes, e.g. the SPIRE server's request body limit. Larger entries fail "+
+			"locally with an error naming their largest field, usually the kubeconfig. 0 disables the check.")
+	flag.StringVar(&spireAPIToken, "spire-api-token", "",
+		"Bearer token sent to the SPIRE API. Prefer --spire-api-token-file, as flags are visible in the process list.")
+	flag.StringVar(&spireAPITokenFile, "spire-api-token-file", "",
+		"File holding the bearer token sent to the SPIRE API, e.g. from a mounted Secret. Re-read when it changes.")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "",
+		"OTLP/HTTP collector endpoint (host:port) to export traces of SPIRE API calls to. Tracing is disabled when empty.")
+	flag.BoolVar(&otelInsecure, "otel-insecure", false,
+		"If set, traces are exported to --otel-endpoint over plain HTTP instead of HTTPS.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	var configErr error
+	if configFile != "" {
+		var config *controller.Config
+		if config, configErr = controller.LoadConfig(configFile); configErr == nil {
+			configErr = config.Apply(flag.CommandLine)
+		}
+	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if configErr != nil {
+		setupLog.Error(configErr, "invalid --config", "file", configFile)
+		os.Exit(1)
+	}
+	setupLog.Info("effective configuration", "config", controller.EffectiveConfig(flag.CommandLine))
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -92,17 +491,87 @@ func main() {
 		TLSOpts: tlsOpts,
 	})
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	ctx := ctrl.SetupSignalHandler()
+
+	if otelEndpoint != "" {
+		shutdownTracing, err := controller.SetupTracing(ctx, otelEndpoint, otelInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing", "endpoint", otelEndpoint)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				setupLog.Error(err, "problem flushing traces")
+			}
+		}()
+		setupLog.Info("exporting traces", "endpoint", otelEndpoint)
+	}
+
+	var resync *controller.ResyncTrigger
+	metricsHandlers := map[string]http.Handler{}
+	if enableResync {
+		resync = controller.NewResyncTrigger()
+		if resyncToken != "" || resyncTokenFile != "" {
+			resync.Token = &controller.BearerToken{Value: resyncToken, File: resyncTokenFile}
+			if _, err := resync.Token.Get(); err != nil {
+				setupLog.Error(err, "unable to load resync token")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("resync endpoint is unauthenticated, set --resync-token or --resync-token-file to protect it")
+		}
+		metricsHandlers[controller.DefaultResyncPath] = resync
+		go resync.NotifySignals(ctx, syscall.SIGUSR1)
+	}
+	var callbacks *controller.SpireCallbacks
+	if enableSpireCallbacks {
+		if callbackToken == "" {
+			setupLog.Error(nil, "--enable-spire-callbacks requires --callback-token")
+			os.Exit(1)
+		}
+		callbacks = controller.NewSpireCallbacks(&controller.BearerToken{Value: callbackToken})
+		metricsHandlers[controller.DefaultCallbackPath] = callbacks
+	}
+	var history *controller.ReconcileHistory
+	if enableDebug {
+		if reconcileHistorySize <= 0 {
+			setupLog.Error(nil, "--reconcile-history-size must be positive")
+			os.Exit(1)
+		}
+		history = &controller.ReconcileHistory{Size: reconcileHistorySize}
+		debug := &controller.DebugHandler{Config: controller.EffectiveConfig(flag.CommandLine), History: history}
+		if debugToken != "" || debugTokenFile != "" {
+			debug.Token = &controller.BearerToken{Value: debugToken, File: debugTokenFile}
+			if _, err := debug.Token.Get(); err != nil {
+				setupLog.Error(err, "unable to load debug token")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("debug endpoint is unauthenticated, set --debug-token or --debug-token-file to protect it")
+		}
+		metricsHandlers[controller.DefaultDebugPath] = debug
+	}
+
+	entryStateNamespace := os.Getenv("POD_NAMESPACE")
+	if entryStateNamespace == "" {
+		entryStateNamespace = controller.DefaultEntryStateNamespace
+	}
+
+	gracefulShutdownTimeout := shutdownGracePeriod + 5*time.Second
+	mgrOptions := ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress:   metricsAddr,
 			SecureServing: secureMetrics,
 			TLSOpts:       tlsOpts,
+			ExtraHandlers: metricsHandlers,
 		},
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "63555a3b.omegahome.net",
+		// Leave room for the deletions drained at shutdown to finish.
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "63555a3b.omegahome.net",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -114,33 +583,716 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
-	})
+	}
+	trustDomain, err := controller.ParseTrustDomainSource(trustDomainSource, trustDomainConfigMap, trustDomainKey)
+	if err != nil {
+		setupLog.Error(err, "invalid --trust-domain-source")
+		os.Exit(1)
+	}
+	if watchNamespace != "" {
+		if enableNamespaceCleanup {
+			setupLog.Error(nil, "--enable-namespace-cleanup watches all namespaces and cannot be combined with --namespace")
+			os.Exit(1)
+		}
+		var configMaps []types.NamespacedName
+		if entryStateConfigMap != "" {
+			configMaps = append(configMaps, types.NamespacedName{Namespace: entryStateNamespace, Name: entryStateConfigMap})
+		}
+		if trustDomain.ConfigMap.Name != "" {
+			configMaps = append(configMaps, trustDomain.ConfigMap)
+		}
+		controller.ScopeToNamespace(&mgrOptions, watchNamespace, configMaps...)
+		setupLog.Info("registering the ServiceAccounts of a single namespace", "namespace", watchNamespace)
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mgrOptions)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controller.ServiceAccountReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	if spireAPIPort != 0 {
+		if err := controller.ValidatePort(spireAPIPort); err != nil {
+			setupLog.Error(err, "invalid --spire-api-port")
+			os.Exit(1)
+		}
+	}
+	var spireServers []controller.SpireAPI
+	for _, server := range splitList(spireAPIServers) {
+		api := controller.SpireAPI{Server: server, Port: spireAPIPort}
+		if api.Port != 0 && api.HasURLPort() {
+			setupLog.Info("--spire-api-port is ignored for a server whose URL sets a port",
+				"server", server, "port", spireAPIPort)
+			api.Port = 0
+		}
+		if err := api.Normalize(); err != nil {
+			setupLog.Error(err, "invalid --spire-api-servers")
+			os.Exit(1)
+		}
+		spireServers = append(spireServers, api)
+	}
+	if len(spireServers) == 0 {
+		setupLog.Error(nil, "--spire-api-servers must list at least one server")
+		os.Exit(1)
+	}
+	if kubeConfigEncoding != controller.KubeConfigEncodingBase64 && kubeConfigEncoding != controller.KubeConfigEncodingRaw {
+		setupLog.Error(nil, "--kubeconfig-encoding must be base64 or raw", "value", kubeConfigEncoding)
+		os.Exit(1)
+	}
+	var selectors *template.Template
+	if selectorTemplate != "" {
+		var err error
+		if selectors, err = controller.ParseSelectorTemplate(selectorTemplate); err != nil {
+			setupLog.Error(err, "invalid --selector-template")
+			os.Exit(1)
+		}
+	}
+	if requireKubeConfig && !sendKubeConfig {
+		setupLog.Error(nil, "--require-kubeconfig cannot be combined with --send-kubeconfig=false")
+		os.Exit(1)
+	}
+	if requeueJitterFraction < 0 || requeueJitterFraction >= 1 {
+		setupLog.Error(nil, "--requeue-jitter-fraction must be in [0, 1)", "value", requeueJitterFraction)
+		os.Exit(1)
+	}
+	for name, value := range map[string]string{"spire-api-content-type": spireAPIContentType, "spire-api-accept": spireAPIAccept} {
+		if _, _, err := mime.ParseMediaType(value); err != nil {
+			setupLog.Error(err, "invalid --"+name, "value", value)
+			os.Exit(1)
+		}
+	}
+	if maxEntrySize < 0 {
+		setupLog.Error(nil, "--max-entry-size must not be negative", "value", maxEntrySize)
+		os.Exit(1)
+	}
+	if maxRequeueInterval < 0 {
+		setupLog.Error(nil, "--max-requeue-interval must not be negative", "value", maxRequeueInterval)
+		os.Exit(1)
+	}
+	clusterNameLookup := controller.ClusterNameLookup{
+		Keys:     splitList(clusterNameKeys),
+		Default:  clusterName,
+		Override: clusterNameOverride,
+
+		TrustDomain: trustDomain,
+	}
+	managed, err := controller.ParseManagedLabel(managedLabel)
+	if err != nil {
+		setupLog.Error(err, "invalid --managed-label")
+		os.Exit(1)
+	}
+	ignored, err := ignoredServiceAccounts(ignoreServiceAccounts)
+	if err != nil {
+		setupLog.Error(err, "invalid --ignore-service-accounts")
+		os.Exit(1)
+	}
+
+	spireClient := controller.NewSpireClient(spireServers...)
+	spireClient.HTTPClient, err = controller.NewSpireHTTPClient(spireAPIProxy, splitList(spireAPINoProxy), spireAPITimeout)
+	if err != nil {
+		setupLog.Error(err, "unable to set up SPIRE API client")
+		os.Exit(1)
+	}
+	if tlsMaterial, err := spireTLS(spireAPICA, spireAPIClientCert, spireAPIClientKey); err != nil {
+		setupLog.Error(err, "invalid SPIRE API TLS flags")
+		os.Exit(1)
+	} else if tlsMaterial != nil {
+		tlsMaterial.Reader = mgr.GetAPIReader()
+		tlsMaterial.ReloadInterval = spireAPITLSReloadInterval
+		if err := tlsMaterial.Wrap(context.Background(), spireClient.HTTPClient); err != nil {
+			setupLog.Error(err, "unable to load SPIRE API TLS material")
+			os.Exit(1)
+		}
+		if err := mgr.Add(tlsMaterial); err != nil {
+			setupLog.Error(err, "unable to set up SPIRE API TLS reloading")
+			os.Exit(1)
+		}
+	}
+	spireClient.Pool.Cooldown = spireAPICooldown
+	if circuitFailureThreshold > 0 {
+		spireClient.Breaker = &controller.CircuitBreaker{
+			FailureThreshold: circuitFailureThreshold,
+			OpenDuration:     circuitOpenDuration,
+		}
+	}
+	spireClient.Paths = &spireAPIPaths
+	if spireClient.DeleteStyle, err = controller.ParseDeleteStyle(spireAPIDeleteStyle); err != nil {
+		setupLog.Error(err, "invalid --spire-api-delete-style")
+		os.Exit(1)
+	}
+	if spireClient.CreateMethod, err = controller.ParseCreateMethod(spireAPICreateMethod); err != nil {
+		setupLog.Error(err, "invalid --spire-api-create-method")
+		os.Exit(1)
+	}
+	spireClient.Upsert = spireAPIUpsert
+	spireClient.JobTimeout, spireClient.JobPollInterval = spireAPIJobTimeout, spireAPIJobPollInterval
+	spireClient.BatchWindow = batchWindow
+	spireClient.CorrelationHeader = correlationHeader
+	spireClient.IdempotencyHeader = idempotencyHeader
+	spireClient.ContentType = spireAPIContentType
+	spireClient.Accept = spireAPIAccept
+	spireClient.MaxResponseBytes = spireAPIMaxResponseBytes
+	spireClient.StrictDecoding = spireAPIStrictDecoding
+	spireClient.MaxEntryBytes = maxEntrySize
+	spireClient.Headers = map[string]string{}
+	spireClient.SensitiveHeaders = map[string]bool{}
+	for name, value := range spireAPIHeaders {
+		spireClient.Headers[name] = value
+	}
+	for name, value := range spireAPISensitiveHeaders {
+		spireClient.Headers[name] = value
+		spireClient.SensitiveHeaders[name] = true
+	}
+	if len(spireClient.Headers) > 0 {
+		setupLog.Info("adding headers to SPIRE API requests", "headers", spireClient.LoggableHeaders())
+	}
+	switch backend {
+	case "http":
+	case "grpc":
+		grpcBackend, err := controller.NewGRPCBackend(spireGRPCAddress)
+		if err != nil {
+			setupLog.Error(err, "unable to set up SPIRE gRPC backend")
+			os.Exit(1)
+		}
+		defer grpcBackend.Close()
+		grpcBackend.ParentIDPath, grpcBackend.ParentIDs = spireGRPCParentIDPath, parentIDs
+		spireClient.Backend = grpcBackend
+		setupLog.Info("registering entries with the SPIRE server Entry API", "address", spireGRPCAddress)
+	default:
+		setupLog.Error(nil, "invalid --backend, must be http or grpc", "backend", backend)
+		os.Exit(1)
+	}
+	if spireAPIToken != "" || spireAPITokenFile != "" {
+		spireClient.Token = &controller.BearerToken{Value: spireAPIToken, File: spireAPITokenFile}
+		if _, err := spireClient.Token.Get(); err != nil {
+			setupLog.Error(err, "unable to load SPIRE API token")
+			os.Exit(1)
+		}
+	}
+	spireClient.DryRun = dryRun
+	spireClient.CompressKubeConfig = compressKubeConfig
+	spireClient.KubeConfigEncoding = kubeConfigEncoding
+	spireClient.OmitKubeConfig = !sendKubeConfig
+
+	var entryState *controller.EntryStateStore
+	if entryStateConfigMap != "" {
+		entryState = &controller.EntryStateStore{
+			Client:    mgr.GetClient(),
+			Namespace: entryStateNamespace,
+			Name:      entryStateConfigMap,
+			Managed:   managed,
+		}
+		if err := mgr.Add(entryState); err != nil {
+			setupLog.Error(err, "unable to set up entry state pruning")
+			os.Exit(1)
+		}
+	}
+
+	saReconciler := &controller.ServiceAccountReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		SpireClient:   spireClient,
+		Recorder:      mgr.GetEventRecorderFor("spire-registrar"),
+		X509SvidTTL:   x509SvidTTL,
+		JWTSvidTTL:    jwtSvidTTL,
+		FederatesWith: splitList(federatesWith),
+		ClusterName:   clusterNameLookup,
+
+		SelectorTemplate:       selectors,
+		DisableFinalizers:      !manageFinalizers,
+		RegistrationStatus:     enableRegistrationStatus,
+		AdoptExistingEntries:   adoptExistingEntries,
+		AnnotateSpiffeID:       annotateSpiffeID,
+		NamespaceCleanup:       enableNamespaceCleanup,
+		RequireKubeConfig:      requireKubeConfig,
+		KubeConfigSecrets:      kubeConfigSecrets,
+		ParentIDs:              parentIDs,
+		Managed:                managed,
+		IgnoredServiceAccounts: ignored,
+		LogSkipped:             logSkipped,
+		EntryState:             entryState,
+		Resync:                 resync,
+		Callbacks:              callbacks,
+		History:                history,
+		ShutdownGracePeriod:    shutdownGracePeriod,
+		FailureLogInterval:     failureLogInterval,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiterBaseDelay:    rateLimiterBaseDelay,
+		RateLimiterMaxDelay:     rateLimiterMaxDelay,
+		RequeueJitterFraction:   requeueJitterFraction,
+		MaxRequeueInterval:      maxRequeueInterval,
+	}
+	if reregisterInterval > 0 {
+		saReconciler.Reregistration = controller.NewReregistration(reregisterInterval)
+	}
+	if err = saReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ServiceAccount")
 		os.Exit(1)
 	}
+	if enablePodRegistration {
+		nodeSelector, err := controller.ParseNodeSelector(podNodeSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid --pod-node-selector")
+			os.Exit(1)
+		}
+		if err = (&controller.PodReconciler{
+			Client:      mgr.GetClient(),
+			Scheme:      mgr.GetScheme(),
+			SpireClient: spireClient,
+			ClusterName: clusterNameLookup,
+
+			RequeueJitterFraction: requeueJitterFraction,
+			RequireKubeConfig:     requireKubeConfig,
+			KubeConfigSecrets:     kubeConfigSecrets,
+			ParentIDs:             parentIDs,
+			NodeSelector:          nodeSelector,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Pod")
+			os.Exit(1)
+		}
+	}
+	if enableOrphanCleanup {
+		if err := mgr.Add(&controller.OrphanCleaner{
+			Client:      mgr.GetClient(),
+			SpireClient: spireClient,
+			Interval:    orphanCleanupInterval,
+			ClusterName: clusterNameLookup,
+			Managed:     managed,
+			Namespace:   watchNamespace,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up orphaned entry cleanup")
+			os.Exit(1)
+		}
+	}
+	if enableAudit {
+		if err := mgr.Add(&controller.EntryAuditor{
+			Reconciler: saReconciler,
+			Interval:   auditInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up SPIRE entry audit")
+			os.Exit(1)
+		}
+	}
+	if enableNamespaceCleanup {
+		if err = (&controller.NamespaceReconciler{
+			Client:      mgr.GetClient(),
+			SpireClient: spireClient,
+			ClusterName: clusterNameLookup,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Namespace")
+			os.Exit(1)
+		}
+	}
+	if enableValidatingWebhook {
+		if err = (&controller.ServiceAccountValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ServiceAccount")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
+	spireCheck := controller.SpireHealthCheck(spireClient, spireHealthPath, spireHealthTimeout)
+	if err := addHealthChecks(mgr, spireCheck); err != nil {
+		setupLog.Error(err, "unable to set up health checks")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+
+	if err := controller.CheckSpireAPI(ctx, spireCheck); err != nil {
+		if failFastOnSpireUnreachable {
+			setupLog.Error(err, "SPIRE API is unreachable, refusing to start")
+			os.Exit(1)
+		}
+		setupLog.Error(err, "SPIRE API is unreachable, reporting not ready until it can be reached")
+	}
+	if err := controller.CheckClusterInfo(ctx, mgr.GetAPIReader(), clusterNameLookup); err != nil {
+		if failFastOnInvalidClusterInfo {
+			setupLog.Error(err, "cluster info is misconfigured, refusing to start")
+			os.Exit(1)
+		}
+		setupLog.Error(err, "cluster info is misconfigured, registrations will fail until it is fixed")
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+	saReconciler.LogShutdownSummary()
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// healthCheckRegistry is the part of the manager the health checks are added to.
+type healthCheckRegistry interface {
+	AddHealthzCheck(name string, check healthz.Checker) error
+	AddReadyzCheck(name string, check healthz.Checker) error
+}
+
+// addHealthChecks adds the liveness and readiness checks of the manager. The SPIRE
+// API check only gates readiness: an unreachable SPIRE API takes the pod out of
+// service, but restarting it would not bring the SPIRE API back.
+func addHealthChecks(mgr healthCheckRegistry, spireCheck healthz.Checker) error {
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up health check: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up ready check: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("spire-api", spireCheck); err != nil {
+		return fmt.Errorf("unable to set up SPIRE API ready check: %w", err)
+	}
+	return nil
+}
+
+// newClient creates the Kubernetes client of the subcommands.
+var newClient = func() (client.Client, error) {
+	return client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+}
+
+// runEntryCommand implements the register and deregister subcommands, which create or
+// delete the SPIRE entry of a single ServiceAccount the way the controller does,
+// without running it. They are meant for manual recovery of missing or leaked entries
+// and neither annotate the ServiceAccount nor touch its finalizer. Their result is
+// printed to out.
+func runEntryCommand(command string, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	namespace := fs.String("namespace", "default", "Namespace of the ServiceAccount.")
+	serviceAccount := fs.String("service-account", "", "Name of the ServiceAccount.")
+	defaultSpireAPI := controller.DefaultSpireAPI()
+	spireAPIServers := fs.String("spire-api-servers", defaultSpireAPI.GetServerURL(),
+		"Comma-separated list of SPIRE API server URLs, tried in order until one succeeds.")
+	spireAPIProxy := fs.String("spire-api-proxy", "", "Forward proxy URL for SPIRE API requests.")
+	spireAPINoProxy := fs.String("spire-api-no-proxy", "", "Comma-separated hosts reached without --spire-api-proxy.")
+	spireAPITimeout := fs.Duration("spire-api-timeout", controller.DefaultSpireRequestTimeout, "Timeout of a single SPIRE API request.")
+	idempotencyHeader := fs.String("spire-api-idempotency-header", "Idempotency-Key",
+		"Header carrying the idempotency key of entry creations. Empty disables it.")
+	spireAPICA := fs.String("spire-api-ca", "", "PEM CA bundle verifying the SPIRE API servers, see the controller flag.")
+	spireAPIClientCert := fs.String("spire-api-client-cert", "", "PEM client certificate presented to the SPIRE API servers, see the controller flag.")
+	spireAPIClientKey := fs.String("spire-api-client-key", "", "PEM private key of --spire-api-client-cert, see the controller flag.")
+	contentType := fs.String("spire-api-content-type", controller.DefaultMediaType, "Content-Type of SPIRE API request bodies.")
+	accept := fs.String("spire-api-accept", controller.DefaultMediaType, "Accept header sent on SPIRE API requests.")
+	spireAPIToken := fs.String("spire-api-token", "", "Bearer token sent on SPIRE API requests.")
+	spireAPITokenFile := fs.String("spire-api-token-file", "", "File holding the bearer token sent on SPIRE API requests.")
+	spireAPIPaths := controller.DefaultSpireAPIPaths()
+	deleteStyle := fs.String("spire-api-delete-style", controller.DeleteStylePost,
+		"How entries are deleted: post to the delete path, or rest to DELETE the entry ID below the base path.")
+	createMethod := fs.String("spire-api-create-method", "POST", "HTTP method of entry creations, POST or PUT.")
+	fs.StringVar(&spireAPIPaths.Base, "spire-api-base-path", controller.DefaultSpireAPIBasePath,
+		"Path below which the SPIRE API serves its entry operations.")
+	fs.Var(apiPathFlag{&spireAPIPaths}, "spire-api-path", "Sub-path of a SPIRE API entry operation, as Operation=Path. May be repeated.")
+	clusterName := fs.String("cluster-name", "", "Cluster name used when it is not found in the cluster info ConfigMap.")
+	clusterNameKeys := fs.String("cluster-name-keys", "", "Comma-separated keys tried for the cluster name, see the controller flag.")
+	clusterNameOverride := fs.String("cluster-name-override", "", "Cluster name used instead of the cluster info ConfigMap.")
+	trustDomainSource := fs.String("trust-domain-source", controller.TrustDomainSourceAnnotation,
+		"Where the trust domain is read, annotation or configmap, see the controller flag.")
+	trustDomainConfigMap := fs.String("trust-domain-configmap", controller.ClusterInfoCmNamespace+"/"+controller.DefaultTrustDomainConfigMap,
+		"Namespace/name of the ConfigMap holding the trust domain with --trust-domain-source=configmap.")
+	trustDomainKey := fs.String("trust-domain-key", controller.DefaultTrustDomainKey, "Key of --trust-domain-configmap holding the trust domain.")
+	kubeConfigSecrets := controller.KubeConfigSecrets{}
+	fs.Var(kubeConfigSecretFlag{kubeConfigSecrets}, "cluster-kubeconfig-secret",
+		"Secret holding the kubeconfig of a cluster's entries, as Cluster=Namespace/Name. May be repeated.")
+	parentIDs := controller.ParentIDs{}
+	fs.Var(parentIDFlag{parentIDs}, "cluster-parent-id",
+		"Parent SPIFFE ID of a cluster's entries, as Cluster=spiffe://<trust-domain>/<path>. May be repeated.")
+	sendKubeConfig := fs.Bool("send-kubeconfig", true, "If false, the entry carries no kubeconfig field at all.")
+	x509SvidTTL := fs.Int("x509-svid-ttl", 0, "Default X509-SVID TTL in seconds. 0 uses the SPIRE server default.")
+	jwtSvidTTL := fs.Int("jwt-svid-ttl", 0, "Default JWT-SVID TTL in seconds. 0 uses the SPIRE server default.")
+	federatesWith := fs.String("federates-with", "", "Comma-separated list of spiffe:// trust domains to federate with.")
+	selectorTemplate := fs.String("selector-template", "", "Go template rendering the selectors, see the controller flag.")
+	dryRun := fs.Bool("dry-run", false, "If set, the entry is rendered and logged but not sent to the SPIRE API.")
+	opts := zap.Options{Development: true}
+	opts.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if *serviceAccount == "" {
+		return fmt.Errorf("--service-account is required")
+	}
+
+	var servers []controller.SpireAPI
+	for _, server := range splitList(*spireAPIServers) {
+		api := controller.SpireAPI{Server: server}
+		if err := api.Normalize(); err != nil {
+			return err
+		}
+		servers = append(servers, api)
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("--spire-api-servers must list at least one server")
+	}
+	spireClient := controller.NewSpireClient(servers...)
+	httpClient, err := controller.NewSpireHTTPClient(*spireAPIProxy, splitList(*spireAPINoProxy), *spireAPITimeout)
+	if err != nil {
+		return err
+	}
+	spireClient.HTTPClient = httpClient
+	spireClient.Paths = &spireAPIPaths
+	spireClient.IdempotencyHeader = *idempotencyHeader
+	k8sClient, err := newClient()
+	if err != nil {
+		return err
+	}
+	if tlsMaterial, err := spireTLS(*spireAPICA, *spireAPIClientCert, *spireAPIClientKey); err != nil {
+		return err
+	} else if tlsMaterial != nil {
+		tlsMaterial.Reader = k8sClient
+		if err := tlsMaterial.Wrap(context.Background(), httpClient); err != nil {
+			return err
+		}
+	}
+	if spireClient.DeleteStyle, err = controller.ParseDeleteStyle(*deleteStyle); err != nil {
+		return err
+	}
+	if spireClient.CreateMethod, err = controller.ParseCreateMethod(*createMethod); err != nil {
+		return err
+	}
+	if *spireAPIToken != "" || *spireAPITokenFile != "" {
+		spireClient.Token = &controller.BearerToken{Value: *spireAPIToken, File: *spireAPITokenFile}
+	}
+	spireClient.ContentType, spireClient.Accept = *contentType, *accept
+	spireClient.DryRun = *dryRun
+	spireClient.OmitKubeConfig = !*sendKubeConfig
+
+	r := &controller.ServiceAccountReconciler{
+		Client:        k8sClient,
+		Scheme:        scheme,
+		SpireClient:   spireClient,
+		X509SvidTTL:   *x509SvidTTL,
+		JWTSvidTTL:    *jwtSvidTTL,
+		FederatesWith: splitList(*federatesWith),
+		ClusterName: controller.ClusterNameLookup{
+			Keys:     splitList(*clusterNameKeys),
+			Default:  *clusterName,
+			Override: *clusterNameOverride,
+		},
+		KubeConfigSecrets: kubeConfigSecrets,
+		ParentIDs:         parentIDs,
+	}
+	if r.ClusterName.TrustDomain, err = controller.ParseTrustDomainSource(*trustDomainSource, *trustDomainConfigMap,
+		*trustDomainKey); err != nil {
+		return err
+	}
+	if *selectorTemplate != "" {
+		if r.SelectorTemplate, err = controller.ParseSelectorTemplate(*selectorTemplate); err != nil {
+			return fmt.Errorf("invalid --selector-template: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	sa := &corev1.ServiceAccount{}
+	err = k8sClient.Get(ctx, client.ObjectKey{Namespace: *namespace, Name: *serviceAccount}, sa)
+	switch {
+	case apierrors.IsNotFound(err) && command == "deregister":
+		// The entry of a deleted ServiceAccount leaked; it is identified by name.
+		sa.Namespace, sa.Name = *namespace, *serviceAccount
+	case err != nil:
+		return err
+	}
+
+	if command == "deregister" {
+		if err := r.DeleteEntry(ctx, sa); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted SPIRE entry of ServiceAccount %s/%s\n", sa.Namespace, sa.Name)
+		return nil
+	}
+	id, err := r.CreateEntry(ctx, sa)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, *id)
+	return nil
+}
+
+// runMigrateState implements the migrate-state subcommand, which records the entry IDs
+// annotated on the managed ServiceAccounts in the entry state ConfigMap, e.g. before
+// --entry-state-configmap is first enabled. It can be run again safely. Its result is
+// printed to out.
+func runMigrateState(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate-state", flag.ContinueOnError)
+	entryStateNamespace := os.Getenv("POD_NAMESPACE")
+	if entryStateNamespace == "" {
+		entryStateNamespace = controller.DefaultEntryStateNamespace
+	}
+	configMap := fs.String("entry-state-configmap", controller.DefaultEntryStateConfigMap,
+		"ConfigMap recording the SPIRE entry IDs, see the controller flag.")
+	namespace := fs.String("entry-state-namespace", entryStateNamespace,
+		"Namespace of --entry-state-configmap, the controller's namespace.")
+	managedLabel := fs.String("managed-label", "", "Label also selecting managed ServiceAccounts, see the controller flag.")
+	removeAnnotations := fs.Bool("remove-annotations", false,
+		"If set, the "+controller.SVIDEntryIDAnnotation+" annotation is removed once recorded. The controller then "+
+			"reads entry IDs from the ConfigMap without annotating them again, so it must run with --entry-state-configmap.")
+	opts := zap.Options{Development: true}
+	opts.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if *configMap == "" {
+		return fmt.Errorf("--entry-state-configmap is required")
+	}
+	managed, err := controller.ParseManagedLabel(*managedLabel)
+	if err != nil {
+		return fmt.Errorf("invalid --managed-label: %w", err)
+	}
+
+	k8sClient, err := newClient()
+	if err != nil {
+		return err
+	}
+	store := &controller.EntryStateStore{Client: k8sClient, Namespace: *namespace, Name: *configMap, Managed: managed}
+	result, err := store.Migrate(context.Background(), *removeAnnotations)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "migrated %d SPIRE entry IDs to ConfigMap %s/%s, %d already recorded, %d annotations removed\n",
+		result.Migrated, *namespace, *configMap, result.Unchanged, result.Unannotated)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ignoredServiceAccounts parses the namespace/name list of ignored ServiceAccounts and
+// adds the controller's own ServiceAccount, as exposed through the downward API.
+func ignoredServiceAccounts(value string) (map[types.NamespacedName]bool, error) {
+	ignored := map[types.NamespacedName]bool{}
+	for _, item := range splitList(value) {
+		namespace, name, ok := strings.Cut(item, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("expected namespace/name, got %q", item)
+		}
+		ignored[types.NamespacedName{Namespace: namespace, Name: name}] = true
+	}
+	if namespace, name := os.Getenv("POD_NAMESPACE"), os.Getenv("POD_SERVICE_ACCOUNT"); namespace != "" && name != "" {
+		ignored[types.NamespacedName{Namespace: namespace, Name: name}] = true
+	}
+	return ignored, nil
+}
+
+// parentIDFlag maps clusters to the parent SPIFFE ID of their entries from
+// Cluster=spiffe://... values.
+type parentIDFlag struct {
+	parentIDs controller.ParentIDs
+}
+
+func (f parentIDFlag) String() string {
+	clusters := make([]string, 0, len(f.parentIDs))
+	for cluster, id := range f.parentIDs {
+		clusters = append(clusters, cluster+"="+id)
+	}
+	sort.Strings(clusters)
+	return strings.Join(clusters, ",")
+}
+
+func (f parentIDFlag) Set(value string) error {
+	cluster, id, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected Cluster=spiffe://<trust-domain>/<path>, got %q", value)
+	}
+	return f.parentIDs.Set(strings.TrimSpace(cluster), strings.TrimSpace(id))
+}
+
+// headerFlag collects repeated Name=Value flags into canonical header names and values.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("expected Name=Value, got %q", value)
+	}
+	h[http.CanonicalHeaderKey(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// apiPathFlag sets the sub-paths of SPIRE API entry operations from Operation=Path values.
+type apiPathFlag struct {
+	paths *controller.SpireAPIPaths
+}
+
+func (f apiPathFlag) String() string {
+	if f.paths == nil {
+		return ""
+	}
+	return fmt.Sprintf("add=%s,delete=%s,update=%s,list=%s,batch-add=%s,jobs=%s",
+		f.paths.Add, f.paths.Delete, f.paths.Update, f.paths.List, f.paths.BatchAdd, f.paths.Jobs)
+}
+
+func (f apiPathFlag) Set(value string) error {
+	operation, path, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected Operation=Path, got %q", value)
+	}
+	return f.paths.SetOperation(strings.TrimSpace(operation), strings.TrimSpace(path))
+}
+
+// spireTLS returns the SpireTLS of the --spire-api-ca, --spire-api-client-cert and
+// --spire-api-client-key values, or nil when none is set.
+func spireTLS(ca, cert, key string) (*controller.SpireTLS, error) {
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+	t := &controller.SpireTLS{}
+	var err error
+	if ca != "" {
+		if t.CA, err = controller.ParseTLSSource(ca, controller.DefaultTLSCAKey); err != nil {
+			return nil, fmt.Errorf("invalid --spire-api-ca: %w", err)
+		}
+	}
+	if cert != "" {
+		if t.Cert, err = controller.ParseTLSSource(cert, controller.DefaultTLSCertKey); err != nil {
+			return nil, fmt.Errorf("invalid --spire-api-client-cert: %w", err)
+		}
+	}
+	if key != "" {
+		if t.Key, err = controller.ParseTLSSource(key, controller.DefaultTLSKeyKey); err != nil {
+			return nil, fmt.Errorf("invalid --spire-api-client-key: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// kubeConfigSecretFlag maps clusters to their kubeconfig Secrets from Cluster=Namespace/Name values.
+type kubeConfigSecretFlag struct {
+	secrets controller.KubeConfigSecrets
+}
+
+func (f kubeConfigSecretFlag) String() string {
+	clusters := make([]string, 0, len(f.secrets))
+	for cluster, secret := range f.secrets {
+		clusters = append(clusters, cluster+"="+secret.String())
+	}
+	sort.Strings(clusters)
+	return strings.Join(clusters, ",")
+}
+
+func (f kubeConfigSecretFlag) Set(value string) error {
+	cluster, secret, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected Cluster=Namespace/Name, got %q", value)
+	}
+	return f.secrets.Set(strings.TrimSpace(cluster), strings.TrimSpace(secret))
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/shanmugara/spire-registrar/internal/controller"
+)
+
+// fakeHealthChecks records the checks added to it the way the manager serves them.
+type fakeHealthChecks struct {
+	healthz, readyz map[string]healthz.Checker
+}
+
+func (f *fakeHealthChecks) AddHealthzCheck(name string, check healthz.Checker) error {
+	f.healthz[name] = check
+	return nil
+}
+
+func (f *fakeHealthChecks) AddReadyzCheck(name string, check healthz.Checker) error {
+	f.readyz[name] = check
+	return nil
+}
+
+func probe(checks map[string]healthz.Checker) int {
+	rec := httptest.NewRecorder()
+	(&healthz.Handler{Checks: checks}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
+
+var _ = Describe("Health checks", func() {
+	It("should fail readiness but not liveness when the SPIRE API is unreachable", func() {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		spireClient := controller.NewSpireClient(controller.SpireAPI{Server: down.URL})
+
+		checks := &fakeHealthChecks{healthz: map[string]healthz.Checker{}, readyz: map[string]healthz.Checker{}}
+		Expect(addHealthChecks(checks, controller.SpireHealthCheck(spireClient, "", time.Second))).To(Succeed())
+		Expect(checks.healthz).NotTo(HaveKey("spire-api"))
+		Expect(checks.readyz).To(HaveKey("spire-api"))
+
+		Expect(probe(checks.healthz)).To(Equal(http.StatusOK))
+		Expect(probe(checks.readyz)).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("should report ready once the SPIRE API is reachable", func() {
+		up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		defer up.Close()
+		spireClient := controller.NewSpireClient(controller.SpireAPI{Server: up.URL})
+
+		checks := &fakeHealthChecks{healthz: map[string]healthz.Checker{}, readyz: map[string]healthz.Checker{}}
+		Expect(addHealthChecks(checks, controller.SpireHealthCheck(spireClient, "", time.Second))).To(Succeed())
+
+		Expect(probe(checks.healthz)).To(Equal(http.StatusOK))
+		Expect(probe(checks.readyz)).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("Entry commands", func() {
+	var requests []string
+	var bodies []string
+	var server *httptest.Server
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		requests, bodies = nil, nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, req.URL.Path)
+			bodies = append(bodies, string(body))
+			if req.URL.Path == "/v1/entries/add" {
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}
+		}))
+		DeferCleanup(server.Close)
+		out = &bytes.Buffer{}
+
+		clusterInfo := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        controller.ClusterInfoCm,
+				Namespace:   controller.ClusterInfoCmNamespace,
+				Annotations: map[string]string{controller.SpireTrustDomainAnnotation: "example.org"},
+			},
+			Data: map[string]string{"ClusterConfiguration": "clusterName: test-cluster\n"},
+		}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterInfo, sa).Build()
+		previous := newClient
+		newClient = func() (client.Client, error) { return k8sClient, nil }
+		DeferCleanup(func() { newClient = previous })
+	})
+
+	run := func(command string, args ...string) error {
+		args = append([]string{"--spire-api-servers=" + server.URL, "--send-kubeconfig=false"}, args...)
+		return runEntryCommand(command, args, out)
+	}
+
+	It("should require --service-account", func() {
+		Expect(run("register")).To(MatchError("--service-account is required"))
+		Expect(run("deregister", "--service-account=")).To(MatchError("--service-account is required"))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("should require at least one SPIRE API server", func() {
+		err := runEntryCommand("register", []string{"--service-account=app", "--spire-api-servers= , "}, out)
+		Expect(err).To(MatchError("--spire-api-servers must list at least one server"))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("should print the ID of the registered entry", func() {
+		Expect(run("register", "--service-account=app")).To(Succeed())
+		Expect(requests).To(Equal([]string{"/v1/entries/add"}))
+		Expect(out.String()).To(Equal("entry-1\n"))
+	})
+
+	It("should not register the entry of a missing ServiceAccount", func() {
+		err := run("register", "--service-account=gone")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(requests).To(BeEmpty())
+		Expect(out.String()).To(BeEmpty())
+	})
+
+	It("should deregister the leaked entry of a ServiceAccount that no longer exists", func() {
+		Expect(run("deregister", "--service-account=gone")).To(Succeed())
+		Expect(requests).To(Equal([]string{"/v1/entries/delete"}))
+		Expect(bodies[0]).To(ContainSubstring("gone"))
+		Expect(out.String()).To(Equal("deleted SPIRE entry of ServiceAccount default/gone\n"))
+	})
+})
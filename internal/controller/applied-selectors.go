@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type appliedSelectorsKey struct{}
+
+// withAppliedSelectors returns a context recording the selectors the SPIRE API
+// reports it applied to an entry sent with requested. Until the API reports any, the
+// requested selectors are recorded.
+func withAppliedSelectors(ctx context.Context, requested []string) (context.Context, *[]string) {
+	selectors := new([]string)
+	*selectors = requested
+	return context.WithValue(ctx, appliedSelectorsKey{}, selectors), selectors
+}
+
+func recordAppliedSelectors(ctx context.Context, selectors []string) {
+	if recorded, ok := ctx.Value(appliedSelectorsKey{}).(*[]string); ok && len(selectors) > 0 {
+		*recorded = selectors
+	}
+}
+
+// setAppliedSelectors records selectors in the AppliedSelectorsAnnotation of sa, or
+// removes it when there are none, i.e. the server derives the selectors.
+func setAppliedSelectors(sa *corev1.ServiceAccount, selectors []string) {
+	if len(selectors) == 0 {
+		delete(sa.Annotations, AppliedSelectorsAnnotation)
+		return
+	}
+	sa.Annotations[AppliedSelectorsAnnotation] = strings.Join(selectors, ",")
+}
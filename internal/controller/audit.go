@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const DefaultAuditInterval = 30 * time.Minute
+
+var _ manager.LeaderElectionRunnable = &EntryAuditor{}
+
+// Audit states of the entry of a managed ServiceAccount.
+const (
+	AuditEntryOK         = "ok"
+	AuditEntryMissing    = "missing"
+	AuditEntryMismatched = "mismatched"
+)
+
+// AuditReport counts the managed ServiceAccounts by the state of their SPIRE entry.
+type AuditReport struct {
+	// OK entries are registered for the ServiceAccount and up to date.
+	OK int
+	// Missing entries were never recorded on the ServiceAccount or are gone from SPIRE.
+	Missing int
+	// Mismatched entries exist but belong to another ServiceAccount, or no longer
+	// match what the ServiceAccount renders to.
+	Mismatched int
+	// Failed counts the ServiceAccounts whose entry could not be rendered or listed.
+	Failed int
+}
+
+// EntryAuditor periodically checks the SPIRE entry of every managed ServiceAccount
+// and reports how many are up to date, missing or mismatched, without changing
+// anything. It reuses the rendering of Reconciler, so the report matches what a
+// reconcile would do.
+type EntryAuditor struct {
+	Reconciler *ServiceAccountReconciler
+	Interval   time.Duration
+}
+
+// Start runs the audit every Interval until ctx is cancelled.
+func (a *EntryAuditor) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("audit")
+	ctx = log.IntoContext(ctx, logger)
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultAuditInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := a.Audit(ctx); err != nil {
+				logger.Error(err, "Failed to audit SPIRE entries")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that only the
+// leader lists the entries of the cluster and exports the audit gauge.
+func (a *EntryAuditor) NeedLeaderElection() bool {
+	return true
+}
+
+// Audit checks the entries of the managed ServiceAccounts once, logs the report and
+// exports it as the spire_registrar_audit_entries gauge. The entries of each
+// cluster are listed once rather than fetched one by one.
+func (a *EntryAuditor) Audit(ctx context.Context) (AuditReport, error) {
+	logger := log.FromContext(ctx)
+	r := a.Reconciler
+
+	saList := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, saList); err != nil {
+		return AuditReport{}, err
+	}
+
+	var report AuditReport
+	entries := map[string]map[string]RegisteredEntry{}
+	for i := range saList.Items {
+		sa := &saList.Items[i]
+		if !r.Managed.Matches(sa) || r.IgnoredServiceAccounts[types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}] ||
+			sa.DeletionTimestamp != nil || paused(ctx, sa) {
+			continue
+		}
+		se, err := r.desiredEntry(ctx, sa)
+		if err != nil {
+			logger.Error(err, "Failed to render SPIRE entry for audit", "namespace", sa.Namespace, "name", sa.Name)
+			report.Failed++
+			continue
+		}
+		registered, listed := entries[se.Cluster]
+		if !listed {
+			list, err := r.spireClient().ListEntries(ctx, se.Cluster)
+			if err != nil {
+				logger.Error(err, "Failed to list SPIRE entries for audit", "cluster", se.Cluster)
+				report.Failed++
+				continue
+			}
+			registered = make(map[string]RegisteredEntry, len(list))
+			for _, entry := range list {
+				registered[entry.EntryID] = entry
+			}
+			entries[se.Cluster] = registered
+		}
+
+		state := auditEntry(sa, se, registered)
+		switch state {
+		case AuditEntryOK:
+			report.OK++
+		case AuditEntryMissing:
+			report.Missing++
+		case AuditEntryMismatched:
+			report.Mismatched++
+		}
+		if state != AuditEntryOK {
+			logger.Info("SPIRE entry is "+state, "namespace", sa.Namespace, "name", sa.Name,
+				"entryID", sa.Annotations[SVIDEntryIDAnnotation])
+		}
+	}
+
+	auditEntries.WithLabelValues(AuditEntryOK).Set(float64(report.OK))
+	auditEntries.WithLabelValues(AuditEntryMissing).Set(float64(report.Missing))
+	auditEntries.WithLabelValues(AuditEntryMismatched).Set(float64(report.Mismatched))
+	logger.Info("SPIRE entry audit report", "entries_ok", report.OK, "entries_missing", report.Missing,
+		"entries_mismatched", report.Mismatched, "entries_failed", report.Failed)
+	return report, nil
+}
+
+// auditEntry returns the audit state of the entry of sa among the registered entries
+// of its cluster, keyed by entry ID. An entry is mismatched when it belongs to
+// another ServiceAccount or when se no longer hashes to the hash recorded at the
+// last sync; the registered entry itself is not compared field by field as the
+// SPIRE API may not echo the kubeconfig as sent.
+func auditEntry(sa *corev1.ServiceAccount, se SpireEntry, registered map[string]RegisteredEntry) string {
+	id := sa.Annotations[SVIDEntryIDAnnotation]
+	entry, found := registered[id]
+	if id == "" || !found {
+		return AuditEntryMissing
+	}
+	if !adoptableEntry(entry.SpireEntry, se) ||
+		(entry.ServiceAccountUID != "" && entry.ServiceAccountUID != string(sa.UID)) ||
+		hashEntry(se) != sa.Annotations[EntryHashAnnotation] {
+		return AuditEntryMismatched
+	}
+	return AuditEntryOK
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Entry audit", func() {
+	It("should count the managed ServiceAccounts by the state of their entry", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			Expect(req.URL.Path).To(Equal("/v1/entries"), "the audit only reads entries")
+			Expect(req.URL.Query().Get("cluster")).To(Equal("test-cluster"))
+			_, _ = w.Write([]byte(`{"entries":[
+				{"entryID":"e-app","namespace":"default","serviceAccount":"app","cluster":"test-cluster"},
+				{"entryID":"e-stale","namespace":"default","serviceAccount":"stale","cluster":"test-cluster"},
+				{"entryID":"e-other","namespace":"default","serviceAccount":"other","cluster":"test-cluster"}
+			]}`))
+		}))
+		defer server.Close()
+
+		registered := func(name, id string) *corev1.ServiceAccount {
+			sa := newManagedServiceAccount(name, "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = id
+			return sa
+		}
+		unmanaged := newManagedServiceAccount("unmanaged", "default")
+		unmanaged.Annotations = nil
+		r := newTestReconciler(server.URL,
+			registered("app", "e-app"),
+			registered("stale", "e-stale"),
+			registered("reused", "e-other"),
+			registered("gone", "e-gone"),
+			newManagedServiceAccount("new", "default"),
+			unmanaged,
+		)
+		for _, name := range []string{"app", "stale", "reused"} {
+			sa := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, sa)).To(Succeed())
+			se, err := r.desiredEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			sa.Annotations[EntryHashAnnotation] = hashEntry(se)
+			if name == "stale" {
+				sa.Annotations[EntryHashAnnotation] = "outdated"
+			}
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+		}
+
+		auditor := &EntryAuditor{Reconciler: r}
+		report, err := auditor.Audit(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(AuditReport{OK: 1, Missing: 2, Mismatched: 2}))
+		Expect(testutil.ToFloat64(auditEntries.WithLabelValues(AuditEntryOK))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(auditEntries.WithLabelValues(AuditEntryMissing))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(auditEntries.WithLabelValues(AuditEntryMismatched))).To(Equal(2.0))
+	})
+
+	It("should count the ServiceAccounts it cannot check as failed", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL, newManagedServiceAccount("app", "default"))
+		report, err := (&EntryAuditor{Reconciler: r}).Audit(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(AuditReport{Failed: 1}))
+	})
+})
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultCallbackPath is the path of the SPIRE callback endpoint on the metrics listener.
+const DefaultCallbackPath = "/spire-callback"
+
+const (
+	// EntryExpiringEvent reports an entry about to expire on the SPIRE server.
+	EntryExpiringEvent = "expiring"
+	// EntryPrunedEvent reports an entry the SPIRE server pruned.
+	EntryPrunedEvent = "pruned"
+)
+
+// maxCallbackBytes bounds the body of a SPIRE callback.
+const maxCallbackBytes = 64 << 10
+
+// SpireCallback is the body the SPIRE server posts to the callback endpoint.
+type SpireCallback struct {
+	EntryID string `json:"entryID"`
+	Event   string `json:"event"`
+}
+
+// SpireCallbacks receives the SPIRE server's notifications of expiring and pruned
+// entries and reconciles the ServiceAccounts they belong to right away. Like a
+// resync, the reconcile sends the entry to SPIRE regardless of its recorded hash,
+// so that a pruned entry is registered again.
+type SpireCallbacks struct {
+	// Token is the shared secret the SPIRE server presents as "Authorization: Bearer".
+	Token *BearerToken
+
+	// reader and managed resolve entry IDs to ServiceAccounts; they are set by the
+	// reconciler watching the callbacks.
+	reader  client.Reader
+	managed ManagedSelector
+	events  chan event.GenericEvent
+}
+
+// NewSpireCallbacks returns a SpireCallbacks to pass to a ServiceAccountReconciler.
+func NewSpireCallbacks(token *BearerToken) *SpireCallbacks {
+	return &SpireCallbacks{Token: token, events: make(chan event.GenericEvent, 128)}
+}
+
+// ServeHTTP enqueues the ServiceAccount of the entry in a POSTed SpireCallback. It
+// responds 202 Accepted, 404 Not Found when no managed ServiceAccount has the entry,
+// or 503 Service Unavailable when the controller is not ready for callbacks.
+func (c *SpireCallbacks) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := ctrl.Log.WithName("spire-callback")
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeRequest(w, req, c.Token, logger) {
+		return
+	}
+
+	var callback SpireCallback
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxCallbackBytes))
+	if err == nil {
+		err = json.Unmarshal(body, &callback)
+	}
+	if err != nil {
+		http.Error(w, "invalid callback: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if callback.EntryID == "" {
+		http.Error(w, "invalid callback: missing entryID", http.StatusBadRequest)
+		return
+	}
+	if callback.Event != EntryExpiringEvent && callback.Event != EntryPrunedEvent {
+		http.Error(w, "invalid callback: unknown event "+callback.Event, http.StatusBadRequest)
+		return
+	}
+	if c.reader == nil {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger = logger.WithValues("entryID", callback.EntryID, "event", callback.Event)
+	sa, err := c.serviceAccountFor(req.Context(), callback.EntryID)
+	if err != nil {
+		logger.Error(err, "Failed to list ServiceAccounts for SPIRE callback")
+		http.Error(w, "unable to resolve entry", http.StatusServiceUnavailable)
+		return
+	}
+	if sa == nil {
+		logger.Info("No managed ServiceAccount has the SPIRE entry of the callback")
+		http.Error(w, "unknown entry", http.StatusNotFound)
+		return
+	}
+	select {
+	case c.events <- event.GenericEvent{Object: sa}:
+	default:
+		http.Error(w, "too many pending callbacks", http.StatusServiceUnavailable)
+		return
+	}
+	logger.Info("SPIRE callback received, reconciling ServiceAccount", "namespace", sa.Namespace, "name", sa.Name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serviceAccountFor returns the managed ServiceAccount registered as entry id, or nil.
+func (c *SpireCallbacks) serviceAccountFor(ctx context.Context, id string) (*corev1.ServiceAccount, error) {
+	saList := &corev1.ServiceAccountList{}
+	if err := c.reader.List(ctx, saList); err != nil {
+		return nil, err
+	}
+	for i := range saList.Items {
+		sa := &saList.Items[i]
+		if sa.Annotations[SVIDEntryIDAnnotation] == id && c.managed.Matches(sa) {
+			return sa, nil
+		}
+	}
+	return nil, nil
+}
+
+// source returns the controller source the reconciler watches for callbacks.
+func (c *SpireCallbacks) source() source.Source {
+	return &source.Channel{Source: c.events}
+}
+
+// callbackHandler enqueues the ServiceAccount of a callback, marking it to be
+// verified against SPIRE regardless of its recorded entry hash.
+func (r *ServiceAccountReconciler) callbackHandler() handler.EventHandler {
+	return handler.Funcs{
+		GenericFunc: func(_ context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+			key := client.ObjectKeyFromObject(e.Object)
+			r.forcedSyncs.Store(key, true)
+			q.Add(reconcile.Request{NamespacedName: key})
+		},
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("SPIRE callbacks", func() {
+	var callbacks *SpireCallbacks
+
+	BeforeEach(func() {
+		registered := newManagedServiceAccount("app", "default")
+		registered.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+		unmanaged := &corev1.ServiceAccount{}
+		unmanaged.Name, unmanaged.Namespace = "other", "default"
+		unmanaged.Annotations = map[string]string{SVIDEntryIDAnnotation: "entry-2"}
+
+		callbacks = NewSpireCallbacks(&BearerToken{Value: "s3cret"})
+		callbacks.reader = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(registered, unmanaged).Build()
+	})
+
+	post := func(body, token string) int {
+		req := httptest.NewRequest(http.MethodPost, DefaultCallbackPath, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		callbacks.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should enqueue the ServiceAccount of a pruned entry", func() {
+		Expect(post(`{"entryID":"entry-1","event":"pruned"}`, "s3cret")).To(Equal(http.StatusAccepted))
+		var e event.GenericEvent
+		Expect(callbacks.events).To(Receive(&e))
+		Expect(e.Object.GetNamespace()).To(Equal("default"))
+		Expect(e.Object.GetName()).To(Equal("app"))
+	})
+
+	It("should reject callbacks without the shared secret", func() {
+		Expect(post(`{"entryID":"entry-1","event":"expiring"}`, "")).To(Equal(http.StatusUnauthorized))
+		Expect(post(`{"entryID":"entry-1","event":"expiring"}`, "wrong")).To(Equal(http.StatusUnauthorized))
+		Expect(callbacks.events).NotTo(Receive())
+	})
+
+	It("should report entries of no managed ServiceAccount as not found", func() {
+		Expect(post(`{"entryID":"entry-2","event":"expiring"}`, "s3cret")).To(Equal(http.StatusNotFound))
+		Expect(post(`{"entryID":"entry-3","event":"expiring"}`, "s3cret")).To(Equal(http.StatusNotFound))
+		Expect(callbacks.events).NotTo(Receive())
+	})
+
+	It("should reject malformed callbacks", func() {
+		Expect(post(`{"entryID":"entry-1","event":"renamed"}`, "s3cret")).To(Equal(http.StatusBadRequest))
+		Expect(post(`{"event":"pruned"}`, "s3cret")).To(Equal(http.StatusBadRequest))
+		Expect(post(`not json`, "s3cret")).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// CheckClusterInfo reads the cluster info ConfigMap once, e.g. at startup, and
+// verifies that it carries the SPIRE trust domain annotation and a cluster name
+// resolvable by names, without which no SPIRE entry can be rendered. As the
+// manager's cache is not started yet, c should be its API reader.
+func CheckClusterInfo(ctx context.Context, c client.Reader, names ClusterNameLookup) error {
+	info, err := readClusterInfo(ctx, c, names)
+	if err != nil {
+		return fmt.Errorf("cluster info ConfigMap %s/%s is unusable: %w", ClusterInfoCmNamespace, ClusterInfoCm, err)
+	}
+	log.FromContext(ctx).Info("Verified cluster info", "trustDomain", info["trustDomain"], "clusterName", info["clusterName"])
+	return nil
+}
+
+// parseClusterConfiguration parses the ClusterConfiguration of the cluster info
+// ConfigMap, given as YAML or JSON. A leading byte order mark is ignored. Of several
+// YAML documents, the one of kind ClusterConfiguration is used, else the first one.
+// An empty ClusterConfiguration parses as an empty map.
+func parseClusterConfiguration(data string) (map[string]interface{}, error) {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(data, "\ufeff"))
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(trimmed)))
+
+	var first map[string]interface{}
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading document %d of %d bytes: %w", i+1, len(data), err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal(doc, &parsed); err != nil {
+			return nil, fmt.Errorf("parsing document %d of %d bytes: %w", i+1, len(data), err)
+		}
+		if parsed == nil {
+			continue
+		}
+		if parsed["kind"] == "ClusterConfiguration" {
+			return parsed, nil
+		}
+		if first == nil {
+			first = parsed
+		}
+	}
+	if first == nil {
+		first = map[string]interface{}{}
+	}
+	return first, nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Checking the cluster info at startup", func() {
+	var r *ServiceAccountReconciler
+	var clusterInfo *corev1.ConfigMap
+
+	BeforeEach(func() {
+		r = newTestReconciler("http://127.0.0.1:0")
+		clusterInfo = &corev1.ConfigMap{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, clusterInfo)).To(Succeed())
+	})
+
+	It("should accept a ConfigMap with a trust domain and a cluster name", func() {
+		Expect(CheckClusterInfo(context.Background(), r.Client, ClusterNameLookup{})).To(Succeed())
+	})
+
+	It("should name the missing trust domain annotation", func() {
+		delete(clusterInfo.Annotations, SpireTrustDomainAnnotation)
+		Expect(r.Update(context.Background(), clusterInfo)).To(Succeed())
+
+		err := CheckClusterInfo(context.Background(), r.Client, ClusterNameLookup{})
+		Expect(err).To(MatchError(ContainSubstring("missing " + SpireTrustDomainAnnotation + " annotation")))
+	})
+
+	It("should report a missing cluster name unless one is configured", func() {
+		clusterInfo.Data["ClusterConfiguration"] = "kubernetesVersion: v1.29.0\n"
+		Expect(r.Update(context.Background(), clusterInfo)).To(Succeed())
+
+		err := CheckClusterInfo(context.Background(), r.Client, ClusterNameLookup{})
+		Expect(err).To(MatchError(ContainSubstring("cluster name not found")))
+		Expect(CheckClusterInfo(context.Background(), r.Client, ClusterNameLookup{Default: "fallback"})).To(Succeed())
+	})
+
+	It("should report a missing ConfigMap", func() {
+		Expect(r.Delete(context.Background(), clusterInfo)).To(Succeed())
+
+		err := CheckClusterInfo(context.Background(), r.Client, ClusterNameLookup{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "got %v", err)
+		Expect(err).To(MatchError(ContainSubstring(ClusterInfoCmNamespace + "/" + ClusterInfoCm)))
+	})
+})
+
+var _ = Describe("Reading the trust domain from a ConfigMap key", func() {
+	var r *ServiceAccountReconciler
+	var names ClusterNameLookup
+
+	BeforeEach(func() {
+		r = newTestReconciler("http://127.0.0.1:0")
+		source, err := ParseTrustDomainSource(TrustDomainSourceConfigMap, "spire-system/spire-config", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source.Key).To(Equal(DefaultTrustDomainKey))
+		names = ClusterNameLookup{TrustDomain: source}
+	})
+
+	setAnnotation := func(trustDomain string) {
+		clusterInfo := &corev1.ConfigMap{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, clusterInfo)).To(Succeed())
+		if trustDomain == "" {
+			delete(clusterInfo.Annotations, SpireTrustDomainAnnotation)
+		} else {
+			clusterInfo.Annotations[SpireTrustDomainAnnotation] = trustDomain
+		}
+		Expect(r.Update(context.Background(), clusterInfo)).To(Succeed())
+	}
+	createConfigMap := func(trustDomain string) {
+		Expect(r.Create(context.Background(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "spire-system", Name: "spire-config"},
+			Data:       map[string]string{DefaultTrustDomainKey: trustDomain},
+		})).To(Succeed())
+	}
+
+	It("should fall back to the annotation while the ConfigMap is missing", func() {
+		setAnnotation("annotated.example.org")
+
+		info, err := readClusterInfo(context.Background(), r.Client, names)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info["trustDomain"]).To(Equal("annotated.example.org"))
+	})
+
+	It("should read the key when there is no annotation", func() {
+		setAnnotation("")
+		createConfigMap("configured.example.org")
+
+		info, err := readClusterInfo(context.Background(), r.Client, names)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info["trustDomain"]).To(Equal("configured.example.org"))
+	})
+
+	It("should prefer the key over the annotation", func() {
+		setAnnotation("annotated.example.org")
+		createConfigMap("configured.example.org")
+
+		info, err := readClusterInfo(context.Background(), r.Client, names)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info["trustDomain"]).To(Equal("configured.example.org"))
+	})
+
+	It("should name both places when neither has a trust domain", func() {
+		setAnnotation("")
+		createConfigMap("")
+
+		err := CheckClusterInfo(context.Background(), r.Client, names)
+		Expect(err).To(MatchError(And(ContainSubstring("missing key "+DefaultTrustDomainKey),
+			ContainSubstring(SpireTrustDomainAnnotation))))
+	})
+
+	It("should reject an invalid trust domain in the key", func() {
+		createConfigMap("Not A Domain")
+
+		err := CheckClusterInfo(context.Background(), r.Client, names)
+		Expect(err).To(MatchError(ContainSubstring("invalid key " + DefaultTrustDomainKey)))
+	})
+
+	It("should reject unknown sources and malformed ConfigMap names", func() {
+		_, err := ParseTrustDomainSource("secret", "", "")
+		Expect(err).To(MatchError(ContainSubstring("unknown trust domain source")))
+		_, err = ParseTrustDomainSource(TrustDomainSourceConfigMap, "spire-config", "")
+		Expect(err).To(MatchError(ContainSubstring("must be namespace/name")))
+		source, err := ParseTrustDomainSource("", "ignored/name", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(TrustDomainSource{}))
+	})
+})
+
+var _ = Describe("Parsing the ClusterConfiguration", func() {
+	DescribeTable("should find the cluster name",
+		func(data string, clusterName interface{}) {
+			info, err := parseClusterConfiguration(data)
+			Expect(err).NotTo(HaveOccurred())
+			if clusterName == nil {
+				Expect(info).NotTo(BeNil())
+				Expect(info).NotTo(HaveKey("clusterName"))
+				return
+			}
+			Expect(info).To(HaveKeyWithValue("clusterName", clusterName))
+		},
+		Entry("in YAML", "apiVersion: kubeadm.k8s.io/v1beta3\nkind: ClusterConfiguration\nclusterName: prod\n", "prod"),
+		Entry("in JSON", `{"apiVersion":"kubeadm.k8s.io/v1beta3","kind":"ClusterConfiguration","clusterName":"prod"}`, "prod"),
+		Entry("in indented JSON", "\n  {\n    \"clusterName\": \"prod\"\n  }\n", "prod"),
+		Entry("after a document marker", "---\nclusterName: prod\n", "prod"),
+		Entry("after a byte order mark", "\ufeffclusterName: prod\n", "prod"),
+		Entry("in the ClusterConfiguration of several documents",
+			"kind: InitConfiguration\nclusterName: other\n---\nkind: ClusterConfiguration\nclusterName: prod\n", "prod"),
+		Entry("in the first of several untyped documents", "---\n---\nclusterName: prod\n---\nclusterName: other\n", "prod"),
+		Entry("nowhere in an empty ClusterConfiguration", "", nil),
+		Entry("nowhere in a blank ClusterConfiguration", " \n---\n", nil),
+	)
+
+	It("should report the size of a ClusterConfiguration that does not parse", func() {
+		_, err := parseClusterConfiguration("clusterName: [prod\n")
+		Expect(err).To(MatchError(ContainSubstring("parsing document 1 of 19 bytes")))
+
+		_, err = parseClusterConfiguration("- prod\n")
+		Expect(err).To(HaveOccurred(), "a list is not a ClusterConfiguration")
+	})
+
+	It("should read a JSON ClusterConfiguration from the ConfigMap", func() {
+		r := newTestReconciler("http://127.0.0.1:0")
+		clusterInfo := &corev1.ConfigMap{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, clusterInfo)).To(Succeed())
+		clusterInfo.Data["ClusterConfiguration"] = `{"kind":"ClusterConfiguration","clusterName":"json-cluster"}`
+		Expect(r.Update(context.Background(), clusterInfo)).To(Succeed())
+
+		info, err := r.GetClusterInfo(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(HaveKeyWithValue("clusterName", "json-cluster"))
+	})
+})
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// secretFlags are the flags whose values EffectiveConfig redacts.
+var secretFlags = map[string]bool{
+	"spire-api-token":            true,
+	"spire-api-sensitive-header": true,
+	"resync-token":               true,
+	"callback-token":             true,
+	"debug-token":                true,
+}
+
+// Config holds controller options loaded from a YAML or JSON file, as with
+// controller-runtime's component config. Each key is the name of a command-line flag
+// without its dashes, e.g. spire-api-servers; a list gives the values of a repeatable
+// flag such as spire-api-header. Flags given on the command line override the file.
+type Config struct {
+	Options map[string][]string
+}
+
+// LoadConfig reads the Config at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig parses a YAML or JSON Config. Values must be scalars or lists of scalars.
+func ParseConfig(data []byte) (*Config, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	config := &Config{Options: map[string][]string{}}
+	for name, value := range raw {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			s, err := configScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", name, err)
+			}
+			config.Options[name] = append(config.Options[name], s)
+		}
+	}
+	return config, nil
+}
+
+// configScalar formats a decoded config value the way it would be given as a flag.
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("expected a string, number or boolean, got %T", value)
+	}
+}
+
+// MarshalJSON writes single values as scalars and repeated ones as lists, so that
+// the output parses back to an equal Config.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(c.Options))
+	for name, values := range c.Options {
+		if len(values) == 1 {
+			out[name] = values[0]
+		} else {
+			out[name] = values
+		}
+	}
+	return json.Marshal(out)
+}
+
+// Apply sets the flags of fs from the config, except those given on the command
+// line. It fails on options naming no flag and on values the flag rejects.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(c.Options))
+	for name := range c.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown option %s", name)
+		}
+		if set[name] {
+			continue
+		}
+		for _, value := range c.Options[name] {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value %q for option %s: %w", value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// EffectiveConfig returns the value of every flag of fs, with secrets redacted, for
+// logging at startup.
+func EffectiveConfig(fs *flag.FlagSet) map[string]string {
+	effective := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "<redacted>"
+		}
+		effective[f.Name] = value
+	})
+	return effective
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config file", func() {
+	// newFlagSet registers a few flags of each kind the controller uses.
+	newFlagSet := func() (*flag.FlagSet, *string, *bool, *int64, *time.Duration, *[]string) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		servers := fs.String("spire-api-servers", "http://localhost:8080", "")
+		dryRun := fs.Bool("dry-run", false, "")
+		maxBytes := fs.Int64("spire-api-max-response-bytes", DefaultMaxResponseBytes, "")
+		grace := fs.Duration("shutdown-grace-period", DefaultShutdownGracePeriod, "")
+		var headers []string
+		fs.Func("spire-api-header", "", func(value string) error {
+			headers = append(headers, value)
+			return nil
+		})
+		fs.String("spire-api-token", "", "")
+		return fs, servers, dryRun, maxBytes, grace, &headers
+	}
+
+	It("should round-trip through JSON", func() {
+		config := &Config{Options: map[string][]string{
+			"spire-api-servers":            {"https://spire-a:8443,https://spire-b:8443"},
+			"dry-run":                      {"true"},
+			"spire-api-max-response-bytes": {"2097152"},
+			"spire-api-header":             {"X-Tenant=blue", "X-Env=prod"},
+		}}
+		data, err := json.Marshal(config)
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := ParseConfig(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(config))
+	})
+
+	It("should load YAML and let command-line flags override it", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(strings.Join([]string{
+			"spire-api-servers: https://spire:8443",
+			"dry-run: true",
+			"spire-api-max-response-bytes: 2097152",
+			"shutdown-grace-period: 45s",
+			"spire-api-header:",
+			"- X-Tenant=blue",
+			"- X-Env=prod",
+		}, "\n")), 0o600)).To(Succeed())
+
+		fs, servers, dryRun, maxBytes, grace, headers := newFlagSet()
+		Expect(fs.Parse([]string{"--shutdown-grace-period=10s"})).To(Succeed())
+		config, err := LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Apply(fs)).To(Succeed())
+
+		Expect(*servers).To(Equal("https://spire:8443"))
+		Expect(*dryRun).To(BeTrue())
+		Expect(*maxBytes).To(BeEquivalentTo(2097152))
+		Expect(*grace).To(Equal(10*time.Second), "the command line overrides the file")
+		Expect(*headers).To(Equal([]string{"X-Tenant=blue", "X-Env=prod"}))
+	})
+
+	DescribeTable("should reject invalid configs",
+		func(data, message string) {
+			fs, _, _, _, _, _ := newFlagSet()
+			config, err := ParseConfig([]byte(data))
+			if err == nil {
+				err = config.Apply(fs)
+			}
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("an unknown option", "spire-api-server: https://spire:8443", "unknown option spire-api-server"),
+		Entry("an invalid value", "dry-run: maybe", `invalid value "maybe" for option dry-run`),
+		Entry("a nested value", "spire-api-header:\n  X-Tenant: blue", "expected a string, number or boolean"),
+		Entry("a config option", "config: other.yaml", "unknown option config"),
+	)
+
+	It("should redact secrets from the effective configuration", func() {
+		fs, _, _, _, _, _ := newFlagSet()
+		Expect(fs.Parse([]string{"--spire-api-token=s3cret", "--dry-run"})).To(Succeed())
+		effective := EffectiveConfig(fs)
+		Expect(effective).To(HaveKeyWithValue("spire-api-token", "<redacted>"))
+		Expect(effective).To(HaveKeyWithValue("dry-run", "true"))
+		Expect(effective).To(HaveKeyWithValue("spire-api-servers", "http://localhost:8080"))
+	})
+})
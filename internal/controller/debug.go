@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultDebugPath is the path of the debug endpoint on the metrics listener.
+const DefaultDebugPath = "/debug/registrar"
+
+// DefaultReconcileHistorySize is the number of reconcile outcomes kept per
+// ServiceAccount.
+const DefaultReconcileHistorySize = 10
+
+// Actions of a ReconcileOutcome.
+const (
+	ReconcileActionSkip     = "skip"
+	ReconcileActionRegister = "register"
+	ReconcileActionSync     = "sync"
+	ReconcileActionDelete   = "delete"
+)
+
+// Results of a ReconcileOutcome.
+const (
+	ReconcileResultSuccess = "success"
+	ReconcileResultRequeue = "requeue"
+	ReconcileResultError   = "error"
+)
+
+// ReconcileOutcome records what a reconcile of a ServiceAccount did.
+type ReconcileOutcome struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Result  string    `json:"result"`
+	EntryID string    `json:"entryID,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ReconcileHistory keeps the last Size reconcile outcomes of each ServiceAccount, for
+// the debug endpoint. ServiceAccounts are forgotten once they no longer exist.
+type ReconcileHistory struct {
+	// Size bounds the outcomes kept per ServiceAccount. Defaults to
+	// DefaultReconcileHistorySize.
+	Size int
+
+	mu       sync.Mutex
+	outcomes map[types.NamespacedName]*outcomeRing
+}
+
+// outcomeRing is a fixed-size ring of outcomes; next is the slot overwritten next.
+type outcomeRing struct {
+	outcomes []ReconcileOutcome
+	next     int
+}
+
+func (h *ReconcileHistory) record(key types.NamespacedName, outcome ReconcileOutcome) {
+	if h == nil {
+		return
+	}
+	size := h.Size
+	if size <= 0 {
+		size = DefaultReconcileHistorySize
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outcomes == nil {
+		h.outcomes = map[types.NamespacedName]*outcomeRing{}
+	}
+	ring := h.outcomes[key]
+	if ring == nil {
+		ring = &outcomeRing{}
+		h.outcomes[key] = ring
+	}
+	if len(ring.outcomes) < size {
+		ring.outcomes = append(ring.outcomes, outcome)
+		return
+	}
+	ring.outcomes[ring.next] = outcome
+	ring.next = (ring.next + 1) % len(ring.outcomes)
+}
+
+func (h *ReconcileHistory) forget(key types.NamespacedName) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.outcomes, key)
+}
+
+// Snapshot returns the recorded outcomes by namespace/name, oldest first.
+func (h *ReconcileHistory) Snapshot() map[string][]ReconcileOutcome {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snapshot := make(map[string][]ReconcileOutcome, len(h.outcomes))
+	for key, ring := range h.outcomes {
+		ordered := make([]ReconcileOutcome, 0, len(ring.outcomes))
+		ordered = append(ordered, ring.outcomes[ring.next:]...)
+		ordered = append(ordered, ring.outcomes[:ring.next]...)
+		snapshot[key.String()] = ordered
+	}
+	return snapshot
+}
+
+type reconcileOutcomeKey struct{}
+
+// withReconcileOutcome returns a context in which the reconcile notes its action and
+// entry ID.
+func withReconcileOutcome(ctx context.Context) (context.Context, *ReconcileOutcome) {
+	outcome := &ReconcileOutcome{Action: ReconcileActionSkip}
+	return context.WithValue(ctx, reconcileOutcomeKey{}, outcome), outcome
+}
+
+func noteReconcileAction(ctx context.Context, action, entryID string) {
+	if outcome, ok := ctx.Value(reconcileOutcomeKey{}).(*ReconcileOutcome); ok {
+		outcome.Action, outcome.EntryID = action, entryID
+	}
+}
+
+// recordOutcome completes outcome with the result of the reconcile and records it.
+func (h *ReconcileHistory) recordOutcome(key types.NamespacedName, outcome *ReconcileOutcome, result ctrl.Result, err error) {
+	if h == nil {
+		return
+	}
+	outcome.Time = time.Now().UTC()
+	switch {
+	case err != nil:
+		outcome.Result, outcome.Error = ReconcileResultError, err.Error()
+	case result.Requeue || result.RequeueAfter > 0:
+		outcome.Result = ReconcileResultRequeue
+	default:
+		outcome.Result = ReconcileResultSuccess
+	}
+	h.record(key, *outcome)
+}
+
+// DebugInfo is the body of the debug endpoint.
+type DebugInfo struct {
+	Config     map[string]string             `json:"config"`
+	Reconciles map[string][]ReconcileOutcome `json:"reconciles"`
+}
+
+// DebugHandler serves the effective configuration and the recent reconciles of each
+// ServiceAccount, so that a registration can be debugged without correlating logs.
+type DebugHandler struct {
+	// Token, when set, must be presented as "Authorization: Bearer".
+	Token *BearerToken
+
+	// Config is the effective configuration, with secrets redacted, see EffectiveConfig.
+	Config map[string]string
+
+	// History is the reconcile history of the ServiceAccountReconciler.
+	History *ReconcileHistory
+}
+
+// ServeHTTP writes the DebugInfo as JSON on GET.
+func (d *DebugHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeRequest(w, req, d.Token, ctrl.Log.WithName("debug")) {
+		return
+	}
+	info := DebugInfo{Config: d.Config, Reconciles: map[string][]ReconcileOutcome{}}
+	if d.History != nil {
+		info.Reconciles = d.History.Snapshot()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		ctrl.Log.WithName("debug").Error(err, "Failed to write debug info")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("The debug endpoint", func() {
+	get := func(d *DebugHandler, token string) (*httptest.ResponseRecorder, DebugInfo) {
+		req := httptest.NewRequest(http.MethodGet, DefaultDebugPath, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		var info DebugInfo
+		if rec.Code == http.StatusOK {
+			Expect(json.Unmarshal(rec.Body.Bytes(), &info)).To(Succeed())
+		}
+		return rec, info
+	}
+
+	It("should redact secrets from the configuration", func() {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("spire-api-token", "", "")
+		fs.String("debug-token", "", "")
+		fs.String("spire-api-servers", "", "")
+		Expect(fs.Parse([]string{"--spire-api-token=api-s3cret", "--debug-token=debug-s3cret",
+			"--spire-api-servers=https://spire:8443"})).To(Succeed())
+
+		rec, info := get(&DebugHandler{Config: EffectiveConfig(fs), Token: &BearerToken{Value: "debug-s3cret"}}, "debug-s3cret")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("api-s3cret"))
+		Expect(info.Config).To(HaveKeyWithValue("spire-api-token", "<redacted>"))
+		Expect(info.Config).To(HaveKeyWithValue("debug-token", "<redacted>"))
+		Expect(info.Config).To(HaveKeyWithValue("spire-api-servers", "https://spire:8443"))
+	})
+
+	It("should require the token when one is set", func() {
+		d := &DebugHandler{Token: &BearerToken{Value: "s3cret"}}
+		rec, _ := get(d, "")
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		rec, _ = get(d, "wrong")
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+
+		rec = httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, DefaultDebugPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should keep the last outcomes of each ServiceAccount, oldest first", func() {
+		history := &ReconcileHistory{Size: 3}
+		key := types.NamespacedName{Namespace: "default", Name: "app"}
+		for _, id := range []string{"1", "2", "3", "4", "5"} {
+			history.record(key, ReconcileOutcome{Action: ReconcileActionSync, EntryID: id})
+		}
+		_, info := get(&DebugHandler{History: history}, "")
+		Expect(info.Reconciles).To(HaveKey("default/app"))
+		var ids []string
+		for _, outcome := range info.Reconciles["default/app"] {
+			ids = append(ids, outcome.EntryID)
+		}
+		Expect(ids).To(Equal([]string{"3", "4", "5"}))
+
+		history.forget(key)
+		_, info = get(&DebugHandler{History: history}, "")
+		Expect(info.Reconciles).To(BeEmpty())
+	})
+
+	It("should record the action, result and entry ID of reconciles", func() {
+		server := newFakeSpireServer()
+		defer server.Close()
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(server.URL, sa)
+		r.History = &ReconcileHistory{}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+
+		outcomes := r.History.Snapshot()["default/app"]
+		Expect(outcomes).To(HaveLen(2))
+		Expect(outcomes[0].Action).To(Equal(ReconcileActionRegister))
+		Expect(outcomes[0].Result).To(Equal(ReconcileResultSuccess))
+		Expect(outcomes[0].EntryID).NotTo(BeEmpty())
+		Expect(outcomes[1].Action).To(Equal(ReconcileActionSync))
+		Expect(outcomes[1].EntryID).To(Equal(outcomes[0].EntryID))
+		Expect(outcomes[1].Time).NotTo(BeZero())
+	})
+
+	It("should record the error of a failed reconcile", func() {
+		history := &ReconcileHistory{}
+		key := types.NamespacedName{Namespace: "default", Name: "app"}
+		_, outcome := withReconcileOutcome(context.Background())
+		history.recordOutcome(key, outcome, ctrl.Result{}, errors.New("boom"))
+		Expect(history.Snapshot()["default/app"]).To(ConsistOf(And(
+			HaveField("Action", ReconcileActionSkip),
+			HaveField("Result", ReconcileResultError),
+			HaveField("Error", "boom"),
+		)))
+	})
+})
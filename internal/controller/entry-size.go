@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// ErrEntryTooLarge indicates an entry exceeds the SpireClient's MaxEntryBytes.
+var ErrEntryTooLarge = errors.New("SPIRE entry too large")
+
+// checkEntrySize fails with ErrEntryTooLarge when the marshaled payload of se exceeds
+// MaxEntryBytes, naming the largest field of the entry so that the error is
+// actionable, rather than leaving the SPIRE server to reject the request.
+func (c *SpireClient) checkEntrySize(se SpireEntry, payload []byte) error {
+	if c.MaxEntryBytes <= 0 || len(payload) <= c.MaxEntryBytes {
+		return nil
+	}
+	field, size := largestEntryField(se)
+	return fmt.Errorf("%w: payload of %s/%s is %d bytes, exceeding the limit of %d bytes; its largest field is %s (%d bytes)",
+		ErrEntryTooLarge, se.Namespace, se.ServiceAccount, len(payload), c.MaxEntryBytes, field, size)
+}
+
+// largestEntryField returns the JSON name and marshaled size of the variable-size
+// field of se taking the most space.
+func largestEntryField(se SpireEntry) (string, int) {
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"kubeConfig", se.KubeConfig},
+		{"dnsNames", se.DnsNames},
+		{"selectors", se.Selectors},
+		{"federatesWith", se.FederatesWith},
+		{"hint", se.Hint},
+	}
+	largest, largestSize := "", -1
+	for _, f := range fields {
+		data, _ := json.Marshal(f.value)
+		if len(data) > largestSize {
+			largest, largestSize = f.name, len(data)
+		}
+	}
+	return largest, largestSize
+}
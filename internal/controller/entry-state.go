@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	DefaultEntryStateConfigMap = "spire-registrar-entries"
+	DefaultEntryStateNamespace = "spire-registrar-system"
+)
+
+var _ manager.LeaderElectionRunnable = &EntryStateStore{}
+
+// EntryStateStore keeps a durable record of the SPIRE entries created for each
+// ServiceAccount in a controller-owned ConfigMap. The record is written right after
+// an entry is created, before the ServiceAccount is annotated, so that a crash in
+// between does not lose the entry ID and register a duplicate on retry.
+//
+// Keys are "<namespace>.<name>"; namespaces cannot contain dots, so keys are unique.
+// At roughly 100 bytes per record, the ConfigMap size limit allows about 10,000 entries.
+//
+// Unlike the SpireRegistrations, the ConfigMap has no owner reference: it is shared by
+// ServiceAccounts of every namespace, and owners must be in its namespace. Records of
+// deleted ServiceAccounts are pruned by Start instead.
+type EntryStateStore struct {
+	Client    client.Client
+	Namespace string
+	Name      string
+
+	// Managed selects the ServiceAccounts whose state is kept when pruning.
+	Managed ManagedSelector
+}
+
+// entryState is a record of the store.
+type entryState struct {
+	EntryID string    `json:"entryID"`
+	UID     types.UID `json:"uid,omitempty"` // UID of the ServiceAccount, so that a recreated SA does not reuse the entry
+}
+
+func entryStateKey(sa types.NamespacedName) string {
+	return sa.Namespace + "." + sa.Name
+}
+
+// Lookup returns the entry ID recorded for the ServiceAccount, if any.
+func (s *EntryStateStore) Lookup(ctx context.Context, sa *corev1.ServiceAccount) (string, bool, error) {
+	cm := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, cm); err != nil {
+		return "", false, client.IgnoreNotFound(err)
+	}
+	value, exists := cm.Data[entryStateKey(client.ObjectKeyFromObject(sa))]
+	if !exists {
+		return "", false, nil
+	}
+	var state entryState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return "", false, fmt.Errorf("invalid entry state for ServiceAccount %s/%s: %w", sa.Namespace, sa.Name, err)
+	}
+	if state.EntryID == "" || (state.UID != "" && state.UID != sa.UID) {
+		return "", false, nil
+	}
+	return state.EntryID, true, nil
+}
+
+// Record stores the entry ID created for the ServiceAccount.
+func (s *EntryStateStore) Record(ctx context.Context, sa *corev1.ServiceAccount, id entryID) error {
+	value, err := json.Marshal(entryState{EntryID: string(id), UID: sa.UID})
+	if err != nil {
+		return err
+	}
+	key := entryStateKey(client.ObjectKeyFromObject(sa))
+	return s.update(ctx, func(data map[string]string) { data[key] = string(value) })
+}
+
+// Forget removes the records of the given ServiceAccounts.
+func (s *EntryStateStore) Forget(ctx context.Context, sas ...types.NamespacedName) error {
+	return s.update(ctx, func(data map[string]string) {
+		for _, sa := range sas {
+			delete(data, entryStateKey(sa))
+		}
+	})
+}
+
+// update applies mutate to the ConfigMap data, creating the ConfigMap when missing
+// and retrying on conflicting writes of other workers.
+func (s *EntryStateStore) update(ctx context.Context, mutate func(map[string]string)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		err := s.Client.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, cm)
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.Namespace, Name: s.Name},
+				Data:       map[string]string{},
+			}
+			mutate(cm.Data)
+			err = s.Client.Create(ctx, cm)
+			if apierrors.IsAlreadyExists(err) {
+				// Lost the race to create it; retry as an update.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+		return s.Client.Update(ctx, cm)
+	})
+}
+
+// StateMigration counts the outcome of EntryStateStore.Migrate.
+type StateMigration struct {
+	// Migrated records were written, Unchanged were already recorded.
+	Migrated  int
+	Unchanged int
+	// Unannotated ServiceAccounts had their entry ID annotation removed.
+	Unannotated int
+}
+
+// Migrate records the entry IDs annotated on the managed ServiceAccounts, e.g. when
+// the store is first enabled for ServiceAccounts registered without it. All records
+// are written in a single update. Records already matching the annotation are left
+// alone, so Migrate can safely be run again. With removeAnnotations, the annotations
+// are removed once recorded; the controller recovers them from the store.
+func (s *EntryStateStore) Migrate(ctx context.Context, removeAnnotations bool) (StateMigration, error) {
+	var result StateMigration
+	saList := &corev1.ServiceAccountList{}
+	if err := s.Client.List(ctx, saList); err != nil {
+		return result, err
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, cm); client.IgnoreNotFound(err) != nil {
+		return result, err
+	}
+
+	records := map[string]string{}
+	var annotated []*corev1.ServiceAccount
+	for i := range saList.Items {
+		sa := &saList.Items[i]
+		id := sa.Annotations[SVIDEntryIDAnnotation]
+		if id == "" || !s.Managed.Matches(sa) || sa.DeletionTimestamp != nil {
+			continue
+		}
+		annotated = append(annotated, sa)
+		key := entryStateKey(client.ObjectKeyFromObject(sa))
+		var recorded entryState
+		if json.Unmarshal([]byte(cm.Data[key]), &recorded) == nil && recorded.EntryID == id && recorded.UID == sa.UID {
+			result.Unchanged++
+			continue
+		}
+		value, err := json.Marshal(entryState{EntryID: id, UID: sa.UID})
+		if err != nil {
+			return result, err
+		}
+		records[key] = string(value)
+	}
+	if len(records) > 0 {
+		if err := s.update(ctx, func(data map[string]string) {
+			for key, value := range records {
+				data[key] = value
+			}
+		}); err != nil {
+			return result, fmt.Errorf("recording entry state: %w", err)
+		}
+		result.Migrated = len(records)
+	}
+
+	if !removeAnnotations {
+		return result, nil
+	}
+	for _, sa := range annotated {
+		patch := client.MergeFrom(sa.DeepCopy())
+		delete(sa.Annotations, SVIDEntryIDAnnotation)
+		if err := s.Client.Patch(ctx, sa, patch); err != nil {
+			return result, fmt.Errorf("removing entry ID annotation of ServiceAccount %s/%s: %w", sa.Namespace, sa.Name, err)
+		}
+		result.Unannotated++
+	}
+	return result, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that replicas
+// that are not the leader do not prune the records concurrently.
+func (s *EntryStateStore) NeedLeaderElection() bool {
+	return true
+}
+
+// Start prunes the records of ServiceAccounts that are gone, were recreated or are no
+// longer managed. Their entries are left to the orphaned entry cleanup. Records of
+// existing ServiceAccounts are recovered by the initial reconcile of each one.
+// It implements manager.Runnable.
+func (s *EntryStateStore) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("entry-state")
+
+	cm := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		logger.Error(err, "Failed to read entry state", "namespace", s.Namespace, "name", s.Name)
+		return nil
+	}
+
+	var stale []types.NamespacedName
+	for key, value := range cm.Data {
+		namespace, name, ok := strings.Cut(key, ".")
+		if !ok {
+			continue
+		}
+		saKey := types.NamespacedName{Namespace: namespace, Name: name}
+		var state entryState
+		_ = json.Unmarshal([]byte(value), &state)
+
+		sa := &corev1.ServiceAccount{}
+		err := s.Client.Get(ctx, saKey, sa)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			logger.Error(err, "Failed to get ServiceAccount of entry state", "namespace", namespace, "name", name)
+			continue
+		case s.Managed.Matches(sa) && (state.UID == "" || state.UID == sa.UID):
+			continue
+		}
+		logger.Info("Pruning stale entry state", "namespace", namespace, "name", name, "entryID", state.EntryID)
+		stale = append(stale, saKey)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if err := s.Forget(ctx, stale...); err != nil {
+		logger.Error(err, "Failed to prune stale entry state")
+	}
+	return nil
+}
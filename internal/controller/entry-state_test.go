@@ -0,0 +1,183 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("SPIRE entry state", func() {
+	var (
+		adds, calls atomic.Int64
+		server      *httptest.Server
+	)
+
+	BeforeEach(func() {
+		adds.Store(0)
+		calls.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			if req.URL.Path == "/v1/entries/add" {
+				adds.Add(1)
+			}
+			_, _ = w.Write([]byte(`{"entryID":"entry-new"}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newStateReconciler := func(objs ...client.Object) *ServiceAccountReconciler {
+		r := newTestReconciler(server.URL, objs...)
+		r.EntryState = &EntryStateStore{Client: r.Client, Namespace: DefaultEntryStateNamespace, Name: DefaultEntryStateConfigMap}
+		return r
+	}
+
+	It("should record created entries and forget them on deletion", func() {
+		sa := newManagedServiceAccount("app", "default")
+		sa.UID = "uid-1"
+		r := newStateReconciler(sa)
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		id, found, err := r.EntryState.Lookup(context.Background(), sa)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(id).To(Equal("entry-new"))
+
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(r.Delete(context.Background(), sa)).To(Succeed())
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		_, found, err = r.EntryState.Lookup(context.Background(), sa)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("should recover an entry ID lost before the ServiceAccount was annotated", func() {
+		sa := newManagedServiceAccount("app", "default")
+		sa.UID = "uid-1"
+		r := newStateReconciler(sa)
+		Expect(r.EntryState.Record(context.Background(), sa, "entry-before-crash")).To(Succeed())
+
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+		Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+		Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		Expect(sa.Annotations).To(HaveKey(EntryHashAnnotation))
+	})
+
+	It("should not reuse the entry of a recreated ServiceAccount", func() {
+		sa := newManagedServiceAccount("app", "default")
+		sa.UID = "uid-2"
+		r := newStateReconciler(sa)
+		old := sa.DeepCopy()
+		old.UID = "uid-1"
+		Expect(r.EntryState.Record(context.Background(), old, "entry-of-old-sa")).To(Succeed())
+
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adds.Load()).To(BeEquivalentTo(1))
+		Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-new"))
+	})
+
+	It("should prune the records of ServiceAccounts that are gone on start", func() {
+		kept := newManagedServiceAccount("kept", "default")
+		r := newStateReconciler(kept)
+		gone := newManagedServiceAccount("gone", "default")
+		Expect(r.EntryState.Record(context.Background(), kept, "entry-kept")).To(Succeed())
+		Expect(r.EntryState.Record(context.Background(), gone, "entry-gone")).To(Succeed())
+
+		Expect(r.EntryState.Start(context.Background())).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: DefaultEntryStateNamespace, Name: DefaultEntryStateConfigMap}, cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKey("default.kept"))
+		Expect(cm.Data).NotTo(HaveKey("default.gone"))
+	})
+
+	It("should migrate the annotated entry IDs of managed ServiceAccounts idempotently", func() {
+		annotated := func(name, id string) *corev1.ServiceAccount {
+			sa := newManagedServiceAccount(name, "default")
+			sa.UID = types.UID("uid-" + name)
+			sa.Annotations[SVIDEntryIDAnnotation] = id
+			sa.Annotations[SpireServerAnnotation] = "https://spire-b:8081"
+			return sa
+		}
+		unmanaged := annotated("unmanaged", "entry-unmanaged")
+		delete(unmanaged.Annotations, ManagedSpireAnnotation)
+		unregistered := newManagedServiceAccount("unregistered", "default")
+		r := newStateReconciler(annotated("web", "entry-web"), annotated("db", "entry-db"), unmanaged, unregistered)
+		Expect(r.EntryState.Record(context.Background(), annotated("db", "entry-db"), "entry-db")).To(Succeed())
+
+		result, err := r.EntryState.Migrate(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(StateMigration{Migrated: 1, Unchanged: 1}))
+		for _, name := range []string{"web", "db"} {
+			id, found, err := r.EntryState.Lookup(context.Background(), annotated(name, ""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(id).To(Equal("entry-" + name))
+		}
+		cm := &corev1.ConfigMap{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: DefaultEntryStateNamespace, Name: DefaultEntryStateConfigMap}, cm)).To(Succeed())
+		Expect(cm.Data).To(HaveLen(2))
+
+		result, err = r.EntryState.Migrate(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(StateMigration{Unchanged: 2, Unannotated: 2}))
+		sa := &corev1.ServiceAccount{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web"}, sa)).To(Succeed())
+		Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "unmanaged"}, sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKey(SVIDEntryIDAnnotation))
+
+		// The controller uses the recorded entry ID without registering or updating the
+		// entry again, and leaves the removed annotation out.
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "web"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web"}, sa)).To(Succeed())
+		Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		Expect(sa.Annotations).To(HaveKeyWithValue(SpireServerAnnotation, "https://spire-b:8081"))
+
+		// Its deletion removes the recorded entry.
+		Expect(r.Delete(context.Background(), sa)).To(Succeed())
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "web"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeEquivalentTo(1))
+		_, found, err := r.EntryState.Lookup(context.Background(), annotated("web", ""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// KubeConfigEncodingBase64 sends the kubeconfig base64-encoded, the default.
+	KubeConfigEncodingBase64 = "base64"
+	// KubeConfigEncodingRaw sends the kubeconfig YAML as is.
+	KubeConfigEncodingRaw = "raw"
+	// KubeConfigEncodingGzip marks a KubeConfig field holding the base64 of the
+	// gzip-compressed kubeconfig rather than the base64 of the kubeconfig itself.
+	KubeConfigEncodingGzip = "gzip"
+
+	// recentEntryWindow is the number of last sent entries over which those without
+	// a kubeconfig are counted.
+	recentEntryWindow = 100
+)
+
+// KubeConfigSecrets maps cluster names to the Secret holding the kubeconfig sent with
+// the SPIRE entries of that cluster, for a registrar registering workloads of several
+// clusters with a central SPIRE server. When empty, every entry carries the admin
+// kubeconfig of kube-system/admin-kubeconfig.
+type KubeConfigSecrets map[string]types.NamespacedName
+
+// Set maps cluster to secret, given as namespace/name.
+func (s KubeConfigSecrets) Set(cluster, secret string) error {
+	if cluster == "" {
+		return fmt.Errorf("missing cluster name for kubeconfig Secret %q", secret)
+	}
+	namespace, name, ok := strings.Cut(secret, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("kubeconfig Secret of cluster %s must be namespace/name, got %q", cluster, secret)
+	}
+	s[cluster] = types.NamespacedName{Namespace: namespace, Name: name}
+	return nil
+}
+
+// secretFor returns the kubeconfig Secret of cluster. Once any cluster is mapped, a
+// cluster without a mapping is an error rather than silently getting the admin
+// kubeconfig of the cluster the registrar runs in.
+func (s KubeConfigSecrets) secretFor(cluster string) (types.NamespacedName, error) {
+	if len(s) == 0 {
+		return types.NamespacedName{Namespace: "kube-system", Name: AdminKubeConfigSecret}, nil
+	}
+	secret, ok := s[cluster]
+	if !ok {
+		return types.NamespacedName{}, fmt.Errorf("no kubeconfig Secret configured for cluster %q; "+
+			"map it with --cluster-kubeconfig-secret", cluster)
+	}
+	return secret, nil
+}
+
+// entryKubeConfig returns the base64-encoded kubeconfig for an entry of cluster. A
+// missing or invalid kubeconfig is counted; unless required, the entry is then
+// sent without one. A cluster without a configured Secret always fails.
+func entryKubeConfig(ctx context.Context, c client.Reader, cache *kubeConfigCache, secrets KubeConfigSecrets, cluster string, required bool) (string, error) {
+	secret, err := secrets.secretFor(cluster)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig, err := readKubeConfig(ctx, c, secret, cache)
+	if err == nil {
+		return kubeConfig, nil
+	}
+	kubeConfigMissing.WithLabelValues(secret.Namespace, secret.Name).Inc()
+	if required {
+		return "", err
+	}
+	log.FromContext(ctx).Error(err, "Failed to get kubeconfig. defaulting to empty string", "cluster", cluster)
+	return "", nil
+}
+
+// recentEntries remembers whether each of the last sent entries lacked a kubeconfig.
+type recentEntries struct {
+	mu      sync.Mutex
+	missing [recentEntryWindow]bool
+	next    int
+	count   int
+}
+
+// sentEntries tracks the entries sent by all SpireClients.
+var sentEntries recentEntries
+
+// record adds a sent entry and returns how many of the recent ones lacked a kubeconfig.
+func (r *recentEntries) record(missing bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.missing[r.next] {
+		r.count--
+	}
+	r.missing[r.next] = missing
+	if missing {
+		r.count++
+	}
+	r.next = (r.next + 1) % len(r.missing)
+	return r.count
+}
+
+// validateKubeConfig checks that data parses as a kubeconfig naming at least one cluster.
+func validateKubeConfig(data []byte) error {
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	if len(cfg.Clusters) == 0 {
+		return fmt.Errorf("invalid kubeconfig: no clusters defined")
+	}
+	return nil
+}
+
+// kubeConfigCache remembers the encoded kubeconfig of each Secret as of its last
+// validation. The Secret itself is read from the manager's cache on every render, so
+// that a rotated kubeconfig is picked up, but an unchanged one is neither parsed nor
+// encoded again by the reconciles of up-to-date entries.
+type kubeConfigCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]cachedKubeConfig
+}
+
+type cachedKubeConfig struct {
+	data    []byte
+	encoded string
+}
+
+// lookup returns the encoded kubeconfig of secret if its data is still data. A nil
+// cache holds nothing.
+func (k *kubeConfigCache) lookup(secret types.NamespacedName, data []byte) (string, bool) {
+	if k == nil {
+		return "", false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cached, ok := k.entries[secret]
+	if !ok || !bytes.Equal(cached.data, data) {
+		return "", false
+	}
+	return cached.encoded, true
+}
+
+func (k *kubeConfigCache) store(secret types.NamespacedName, data []byte, encoded string) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.entries == nil {
+		k.entries = map[types.NamespacedName]cachedKubeConfig{}
+	}
+	k.entries[secret] = cachedKubeConfig{data: bytes.Clone(data), encoded: encoded}
+}
+
+// compressKubeConfig gzips the base64-encoded kubeconfig, returning it base64-encoded.
+// The output is deterministic, so the entry hash only changes with the kubeconfig.
+func compressKubeConfig(encoded string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubeconfig encoding: %w", err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decompressKubeConfig reverses compressKubeConfig.
+func decompressKubeConfig(compressed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(compressed)
+	if err != nil {
+		return "", fmt.Errorf("invalid compressed kubeconfig encoding: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// wireEntry returns se as it is sent to the SPIRE API. Entries carry the kubeconfig
+// base64-encoded; it is compressed when CompressKubeConfig is set, which always keeps
+// it base64-encoded, and otherwise decoded when KubeConfigEncoding is raw. With
+// OmitKubeConfig, entries carry no kubeconfig and are not counted as missing one.
+func (c *SpireClient) wireEntry(se SpireEntry) (SpireEntry, error) {
+	if c.OmitKubeConfig {
+		se.KubeConfig, se.KubeConfigEncoding = "", ""
+		return se, nil
+	}
+	recent := sentEntries.record(se.KubeConfig == "")
+	recentEntriesWithoutKubeConfig.WithLabelValues("kube-system", AdminKubeConfigSecret).Set(float64(recent))
+	if se.KubeConfig == "" {
+		return se, nil
+	}
+	switch {
+	case c.CompressKubeConfig:
+		compressed, err := compressKubeConfig(se.KubeConfig)
+		if err != nil {
+			return SpireEntry{}, err
+		}
+		se.KubeConfig = compressed
+		se.KubeConfigEncoding = KubeConfigEncodingGzip
+	case c.KubeConfigEncoding == KubeConfigEncodingRaw:
+		raw, err := base64.StdEncoding.DecodeString(se.KubeConfig)
+		if err != nil {
+			return SpireEntry{}, fmt.Errorf("invalid kubeconfig encoding: %w", err)
+		}
+		se.KubeConfig = string(raw)
+	}
+	return se, nil
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Kubeconfig compression", func() {
+	kubeConfig := base64.StdEncoding.EncodeToString([]byte("apiVersion: v1\nkind: Config\nclusters:\n" +
+		strings.Repeat("- cluster:\n    server: https://api.example.com:6443\n  name: example\n", 200)))
+
+	It("should round-trip the kubeconfig", func() {
+		compressed, err := compressKubeConfig(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(compressed)).To(BeNumerically("<", len(kubeConfig)/4))
+
+		again, err := compressKubeConfig(kubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(compressed), "compression should be deterministic")
+
+		decompressed, err := decompressKubeConfig(compressed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decompressed).To(Equal(kubeConfig))
+	})
+
+	It("should send the compressed kubeconfig only when enabled", func() {
+		var sent []SpireEntry
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			var se SpireEntry
+			Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+			sent = append(sent, se)
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		defer server.Close()
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		se := SpireEntry{ServiceAccount: "app", Namespace: "default", KubeConfig: kubeConfig}
+		_, err := c.AddEntry(context.Background(), se)
+		Expect(err).NotTo(HaveOccurred())
+		c.CompressKubeConfig = true
+		_, err = c.AddEntry(context.Background(), se)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sent).To(HaveLen(2))
+		Expect(sent[0].KubeConfig).To(Equal(kubeConfig))
+		Expect(sent[0].KubeConfigEncoding).To(BeEmpty())
+		Expect(sent[1].KubeConfigEncoding).To(Equal(KubeConfigEncodingGzip))
+		decompressed, err := decompressKubeConfig(sent[1].KubeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decompressed).To(Equal(kubeConfig))
+	})
+
+	Context("When choosing the kubeconfig wire format", func() {
+		var sent []SpireEntry
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			sent = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				sent = append(sent, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		DescribeTable("should send the kubeconfig of the admin Secret",
+			func(encoding string, decode func(string) string) {
+				r := newTestReconciler(server.URL)
+				r.SpireClient.KubeConfigEncoding = encoding
+				_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(HaveLen(1))
+				Expect(sent[0].KubeConfigEncoding).To(BeEmpty())
+				Expect(decode(sent[0].KubeConfig)).To(Equal(testKubeConfig))
+			},
+			Entry("base64 by default", "", func(s string) string {
+				raw, err := base64.StdEncoding.DecodeString(s)
+				Expect(err).NotTo(HaveOccurred())
+				return string(raw)
+			}),
+			Entry("base64", KubeConfigEncodingBase64, func(s string) string {
+				raw, err := base64.StdEncoding.DecodeString(s)
+				Expect(err).NotTo(HaveOccurred())
+				return string(raw)
+			}),
+			Entry("raw", KubeConfigEncodingRaw, func(s string) string { return s }),
+		)
+
+		It("should only validate the kubeconfig again once its Secret changes", func() {
+			r := newTestReconciler(server.URL)
+			var reads int
+			ctx := log.IntoContext(context.Background(), funcr.New(func(prefix, args string) {
+				if strings.Contains(args, "Getting kubeconfig from Secret") {
+					reads++
+				}
+			}, funcr.Options{}))
+			for i := 0; i < 3; i++ {
+				kubeConfig, err := r.GetKubeConfig(ctx, "test-cluster")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(kubeConfig).To(Equal(base64.StdEncoding.EncodeToString([]byte(testKubeConfig))))
+			}
+			Expect(reads).To(Equal(1))
+
+			secret := &corev1.Secret{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "kube-system", Name: AdminKubeConfigSecret}, secret)).To(Succeed())
+			secret.Data["kubeconfig"] = []byte(testKubeConfig + "\n# rotated\n")
+			Expect(r.Update(context.Background(), secret)).To(Succeed())
+			kubeConfig, err := r.GetKubeConfig(ctx, "test-cluster")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kubeConfig).To(Equal(base64.StdEncoding.EncodeToString(secret.Data["kubeconfig"])))
+			Expect(reads).To(Equal(2))
+		})
+
+		It("should not send a Secret that is not a kubeconfig", func() {
+			r := newTestReconciler(server.URL)
+			secret := &corev1.Secret{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "kube-system", Name: AdminKubeConfigSecret}, secret)).To(Succeed())
+			secret.Data["kubeconfig"] = []byte("not: [a kubeconfig")
+			Expect(r.Update(context.Background(), secret)).To(Succeed())
+
+			_, err := r.GetKubeConfig(context.Background(), "test-cluster")
+			Expect(err).To(MatchError(ContainSubstring("invalid kubeconfig")))
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent[0].KubeConfig).To(BeEmpty())
+		})
+
+		It("should count entries sent without a kubeconfig and fail them when required", func() {
+			r := newTestReconciler(server.URL)
+			secret := &corev1.Secret{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "kube-system", Name: AdminKubeConfigSecret}, secret)).To(Succeed())
+			Expect(r.Delete(context.Background(), secret)).To(Succeed())
+			missing := kubeConfigMissing.WithLabelValues("kube-system", AdminKubeConfigSecret)
+			before := testutil.ToFloat64(missing)
+
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent[0].KubeConfig).To(BeEmpty())
+			Expect(testutil.ToFloat64(missing)).To(Equal(before + 1))
+			Expect(testutil.ToFloat64(recentEntriesWithoutKubeConfig.WithLabelValues("kube-system", AdminKubeConfigSecret))).
+				To(BeNumerically(">=", 1))
+
+			r.RequireKubeConfig = true
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(HaveOccurred())
+			Expect(sent).To(HaveLen(1))
+			Expect(testutil.ToFloat64(missing)).To(Equal(before + 2))
+		})
+	})
+
+	It("should leave the kubeconfig field out without reading the Secret when omitted", func() {
+		var payloads []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			var payload map[string]any
+			Expect(json.NewDecoder(req.Body).Decode(&payload)).To(Succeed())
+			payloads = append(payloads, payload)
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL)
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "kube-system", Name: AdminKubeConfigSecret}, secret)).To(Succeed())
+		Expect(r.Delete(context.Background(), secret)).To(Succeed())
+		missing := kubeConfigMissing.WithLabelValues("kube-system", AdminKubeConfigSecret)
+		before := testutil.ToFloat64(missing)
+		r.RequireKubeConfig = true
+		r.SpireClient.OmitKubeConfig, r.SpireClient.CompressKubeConfig = true, true
+
+		_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payloads).To(HaveLen(1))
+		Expect(payloads[0]).To(HaveKeyWithValue("serviceAccount", "app"))
+		Expect(payloads[0]).NotTo(HaveKey("kubeConfig"))
+		Expect(payloads[0]).NotTo(HaveKey("kubeConfigEncoding"))
+		Expect(testutil.ToFloat64(missing)).To(Equal(before), "the kubeconfig Secret was read")
+	})
+
+	Context("When registering the clusters of several kubeconfigs", func() {
+		var sent []SpireEntry
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			sent = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				sent = append(sent, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should parse the Secret of a cluster", func() {
+			secrets := KubeConfigSecrets{}
+			Expect(secrets.Set("edge", "clusters/edge-kubeconfig")).To(Succeed())
+			Expect(secrets).To(HaveKeyWithValue("edge", types.NamespacedName{Namespace: "clusters", Name: "edge-kubeconfig"}))
+			Expect(secrets.Set("edge", "edge-kubeconfig")).To(MatchError(ContainSubstring("namespace/name")))
+			Expect(secrets.Set("edge", "clusters/")).To(HaveOccurred())
+			Expect(secrets.Set("edge", "a/b/c")).To(HaveOccurred())
+			Expect(secrets.Set("", "clusters/edge-kubeconfig")).To(HaveOccurred())
+		})
+
+		It("should resolve the admin Secret when no cluster is mapped", func() {
+			secret, err := KubeConfigSecrets{}.secretFor("any-cluster")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret).To(Equal(types.NamespacedName{Namespace: "kube-system", Name: AdminKubeConfigSecret}))
+		})
+
+		It("should send the kubeconfig of the cluster of the entry", func() {
+			edgeKubeConfig := strings.Replace(testKubeConfig, "test-cluster", "edge", -1)
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[ClusterNameAnnotation] = "edge"
+			r := newTestReconciler(server.URL, sa, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "clusters", Name: "edge-kubeconfig"},
+				Data:       map[string][]byte{"kubeconfig": []byte(edgeKubeConfig)},
+			})
+			r.KubeConfigSecrets = KubeConfigSecrets{}
+			Expect(r.KubeConfigSecrets.Set("test-cluster", "kube-system/"+AdminKubeConfigSecret)).To(Succeed())
+			Expect(r.KubeConfigSecrets.Set("edge", "clusters/edge-kubeconfig")).To(Succeed())
+
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("local", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(HaveLen(2))
+			raw, err := base64.StdEncoding.DecodeString(sent[0].KubeConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(raw)).To(Equal(testKubeConfig))
+			Expect(sent[1].Cluster).To(Equal("edge"))
+			raw, err = base64.StdEncoding.DecodeString(sent[1].KubeConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(raw)).To(Equal(edgeKubeConfig))
+		})
+
+		It("should fail entries of a cluster without a kubeconfig Secret", func() {
+			r := newTestReconciler(server.URL)
+			r.KubeConfigSecrets = KubeConfigSecrets{}
+			Expect(r.KubeConfigSecrets.Set("edge", "clusters/edge-kubeconfig")).To(Succeed())
+
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(MatchError(ContainSubstring(`no kubeconfig Secret configured for cluster "test-cluster"`)))
+			_, err = r.GetKubeConfig(context.Background(), "test-cluster")
+			Expect(err).To(HaveOccurred())
+			Expect(sent).To(BeEmpty())
+		})
+	})
+
+	Context("When tracking recent entries", func() {
+		It("should only count the entries within the window", func() {
+			var recent recentEntries
+			for i := 0; i < 10; i++ {
+				Expect(recent.record(true)).To(Equal(i + 1))
+			}
+			for i := 0; i < recentEntryWindow-10; i++ {
+				recent.record(false)
+			}
+			Expect(recent.record(false)).To(Equal(9), "the oldest entry without a kubeconfig left the window")
+			for i := 0; i < recentEntryWindow; i++ {
+				recent.record(false)
+			}
+			Expect(recent.record(false)).To(BeZero())
+		})
+	})
+
+	It("should fail an entry with an oversized kubeconfig before sending it", func() {
+		var requests atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL)
+		r.SpireClient.MaxEntryBytes = 256
+		sa := newManagedServiceAccount("app", "default")
+		_, err := r.CreateEntry(context.Background(), sa)
+		Expect(err).To(MatchError(ErrEntryTooLarge))
+		Expect(err).To(MatchError(ContainSubstring("largest field is kubeConfig")))
+		Expect(requests.Load()).To(BeZero())
+
+		r.SpireClient.MaxEntryBytes = 64 << 10
+		_, err = r.CreateEntry(context.Background(), sa)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+	})
+})
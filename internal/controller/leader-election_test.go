@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// fakeLock is a resourcelock.Interface that is either free, so that it is acquired
+// at once, or held by another replica with a lease that never expires.
+type fakeLock struct {
+	heldByOther bool
+}
+
+func (l *fakeLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	if !l.heldByOther {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "leases"}, "spire-registrar")
+	}
+	return &resourcelock.LeaderElectionRecord{
+		HolderIdentity:       "other-replica",
+		LeaseDurationSeconds: 3600,
+		AcquireTime:          metav1.Now(),
+		RenewTime:            metav1.Now(),
+	}, []byte("other-replica"), nil
+}
+
+func (l *fakeLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return nil
+}
+
+func (l *fakeLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return nil
+}
+
+func (l *fakeLock) RecordEvent(string) {}
+
+func (l *fakeLock) Identity() string { return "this-replica" }
+
+func (l *fakeLock) Describe() string { return "fake lock" }
+
+var _ = Describe("Leader election of the periodic loops", func() {
+	// startLoops runs an orphan cleanup and an audit every few milliseconds in a
+	// manager holding lock, and returns the number of SPIRE API calls they make.
+	startLoops := func(lock *fakeLock) *atomic.Int32 {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			_, _ = w.Write([]byte(`{"entries":[]}`))
+		}))
+		DeferCleanup(server.Close)
+
+		mgr, err := ctrl.NewManager(&rest.Config{Host: "http://127.0.0.1:0"}, ctrl.Options{
+			Metrics:                             metricsserver.Options{BindAddress: "0"},
+			HealthProbeBindAddress:              "0",
+			LeaderElection:                      true,
+			LeaderElectionResourceLockInterface: lock,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		r := newTestReconciler(server.URL, newManagedServiceAccount("app", "default"))
+		Expect(mgr.Add(&OrphanCleaner{Client: r.Client, SpireClient: r.SpireClient, Interval: 10 * time.Millisecond})).To(Succeed())
+		Expect(mgr.Add(&EntryAuditor{Reconciler: r, Interval: 10 * time.Millisecond})).To(Succeed())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+		return &calls
+	}
+
+	It("should run the loops on the leader", func() {
+		calls := startLoops(&fakeLock{})
+		Eventually(calls.Load).Should(BeNumerically(">=", 2))
+	})
+
+	It("should not run the loops on a replica that is not the leader", func() {
+		calls := startLoops(&fakeLock{heldByOther: true})
+		Consistently(calls.Load, 300*time.Millisecond).Should(BeZero())
+	})
+})
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultFailureLogInterval is how often a repeated identical failure of a
+// ServiceAccount is logged.
+const DefaultFailureLogInterval = time.Minute
+
+// logThrottle collapses repeated identical failures of an object into periodic
+// summaries, so that an outage retried on every requeue does not flood the logs. The
+// first occurrence of a failure is always logged right away; the same failure of the
+// same object is then only counted until the interval has passed, and logged along
+// with the number of occurrences suppressed in between.
+type logThrottle struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]map[string]*throttledFailure
+
+	// now is the clock of the throttle. When nil, time.Now is used.
+	now func() time.Time
+}
+
+type throttledFailure struct {
+	logged     time.Time
+	last       time.Time
+	suppressed int
+}
+
+// error logs err for key unless the same error of key was logged less than interval
+// ago. An interval of zero or less logs every failure.
+func (t *logThrottle) error(logger logr.Logger, interval time.Duration, key types.NamespacedName, err error, msg string, keysAndValues ...interface{}) {
+	if interval <= 0 {
+		logger.Error(err, msg, keysAndValues...)
+		return
+	}
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures == nil {
+		t.failures = map[types.NamespacedName]map[string]*throttledFailure{}
+	}
+	if t.failures[key] == nil {
+		t.failures[key] = map[string]*throttledFailure{}
+	}
+	ts := now()
+	message := err.Error()
+	failure := t.failures[key][message]
+	// A failure not seen for a while, e.g. because the object was deleted in
+	// between, starts over.
+	if failure == nil || ts.Sub(failure.last) > 2*interval {
+		t.failures[key][message] = &throttledFailure{logged: ts, last: ts}
+		logger.Error(err, msg, keysAndValues...)
+		return
+	}
+	failure.last = ts
+	if ts.Sub(failure.logged) < interval {
+		failure.suppressed++
+		return
+	}
+	if failure.suppressed > 0 {
+		keysAndValues = append(keysAndValues, "repeated", failure.suppressed+1, "since", failure.logged.Format(time.RFC3339))
+	}
+	logger.Error(err, msg, keysAndValues...)
+	failure.logged, failure.suppressed = ts, 0
+}
+
+// reset forgets the failures of key, logging how many occurrences went unreported.
+func (t *logThrottle) reset(logger logr.Logger, key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for message, failure := range t.failures[key] {
+		if failure.suppressed > 0 {
+			logger.Info("Recovered from repeated failure", "namespace", key.Namespace, "name", key.Name,
+				"error", message, "unreported", failure.suppressed)
+		}
+	}
+	delete(t.failures, key)
+}
+
+// logFailure logs a failed SPIRE sync of sa, collapsing repeated identical failures
+// per FailureLogInterval.
+func (r *ServiceAccountReconciler) logFailure(ctx context.Context, sa *corev1.ServiceAccount, err error, msg string) {
+	r.failureLog.error(log.FromContext(ctx), r.FailureLogInterval, client.ObjectKeyFromObject(sa), err, msg, "name", sa.Name)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ManagedSelector selects the ServiceAccounts the controller registers. The
+// ManagedSpireAnnotation takes precedence when present: "true" selects the
+// ServiceAccount and any other value deselects it, whatever its labels. Without the
+// annotation, a ServiceAccount is selected when its Label has the value Value. The
+// zero ManagedSelector only honours the annotation.
+type ManagedSelector struct {
+	Label string
+	Value string
+}
+
+// ParseManagedLabel parses a key=value label selecting managed ServiceAccounts. A
+// bare key selects the value "true".
+func ParseManagedLabel(value string) (ManagedSelector, error) {
+	if value == "" {
+		return ManagedSelector{}, nil
+	}
+	key, labelValue, ok := strings.Cut(value, "=")
+	if !ok {
+		labelValue = "true"
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return ManagedSelector{}, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+	}
+	if errs := validation.IsValidLabelValue(labelValue); len(errs) > 0 {
+		return ManagedSelector{}, fmt.Errorf("invalid label value %q: %s", labelValue, strings.Join(errs, "; "))
+	}
+	return ManagedSelector{Label: key, Value: labelValue}, nil
+}
+
+// Matches reports whether obj is managed.
+func (s ManagedSelector) Matches(obj metav1.Object) bool {
+	if value, exists := obj.GetAnnotations()[ManagedSpireAnnotation]; exists {
+		return value == "true"
+	}
+	if s.Label == "" {
+		return false
+	}
+	value, exists := obj.GetLabels()[s.Label]
+	return exists && value == s.Value
+}
+
+// String returns the selector as given to ParseManagedLabel.
+func (s ManagedSelector) String() string {
+	if s.Label == "" {
+		return ""
+	}
+	return s.Label + "=" + s.Value
+}
+
+// predicate filters out the events of ServiceAccounts that are not managed. Updates
+// pass when either side is managed, so that the controller sees a ServiceAccount
+// becoming managed.
+func (s ManagedSelector) predicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return s.Matches(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return s.Matches(e.ObjectOld) || s.Matches(e.ObjectNew) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return s.Matches(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return s.Matches(e.Object) },
+	}
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	orphanedEntriesDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spire_registrar_orphaned_entries_deleted_total",
+		Help: "Number of SPIRE entries deleted because their ServiceAccount no longer exists",
+	})
+
+	kubeConfigMissing = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spire_registrar_kubeconfig_missing_total",
+		Help: "Number of times the admin kubeconfig Secret was missing or invalid when rendering a SPIRE entry",
+	}, []string{"secret_namespace", "secret_name"})
+
+	recentEntriesWithoutKubeConfig = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "spire_registrar_recent_entries_without_kubeconfig",
+		Help: "Number of the last 100 SPIRE entries sent without the admin kubeconfig",
+	}, []string{"secret_namespace", "secret_name"})
+
+	// The trust domains and clusters of a deployment are few, which bounds the
+	// cardinality of the labels.
+	registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spire_registrar_registrations_total",
+		Help: "Number of SPIRE entry creations, updates and deletions for ServiceAccounts by result",
+	}, []string{"operation", "result", "trust_domain", "cluster"})
+
+	// lastSuccessfulSync lets operators alert on a controller that is stuck without
+	// logging errors. It starts at the process start time rather than zero.
+	lastSuccessfulSync = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spire_registrar_last_successful_sync_timestamp_seconds",
+		Help: "Unix time of the last SPIRE entry successfully created, updated, deleted or verified up to date",
+	})
+
+	auditEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "spire_registrar_audit_entries",
+		Help: "Number of managed ServiceAccounts by the state of their SPIRE entry at the last audit",
+	}, []string{"state"})
+)
+
+// unknownLabel is the label value of a trust domain or cluster that could not be resolved.
+const unknownLabel = "unknown"
+
+func init() {
+	metrics.Registry.MustRegister(orphanedEntriesDeleted, kubeConfigMissing, recentEntriesWithoutKubeConfig, registrations,
+		lastSuccessfulSync, auditEntries)
+	lastSuccessfulSync.SetToCurrentTime()
+}
+
+// countRegistration counts an entry operation on se, which may be incomplete when
+// rendering it failed.
+func countRegistration(operation string, se SpireEntry, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	} else {
+		lastSuccessfulSync.SetToCurrentTime()
+	}
+	trustDomain, cluster := se.TrustDomain, se.Cluster
+	if trustDomain == "" {
+		trustDomain = unknownLabel
+	}
+	if cluster == "" {
+		cluster = unknownLabel
+	}
+	registrations.WithLabelValues(operation, result, trustDomain, cluster).Inc()
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ScopeToNamespace restricts the manager of opts to the ServiceAccounts, Pods and
+// SpireRegistrations of namespace, for deployments granted a Role there rather than
+// a ClusterRole.
+//
+// The cluster info ConfigMap lives in kube-system regardless, and configMaps lists
+// further ConfigMaps read outside namespace, e.g. the entry state. Those are cached
+// by name, so a Role in their namespace only needs to grant get, list and watch on
+// that resourceName. Secrets are read from the API server without a cache, needing
+// only get on the kubeconfig Secrets.
+func ScopeToNamespace(opts *ctrl.Options, namespace string, configMaps ...types.NamespacedName) {
+	configMapNamespaces := map[string]cache.Config{namespace: {}}
+	names := map[string]string{}
+	for _, cm := range append([]types.NamespacedName{{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}}, configMaps...) {
+		if cm.Namespace == namespace {
+			continue
+		}
+		if name, ok := names[cm.Namespace]; ok && name != cm.Name {
+			// A field selector matches a single name; cache the whole namespace.
+			configMapNamespaces[cm.Namespace] = cache.Config{}
+			continue
+		}
+		names[cm.Namespace] = cm.Name
+		configMapNamespaces[cm.Namespace] = cache.Config{FieldSelector: fields.OneTermEqualSelector("metadata.name", cm.Name)}
+	}
+
+	opts.Cache.DefaultNamespaces = map[string]cache.Config{namespace: {}}
+	if opts.Cache.ByObject == nil {
+		opts.Cache.ByObject = map[client.Object]cache.ByObject{}
+	}
+	opts.Cache.ByObject[&corev1.ConfigMap{}] = cache.ByObject{Namespaces: configMapNamespaces}
+	if opts.Client.Cache == nil {
+		opts.Client.Cache = &client.CacheOptions{}
+	}
+	opts.Client.Cache.DisableFor = append(opts.Client.Cache.DisableFor, &corev1.Secret{})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+var _ = Describe("Namespace-scoped controller", func() {
+	It("should cache the ConfigMaps it reads outside the namespace by name", func() {
+		opts := ctrl.Options{}
+		ScopeToNamespace(&opts, "team-a",
+			types.NamespacedName{Namespace: "team-a", Name: "entry-state"},
+			types.NamespacedName{Namespace: "spire-registrar-system", Name: "entry-state"})
+
+		Expect(opts.Cache.DefaultNamespaces).To(HaveLen(1))
+		Expect(opts.Cache.DefaultNamespaces).To(HaveKey("team-a"))
+		var configMaps map[string]string
+		for obj, byObject := range opts.Cache.ByObject {
+			Expect(obj).To(BeAssignableToTypeOf(&corev1.ConfigMap{}))
+			configMaps = map[string]string{}
+			for namespace, config := range byObject.Namespaces {
+				configMaps[namespace] = ""
+				if config.FieldSelector != nil {
+					configMaps[namespace] = config.FieldSelector.String()
+				}
+			}
+		}
+		Expect(configMaps).To(Equal(map[string]string{
+			"team-a":                 "",
+			ClusterInfoCmNamespace:   "metadata.name=" + ClusterInfoCm,
+			"spire-registrar-system": "metadata.name=entry-state",
+		}))
+		Expect(opts.Client.Cache.DisableFor).To(ConsistOf(BeAssignableToTypeOf(&corev1.Secret{})))
+	})
+
+	It("should cache a namespace holding several ConfigMaps it reads as a whole", func() {
+		opts := ctrl.Options{}
+		ScopeToNamespace(&opts, "team-a", types.NamespacedName{Namespace: ClusterInfoCmNamespace, Name: "entry-state"})
+		for _, byObject := range opts.Cache.ByObject {
+			Expect(byObject.Namespaces).To(HaveKey(ClusterInfoCmNamespace))
+			Expect(byObject.Namespaces[ClusterInfoCmNamespace].FieldSelector).To(BeNil())
+		}
+	})
+
+	// Runs a manager against the envtest API server.
+	It("should only register the ServiceAccounts of its namespace", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		var registered []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			var se SpireEntry
+			Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+			mu.Lock()
+			registered = append(registered, se.Namespace+"/"+se.ServiceAccount)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		defer server.Close()
+
+		for _, obj := range []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "scoped-in"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "scoped-out"}},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm,
+					Annotations: map[string]string{SpireTrustDomainAnnotation: "example.org"}},
+				Data: map[string]string{"ClusterConfiguration": "clusterName: test-cluster\n"},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: AdminKubeConfigSecret},
+				Data:       map[string][]byte{"kubeconfig": []byte(testKubeConfig)},
+			},
+		} {
+			if err := k8sClient.Create(ctx, obj); !apierrors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		opts := ctrl.Options{Scheme: scheme.Scheme, Metrics: metricsserver.Options{BindAddress: "0"}}
+		ScopeToNamespace(&opts, "scoped-in")
+		mgr, err := ctrl.NewManager(cfg, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect((&ServiceAccountReconciler{
+			Client:            mgr.GetClient(),
+			Scheme:            mgr.GetScheme(),
+			SpireClient:       NewSpireClient(SpireAPI{Server: server.URL}),
+			DisableFinalizers: true,
+		}).SetupWithManager(mgr)).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+
+		Expect(k8sClient.Create(ctx, newManagedServiceAccount("app", "scoped-in"))).To(Succeed())
+		Expect(k8sClient.Create(ctx, newManagedServiceAccount("app", "scoped-out"))).To(Succeed())
+
+		Eventually(func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), registered...)
+		}, 10*time.Second).Should(ContainElement("scoped-in/app"))
+		Consistently(func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), registered...)
+		}, time.Second).ShouldNot(ContainElement("scoped-out/app"))
+	})
+})
@@ -0,0 +1,135 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NamespaceReconciler deletes all SPIRE entries of a namespace of this cluster when
+// the namespace is deleted. Its ServiceAccounts can be removed faster than their
+// finalizers are processed one by one; the bulk delete keeps their entries from
+// leaking. Entries already deleted through a ServiceAccount finalizer are skipped.
+type NamespaceReconciler struct {
+	client.Client
+
+	// SpireClient talks to the SPIRE registrar API. When nil, DefaultSpireAPI is used.
+	SpireClient *SpireClient
+
+	// ClusterName locates the cluster name in the cluster info ConfigMap.
+	ClusterName ClusterNameLookup
+}
+
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("namespace", req.Name)
+	ctx = log.IntoContext(ctx, logger)
+
+	ns := &corev1.Namespace{}
+	err := r.Get(ctx, req.NamespacedName, ns)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	// A namespace that is already gone has no ServiceAccounts left either.
+	if err == nil && ns.DeletionTimestamp == nil {
+		return ctrl.Result{}, nil
+	}
+
+	deleted, err := r.DeleteNamespaceEntries(ctx, req.Name)
+	if deleted > 0 {
+		logger.Info("Deleted SPIRE entries of deleted namespace", "entries", deleted)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to delete SPIRE entries of deleted namespace")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// DeleteNamespaceEntries deletes the SPIRE entries registered for ServiceAccounts
+// and pods of namespace in this cluster and returns how many it deleted. Entries
+// that are already gone are not an error.
+func (r *NamespaceReconciler) DeleteNamespaceEntries(ctx context.Context, namespace string) (int, error) {
+	logger := log.FromContext(ctx)
+
+	clusterConfig, err := readClusterInfo(ctx, r.Client, r.ClusterName)
+	if err != nil {
+		return 0, err
+	}
+	clusterName, ok := clusterConfig["clusterName"].(string)
+	if !ok || clusterName == "" {
+		return 0, fmt.Errorf("missing clusterName in configmap")
+	}
+
+	entries, err := r.spireClient().ListEntries(ctx, clusterName)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	for _, entry := range entries {
+		if entry.Cluster != clusterName || entry.Namespace != namespace {
+			continue
+		}
+		err := r.spireClient().RemoveEntry(ctx, entryID(entry.EntryID), entry.SpireEntry)
+		if errors.Is(err, ErrEntryNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deleting entry %s: %w", entry.EntryID, err))
+			continue
+		}
+		logger.Info("Deleted SPIRE entry of deleted namespace", "entryID", entry.EntryID,
+			"serviceAccount", entry.ServiceAccount, "pod", entry.Pod)
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func (r *NamespaceReconciler) spireClient() *SpireClient {
+	if r.SpireClient != nil {
+		return r.SpireClient
+	}
+	return NewSpireClient(DefaultSpireAPI())
+}
+
+// SetupWithManager sets up the controller with the Manager. Only namespaces being
+// deleted are reconciled.
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	deleting := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return e.Object.GetDeletionTimestamp() != nil },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return e.ObjectNew.GetDeletionTimestamp() != nil },
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("namespace").
+		For(&corev1.Namespace{}, builder.WithPredicates(deleting)).
+		Complete(r)
+}
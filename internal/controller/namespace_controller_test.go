@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Namespace Controller", func() {
+	var (
+		mu      sync.Mutex
+		deleted []string
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		deleted = nil
+		entries := []RegisteredEntry{
+			{EntryID: "entry-web", SpireEntry: SpireEntry{Cluster: "test-cluster", Namespace: "doomed", ServiceAccount: "web"}},
+			{EntryID: "entry-pod", SpireEntry: SpireEntry{Cluster: "test-cluster", Namespace: "doomed", ServiceAccount: "web", Pod: "web-0"}},
+			{EntryID: "entry-gone", SpireEntry: SpireEntry{Cluster: "test-cluster", Namespace: "doomed", ServiceAccount: "gone"}},
+			{EntryID: "entry-kept", SpireEntry: SpireEntry{Cluster: "test-cluster", Namespace: "default", ServiceAccount: "web"}},
+			{EntryID: "entry-other", SpireEntry: SpireEntry{Cluster: "other-cluster", Namespace: "doomed", ServiceAccount: "web"}},
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			switch req.URL.Path {
+			case "/v1/entries":
+				_ = json.NewEncoder(w).Encode(SpireEntryListResponse{Entries: entries})
+			case "/v1/entries/delete":
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				if se.ServiceAccount == "gone" {
+					// Already deleted through the ServiceAccount finalizer.
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"message":"entry not found"}`))
+					return
+				}
+				mu.Lock()
+				deleted = append(deleted, se.Namespace+"/"+se.ServiceAccount+"/"+se.Pod)
+				mu.Unlock()
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newNamespaceReconciler := func(objs ...client.Object) *NamespaceReconciler {
+		sar := newTestReconciler(server.URL, objs...)
+		return &NamespaceReconciler{Client: sar.Client, SpireClient: sar.SpireClient}
+	}
+
+	It("should delete the entries of a namespace being deleted", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:              "doomed",
+			Finalizers:        []string{"kubernetes"},
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+		}}
+		r := newNamespaceReconciler(ns)
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "doomed"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(ConsistOf("doomed/web/", "doomed/web/web-0"))
+	})
+
+	It("should delete the entries of a namespace that is already gone", func() {
+		r := newNamespaceReconciler()
+		n, err := r.DeleteNamespaceEntries(context.Background(), "doomed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+	})
+
+	It("should leave the entries of an active namespace alone", func() {
+		r := newNamespaceReconciler(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "doomed"}})
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "doomed"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(BeEmpty())
+	})
+
+	It("should release the finalizer of a ServiceAccount whose entry went with its namespace", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:              "doomed",
+			Finalizers:        []string{"kubernetes"},
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+		}}
+		sa := newManagedServiceAccount("gone", "doomed")
+		sa.Annotations[SVIDEntryIDAnnotation] = "entry-gone"
+		sa.Finalizers = []string{SpireFinalizer}
+		sa.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		r := newTestReconciler(server.URL, ns, sa)
+
+		recorder := record.NewFakeRecorder(10)
+		r.Recorder = recorder
+		r.NamespaceCleanup = true
+
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), req.NamespacedName, &corev1.ServiceAccount{})).NotTo(Succeed(),
+			"the finalizer should be removed")
+		Expect(recorder.Events).NotTo(Receive(), "an entry deleted with its namespace is expected")
+	})
+})
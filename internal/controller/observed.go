@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// annotationPrefix is the prefix of the annotations the controller reads and writes.
+const annotationPrefix = "omegahome.net/"
+
+// observedFields are the fields of a ServiceAccount its reconcile depends on.
+type observedFields struct {
+	UID         types.UID         `json:"uid"`
+	Deleting    bool              `json:"deleting"`
+	Finalizers  []string          `json:"finalizers,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// observedHash returns the SHA-256 of the fields of sa its reconcile depends on: the
+// deletion timestamp, finalizers, labels and the controller's annotations other than
+// the sync status. All annotations count when a selector template, which may read
+// any of them, applies.
+func (r *ServiceAccountReconciler) observedHash(sa client.Object) string {
+	annotations := sa.GetAnnotations()
+	_, perSATemplate := annotations[SelectorTemplateAnnotation]
+	allAnnotations := r.SelectorTemplate != nil || perSATemplate
+
+	fields := observedFields{
+		UID:        sa.GetUID(),
+		Deleting:   sa.GetDeletionTimestamp() != nil,
+		Finalizers: sa.GetFinalizers(),
+		Labels:     sa.GetLabels(),
+	}
+	for k, v := range withoutSyncStatus(annotations) {
+		if !allAnnotations && !strings.HasPrefix(k, annotationPrefix) {
+			continue
+		}
+		if fields.Annotations == nil {
+			fields.Annotations = map[string]string{}
+		}
+		fields.Annotations[k] = v
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type observedHashKey struct{}
+
+// withObservedHash returns a context in which the reconcile notes the observedHash of
+// the ServiceAccount it read.
+func withObservedHash(ctx context.Context) (context.Context, *string) {
+	hash := new(string)
+	return context.WithValue(ctx, observedHashKey{}, hash), hash
+}
+
+func (r *ServiceAccountReconciler) noteObserved(ctx context.Context, sa *corev1.ServiceAccount) {
+	if hash, ok := ctx.Value(observedHashKey{}).(*string); ok {
+		*hash = r.observedHash(sa)
+	}
+}
+
+// skipObservedUpdates filters out updates of ServiceAccounts whose observedHash is the
+// one of their last clean reconcile, e.g. metadata written by other controllers, so
+// that they are not reconciled again. ServiceAccounts whose last reconcile failed or
+// requeued are always reconciled.
+func (r *ServiceAccountReconciler) skipObservedUpdates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			observed, ok := r.observed.Load(client.ObjectKeyFromObject(e.ObjectNew))
+			return !ok || observed.(string) != r.observedHash(e.ObjectNew)
+		},
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const DefaultOrphanCleanupInterval = 10 * time.Minute
+
+var _ manager.LeaderElectionRunnable = &OrphanCleaner{}
+
+// OrphanCleaner periodically deletes SPIRE entries registered for this cluster whose
+// ServiceAccount no longer exists or is no longer managed, e.g. because its finalizer
+// was force-removed while the controller was down.
+type OrphanCleaner struct {
+	client.Client
+
+	// SpireClient talks to the SPIRE registrar API. When nil, DefaultSpireAPI is used.
+	SpireClient *SpireClient
+	Interval    time.Duration
+
+	// ClusterName locates the cluster name in the cluster info ConfigMap.
+	ClusterName ClusterNameLookup
+
+	// Managed selects the ServiceAccounts whose entries are kept.
+	Managed ManagedSelector
+
+	// Namespace, when set, limits the cleanup to the entries of that namespace, as
+	// a namespace-scoped controller cannot tell whether the ServiceAccounts of other
+	// namespaces exist.
+	Namespace string
+}
+
+// Start runs the cleanup every Interval until ctx is cancelled.
+func (o *OrphanCleaner) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("orphan-cleanup")
+	ctx = log.IntoContext(ctx, logger)
+
+	interval := o.Interval
+	if interval <= 0 {
+		interval = DefaultOrphanCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := o.Cleanup(ctx); err != nil {
+				logger.Error(err, "Failed to clean up orphaned SPIRE entries")
+			}
+		}
+	}
+}
+
+// Cleanup deletes the orphaned SPIRE entries of this cluster once and returns the
+// number of entries reclaimed.
+func (o *OrphanCleaner) Cleanup(ctx context.Context) (int, error) {
+	logger := log.FromContext(ctx)
+
+	clusterConfig, err := readClusterInfo(ctx, o.Client, o.ClusterName)
+	if err != nil {
+		return 0, err
+	}
+	clusterName, ok := clusterConfig["clusterName"].(string)
+	if !ok || clusterName == "" {
+		return 0, fmt.Errorf("missing clusterName in configmap")
+	}
+
+	entries, err := o.spireClient().ListEntries(ctx, clusterName)
+	if err != nil {
+		return 0, err
+	}
+
+	saList := &corev1.ServiceAccountList{}
+	if err := o.List(ctx, saList, client.InNamespace(o.Namespace)); err != nil {
+		return 0, err
+	}
+	managed := map[types.NamespacedName]bool{}
+	for _, sa := range saList.Items {
+		if o.Managed.Matches(&sa) {
+			managed[types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}] = true
+		}
+	}
+
+	reclaimed := 0
+	for _, entry := range entries {
+		// Pod-level entries are owned by the PodReconciler, not a ServiceAccount.
+		if entry.Cluster != clusterName || entry.Pod != "" {
+			continue
+		}
+		if o.Namespace != "" && entry.Namespace != o.Namespace {
+			continue
+		}
+		if managed[types.NamespacedName{Namespace: entry.Namespace, Name: entry.ServiceAccount}] {
+			continue
+		}
+		if err := o.spireClient().RemoveEntry(ctx, entryID(entry.EntryID), entry.SpireEntry); err != nil {
+			logger.Error(err, "Failed to delete orphaned SPIRE entry", "entryID", entry.EntryID)
+			continue
+		}
+		logger.Info("Deleted orphaned SPIRE entry", "entryID", entry.EntryID,
+			"namespace", entry.Namespace, "serviceAccount", entry.ServiceAccount)
+		orphanedEntriesDeleted.Inc()
+		lastSuccessfulSync.SetToCurrentTime()
+		reclaimed++
+	}
+	return reclaimed, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: replicas that are
+// not the leader would otherwise delete the same entries concurrently.
+func (o *OrphanCleaner) NeedLeaderElection() bool {
+	return true
+}
+
+func (o *OrphanCleaner) spireClient() *SpireClient {
+	if o.SpireClient != nil {
+		return o.SpireClient
+	}
+	return NewSpireClient(DefaultSpireAPI())
+}
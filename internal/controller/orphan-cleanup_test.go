@@ -0,0 +1,96 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orphan cleanup", func() {
+	It("should delete only entries of this cluster without a managed ServiceAccount", func() {
+		var mu sync.Mutex
+		var deleted []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			switch req.URL.Path {
+			case "/v1/entries":
+				Expect(req.URL.Query().Get("cluster")).To(Equal("test-cluster"))
+				_, _ = w.Write([]byte(`{"entries":[
+					{"entryID":"kept","namespace":"default","serviceAccount":"app","cluster":"test-cluster"},
+					{"entryID":"orphan","namespace":"default","serviceAccount":"gone","cluster":"test-cluster"},
+					{"entryID":"pod","namespace":"default","serviceAccount":"gone","pod":"web-0","cluster":"test-cluster"},
+					{"entryID":"other","namespace":"default","serviceAccount":"gone","cluster":"other-cluster"}
+				]}`))
+			case "/v1/entries/delete":
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				mu.Lock()
+				deleted = append(deleted, se.Namespace+"/"+se.ServiceAccount)
+				mu.Unlock()
+				w.WriteHeader(http.StatusOK)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL, newManagedServiceAccount("app", "default"))
+		cleaner := &OrphanCleaner{Client: r.Client, SpireClient: r.SpireClient}
+
+		reclaimed, err := cleaner.Cleanup(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reclaimed).To(Equal(1))
+		Expect(deleted).To(Equal([]string{"default/gone"}))
+	})
+
+	It("should leave the entries of other namespaces to a namespace-scoped controller", func() {
+		var deleted []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			switch req.URL.Path {
+			case "/v1/entries":
+				_, _ = w.Write([]byte(`{"entries":[
+					{"entryID":"orphan","namespace":"team-a","serviceAccount":"gone","cluster":"test-cluster"},
+					{"entryID":"elsewhere","namespace":"team-b","serviceAccount":"app","cluster":"test-cluster"}
+				]}`))
+			case "/v1/entries/delete":
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				deleted = append(deleted, se.Namespace+"/"+se.ServiceAccount)
+				w.WriteHeader(http.StatusOK)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL)
+		cleaner := &OrphanCleaner{Client: r.Client, SpireClient: r.SpireClient, Namespace: "team-a"}
+
+		reclaimed, err := cleaner.Cleanup(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reclaimed).To(Equal(1))
+		Expect(deleted).To(Equal([]string{"team-a/gone"}))
+	})
+})
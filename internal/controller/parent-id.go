@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParentIDs maps cluster names to the SPIFFE ID of the parent of the SPIRE entries of
+// that cluster, e.g. the node alias or agent of that cluster in a delegated
+// registration setup. Entries of an unmapped cluster leave the parent to the SPIRE
+// server.
+type ParentIDs map[string]string
+
+// Set maps cluster to the parent SPIFFE ID id.
+func (p ParentIDs) Set(cluster, id string) error {
+	if cluster == "" {
+		return fmt.Errorf("missing cluster name for parent ID %q", id)
+	}
+	if err := validateParentID(id); err != nil {
+		return fmt.Errorf("parent ID of cluster %s: %w", cluster, err)
+	}
+	p[cluster] = id
+	return nil
+}
+
+// parentFor returns the parent ID of the entries of cluster in trustDomain, or "" when
+// the cluster is not mapped. SPIRE only accepts a parent of the entry's trust domain.
+func (p ParentIDs) parentFor(cluster, trustDomain string) (string, error) {
+	id, ok := p[cluster]
+	if !ok {
+		return "", nil
+	}
+	if !strings.HasPrefix(id, "spiffe://"+trustDomain+"/") {
+		return "", fmt.Errorf("parent ID %s of cluster %s is not in the trust domain %s of the entry", id, cluster, trustDomain)
+	}
+	return id, nil
+}
+
+// validateParentID checks that id is a SPIFFE ID with a path: spiffe://<trust-domain>/<path>.
+func validateParentID(id string) error {
+	u, err := url.Parse(id)
+	if err != nil {
+		return fmt.Errorf("invalid parent ID %q: %w", id, err)
+	}
+	if u.Scheme != "spiffe" || u.Host == "" || u.Path == "" || u.Path == "/" {
+		return fmt.Errorf("invalid parent ID %q: must be of the form spiffe://<trust-domain>/<path>", id)
+	}
+	if u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(u.Path, "/") ||
+		strings.Contains(u.Path, "//") {
+		return fmt.Errorf("invalid parent ID %q: must not contain user info, port, query, fragment or empty path segments", id)
+	}
+	if err := validateTrustDomain(u.Host); err != nil {
+		return fmt.Errorf("invalid parent ID %q: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parent IDs of clusters", func() {
+	It("should accept SPIFFE IDs with a path only", func() {
+		p := ParentIDs{}
+		Expect(p.Set("east", "spiffe://example.org/k8s-workload-registrar/east/node")).To(Succeed())
+		Expect(p).To(HaveKeyWithValue("east", "spiffe://example.org/k8s-workload-registrar/east/node"))
+
+		for _, id := range []string{
+			"spiffe://example.org",
+			"spiffe://example.org/",
+			"https://example.org/node",
+			"spiffe://Example.org/node",
+			"spiffe://example.org:8443/node",
+			"spiffe://example.org/node/",
+			"spiffe://example.org/a//node",
+			"spiffe://example.org/node?x=1",
+			"example.org/node",
+		} {
+			Expect(p.Set("west", id)).To(MatchError(ContainSubstring("parent ID of cluster west")), id)
+		}
+		Expect(p.Set("", "spiffe://example.org/node")).To(MatchError(ContainSubstring("missing cluster name")))
+		Expect(p).NotTo(HaveKey("west"))
+	})
+
+	It("should resolve the parent ID of mapped clusters in their trust domain", func() {
+		p := ParentIDs{"east": "spiffe://example.org/east/node"}
+		id, err := p.parentFor("east", "example.org")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("spiffe://example.org/east/node"))
+
+		id, err = p.parentFor("west", "example.org")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(BeEmpty(), "unmapped clusters leave the parent to the server")
+
+		_, err = p.parentFor("east", "other.org")
+		Expect(err).To(MatchError(ContainSubstring("not in the trust domain other.org")))
+		var unset ParentIDs
+		id, err = unset.parentFor("east", "example.org")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(BeEmpty())
+	})
+
+	It("should send the parent ID of the entry's cluster on creation", func() {
+		var entries []SpireEntry
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			var se SpireEntry
+			Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+			entries = append(entries, se)
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		defer server.Close()
+
+		r := newTestReconciler(server.URL)
+		r.ParentIDs = ParentIDs{"test-cluster": "spiffe://example.org/k8s-workload-registrar/test-cluster/node"}
+		mapped := newManagedServiceAccount("mapped", "default")
+		_, err := r.CreateEntry(context.Background(), mapped)
+		Expect(err).NotTo(HaveOccurred())
+		unmapped := newManagedServiceAccount("unmapped", "default")
+		unmapped.Annotations[ClusterNameAnnotation] = "other-cluster"
+		_, err = r.CreateEntry(context.Background(), unmapped)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].ParentID).To(Equal("spiffe://example.org/k8s-workload-registrar/test-cluster/node"))
+		Expect(entries[1].Cluster).To(Equal("other-cluster"))
+		Expect(entries[1].ParentID).To(BeEmpty())
+	})
+})
@@ -0,0 +1,304 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sort"
+)
+
+// PodReconciler reconciles a Pod object, registering workload-level SPIRE entries
+// with selectors derived from the pod's labels and node.
+type PodReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// SpireClient talks to the SPIRE registrar API. When nil, DefaultSpireAPI is used.
+	SpireClient *SpireClient
+
+	// ClusterName locates the cluster name in the cluster info ConfigMap.
+	ClusterName ClusterNameLookup
+
+	// RequeueJitterFraction randomizes SPIRE Retry-After back-offs by up to ± this fraction.
+	RequeueJitterFraction float64
+
+	// RequireKubeConfig fails registrations when the admin kubeconfig is unavailable
+	// instead of sending the entry without one.
+	RequireKubeConfig bool
+
+	// KubeConfigSecrets maps the cluster of an entry to the Secret of the kubeconfig it
+	// carries. When empty, every entry carries the admin kubeconfig.
+	KubeConfigSecrets KubeConfigSecrets
+
+	// ParentIDs maps the cluster of an entry to its parent SPIFFE ID. Entries of an
+	// unmapped cluster leave the parent to the SPIRE server.
+	ParentIDs ParentIDs
+
+	// NodeSelector, when set, scopes entries to the node of the pod for node-attested
+	// workloads such as DaemonSets, see ParseNodeSelector.
+	NodeSelector string
+
+	// kubeConfigs remembers the validated kubeconfigs of the rendered entries.
+	kubeConfigs kubeConfigCache
+}
+
+const (
+	// NodeSelectorName adds a k8s_psat:agent_node_name selector of the pod's node.
+	NodeSelectorName = "name"
+	// NodeSelectorUID adds a k8s_psat:agent_node_uid selector with the UID of the
+	// Node object of the pod's node.
+	NodeSelectorUID = "uid"
+)
+
+// ParseNodeSelector validates a --pod-node-selector value: none, name or uid.
+func ParseNodeSelector(value string) (string, error) {
+	switch value {
+	case "", "none":
+		return "", nil
+	case NodeSelectorName, NodeSelectorUID:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown pod node selector %q: must be none, name or uid", value)
+	}
+}
+
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+
+func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("namespace", req.Namespace)
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		// if the object is not found, return and don't requeue
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if value, exists := pod.Annotations[ManagedSpireAnnotation]; !exists || value != "true" {
+		return ctrl.Result{}, nil
+	}
+
+	// Check for deletion
+	if pod.DeletionTimestamp != nil {
+		if !controllerutil.ContainsFinalizer(pod, SpireFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		logger.Info("Pod is being deleted", "name", pod.Name)
+		if err := r.DeleteEntry(ctx, pod); err != nil {
+			if after, ok := retryAfter(err); ok {
+				logger.Info("SPIRE server is rate limiting, backing off", "name", pod.Name, "retryAfter", after)
+				return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
+			}
+			logger.Error(err, "Failed to delete SPIRE entry for Pod during cleanup", "name", pod.Name)
+			return ctrl.Result{RequeueAfter: 15}, err
+		}
+		if r.spireClient().DryRun {
+			logger.Info("Dry run: leaving finalizer in place", "name", pod.Name)
+			return ctrl.Result{}, nil
+		}
+		controllerutil.RemoveFinalizer(pod, SpireFinalizer)
+		if err := r.Update(ctx, pod); err != nil {
+			logger.Error(err, "Failed to remove finalizer", "name", pod.Name)
+			return ctrl.Result{RequeueAfter: 15}, err
+		}
+		logger.Info("Removed finalizer", "name", pod.Name)
+		return ctrl.Result{}, nil
+	}
+
+	if svidEntryID := pod.Annotations[SVIDEntryIDAnnotation]; svidEntryID != "" {
+		logger.Info("Pod has a valid SVID", "SVIDEntryID", svidEntryID)
+		return ctrl.Result{}, nil
+	}
+
+	// The node selector can only be derived once the pod is scheduled; the update
+	// setting spec.nodeName triggers another reconcile.
+	if pod.Spec.NodeName == "" {
+		logger.Info("Pod is not scheduled yet, waiting for node assignment", "name", pod.Name)
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Pod does not have an SVID. registering...", "name", pod.Name)
+	entryID, err := r.CreateEntry(ctx, pod)
+	if err != nil {
+		if after, ok := retryAfter(err); ok {
+			logger.Info("SPIRE server is rate limiting, backing off", "name", pod.Name, "retryAfter", after)
+			return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
+		}
+		logger.Error(err, "Failed to create SPIRE entry for Pod", "name", pod.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+
+	if r.spireClient().DryRun {
+		logger.Info("Dry run: not persisting SVID entryID or finalizer", "name", pod.Name, "entryID", *entryID)
+		return ctrl.Result{}, nil
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[SVIDEntryIDAnnotation] = string(*entryID)
+	controllerutil.AddFinalizer(pod, SpireFinalizer)
+	if err := r.Update(ctx, pod); err != nil {
+		logger.Error(err, "Failed to update Pod with SVID entryID", "name", pod.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// CreateEntry registers a SPIRE entry for the pod.
+func (r *PodReconciler) CreateEntry(ctx context.Context, pod *corev1.Pod) (_ *entryID, err error) {
+	ctx, span := tracer.Start(ctx, "CreateEntry", trace.WithAttributes(objectAttributes("Pod", pod.Namespace, pod.Name)...))
+	defer func() { endSpan(span, err) }()
+
+	logger := log.FromContext(ctx)
+	logger.Info("Creating SPIRE entry for Pod", "name", pod.Name, "namespace", pod.Namespace)
+
+	se, err := r.podEntry(ctx, pod, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.spireClient().OmitKubeConfig {
+		if se.KubeConfig, err = entryKubeConfig(ctx, r.Client, &r.kubeConfigs, r.KubeConfigSecrets, se.Cluster, r.RequireKubeConfig); err != nil {
+			return nil, err
+		}
+	}
+	if se.ParentID, err = r.ParentIDs.parentFor(se.Cluster, se.TrustDomain); err != nil {
+		return nil, err
+	}
+
+	return r.spireClient().AddEntry(ctx, se)
+}
+
+// DeleteEntry removes the SPIRE entry registered for the pod.
+func (r *PodReconciler) DeleteEntry(ctx context.Context, pod *corev1.Pod) (err error) {
+	ctx, span := tracer.Start(ctx, "DeleteEntry", trace.WithAttributes(objectAttributes("Pod", pod.Namespace, pod.Name)...))
+	defer func() { endSpan(span, err) }()
+
+	logger := log.FromContext(ctx)
+	logger.Info("Deleting SPIRE entry for Pod", "name", pod.Name, "namespace", pod.Namespace)
+
+	se, err := r.podEntry(ctx, pod, true)
+	if err != nil {
+		return err
+	}
+	return r.spireClient().RemoveEntry(ctx, entryID(pod.Annotations[SVIDEntryIDAnnotation]), se)
+}
+
+// podEntry builds the SpireEntry for the pod from the cluster info and the pod spec.
+// When deleting, a node that no longer exists leaves its selector out instead of
+// failing, as the entry is matched by ID.
+func (r *PodReconciler) podEntry(ctx context.Context, pod *corev1.Pod, deleting bool) (SpireEntry, error) {
+	clusterConfig, err := readClusterInfo(ctx, r.Client, r.ClusterName)
+	if err != nil {
+		return SpireEntry{}, err
+	}
+	clusterName, ok := clusterConfig["clusterName"].(string)
+	if !ok || clusterName == "" {
+		return SpireEntry{}, fmt.Errorf("missing clusterName in configmap")
+	}
+
+	selectors := podSelectors(pod)
+	if r.NodeSelector != "" {
+		selector, err := r.nodeSelector(ctx, pod)
+		switch {
+		case deleting && apierrors.IsNotFound(err):
+			log.FromContext(ctx).Info("Node of the Pod no longer exists, leaving out its selector",
+				"name", pod.Name, "node", pod.Spec.NodeName)
+		case err != nil:
+			return SpireEntry{}, err
+		default:
+			selectors = append(selectors, selector)
+		}
+	}
+
+	return SpireEntry{
+		TrustDomain:    clusterConfig["trustDomain"].(string),
+		ServiceAccount: pod.Spec.ServiceAccountName,
+		Namespace:      pod.Namespace,
+		Cluster:        clusterName,
+		Pod:            pod.Name,
+		Selectors:      selectors,
+	}, nil
+}
+
+// nodeSelector returns the NodeSelector selector of the node the pod is scheduled on.
+func (r *PodReconciler) nodeSelector(ctx context.Context, pod *corev1.Pod) (string, error) {
+	if pod.Spec.NodeName == "" {
+		return "", fmt.Errorf("pod %s/%s has no node assigned for its node selector", pod.Namespace, pod.Name)
+	}
+	if r.NodeSelector == NodeSelectorName {
+		return "k8s_psat:agent_node_name:" + pod.Spec.NodeName, nil
+	}
+	node := &corev1.Node{}
+	if err := getWithRetry(ctx, r.Client, client.ObjectKey{Name: pod.Spec.NodeName}, node); err != nil {
+		return "", fmt.Errorf("reading node %s of pod %s/%s: %w", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+	}
+	return "k8s_psat:agent_node_uid:" + string(node.UID), nil
+}
+
+func (r *PodReconciler) spireClient() *SpireClient {
+	if r.SpireClient != nil {
+		return r.SpireClient
+	}
+	return NewSpireClient(DefaultSpireAPI())
+}
+
+// podSelectors derives k8s workload attestor selectors from the pod's namespace,
+// service account, labels and node. Labels are sorted for a stable selector order.
+func podSelectors(pod *corev1.Pod) []string {
+	selectors := []string{"k8s:ns:" + pod.Namespace}
+	if pod.Spec.ServiceAccountName != "" {
+		selectors = append(selectors, "k8s:sa:"+pod.Spec.ServiceAccountName)
+	}
+
+	keys := make([]string, 0, len(pod.Labels))
+	for key := range pod.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		selectors = append(selectors, fmt.Sprintf("k8s:pod-label:%s:%s", key, pod.Labels[key]))
+	}
+
+	if pod.Spec.NodeName != "" {
+		selectors = append(selectors, "k8s:node-name:"+pod.Spec.NodeName)
+	}
+	return selectors
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	managed := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetAnnotations()[ManagedSpireAnnotation] == "true"
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(managed)).
+		Complete(r)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Pod Controller", func() {
+	Context("When deriving selectors", func() {
+		It("should include namespace, service account, sorted labels and node", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "web-0",
+					Namespace: "apps",
+					Labels:    map[string]string{"tier": "frontend", "app": "web"},
+				},
+				Spec: corev1.PodSpec{ServiceAccountName: "web", NodeName: "node-1"},
+			}
+			Expect(podSelectors(pod)).To(Equal([]string{
+				"k8s:ns:apps",
+				"k8s:sa:web",
+				"k8s:pod-label:app:web",
+				"k8s:pod-label:tier:frontend",
+				"k8s:node-name:node-1",
+			}))
+		})
+	})
+
+	Context("When scoping entries to the pod's node", func() {
+		var node *corev1.Node
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "3f1c9a52-node-uid"}}
+			pod = &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "agent-x7k2p",
+					Namespace:   "monitoring",
+					Annotations: map[string]string{ManagedSpireAnnotation: "true"},
+				},
+				Spec: corev1.PodSpec{ServiceAccountName: "agent", NodeName: "node-1"},
+			}
+		})
+
+		newPodReconciler := func(serverURL, nodeSelector string) *PodReconciler {
+			sar := newTestReconciler(serverURL, node, pod)
+			return &PodReconciler{Client: sar.Client, Scheme: sar.Scheme, SpireClient: sar.SpireClient, NodeSelector: nodeSelector}
+		}
+
+		DescribeTable("should add the node selector",
+			func(nodeSelector, selector string) {
+				se, err := newPodReconciler("http://127.0.0.1:0", nodeSelector).podEntry(context.Background(), pod, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(se.Selectors).To(ContainElement(selector))
+				Expect(se.Selectors).To(ContainElement("k8s:node-name:node-1"))
+			},
+			Entry("by name", NodeSelectorName, "k8s_psat:agent_node_name:node-1"),
+			Entry("by UID", NodeSelectorUID, "k8s_psat:agent_node_uid:3f1c9a52-node-uid"),
+		)
+
+		It("should reject a pod without an assigned node", func() {
+			pod.Spec.NodeName = ""
+			_, err := newPodReconciler("http://127.0.0.1:0", NodeSelectorName).podEntry(context.Background(), pod, false)
+			Expect(err).To(MatchError(ContainSubstring("has no node assigned")))
+		})
+
+		It("should wait for an unscheduled pod to be assigned a node before registering it", func() {
+			var entries []SpireEntry
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				entries = append(entries, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			pod.Spec.NodeName = ""
+			r := newPodReconciler(server.URL, NodeSelectorUID)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+
+			Expect(r.Get(context.Background(), req.NamespacedName, pod)).To(Succeed())
+			pod.Spec.NodeName = "node-1"
+			Expect(r.Update(context.Background(), pod)).To(Succeed())
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Selectors).To(ContainElement("k8s_psat:agent_node_uid:3f1c9a52-node-uid"))
+		})
+
+		It("should leave out the selector of a deleted node when deleting the entry", func() {
+			r := newPodReconciler("http://127.0.0.1:0", NodeSelectorUID)
+			Expect(r.Delete(context.Background(), node)).To(Succeed())
+
+			_, err := r.podEntry(context.Background(), pod, false)
+			Expect(err).To(MatchError(ContainSubstring("reading node node-1")))
+			se, err := r.podEntry(context.Background(), pod, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(se.Selectors).NotTo(ContainElement(HavePrefix("k8s_psat:")))
+		})
+
+		It("should parse the node selector flag", func() {
+			Expect(ParseNodeSelector("none")).To(BeEmpty())
+			Expect(ParseNodeSelector("uid")).To(Equal(NodeSelectorUID))
+			_, err := ParseNodeSelector("hostname")
+			Expect(err).To(MatchError(ContainSubstring("must be none, name or uid")))
+		})
+	})
+})
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// readRetryBackoff bounds the retries of the cluster info ConfigMap and kubeconfig
+// Secret reads, so that an API server hiccup does not fail the registration.
+var readRetryBackoff = wait.Backoff{
+	Steps:    3,
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// getWithRetry gets key into obj, retrying transient errors per readRetryBackoff.
+func getWithRetry(ctx context.Context, c client.Reader, key client.ObjectKey, obj client.Object) error {
+	attempt := 0
+	return retry.OnError(readRetryBackoff, func(err error) bool {
+		if ctx.Err() != nil || !isTransientReadError(err) {
+			return false
+		}
+		log.FromContext(ctx).Info("Transient error reading object, retrying", "namespace", key.Namespace,
+			"name", key.Name, "attempt", attempt, "error", err.Error())
+		return true
+	}, func() error {
+		attempt++
+		return c.Get(ctx, key, obj)
+	})
+}
+
+// isTransientReadError reports whether a failed read may succeed when retried. A
+// missing object or a request the API server rejects will not.
+func isTransientReadError(err error) bool {
+	switch {
+	case apierrors.IsNotFound(err),
+		apierrors.IsForbidden(err),
+		apierrors.IsUnauthorized(err),
+		apierrors.IsBadRequest(err),
+		apierrors.IsInvalid(err),
+		apierrors.IsMethodNotSupported(err):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// flakyReader fails the first failures Gets with err before reading from Reader.
+type flakyReader struct {
+	client.Reader
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return f.Reader.Get(ctx, key, obj, opts...)
+}
+
+var _ = Describe("Retrying ConfigMap and Secret reads", func() {
+	var saved wait.Backoff
+	BeforeEach(func() {
+		saved = readRetryBackoff
+		readRetryBackoff.Duration = time.Millisecond
+	})
+	AfterEach(func() {
+		readRetryBackoff = saved
+	})
+
+	timeout := apierrors.NewTimeoutError("request timed out", 1)
+	adminKubeConfig := types.NamespacedName{Namespace: "kube-system", Name: AdminKubeConfigSecret}
+
+	It("should read the cluster info after transient errors", func() {
+		reader := &flakyReader{Reader: newTestReconciler("http://127.0.0.1:0").Client, failures: 2, err: timeout}
+		info, err := readClusterInfo(context.Background(), reader, ClusterNameLookup{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(HaveKeyWithValue("clusterName", "test-cluster"))
+		Expect(reader.calls).To(Equal(3))
+	})
+
+	It("should give up after a bounded number of attempts", func() {
+		reader := &flakyReader{Reader: newTestReconciler("http://127.0.0.1:0").Client, failures: 10,
+			err: apierrors.NewServiceUnavailable("overloaded")}
+		_, err := readKubeConfig(context.Background(), reader, adminKubeConfig, nil)
+		Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue(), "got %v", err)
+		Expect(reader.calls).To(Equal(readRetryBackoff.Steps))
+	})
+
+	It("should not retry a missing object", func() {
+		notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, AdminKubeConfigSecret)
+		reader := &flakyReader{Reader: newTestReconciler("http://127.0.0.1:0").Client, failures: 10, err: notFound}
+		_, err := readKubeConfig(context.Background(), reader, adminKubeConfig, nil)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "got %v", err)
+		Expect(reader.calls).To(Equal(1))
+	})
+
+	It("should stop retrying once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		reader := &flakyReader{Reader: newTestReconciler("http://127.0.0.1:0").Client, failures: 10, err: timeout}
+		_, err := readClusterInfo(ctx, reader, ClusterNameLookup{})
+		Expect(err).To(HaveOccurred())
+		Expect(reader.calls).To(Equal(1))
+	})
+
+	DescribeTable("isTransientReadError",
+		func(err error, transient bool) {
+			Expect(isTransientReadError(err)).To(Equal(transient))
+		},
+		Entry("a timeout", timeout, true),
+		Entry("too many requests", apierrors.NewTooManyRequests("slow down", 1), true),
+		Entry("an internal error", apierrors.NewInternalError(context.DeadlineExceeded), true),
+		Entry("not found", apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, ClusterInfoCm), false),
+		Entry("forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, AdminKubeConfigSecret, nil), false),
+	)
+})
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	spirev1alpha1 "github.com/shanmugara/spire-registrar/api/v1alpha1"
+)
+
+const (
+	SyncingReason = "Syncing"
+	SyncedReason  = "Synced"
+)
+
+// markSyncing reports on the SpireRegistration that the SPIRE entry of the
+// ServiceAccount is being created or updated.
+func (r *ServiceAccountReconciler) markSyncing(ctx context.Context, sa *corev1.ServiceAccount) {
+	r.updateRegistration(ctx, sa, func(status *spirev1alpha1.SpireRegistrationStatus) bool {
+		return meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    spirev1alpha1.ConditionSyncing,
+			Status:  metav1.ConditionTrue,
+			Reason:  SyncingReason,
+			Message: "Sending the entry to the SPIRE server",
+		})
+	})
+}
+
+// recordRegistration reports the outcome of the last SPIRE sync on the
+// SpireRegistration of the ServiceAccount.
+func (r *ServiceAccountReconciler) recordRegistration(ctx context.Context, sa *corev1.ServiceAccount, syncErr error) {
+	r.updateRegistration(ctx, sa, func(status *spirev1alpha1.SpireRegistrationStatus) bool {
+		ready := metav1.Condition{Type: spirev1alpha1.ConditionReady, Status: metav1.ConditionTrue, Reason: SyncedReason,
+			Message: "The SPIRE entry matches the ServiceAccount"}
+		failed := metav1.Condition{Type: spirev1alpha1.ConditionError, Status: metav1.ConditionFalse, Reason: SyncedReason}
+		if syncErr != nil {
+			ready = metav1.Condition{Type: spirev1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: SyncFailedReason,
+				Message: syncErr.Error()}
+			failed = metav1.Condition{Type: spirev1alpha1.ConditionError, Status: metav1.ConditionTrue, Reason: SyncFailedReason,
+				Message: syncErr.Error()}
+		}
+		changed := meta.SetStatusCondition(&status.Conditions, ready)
+		changed = meta.SetStatusCondition(&status.Conditions, failed) || changed
+		changed = meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   spirev1alpha1.ConditionSyncing,
+			Status: metav1.ConditionFalse,
+			Reason: ready.Reason,
+		}) || changed
+		if id := sa.Annotations[SVIDEntryIDAnnotation]; id != status.EntryID {
+			status.EntryID = id
+			changed = true
+		}
+		return changed
+	})
+}
+
+// updateRegistration applies mutate to the status of the SpireRegistration named
+// after the ServiceAccount, creating it first when missing. The status is only
+// written when mutate reports a change. Failures are logged but do not fail the
+// reconcile, as the registration only reports on it.
+func (r *ServiceAccountReconciler) updateRegistration(ctx context.Context, sa *corev1.ServiceAccount, mutate func(*spirev1alpha1.SpireRegistrationStatus) bool) {
+	if !r.RegistrationStatus || r.spireClient().DryRun {
+		return
+	}
+	logger := log.FromContext(ctx)
+
+	reg := &spirev1alpha1.SpireRegistration{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(sa), reg)
+	if apierrors.IsNotFound(err) {
+		if sa.DeletionTimestamp != nil {
+			return
+		}
+		reg = &spirev1alpha1.SpireRegistration{
+			ObjectMeta: metav1.ObjectMeta{Name: sa.Name, Namespace: sa.Namespace},
+			Spec:       spirev1alpha1.SpireRegistrationSpec{ServiceAccountName: sa.Name},
+		}
+		if err := controllerutil.SetControllerReference(sa, reg, r.Scheme); err != nil {
+			logger.Error(err, "Failed to set owner of SpireRegistration", "name", sa.Name)
+			return
+		}
+		err = r.Create(ctx, reg)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to get SpireRegistration", "name", sa.Name)
+		return
+	}
+	if !metav1.IsControlledBy(reg, sa) && sa.DeletionTimestamp == nil {
+		// Adopt a registration created without an owner, or owned by a previous
+		// ServiceAccount of the same name, so that it is garbage collected with this one.
+		if err := controllerutil.SetControllerReference(sa, reg, r.Scheme); err != nil {
+			logger.Error(err, "Failed to set owner of SpireRegistration", "name", sa.Name)
+			return
+		}
+		if err := r.Update(ctx, reg); err != nil {
+			logger.Error(err, "Failed to adopt SpireRegistration", "name", sa.Name)
+			return
+		}
+	}
+
+	changed := mutate(&reg.Status)
+	if reg.Status.ObservedGeneration != reg.Generation {
+		reg.Status.ObservedGeneration = reg.Generation
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if err := r.Status().Update(ctx, reg); err != nil {
+		logger.Error(err, "Failed to update SpireRegistration status", "name", sa.Name)
+	}
+}
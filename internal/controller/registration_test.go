@@ -0,0 +1,123 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spirev1alpha1 "github.com/shanmugara/spire-registrar/api/v1alpha1"
+)
+
+var _ = Describe("SpireRegistration status", func() {
+	var spire *fakeSpireServer
+
+	BeforeEach(func() {
+		spire = newFakeSpireServer()
+	})
+
+	AfterEach(func() {
+		spire.Close()
+	})
+
+	It("should report Ready once registered and Error when a sync fails", func() {
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(spire.URL, sa)
+		r.RegistrationStatus = true
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		reg := &spirev1alpha1.SpireRegistration{}
+		Expect(r.Get(context.Background(), req.NamespacedName, reg)).To(Succeed())
+		Expect(reg.Spec.ServiceAccountName).To(Equal("app"))
+		Expect(reg.OwnerReferences).To(HaveLen(1))
+		Expect(reg.Status.EntryID).To(Equal("entry-1"))
+		Expect(reg.Status.ObservedGeneration).To(Equal(reg.Generation))
+		Expect(meta.IsStatusConditionTrue(reg.Status.Conditions, spirev1alpha1.ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(reg.Status.Conditions, spirev1alpha1.ConditionSyncing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(reg.Status.Conditions, spirev1alpha1.ConditionError)).To(BeTrue())
+		readySince := meta.FindStatusCondition(reg.Status.Conditions, spirev1alpha1.ConditionReady).LastTransitionTime
+
+		// A steady-state reconcile leaves the status alone.
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), req.NamespacedName, reg)).To(Succeed())
+		Expect(meta.FindStatusCondition(reg.Status.Conditions, spirev1alpha1.ConditionReady).LastTransitionTime).To(Equal(readySince))
+
+		// Changing the entry makes the next sync fail.
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		sa.Annotations[DNSNamesAnnotation] = "app.example.com"
+		Expect(r.Update(context.Background(), sa)).To(Succeed())
+		spire.respondWith(http.StatusInternalServerError, `{"message":"datastore unavailable"}`)
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).To(HaveOccurred())
+
+		Expect(r.Get(context.Background(), req.NamespacedName, reg)).To(Succeed())
+		Expect(reg.Status.EntryID).To(Equal("entry-1"))
+		Expect(meta.IsStatusConditionFalse(reg.Status.Conditions, spirev1alpha1.ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(reg.Status.Conditions, spirev1alpha1.ConditionSyncing)).To(BeTrue())
+		failed := meta.FindStatusCondition(reg.Status.Conditions, spirev1alpha1.ConditionError)
+		Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+		Expect(failed.Message).To(ContainSubstring("datastore unavailable"))
+	})
+
+	It("should be owned by the ServiceAccount, so that it is garbage collected with it", func() {
+		sa := newManagedServiceAccount("app", "default")
+		sa.UID = "sa-uid"
+		orphan := &spirev1alpha1.SpireRegistration{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       spirev1alpha1.SpireRegistrationSpec{ServiceAccountName: "app"},
+		}
+		r := newTestReconciler(spire.URL, sa, orphan)
+		r.RegistrationStatus = true
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		reg := &spirev1alpha1.SpireRegistration{}
+		Expect(r.Get(context.Background(), req.NamespacedName, reg)).To(Succeed())
+		Expect(reg.OwnerReferences).To(ConsistOf(And(
+			HaveField("APIVersion", "v1"),
+			HaveField("Kind", "ServiceAccount"),
+			HaveField("Name", "app"),
+			HaveField("UID", sa.UID),
+			HaveField("Controller", HaveValue(BeTrue())),
+			HaveField("BlockOwnerDeletion", HaveValue(BeTrue())),
+		)))
+		Expect(reg.Status.EntryID).To(Equal("entry-1"))
+	})
+
+	It("should not create SpireRegistrations unless enabled", func() {
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(spire.URL, sa)
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+		Expect(err).NotTo(HaveOccurred())
+
+		regs := &spirev1alpha1.SpireRegistrationList{}
+		Expect(r.List(context.Background(), regs)).To(Succeed())
+		Expect(regs.Items).To(BeEmpty())
+	})
+})
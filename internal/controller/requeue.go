@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultRequeueJitterFraction spreads requeues over ±20% of their delay.
+	DefaultRequeueJitterFraction = 0.2
+
+	// DefaultRequeueBaseDelay is the requeue delay after the first failed reconcile
+	// of an object when failures are backed off by the reconciler.
+	DefaultRequeueBaseDelay = time.Second
+)
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns d scaled by a random factor in [1-fraction, 1+fraction], so that
+// ServiceAccounts asked to back off at the same time do not all come back at once.
+// The fraction is capped below 1 and the result is always positive.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 || fraction <= 0 {
+		return d
+	}
+	if fraction > 0.9 {
+		fraction = 0.9
+	}
+	jitterMu.Lock()
+	factor := 1 + fraction*(2*jitterRand.Float64()-1)
+	jitterMu.Unlock()
+
+	if jittered := time.Duration(float64(d) * factor); jittered > 0 {
+		return jittered
+	}
+	return d
+}
+
+// requeueBackoff counts the consecutive failed reconciles of each object and
+// doubles its requeue delay with every failure, up to a maximum. The count of an
+// object is reset by a successful reconcile, or once it has not failed for twice
+// the maximum delay, e.g. because it was deleted in between.
+type requeueBackoff struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]backoffState
+
+	// now is the clock of the back-off. When nil, time.Now is used.
+	now func() time.Time
+}
+
+type backoffState struct {
+	count int
+	last  time.Time
+}
+
+// next records a failure of key and returns its requeue delay: base after the
+// first failure, doubling up to maxDelay.
+func (b *requeueBackoff) next(key types.NamespacedName, base, maxDelay time.Duration) time.Duration {
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == nil {
+		b.failures = map[types.NamespacedName]backoffState{}
+	}
+	t := now()
+	state := b.failures[key]
+	if state.count > 0 && t.Sub(state.last) > 2*maxDelay {
+		state.count = 0
+	}
+	state.count++
+	state.last = t
+	b.failures[key] = state
+
+	delay := base
+	for i := 1; i < state.count && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// reset forgets the failures of key.
+func (b *requeueBackoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	delete(b.failures, key)
+	b.mu.Unlock()
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultReregisterJitter is the fraction by which the interval of the periodic
+// re-registration is randomized, so that replicas restarted together do not verify
+// their entries in lockstep.
+const DefaultReregisterJitter = 0.1
+
+var _ manager.LeaderElectionRunnable = &Reregistration{}
+
+// Reregistration periodically verifies that the entry recorded on every managed
+// ServiceAccount still exists in SPIRE and registers the ServiceAccounts whose entry
+// is gone again, e.g. after the SPIRE server lost its datastore. The entries of each
+// cluster are listed once per round on the server holding them, so an existing entry
+// is never created twice. It is added to the manager by the ServiceAccountReconciler
+// it is set on.
+type Reregistration struct {
+	// Interval is the time between two rounds, randomized by JitterFraction.
+	Interval       time.Duration
+	JitterFraction float64
+
+	reconciler *ServiceAccountReconciler
+	events     chan event.GenericEvent
+}
+
+// NewReregistration returns a Reregistration to pass to a ServiceAccountReconciler.
+func NewReregistration(interval time.Duration) *Reregistration {
+	return &Reregistration{
+		Interval:       interval,
+		JitterFraction: DefaultReregisterJitter,
+		events:         make(chan event.GenericEvent, 128),
+	}
+}
+
+// Start verifies the entries every Interval until ctx is cancelled.
+func (p *Reregistration) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("reregister")
+	ctx = log.IntoContext(ctx, logger)
+
+	for {
+		timer := time.NewTimer(jitter(p.Interval, p.JitterFraction))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+			if _, err := p.Verify(ctx); err != nil {
+				logger.Error(err, "Failed to verify SPIRE entries")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that only the
+// leader, whose controller registers the entries, verifies them.
+func (p *Reregistration) NeedLeaderElection() bool {
+	return true
+}
+
+// Verify lists the entries of the clusters of the managed ServiceAccounts once per
+// SPIRE server they were registered on and enqueues the ServiceAccounts whose
+// recorded entry is missing for registration. It returns how many were enqueued.
+// Clusters whose entries cannot be listed are skipped until the next round.
+func (p *Reregistration) Verify(ctx context.Context) (int, error) {
+	logger := log.FromContext(ctx)
+	r := p.reconciler
+
+	saList := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, saList); err != nil {
+		return 0, err
+	}
+
+	missing := 0
+	entries := map[entryList]map[string]bool{}
+	for i := range saList.Items {
+		sa := &saList.Items[i]
+		id := sa.Annotations[SVIDEntryIDAnnotation]
+		key := types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}
+		if id == "" || !r.Managed.Matches(sa) || r.IgnoredServiceAccounts[key] || sa.DeletionTimestamp != nil || paused(ctx, sa) {
+			continue
+		}
+		se, err := r.desiredEntry(ctx, sa)
+		if err != nil {
+			logger.Error(err, "Failed to render SPIRE entry for verification", "namespace", sa.Namespace, "name", sa.Name)
+			continue
+		}
+		// An entry is looked up on the server recorded at its registration.
+		list := entryList{cluster: se.Cluster, server: sa.Annotations[SpireServerAnnotation]}
+		registered, listed := entries[list]
+		if !listed {
+			var err error
+			if registered, err = p.listEntries(ctx, list); err != nil {
+				logger.Error(err, "Failed to list SPIRE entries for verification", "cluster", list.cluster, "server", list.server)
+				registered = nil
+			}
+			entries[list] = registered
+		}
+		if registered == nil || registered[id] {
+			continue
+		}
+
+		logger.Info("SPIRE entry is missing, registering again", "namespace", sa.Namespace, "name", sa.Name, "entryID", id)
+		r.missingEntries.Store(key, id)
+		select {
+		case p.events <- event.GenericEvent{Object: sa}:
+			missing++
+		case <-ctx.Done():
+			return missing, ctx.Err()
+		}
+	}
+	logger.Info("Verified SPIRE entries", "missing", missing)
+	return missing, nil
+}
+
+// entryList identifies a listing of the entries of a cluster on a SPIRE server. An
+// empty server is the whole pool.
+type entryList struct {
+	cluster, server string
+}
+
+// listEntries returns the IDs of the entries of list.cluster on list.server or, for
+// entries registered without recording their server, on every server of the pool,
+// as such an entry may have been created on any of them.
+func (p *Reregistration) listEntries(ctx context.Context, list entryList) (map[string]bool, error) {
+	c := p.reconciler.spireClient()
+	servers := []string{list.server}
+	if list.server == "" && c.Backend == nil && len(c.Pool.Servers) > 1 {
+		servers = servers[:0]
+		for _, api := range c.Pool.Servers {
+			servers = append(servers, api.GetServerURL())
+		}
+	}
+	registered := map[string]bool{}
+	for _, server := range servers {
+		entries, err := c.ListEntries(WithSpireServer(ctx, server), list.cluster)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			registered[entry.EntryID] = true
+		}
+	}
+	return registered, nil
+}
+
+// source returns the controller source of the ServiceAccounts found missing.
+func (p *Reregistration) source() source.Source {
+	return &source.Channel{Source: p.events}
+}
+
+// entryMissing reports whether the last verification found the entry id of the
+// ServiceAccount key missing, forgetting the finding.
+func (r *ServiceAccountReconciler) entryMissing(key client.ObjectKey, id string) bool {
+	missing, found := r.missingEntries.LoadAndDelete(key)
+	return found && missing == id
+}
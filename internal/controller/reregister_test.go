@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Periodic re-registration", func() {
+	var adds atomic.Int32
+	var down atomic.Bool
+	var server *httptest.Server
+	var r *ServiceAccountReconciler
+	var p *Reregistration
+
+	registered := func(name, id string) *corev1.ServiceAccount {
+		sa := newManagedServiceAccount(name, "default")
+		sa.Annotations[SVIDEntryIDAnnotation] = id
+		sa.Finalizers = []string{SpireFinalizer}
+		return sa
+	}
+
+	BeforeEach(func() {
+		adds.Store(0)
+		down.Store(false)
+		// The SPIRE server lost every entry but e-app.
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case down.Load():
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case req.URL.Path == "/v1/entries":
+				_, _ = w.Write([]byte(`{"entries":[
+					{"entryID":"e-app","namespace":"default","serviceAccount":"app","cluster":"test-cluster"}
+				]}`))
+			case req.URL.Path == "/v1/entries/add":
+				adds.Add(1)
+				_, _ = w.Write([]byte(`{"entryID":"e-new"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		unregistered := newManagedServiceAccount("new", "default")
+		r = newTestReconciler(server.URL, registered("app", "e-app"), registered("lost", "e-lost"), unregistered)
+		p = NewReregistration(time.Hour)
+		p.reconciler = r
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should enqueue only the ServiceAccounts whose entry is gone", func() {
+		missing, err := p.Verify(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal(1))
+		var e event.GenericEvent
+		Expect(p.events).To(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal("lost"))
+		Expect(p.events).NotTo(Receive())
+		Expect(adds.Load()).To(BeZero(), "verifying registers nothing")
+	})
+
+	It("should register a ServiceAccount found missing again", func() {
+		_, err := p.Verify(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		req := ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "lost"}}
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adds.Load()).To(Equal(int32(1)))
+		sa := &corev1.ServiceAccount{}
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "e-new"))
+
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adds.Load()).To(Equal(int32(1)), "the finding is consumed by the first reconcile")
+	})
+
+	It("should ignore a finding about an entry the ServiceAccount no longer records", func() {
+		r.missingEntries.Store(client.ObjectKey{Namespace: "default", Name: "app"}, "e-previous")
+		Expect(r.entryMissing(client.ObjectKey{Namespace: "default", Name: "app"}, "e-app")).To(BeFalse())
+	})
+
+	It("should skip clusters whose entries cannot be listed", func() {
+		down.Store(true)
+		missing, err := p.Verify(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeZero())
+		Expect(p.events).NotTo(Receive())
+	})
+
+	It("should look entries up on the server they were registered on", func() {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(`{"entries":[
+				{"entryID":"e-other","namespace":"default","serviceAccount":"pinned","cluster":"test-cluster"}
+			]}`))
+		}))
+		defer other.Close()
+		onServer := func(sa *corev1.ServiceAccount, server string) *corev1.ServiceAccount {
+			sa.Annotations[SpireServerAnnotation] = server
+			return sa
+		}
+		r = newTestReconciler(server.URL,
+			onServer(registered("pinned", "e-other"), other.URL),
+			onServer(registered("moved", "e-app"), other.URL),
+			registered("unpinned", "e-other"))
+		r.SpireClient = NewSpireClient(SpireAPI{Server: server.URL}, SpireAPI{Server: other.URL})
+		p.reconciler = r
+
+		missing, err := p.Verify(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal(1))
+		var e event.GenericEvent
+		Expect(p.events).To(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal("moved"))
+	})
+
+	It("should only run on the leader", func() {
+		Expect(p.NeedLeaderElection()).To(BeTrue())
+	})
+})
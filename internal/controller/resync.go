@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultResyncPath is the path of the resync endpoint on the metrics listener.
+const DefaultResyncPath = "/resync"
+
+// ResyncTrigger forces a reconcile of every managed ServiceAccount on demand, e.g.
+// to recover after the SPIRE server lost its data. A resync does not trust the
+// entry ID and hash annotations: every entry is sent to SPIRE again and recreated
+// if it no longer exists.
+type ResyncTrigger struct {
+	// Token, when set, must be presented as "Authorization: Bearer" to the HTTP handler.
+	Token *BearerToken
+
+	events chan event.GenericEvent
+}
+
+// NewResyncTrigger returns a ResyncTrigger to pass to a ServiceAccountReconciler.
+func NewResyncTrigger() *ResyncTrigger {
+	return &ResyncTrigger{events: make(chan event.GenericEvent, 1)}
+}
+
+// Trigger requests a resync. It returns false when a resync is already pending.
+func (t *ResyncTrigger) Trigger() bool {
+	select {
+	case t.events <- event.GenericEvent{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// NotifySignals triggers a resync whenever one of sigs is received, until ctx is done.
+func (t *ResyncTrigger) NotifySignals(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	logger := ctrl.Log.WithName("resync")
+	for {
+		select {
+		case sig := <-ch:
+			logger.Info("Received signal, resyncing managed ServiceAccounts", "signal", sig.String())
+			t.Trigger()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ServeHTTP triggers a resync on POST. It responds 202 Accepted, or 409 Conflict when
+// a resync is already pending.
+func (t *ResyncTrigger) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeRequest(w, req, t.Token, ctrl.Log.WithName("resync")) {
+		return
+	}
+	if !t.Trigger() {
+		http.Error(w, "resync already pending", http.StatusConflict)
+		return
+	}
+	ctrl.Log.WithName("resync").Info("Resync requested", "remoteAddr", req.RemoteAddr)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// source returns the controller source the reconciler watches for resyncs.
+func (t *ResyncTrigger) source() source.Source {
+	return &source.Channel{Source: t.events}
+}
+
+// resyncHandler enqueues all managed ServiceAccounts, marking them to be verified
+// against SPIRE regardless of their recorded entry hash.
+func (r *ServiceAccountReconciler) resyncHandler() handler.EventHandler {
+	return handler.Funcs{
+		GenericFunc: func(ctx context.Context, _ event.GenericEvent, q workqueue.RateLimitingInterface) {
+			logger := log.FromContext(ctx)
+			saList := &corev1.ServiceAccountList{}
+			if err := r.List(ctx, saList); err != nil {
+				logger.Error(err, "Failed to list ServiceAccounts to resync")
+				return
+			}
+			enqueued := 0
+			for _, sa := range saList.Items {
+				if !r.Managed.Matches(&sa) {
+					continue
+				}
+				key := client.ObjectKeyFromObject(&sa)
+				r.forcedSyncs.Store(key, true)
+				q.Add(reconcile.Request{NamespacedName: key})
+				enqueued++
+			}
+			logger.Info("Resyncing managed ServiceAccounts", "count", enqueued)
+		},
+	}
+}
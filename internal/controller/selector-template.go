@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ParseSelectorTemplate parses a Go text/template rendering the selectors of a
+// ServiceAccount, e.g.
+//
+//	k8s:ns:{{.Namespace}},k8s:sa:{{.Name}},k8s:pod-label:app:{{index .Labels "app"}}
+//
+// Referencing a missing label fails the rendering rather than producing an empty
+// value.
+func ParseSelectorTemplate(text string) (*template.Template, error) {
+	return template.New("selectors").Option("missingkey=error").Parse(text)
+}
+
+// entryTemplateSelectors renders the selectors of sa from the template in its
+// SelectorTemplateAnnotation, or else from defaultTemplate. The template is executed
+// against the ServiceAccount, so .Name, .Namespace, .Labels and .Annotations are
+// available, and renders comma or newline separated type:value selectors. None is
+// returned without a template.
+func entryTemplateSelectors(sa *corev1.ServiceAccount, defaultTemplate *template.Template) ([]string, error) {
+	tmpl, source := defaultTemplate, "the selector template"
+	if text, exists := sa.Annotations[SelectorTemplateAnnotation]; exists {
+		var err error
+		if tmpl, err = ParseSelectorTemplate(text); err != nil {
+			return nil, fmt.Errorf("invalid selector template in annotation %s: %w", SelectorTemplateAnnotation, err)
+		}
+		source = "the selector template of annotation " + SelectorTemplateAnnotation
+	}
+	if tmpl == nil {
+		return nil, nil
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, sa); err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", source, err)
+	}
+	selectors, err := parseSelectors(rendered.String(), "the output of "+source)
+	if err != nil {
+		return nil, err
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("%s rendered no selectors", source)
+	}
+	return selectors, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Selector templates", func() {
+	newLabeledServiceAccount := func() *corev1.ServiceAccount {
+		sa := newManagedServiceAccount("web", "payments")
+		sa.Labels = map[string]string{"app": "checkout", "pool": "gpu"}
+		return sa
+	}
+
+	DescribeTable("rendering the selectors of a ServiceAccount",
+		func(text string, expected []string, message string) {
+			tmpl, err := ParseSelectorTemplate(text)
+			Expect(err).NotTo(HaveOccurred())
+			selectors, err := entryTemplateSelectors(newLabeledServiceAccount(), tmpl)
+			if message != "" {
+				Expect(err).To(MatchError(ContainSubstring(message)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selectors).To(Equal(expected))
+		},
+		Entry("from the name and namespace", "k8s:ns:{{.Namespace}},k8s:sa:{{.Name}}",
+			[]string{"k8s:ns:payments", "k8s:sa:web"}, ""),
+		Entry("from the labels, one per line",
+			"k8s:pod-label:app:{{.Labels.app}}\n{{range $k, $v := .Labels}}k8s:pod-label:{{$k}}:{{$v}}\n{{end}}",
+			[]string{"k8s:pod-label:app:checkout", "k8s:pod-label:pool:gpu"}, ""),
+		Entry("with a conditional node pool", `k8s:sa:{{.Name}}{{if eq (index .Labels "pool") "gpu"}},k8s:node-label:pool:gpu{{end}}`,
+			[]string{"k8s:sa:web", "k8s:node-label:pool:gpu"}, ""),
+		Entry("referencing a missing label", "k8s:pod-label:tier:{{.Labels.tier}}", nil, "map has no entry for key"),
+		Entry("rendering an invalid selector", "k8s {{.Name}}", nil, "must be of the form type:value"),
+		Entry("rendering nothing", "{{if .Labels.app}}{{end}}", nil, "rendered no selectors"),
+	)
+
+	It("should prefer the template annotation over the default template", func() {
+		tmpl, err := ParseSelectorTemplate("k8s:sa:{{.Name}}")
+		Expect(err).NotTo(HaveOccurred())
+		sa := newLabeledServiceAccount()
+		sa.Annotations[SelectorTemplateAnnotation] = "k8s:ns:{{.Namespace}}"
+		Expect(entryTemplateSelectors(sa, tmpl)).To(Equal([]string{"k8s:ns:payments"}))
+
+		sa.Annotations[SelectorTemplateAnnotation] = "k8s:ns:{{.Namespace"
+		_, err = entryTemplateSelectors(sa, tmpl)
+		Expect(err).To(MatchError(ContainSubstring(SelectorTemplateAnnotation)))
+		Expect(entryTemplateSelectors(newManagedServiceAccount("web", "payments"), nil)).To(BeNil())
+	})
+
+	Context("When registering a ServiceAccount", func() {
+		var sent []SpireEntry
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			sent = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				sent = append(sent, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			DeferCleanup(server.Close)
+		})
+
+		It("should send the rendered selectors unless the selectors are annotated", func() {
+			r := newTestReconciler(server.URL)
+			var err error
+			r.SelectorTemplate, err = ParseSelectorTemplate("k8s:ns:{{.Namespace}},k8s:pod-label:app:{{.Labels.app}}")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.CreateEntry(context.Background(), newLabeledServiceAccount())
+			Expect(err).NotTo(HaveOccurred())
+			sa := newLabeledServiceAccount()
+			sa.Annotations[SelectorsAnnotation] = "unix:uid:1000"
+			_, err = r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sent).To(HaveLen(2))
+			Expect(sent[0].Selectors).To(Equal([]string{"k8s:ns:payments", "k8s:pod-label:app:checkout"}))
+			Expect(sent[1].Selectors).To(Equal([]string{"unix:uid:1000"}))
+		})
+
+		It("should fall back to the default selectors when the template fails", func() {
+			r := newTestReconciler(server.URL)
+			sa := newLabeledServiceAccount()
+			sa.Annotations[SelectorTemplateAnnotation] = "k8s:pod-label:tier:{{.Labels.tier}}"
+
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(HaveLen(1))
+			Expect(sent[0].Selectors).To(BeNil())
+		})
+	})
+})
@@ -18,101 +18,1044 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	spirev1alpha1 "github.com/shanmugara/spire-registrar/api/v1alpha1"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
 )
 
 const (
-	ManagedSpireAnnotation = "omegahome.net/managed-spire"
-	SVIDEntryIDAnnotation  = "omegahome.net/svid-entry-id"
-	SpireFinalizer         = "omegahome.net/spire-finalizer" // Finalizer to ensure SPIRE entries are cleaned up
+	ManagedSpireAnnotation  = "omegahome.net/managed-spire"
+	SVIDEntryIDAnnotation   = "omegahome.net/svid-entry-id"
+	SpireFinalizer          = "omegahome.net/spire-finalizer"      // Finalizer to ensure SPIRE entries are cleaned up
+	X509SvidTTLAnnotation   = "omegahome.net/spire-x509-svid-ttl"  // Per-SA override of the X509-SVID TTL in seconds
+	JWTSvidTTLAnnotation    = "omegahome.net/spire-jwt-svid-ttl"   // Per-SA override of the JWT-SVID TTL in seconds
+	DNSNamesAnnotation      = "omegahome.net/spire-dns-names"      // Comma-separated DNS SANs for the SVID
+	FederatesWithAnnotation = "omegahome.net/spire-federates-with" // Comma-separated spiffe:// trust domains to federate with
+	LastSyncAnnotation      = "omegahome.net/spire-last-sync"      // RFC3339 time of the last SPIRE sync attempt
+	SyncStatusAnnotation    = "omegahome.net/spire-sync-status"    // Result of the last SPIRE sync, Synced or Failed
+	SyncReasonAnnotation    = "omegahome.net/spire-sync-reason"    // Failure reason of the last SPIRE sync
+	EntryHashAnnotation     = "omegahome.net/spire-entry-hash"     // SHA-256 of the SpireEntry last sent to SPIRE
+	AdminAnnotation         = "omegahome.net/spire-admin"          // "true" grants the SVID admin privileges on the SPIRE server
+	SelectorsAnnotation     = "omegahome.net/spire-selectors"      // Comma or newline separated type:value workload selectors
+	DownstreamAnnotation    = "omegahome.net/spire-downstream"     // "true" allows the SVID to mint SVIDs as a downstream SPIRE server
+	ClusterNameAnnotation   = "omegahome.net/spire-cluster-name"   // Per-SA override of the cluster name of the SPIRE entry
+	HintAnnotation          = "omegahome.net/spire-hint"           // Hint letting workloads with several SVIDs tell them apart
+	SpireServerAnnotation   = "omegahome.net/spire-server"         // URL of the SPIRE server the entry was created on
+	PausedAnnotation        = "omegahome.net/spire-paused"         // "true" skips the SA entirely, e.g. during maintenance
+	SpiffeIDAnnotation      = "omegahome.net/spiffe-id"            // SPIFFE ID of the entry, written when AnnotateSpiffeID is set
 
+	SelectorTemplateAnnotation = "omegahome.net/spire-selector-template"  // Go template rendering the selectors from the SA
+	EntryTrustDomainAnnotation = "omegahome.net/spire-entry-trust-domain" // Trust domain the SPIRE entry is registered under
+	AppliedSelectorsAnnotation = "omegahome.net/spire-applied-selectors"  // Comma-separated selectors the SPIRE server applied
+	EntryJobAnnotation         = "omegahome.net/spire-entry-job"          // ID of the pending asynchronous creation of the SPIRE entry
+
+	DefaultClusterInfoDebounce = 10 * time.Second
+
+	// SyncFailedReason is the reason of the Warning event recorded for a failed sync.
+	SyncFailedReason = "SpireSyncFailed"
+	// EntryAlreadyDeletedReason is the reason of the Normal event recorded when the
+	// entry of a deleted ServiceAccount was already gone from SPIRE.
+	EntryAlreadyDeletedReason = "SpireEntryAlreadyDeleted"
+	// TrustDomainChangedReason is the reason of the Normal event recorded when the
+	// entry of a ServiceAccount is moved to a new trust domain.
+	TrustDomainChangedReason = "SpireTrustDomainChanged"
+	// EntryDeletedReason is the reason of the Normal event carrying the message the
+	// SPIRE server returned for the deletion of an entry.
+	EntryDeletedReason = "SpireEntryDeleted"
+
+	SyncStatusSynced = "Synced"
+	SyncStatusFailed = "Failed"
 )
 
 // ServiceAccountReconciler reconciles a ServiceAccount object
 type ServiceAccountReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// SpireClient talks to the SPIRE registrar API. When nil, DefaultSpireAPI is used.
+	SpireClient *SpireClient
+
+	// Recorder, when set, receives a Warning event on the ServiceAccount for every
+	// failed SPIRE sync.
+	Recorder record.EventRecorder
+
+	// X509SvidTTL and JWTSvidTTL are the default SVID lifetimes in seconds set on
+	// created entries. Zero leaves the SPIRE server default in place.
+	X509SvidTTL int
+	JWTSvidTTL  int
+
+	// ClusterName locates the cluster name in the cluster info ConfigMap.
+	ClusterName ClusterNameLookup
+
+	// RequireKubeConfig fails registrations when the admin kubeconfig Secret is missing
+	// or invalid instead of sending the entry without a kubeconfig.
+	RequireKubeConfig bool
+
+	// KubeConfigSecrets maps the cluster of an entry to the Secret of the kubeconfig it
+	// carries. When empty, every entry carries the admin kubeconfig.
+	KubeConfigSecrets KubeConfigSecrets
+
+	// ParentIDs maps the cluster of an entry to its parent SPIFFE ID. Entries of an
+	// unmapped cluster leave the parent to the SPIRE server.
+	ParentIDs ParentIDs
+
+	// AnnotateSpiffeID records the SPIFFE ID of the entry in SpiffeIDAnnotation, as
+	// reported by the SPIRE API on creation or else computed from the entry.
+	AnnotateSpiffeID bool
+
+	// SelectorTemplate, when set, renders the selectors of ServiceAccounts without a
+	// selectors or selector template annotation. See entryTemplateSelectors.
+	SelectorTemplate *template.Template
+
+	// FederatesWith lists the spiffe:// trust domains created entries federate with,
+	// unless overridden per ServiceAccount.
+	FederatesWith []string
+
+	// MaxConcurrentReconciles is the number of ServiceAccounts reconciled in parallel.
+	// Each worker issues at most one SPIRE API call at a time, so this also bounds the
+	// request concurrency against the SPIRE server. Defaults to 1.
+	MaxConcurrentReconciles int
+
+	// RateLimiterBaseDelay and RateLimiterMaxDelay bound the per-item exponential
+	// back-off of failed reconciles. When both are zero the controller-runtime default is used.
+	RateLimiterBaseDelay time.Duration
+	RateLimiterMaxDelay  time.Duration
+
+	// RequeueJitterFraction randomizes the requeue delays returned without an error,
+	// such as SPIRE Retry-After back-offs, by up to ± this fraction.
+	RequeueJitterFraction float64
+
+	// MaxRequeueInterval, when set, makes the reconciler back off failed reconciles
+	// itself: the requeue delay of a ServiceAccount starts at RateLimiterBaseDelay, or
+	// DefaultRequeueBaseDelay, doubles with each consecutive failure up to this cap and
+	// resets on success. Zero leaves failed reconciles to the work queue rate limiter.
+	MaxRequeueInterval time.Duration
+
+	// RegistrationStatus maintains a SpireRegistration named after each managed
+	// ServiceAccount, whose status reports the SPIRE entry ID and Ready, Syncing and
+	// Error conditions. It requires the SpireRegistration CRD to be installed.
+	RegistrationStatus bool
+
+	// DisableFinalizers stops the controller from adding its finalizer to ServiceAccounts.
+	// Entries are then deleted best-effort when a ServiceAccount delete is observed;
+	// deletes missed while the controller is down leave orphaned entries behind.
+	DisableFinalizers bool
+
+	// EntryState, when set, durably records created entry IDs so that they survive a
+	// crash between creating the entry and annotating the ServiceAccount.
+	EntryState *EntryStateStore
+
+	// Managed selects the ServiceAccounts to register, by ManagedSpireAnnotation and
+	// optionally a label.
+	Managed ManagedSelector
+
+	// IgnoredServiceAccounts are never registered, even when annotated as managed,
+	// e.g. the controller's own ServiceAccount.
+	IgnoredServiceAccounts map[types.NamespacedName]bool
+
+	// LogSkipped logs the reconciles of unmanaged ServiceAccounts, which are skipped,
+	// at info level. Otherwise they are only logged at debug verbosity, as every
+	// ServiceAccount of the cluster is reconciled.
+	LogSkipped bool
+
+	// NamespaceCleanup tells the reconciler that a NamespaceReconciler deletes the
+	// entries of deleted namespaces, so that an entry found already gone while its
+	// namespace is being deleted is expected rather than reported with an event.
+	NamespaceCleanup bool
+
+	// AdoptExistingEntries makes the controller look up an entry already registered
+	// for a managed ServiceAccount without an entry ID, e.g. created manually before
+	// the cluster was migrated to the controller, and adopt it instead of creating a
+	// duplicate.
+	AdoptExistingEntries bool
+
+	// ClusterInfoDebounce delays the re-reconcile of managed ServiceAccounts after the
+	// cluster info ConfigMap changes, so that a burst of updates enqueues each
+	// ServiceAccount once. Defaults to DefaultClusterInfoDebounce.
+	ClusterInfoDebounce time.Duration
+
+	// ShutdownGracePeriod is how long deletions in flight at shutdown may run on after
+	// the manager is stopped, so that their entries are not left dangling. Registrations
+	// reconciled after shutdown began are abandoned right away, freeing the workers for
+	// deletions; they are retried after restart. Zero cancels all reconciles at shutdown.
+	ShutdownGracePeriod time.Duration
+
+	// FailureLogInterval is how often a repeated identical sync failure of a
+	// ServiceAccount is logged; the occurrences in between are counted and reported
+	// with the next log line. Zero logs every failure.
+	FailureLogInterval time.Duration
+
+	// Resync, when set, lets operators force a reconcile of all managed ServiceAccounts
+	// that verifies each entry against SPIRE, recreating the missing ones.
+	Resync *ResyncTrigger
+
+	// Callbacks, when set, reconciles the ServiceAccounts whose entries the SPIRE
+	// server reports as expiring or pruned.
+	Callbacks *SpireCallbacks
+
+	// Reregistration, when set, periodically registers again the ServiceAccounts whose
+	// recorded entry is gone from SPIRE.
+	Reregistration *Reregistration
+
+	// History, when set, records the outcome of the recent reconciles of each
+	// ServiceAccount for the debug endpoint.
+	History *ReconcileHistory
+
+	// backoff tracks consecutive failures per ServiceAccount for MaxRequeueInterval.
+	backoff requeueBackoff
+
+	// failureLog throttles the logging of repeated sync failures.
+	failureLog logThrottle
+
+	// createFlight coalesces concurrent CreateEntry calls per ServiceAccount.
+	createFlight singleflight.Group
+
+	// kubeConfigs remembers the validated kubeconfigs of the rendered entries.
+	kubeConfigs kubeConfigCache
+
+	// forcedSyncs records the ServiceAccounts enqueued by a resync or a SPIRE callback
+	// that have not reconciled cleanly yet.
+	forcedSyncs sync.Map
+
+	// missingEntries records the entry IDs the last Reregistration round found missing,
+	// by ServiceAccount.
+	missingEntries sync.Map
+
+	// deletedEntries records, by UID, the deleting ServiceAccounts whose SPIRE entry is
+	// deleted but whose finalizer is not removed yet, so that retries skip the SPIRE call.
+	deletedEntries sync.Map
+
+	// observed records, by ServiceAccount, its observedHash as of its last clean
+	// reconcile, see skipObservedUpdates.
+	observed sync.Map
+
+	// warnedIgnored records the ignored ServiceAccounts already warned about.
+	warnedIgnored sync.Map
+
+	// pendingJobs records, by job ID, when the pending asynchronous entry creations
+	// were first seen, and whether they were reported as timed out.
+	pendingJobs sync.Map
+
+	// shutdown counts the reconciles drained and abandoned at shutdown.
+	shutdown shutdownStats
 }
 
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=spire.omegahome.net,resources=spireregistrations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=spire.omegahome.net,resources=spireregistrations/status,verbs=get;update;patch
 
 func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, outcome := withReconcileOutcome(ctx)
+	ctx, observed := withObservedHash(ctx)
+	result, err := r.reconcile(ctx, req)
+	r.History.recordOutcome(req.NamespacedName, outcome, result, err)
+	if err == nil && result.IsZero() {
+		r.forcedSyncs.Delete(req.NamespacedName)
+	}
+	if err == nil && result.IsZero() && *observed != "" {
+		r.observed.Store(req.NamespacedName, *observed)
+	} else {
+		r.observed.Delete(req.NamespacedName)
+	}
+	if err == nil {
+		r.failureLog.reset(log.FromContext(ctx), req.NamespacedName)
+	}
+	if r.MaxRequeueInterval <= 0 {
+		return result, err
+	}
+	if err == nil {
+		r.backoff.reset(req.NamespacedName)
+		return result, nil
+	}
+	// controller-runtime ignores RequeueAfter when an error is returned; the error
+	// has been logged by reconcile already.
+	baseDelay := r.RateLimiterBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = DefaultRequeueBaseDelay
+	}
+	after := jitter(r.backoff.next(req.NamespacedName, baseDelay, r.MaxRequeueInterval), r.RequeueJitterFraction)
+	if after > r.MaxRequeueInterval {
+		after = r.MaxRequeueInterval
+	}
+	log.FromContext(ctx).Info("Reconcile failed, backing off", "namespace", req.Namespace, "name", req.Name,
+		"requeueAfter", after)
+	return ctrl.Result{RequeueAfter: after}, nil
+}
+
+func (r *ServiceAccountReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("namespace", req.Namespace)
+	stopping := ctx
+	if r.ShutdownGracePeriod > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withShutdownGrace(ctx, r.ShutdownGracePeriod)
+		defer cancel()
+	}
 	sa := &corev1.ServiceAccount{}
 	if err := r.Get(ctx, req.NamespacedName, sa); err != nil {
 		// if the object is not found, return and don't requeue
+		if apierrors.IsNotFound(err) {
+			r.History.forget(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	r.noteObserved(ctx, sa)
+	// Every line logged for a registered ServiceAccount, including by the SPIRE
+	// client, carries its entry ID.
+	unregisteredCtx, unregisteredLogger := ctx, logger
+	if id := sa.Annotations[SVIDEntryIDAnnotation]; id != "" {
+		logger = logger.WithValues("entryID", id)
+		ctx = log.IntoContext(ctx, logger)
+	}
+
+	if r.IgnoredServiceAccounts[req.NamespacedName] {
+		if r.Managed.Matches(sa) {
+			if _, warned := r.warnedIgnored.LoadOrStore(req.NamespacedName, true); !warned {
+				logger.Error(nil, "ServiceAccount is annotated as managed but ignored, not registering it", "name", sa.Name)
+			}
+		}
+		return ctrl.Result{}, nil
+	}
 
 	// check for annotations
-	if value, exists := sa.Annotations[ManagedSpireAnnotation]; exists && value == "true" {
+	if r.Managed.Matches(sa) {
 		logger.Info("ServiceAccount is managed by SPIRE", "name", sa.Name)
 	} else {
-		logger.Info("ServiceAccount is not managed by SPIRE, skipping reconciliation", "name", sa.Name)
+		skipLogger := logger.V(1)
+		if r.LogSkipped {
+			skipLogger = logger
+		}
+		skipLogger.Info("ServiceAccount is not managed by SPIRE, skipping reconciliation", "name", sa.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// A paused ServiceAccount is skipped entirely: no SPIRE calls are made and, when
+	// it is being deleted, its finalizer stays until it is unpaused.
+	if paused(ctx, sa) {
+		logger.Info("ServiceAccount is paused, skipping reconciliation", "name", sa.Name)
 		return ctrl.Result{}, nil
 	}
 
+	if stopping.Err() != nil && sa.DeletionTimestamp == nil {
+		r.shutdown.abandoned.Add(1)
+		logger.Info("Shutting down, abandoning reconcile until restart", "name", sa.Name)
+		return ctrl.Result{}, nil
+	}
+
+	svidEntryID, fromState, err := r.recordedEntryID(ctx, sa)
+	if err != nil {
+		logger.Error(err, "Failed to read SPIRE entry state", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	if fromState {
+		logger = logger.WithValues("entryID", svidEntryID)
+		ctx = log.IntoContext(ctx, logger)
+	}
+
 	// Check for deletion
 	if sa.DeletionTimestamp != nil {
 		logger.Info("ServiceAccount is being deleted", "name", sa.Name)
-		err := r.DeleteEntry(ctx, sa)
+		noteReconcileAction(ctx, ReconcileActionDelete, svidEntryID)
+		var err error
+		if _, deleted := r.deletedEntries.Load(sa.UID); deleted {
+			logger.Info("SPIRE entry already deleted, retrying finalizer removal", "name", sa.Name)
+		} else {
+			deleteCtx, message := withDeleteMessage(ctx)
+			err = r.DeleteEntry(deleteCtx, sa)
+			if err == nil && *message != "" && r.Recorder != nil {
+				r.Recorder.Event(sa, corev1.EventTypeNormal, EntryDeletedReason, "SPIRE entry deleted: "+*message)
+			}
+		}
+		// An entry already gone is as good as deleted: the finalizer is released. Server
+		// errors still fail the reconcile and are retried.
+		if errors.Is(err, ErrEntryNotFound) {
+			if r.NamespaceCleanup && r.namespaceDeleting(ctx, sa.Namespace) {
+				logger.Info("SPIRE entry already deleted with its namespace", "name", sa.Name)
+			} else {
+				logger.Info("SPIRE entry already deleted", "name", sa.Name)
+				if r.Recorder != nil {
+					r.Recorder.Event(sa, corev1.EventTypeNormal, EntryAlreadyDeletedReason, "SPIRE entry was already deleted")
+				}
+			}
+			err = nil
+		}
+		if stopping.Err() != nil && err == nil {
+			r.shutdown.drained.Add(1)
+		}
+		r.recordSyncStatus(ctx, sa, err)
+		if after, ok := retryAfter(err); ok {
+			logger.Info("SPIRE server is rate limiting, backing off", "name", sa.Name, "retryAfter", after)
+			return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
+		}
 		if err != nil {
-			logger.Error(err, "Failed to delete SPIRE entry for ServiceAccount during cleanup", "name", sa.Name)
+			r.logFailure(ctx, sa, err, "Failed to delete SPIRE entry for ServiceAccount during cleanup")
 			return ctrl.Result{RequeueAfter: 15}, err
 		}
+		if r.spireClient().DryRun {
+			logger.Info("Dry run: leaving finalizer in place", "name", sa.Name)
+			return ctrl.Result{}, nil
+		}
+		r.deletedEntries.Store(sa.UID, true)
+
+		if r.EntryState != nil {
+			if err := r.EntryState.Forget(ctx, req.NamespacedName); err != nil {
+				logger.Error(err, "Failed to remove SPIRE entry state", "name", sa.Name)
+				return ctrl.Result{RequeueAfter: 15}, err
+			}
+		}
 
 		if controllerutil.ContainsFinalizer(sa, SpireFinalizer) {
-			controllerutil.RemoveFinalizer(sa, SpireFinalizer)
-			if err := r.Update(ctx, sa); err != nil {
+			err := r.updateServiceAccount(ctx, sa, func(sa *corev1.ServiceAccount) {
+				controllerutil.RemoveFinalizer(sa, SpireFinalizer)
+			})
+			if client.IgnoreNotFound(err) != nil {
 				logger.Error(err, "Failed to remove finalizer", "name", sa.Name)
 				return ctrl.Result{RequeueAfter: 15}, err
 			} else {
 				logger.Info("Removed finalizer", "name", sa.Name)
 			}
 		}
+		r.deletedEntries.Delete(sa.UID)
 		return ctrl.Result{}, nil
 	}
 
-	if svidEntryID, exists := sa.Annotations[SVIDEntryIDAnnotation]; exists && svidEntryID != "" {
-		logger.Info("ServiceAccount has a valid SVID", "SVIDEntryID", svidEntryID)
-		return ctrl.Result{}, nil
+	if svidEntryID != "" {
+		logger.Info("ServiceAccount has a valid SVID")
+		noteReconcileAction(ctx, ReconcileActionSync, svidEntryID)
+		var result ctrl.Result
+		var err error
+		if r.entryMissing(req.NamespacedName, svidEntryID) {
+			err = ErrEntryNotFound
+		} else {
+			_, forced := r.forcedSyncs.Load(req.NamespacedName)
+			result, err = r.syncEntry(ctx, sa, entryID(svidEntryID), forced)
+		}
+		// An entry ID only recorded in the entry state stays there: the ServiceAccount
+		// just gets the finalizer it may have missed.
+		if err == nil && fromState {
+			result, err = r.ensureFinalizer(ctx, sa)
+		}
+		if !errors.Is(err, ErrEntryNotFound) {
+			return result, err
+		}
+		logger.Info("SPIRE entry no longer exists. registering again...", "name", sa.Name)
+		delete(sa.Annotations, SVIDEntryIDAnnotation)
+		delete(sa.Annotations, SpireServerAnnotation)
+		if r.EntryState != nil {
+			if err := r.EntryState.Forget(ctx, req.NamespacedName); err != nil {
+				logger.Error(err, "Failed to remove SPIRE entry state", "name", sa.Name)
+				return ctrl.Result{RequeueAfter: 15}, err
+			}
+		}
+		ctx, logger = unregisteredCtx, unregisteredLogger
+	}
 
-	} else {
-		logger.Info("ServiceAccount does not have an SVID. registering...", "name", sa.Name)
-		entryID, err := r.CreateEntry(ctx, sa)
-		if err != nil {
-			logger.Error(err, "Failed to create SPIRE entry for ServiceAccount", "name", sa.Name)
-			return ctrl.Result{RequeueAfter: 15}, err
+	// The entry of a creation the SPIRE API accepted asynchronously is taken from its job.
+	if job := sa.Annotations[EntryJobAnnotation]; job != "" {
+		return r.reconcileEntryJob(ctx, sa, job)
+	}
+
+	logger.Info("ServiceAccount does not have an SVID. registering...", "name", sa.Name)
+	noteReconcileAction(ctx, ReconcileActionRegister, "")
+	var reg registration
+	if r.AdoptExistingEntries {
+		reg.id, err = r.adoptEntry(ctx, sa)
+	}
+	if err == nil && reg.id == nil {
+		r.markSyncing(ctx, sa)
+		reg, err = r.registerEntry(withEntryJobs(ctx), sa)
+	}
+	var pending *JobPendingError
+	if errors.As(err, &pending) {
+		return r.recordEntryJob(ctx, sa, pending, reg)
+	}
+	if err != nil {
+		r.recordSyncStatus(ctx, sa, err)
+		// Honour the server's back-off instead of the rate limiter; returning the
+		// error would make controller-runtime ignore RequeueAfter.
+		if after, ok := retryAfter(err); ok {
+			logger.Info("SPIRE server is rate limiting, backing off", "name", sa.Name, "retryAfter", after)
+			return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
 		}
-		// Update the ServiceAccount with the SVID entry ID
-		sa.Annotations[SVIDEntryIDAnnotation] = string(*entryID)
-		if err := r.Update(ctx, sa); err != nil {
-			logger.Error(err, "Failed to update ServiceAccount with SVID entryID", "name", sa.Name)
+		r.logFailure(ctx, sa, err, "Failed to create SPIRE entry for ServiceAccount")
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	return r.persistRegistration(ctx, sa, reg)
+}
+
+// persistRegistration records the registered entry of sa: its entry state and, in a
+// single update, the SVID entry ID, the finalizer ensuring the entry is cleaned up
+// when the ServiceAccount is deleted and the sync status.
+func (r *ServiceAccountReconciler) persistRegistration(ctx context.Context, sa *corev1.ServiceAccount, reg registration) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("entryID", string(*reg.id))
+	ctx = log.IntoContext(ctx, logger)
+	noteReconcileAction(ctx, ReconcileActionRegister, string(*reg.id))
+	if r.spireClient().DryRun {
+		logger.Info("Dry run: not persisting SVID entryID or finalizer", "name", sa.Name)
+		return ctrl.Result{}, nil
+	}
+	if r.EntryState != nil {
+		if err := r.EntryState.Record(ctx, sa, *reg.id); err != nil {
+			logger.Error(err, "Failed to record SPIRE entry state", "name", sa.Name)
 			return ctrl.Result{RequeueAfter: 15}, err
 		}
-		// Add finalizer to ensure cleanup of SPIRE entry when the ServiceAccount is deleted
-		if !controllerutil.ContainsFinalizer(sa, SpireFinalizer) {
+	}
+	var spiffeID string
+	if r.AnnotateSpiffeID {
+		spiffeID = r.spiffeIDFor(ctx, sa, reg.spiffeID)
+	}
+	err := r.updateServiceAccount(ctx, sa, func(sa *corev1.ServiceAccount) {
+		if sa.Annotations == nil {
+			sa.Annotations = map[string]string{}
+		}
+		sa.Annotations[SVIDEntryIDAnnotation] = string(*reg.id)
+		delete(sa.Annotations, EntryJobAnnotation)
+		if spiffeID != "" {
+			sa.Annotations[SpiffeIDAnnotation] = spiffeID
+		}
+		sa.Annotations[EntryHashAnnotation] = reg.hash
+		// An adopted entry's trust domain and selectors are recorded by its first update.
+		setAppliedSelectors(sa, reg.selectors)
+		if reg.trustDomain != "" {
+			sa.Annotations[EntryTrustDomainAnnotation] = reg.trustDomain
+		} else {
+			delete(sa.Annotations, EntryTrustDomainAnnotation)
+		}
+		if reg.server != "" {
+			sa.Annotations[SpireServerAnnotation] = reg.server
+		} else {
+			delete(sa.Annotations, SpireServerAnnotation)
+		}
+		if !r.DisableFinalizers {
 			controllerutil.AddFinalizer(sa, SpireFinalizer)
-			if err := r.Update(ctx, sa); err != nil {
-				logger.Error(err, "Failed to add finalizer ", "name", sa.Name)
+		}
+		setSyncStatus(sa, nil)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to update ServiceAccount with SVID entryID", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	r.recordRegistration(ctx, sa, nil)
+
+	return ctrl.Result{}, nil
+}
+
+// updateServiceAccount applies mutate to sa and updates it. When the update conflicts
+// with a concurrent change, sa is read again and mutate re-applied, so that the
+// conflict resolves within the reconcile instead of through the work queue.
+func (r *ServiceAccountReconciler) updateServiceAccount(ctx context.Context, sa *corev1.ServiceAccount, mutate func(*corev1.ServiceAccount)) error {
+	attempt := 0
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if attempt++; attempt > 1 {
+			log.FromContext(ctx).Info("ServiceAccount changed concurrently, retrying update", "name", sa.Name, "attempt", attempt)
+			if err := r.Get(ctx, client.ObjectKeyFromObject(sa), sa); err != nil {
+				return err
+			}
+		}
+		mutate(sa)
+		return r.Update(ctx, sa)
+	})
+}
+
+// paused reports whether sa carries PausedAnnotation. An invalid value is logged
+// and does not pause the ServiceAccount.
+func paused(ctx context.Context, sa *corev1.ServiceAccount) bool {
+	isPaused, err := entryFlag(sa, PausedAnnotation)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Ignoring invalid paused annotation", "name", sa.Name)
+	}
+	return isPaused
+}
+
+// recordedEntryID returns the entry ID of sa: its annotation or, when the annotation
+// was never written or was removed by migrate-state, the ID recorded in the entry
+// state. fromState reports the latter. The ID is not written back to the annotation,
+// and an entry without a hash annotation has its hash backfilled on sync.
+func (r *ServiceAccountReconciler) recordedEntryID(ctx context.Context, sa *corev1.ServiceAccount) (id string, fromState bool, err error) {
+	if id := sa.Annotations[SVIDEntryIDAnnotation]; id != "" || r.EntryState == nil {
+		return id, false, nil
+	}
+	id, found, err := r.EntryState.Lookup(ctx, sa)
+	if err != nil || !found {
+		return "", false, err
+	}
+	log.FromContext(ctx).V(1).Info("Using SPIRE entry ID from entry state", "name", sa.Name, "entryID", id)
+	return id, true, nil
+}
+
+// ensureFinalizer adds the finalizer to sa when finalizers are managed and it is
+// missing.
+func (r *ServiceAccountReconciler) ensureFinalizer(ctx context.Context, sa *corev1.ServiceAccount) (ctrl.Result, error) {
+	if r.DisableFinalizers || r.spireClient().DryRun || controllerutil.ContainsFinalizer(sa, SpireFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	err := r.updateServiceAccount(ctx, sa, func(sa *corev1.ServiceAccount) {
+		controllerutil.AddFinalizer(sa, SpireFinalizer)
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to add finalizer", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// namespaceDeleting reports whether the namespace is being deleted or already gone.
+func (r *ServiceAccountReconciler) namespaceDeleting(ctx context.Context, name string) bool {
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+		return apierrors.IsNotFound(err)
+	}
+	return ns.DeletionTimestamp != nil
+}
+
+// adoptEntry returns the ID of an entry registered for the ServiceAccount outside of
+// the controller, e.g. before the cluster was migrated to it, or nil when there is
+// none. Like a recovered entry, the adopted entry has no hash annotation, so the
+// next reconcile brings it up to date.
+func (r *ServiceAccountReconciler) adoptEntry(ctx context.Context, sa *corev1.ServiceAccount) (*entryID, error) {
+	logger := log.FromContext(ctx)
+
+	se, err := r.desiredEntry(ctx, sa)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.spireClient().ListEntries(ctx, se.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, entry := range entries {
+		if entry.EntryID != "" && adoptableEntry(entry.SpireEntry, se) {
+			matches = append(matches, entry.EntryID)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	if len(matches) > 1 {
+		logger.Error(nil, "Several SPIRE entries match the ServiceAccount, adopting the first", "name", sa.Name, "entryIDs", matches)
+	}
+	logger.Info("Adopting existing SPIRE entry", "name", sa.Name, "entryID", matches[0])
+	eID := entryID(matches[0])
+	return &eID, nil
+}
+
+// adoptableEntry reports whether registered is an entry for the same ServiceAccount
+// as desired: a ServiceAccount-level entry of the same namespace and name, in the
+// same trust domain when registered has one, and with the same selectors when the
+// ServiceAccount sets them.
+func adoptableEntry(registered, desired SpireEntry) bool {
+	if registered.Namespace != desired.Namespace || registered.ServiceAccount != desired.ServiceAccount || registered.Pod != "" {
+		return false
+	}
+	if registered.TrustDomain != "" && registered.TrustDomain != desired.TrustDomain {
+		return false
+	}
+	if len(desired.Selectors) > 0 && !slices.Equal(sortedCopy(registered.Selectors), sortedCopy(desired.Selectors)) {
+		return false
+	}
+	return true
+}
+
+// syncEntry updates the registered SPIRE entry when the rendered entry no longer
+// matches the hash recorded at the last sync, so that steady-state reconciles do
+// not call the SPIRE API. When forced, as on a resync, the entry is updated regardless
+// of the hash. It returns ErrEntryNotFound when the entry is gone, and
+// ErrUpdateUnsupported, leaving the entry as is, when the SPIRE API cannot update it.
+func (r *ServiceAccountReconciler) syncEntry(ctx context.Context, sa *corev1.ServiceAccount, id entryID, forced bool) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	se, err := r.desiredEntry(ctx, sa)
+	if err != nil {
+		r.logFailure(ctx, sa, err, "Failed to render SPIRE entry for ServiceAccount")
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	if recorded := sa.Annotations[EntryTrustDomainAnnotation]; recorded != "" && recorded != se.TrustDomain {
+		return r.moveTrustDomain(ctx, sa, id, recorded, se)
+	}
+	// Entries registered before the hash was tracked have no hash annotation. They are
+	// taken as up to date and the hash is backfilled, rather than every entry updated
+	// on the first reconcile after an upgrade.
+	recordedHash, hashRecorded := sa.Annotations[EntryHashAnnotation]
+	if !forced && (!hashRecorded || hashEntry(se) == recordedHash) {
+		lastSuccessfulSync.SetToCurrentTime()
+		r.recordRegistration(ctx, sa, nil)
+		// ServiceAccounts registered before AnnotateSpiffeID was set, or before the trust
+		// domain of their entry was recorded, are annotated now.
+		staleSpiffeID := r.AnnotateSpiffeID && sa.Annotations[SpiffeIDAnnotation] != entrySpiffeID(se)
+		if !hashRecorded && r.spireClient().DryRun {
+			logger.Info("Dry run: not backfilling SPIRE entry hash", "name", sa.Name)
+			return ctrl.Result{}, nil
+		}
+		if !hashRecorded || staleSpiffeID || sa.Annotations[EntryTrustDomainAnnotation] != se.TrustDomain {
+			if !hashRecorded {
+				logger.Info("Backfilling SPIRE entry hash", "name", sa.Name)
+			}
+			patch := client.MergeFrom(sa.DeepCopy())
+			if sa.Annotations == nil {
+				sa.Annotations = map[string]string{}
+			}
+			if r.AnnotateSpiffeID {
+				sa.Annotations[SpiffeIDAnnotation] = entrySpiffeID(se)
+			}
+			sa.Annotations[EntryHashAnnotation] = hashEntry(se)
+			sa.Annotations[EntryTrustDomainAnnotation] = se.TrustDomain
+			if err := r.Patch(ctx, sa, patch); err != nil {
+				logger.Error(err, "Failed to annotate ServiceAccount with its SPIRE entry", "name", sa.Name)
 				return ctrl.Result{RequeueAfter: 15}, err
 			}
 		}
+		return ctrl.Result{}, nil
 	}
 
+	if forced {
+		logger.Info("Resyncing SPIRE entry", "name", sa.Name)
+	} else {
+		logger.Info("SPIRE entry is out of date. updating...", "name", sa.Name)
+	}
+	r.markSyncing(ctx, sa)
+	if err := r.checkEntryOwner(ctx, sa, id, se); err != nil {
+		if errors.Is(err, ErrEntryNotFound) {
+			return ctrl.Result{}, err
+		}
+		r.recordSyncStatus(ctx, sa, err)
+		logger.Error(err, "Failed to remove stale SPIRE entry", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	updateCtx, selectors := withAppliedSelectors(ctx, se.Selectors)
+	hash, err := r.UpdateEntry(updateCtx, sa, id)
+	if errors.Is(err, ErrEntryNotFound) {
+		return ctrl.Result{}, err
+	}
+	r.recordSyncStatus(ctx, sa, err)
+	if after, ok := retryAfter(err); ok {
+		logger.Info("SPIRE server is rate limiting, backing off", "name", sa.Name, "retryAfter", after)
+		return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
+	}
+	if err != nil {
+		r.logFailure(ctx, sa, err, "Failed to update SPIRE entry for ServiceAccount")
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	if r.spireClient().DryRun {
+		logger.Info("Dry run: not persisting SPIRE entry hash", "name", sa.Name)
+		return ctrl.Result{}, nil
+	}
+
+	patch := client.MergeFrom(sa.DeepCopy())
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	sa.Annotations[EntryHashAnnotation] = hash
+	sa.Annotations[EntryTrustDomainAnnotation] = se.TrustDomain
+	setAppliedSelectors(sa, *selectors)
+	if r.AnnotateSpiffeID {
+		sa.Annotations[SpiffeIDAnnotation] = entrySpiffeID(se)
+	}
+	if err := r.Patch(ctx, sa, patch); err != nil {
+		logger.Error(err, "Failed to record SPIRE entry hash", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
 	return ctrl.Result{}, nil
 }
 
+// moveTrustDomain deletes the entry id, registered under the trust domain recorded in
+// EntryTrustDomainAnnotation, after the trust domain of sa changed, e.g. with the
+// annotation of the cluster info ConfigMap. A SPIFFE ID cannot move between trust
+// domains, so the entry is not updated in place: ErrEntryNotFound is returned once
+// it is gone, so that the ServiceAccount is registered again under se.TrustDomain.
+func (r *ServiceAccountReconciler) moveTrustDomain(ctx context.Context, sa *corev1.ServiceAccount, id entryID, recorded string, se SpireEntry) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Trust domain changed, moving SPIRE entry", "name", sa.Name, "from", recorded, "to", se.TrustDomain)
+
+	old := se
+	old.TrustDomain, old.KubeConfig = recorded, ""
+	err := r.spireClient().RemoveEntry(WithSpireServer(ctx, sa.Annotations[SpireServerAnnotation]), id, old)
+	countRegistration("delete", old, err)
+	if err != nil && !errors.Is(err, ErrEntryNotFound) {
+		r.recordSyncStatus(ctx, sa, err)
+		r.logFailure(ctx, sa, err, "Failed to delete SPIRE entry of the previous trust domain")
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(sa, corev1.EventTypeNormal, TrustDomainChangedReason,
+			"Moving SPIRE entry %s from trust domain %s to %s", id, recorded, se.TrustDomain)
+	}
+	return ctrl.Result{}, fmt.Errorf("%w: entry %s was registered under trust domain %s", ErrEntryNotFound, id, recorded)
+}
+
+// checkEntryOwner verifies that the registered entry id belongs to sa. A ServiceAccount
+// deleted and recreated under the same name, e.g. by a GitOps reapply, may carry the
+// entry ID annotation of its predecessor; its entry is then removed and
+// ErrEntryNotFound returned, so that the ServiceAccount is registered again. The
+// check lists the entries of the cluster, so it only runs when the entry is about to
+// be updated anyway; a failure to list is logged and the update goes ahead.
+func (r *ServiceAccountReconciler) checkEntryOwner(ctx context.Context, sa *corev1.ServiceAccount, id entryID, se SpireEntry) error {
+	logger := log.FromContext(ctx)
+
+	entries, err := r.spireClient().ListEntries(ctx, se.Cluster)
+	if err != nil {
+		logger.Info("Unable to verify the owner of the SPIRE entry", "name", sa.Name, "error", err.Error())
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.EntryID != string(id) {
+			continue
+		}
+		if entry.ServiceAccountUID == "" || entry.ServiceAccountUID == string(sa.UID) {
+			return nil
+		}
+		logger.Info("SPIRE entry belongs to a previous ServiceAccount of the same name, removing it",
+			"name", sa.Name, "entryUID", entry.ServiceAccountUID, "uid", sa.UID)
+		err := r.spireClient().RemoveEntry(WithSpireServer(ctx, sa.Annotations[SpireServerAnnotation]), id, entry.SpireEntry)
+		if err != nil && !errors.Is(err, ErrEntryNotFound) {
+			return err
+		}
+		return fmt.Errorf("%w: entry %s belongs to ServiceAccount UID %s", ErrEntryNotFound, id, entry.ServiceAccountUID)
+	}
+	return nil
+}
+
+// recordSyncStatus patches the result of the last SPIRE call onto the ServiceAccount
+// annotations. Failures to record are logged and otherwise ignored.
+func (r *ServiceAccountReconciler) recordSyncStatus(ctx context.Context, sa *corev1.ServiceAccount, syncErr error) {
+	logger := log.FromContext(ctx)
+	if syncErr != nil && r.Recorder != nil {
+		r.Recorder.Event(sa, corev1.EventTypeWarning, SyncFailedReason, syncErr.Error())
+	}
+	if r.spireClient().DryRun {
+		return
+	}
+	patch := client.MergeFrom(sa.DeepCopy())
+	setSyncStatus(sa, syncErr)
+	if err := r.Patch(ctx, sa, patch); err != nil {
+		logger.Error(err, "Failed to record SPIRE sync status", "name", sa.Name)
+	}
+	r.recordRegistration(ctx, sa, syncErr)
+}
+
+// setSyncStatus sets the sync status annotations of sa for the result of a SPIRE sync.
+func setSyncStatus(sa *corev1.ServiceAccount, syncErr error) {
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	sa.Annotations[LastSyncAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	if syncErr != nil {
+		sa.Annotations[SyncStatusAnnotation] = SyncStatusFailed
+		sa.Annotations[SyncReasonAnnotation] = syncErr.Error()
+	} else {
+		sa.Annotations[SyncStatusAnnotation] = SyncStatusSynced
+		delete(sa.Annotations, SyncReasonAnnotation)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ServiceAccountReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.ServiceAccount{}).
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.ServiceAccount{}, builder.WithPredicates(r.Managed.predicate(), ignoreSyncStatusUpdates(), r.skipObservedUpdates())).
+		Watches(&corev1.ConfigMap{}, r.clusterInfoHandler(), builder.WithPredicates(isClusterInfo(r.ClusterName), predicate.ResourceVersionChangedPredicate{}))
+	if r.DisableFinalizers {
+		b = b.Watches(&corev1.ServiceAccount{}, r.deletedServiceAccountHandler())
+	}
+	if r.RegistrationStatus {
+		// Recreate deleted SpireRegistrations; their own status updates are ignored.
+		b = b.Owns(&spirev1alpha1.SpireRegistration{}, builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	if r.Resync != nil {
+		b = b.WatchesRawSource(r.Resync.source(), r.resyncHandler())
+	}
+	if r.Callbacks != nil {
+		r.Callbacks.reader, r.Callbacks.managed = mgr.GetClient(), r.Managed
+		b = b.WatchesRawSource(r.Callbacks.source(), r.callbackHandler())
+	}
+	if r.Reregistration != nil {
+		r.Reregistration.reconciler = r
+		if err := mgr.Add(r.Reregistration); err != nil {
+			return err
+		}
+		b = b.WatchesRawSource(r.Reregistration.source(), &handler.EnqueueRequestForObject{})
+	}
+	return b.
+		WithOptions(crcontroller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.rateLimiter(),
+		}).
 		Complete(r)
 }
+
+// deletedServiceAccountTimeout bounds the best-effort entry deletion of a deleted
+// ServiceAccount without a finalizer.
+const deletedServiceAccountTimeout = 30 * time.Second
+
+// deletedServiceAccountHandler deletes the SPIRE entry of a managed ServiceAccount
+// once it is gone. It only applies when finalizers are disabled, as the object can no
+// longer be reconciled then. Deletion is best-effort: failures are logged, not retried.
+func (r *ServiceAccountReconciler) deletedServiceAccountHandler() handler.EventHandler {
+	return handler.Funcs{
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+			sa, ok := e.Object.(*corev1.ServiceAccount)
+			// Without an entry ID annotation, the entry may still be recorded in the entry
+			// state; DeleteEntry looks it up.
+			if !ok || !r.Managed.Matches(sa) || sa.Annotations[SVIDEntryIDAnnotation] == "" && r.EntryState == nil {
+				return
+			}
+			// Left over from when finalizers were managed: the reconcile deletes the entry.
+			if controllerutil.ContainsFinalizer(sa, SpireFinalizer) {
+				return
+			}
+			if paused(ctx, sa) {
+				log.FromContext(ctx).Info("Deleted ServiceAccount was paused, leaving its SPIRE entry in place",
+					"namespace", sa.Namespace, "name", sa.Name)
+				return
+			}
+
+			logger := log.FromContext(ctx).WithValues("namespace", sa.Namespace, "name", sa.Name,
+				"entryID", sa.Annotations[SVIDEntryIDAnnotation])
+			go func() {
+				ctx, cancel := context.WithTimeout(log.IntoContext(context.Background(), logger), deletedServiceAccountTimeout)
+				defer cancel()
+				if id, _, err := r.recordedEntryID(ctx, sa); err != nil {
+					logger.Error(err, "Failed to read SPIRE entry state of deleted ServiceAccount")
+					return
+				} else if id == "" {
+					return
+				}
+				if err := r.DeleteEntry(ctx, sa); err != nil {
+					logger.Error(err, "Failed to delete SPIRE entry of deleted ServiceAccount")
+					return
+				}
+				logger.Info("Deleted SPIRE entry of deleted ServiceAccount")
+				if r.EntryState != nil {
+					if err := r.EntryState.Forget(ctx, client.ObjectKeyFromObject(sa)); err != nil {
+						logger.Error(err, "Failed to remove SPIRE entry state")
+					}
+				}
+			}()
+		},
+	}
+}
+
+// clusterInfoHandler enqueues all managed ServiceAccounts when the cluster info
+// ConfigMap is created or updated, so that their entries pick up a changed trust
+// domain or cluster name. The requests are delayed by ClusterInfoDebounce; the work
+// queue keeps a single pending request per ServiceAccount, which collapses bursts.
+func (r *ServiceAccountReconciler) clusterInfoHandler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, _ event.CreateEvent, q workqueue.RateLimitingInterface) {
+			r.enqueueManagedServiceAccounts(ctx, q)
+		},
+		UpdateFunc: func(ctx context.Context, _ event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			r.enqueueManagedServiceAccounts(ctx, q)
+		},
+	}
+}
+
+func (r *ServiceAccountReconciler) enqueueManagedServiceAccounts(ctx context.Context, q workqueue.RateLimitingInterface) {
+	logger := log.FromContext(ctx)
+	saList := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, saList); err != nil {
+		logger.Error(err, "Failed to list ServiceAccounts after cluster info change")
+		return
+	}
+
+	debounce := r.ClusterInfoDebounce
+	if debounce <= 0 {
+		debounce = DefaultClusterInfoDebounce
+	}
+	enqueued := 0
+	for _, sa := range saList.Items {
+		if !r.Managed.Matches(&sa) {
+			continue
+		}
+		q.AddAfter(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&sa)}, debounce)
+		enqueued++
+	}
+	logger.Info("Cluster info changed, re-reconciling managed ServiceAccounts", "count", enqueued, "after", debounce)
+}
+
+// isClusterInfo selects the cluster info ConfigMap and the ConfigMap holding the
+// trust domain, if any.
+func isClusterInfo(names ClusterNameLookup) predicate.Predicate {
+	trustDomain := names.TrustDomain.ConfigMap
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		if trustDomain.Name != "" && obj.GetNamespace() == trustDomain.Namespace && obj.GetName() == trustDomain.Name {
+			return true
+		}
+		return obj.GetNamespace() == ClusterInfoCmNamespace && obj.GetName() == ClusterInfoCm
+	})
+}
+
+// rateLimiter returns the work queue rate limiter: a bounded per-item exponential
+// back-off combined with the default overall token bucket. It returns nil to keep
+// the controller-runtime default when no delays are configured.
+func (r *ServiceAccountReconciler) rateLimiter() workqueue.RateLimiter {
+	if r.RateLimiterBaseDelay <= 0 && r.RateLimiterMaxDelay <= 0 {
+		return nil
+	}
+	baseDelay, maxDelay := r.RateLimiterBaseDelay, r.RateLimiterMaxDelay
+	if baseDelay <= 0 {
+		baseDelay = 5 * time.Millisecond
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// ignoreSyncStatusUpdates filters out update events caused solely by recordSyncStatus,
+// so that recording a failed sync does not immediately trigger another reconcile.
+func ignoreSyncStatusUpdates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldObj, newObj := e.ObjectOld, e.ObjectNew
+			if !reflect.DeepEqual(oldObj.GetDeletionTimestamp(), newObj.GetDeletionTimestamp()) ||
+				!reflect.DeepEqual(oldObj.GetFinalizers(), newObj.GetFinalizers()) ||
+				!reflect.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) {
+				return true
+			}
+			return !reflect.DeepEqual(withoutSyncStatus(oldObj.GetAnnotations()), withoutSyncStatus(newObj.GetAnnotations()))
+		},
+	}
+}
+
+// withoutSyncStatus returns a copy of annotations without the sync status annotations.
+func withoutSyncStatus(annotations map[string]string) map[string]string {
+	filtered := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		switch k {
+		case LastSyncAnnotation, SyncStatusAnnotation, SyncReasonAnnotation:
+			continue
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
@@ -17,7 +17,33 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gmeasure"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var _ = Describe("ServiceAccount Controller", func() {
@@ -29,4 +55,891 @@ var _ = Describe("ServiceAccount Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When reconciling a ServiceAccount without annotations", func() {
+		It("should not panic on the nil annotations map", func() {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+			}))
+			defer server.Close()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "default"}}
+			r := newTestReconciler(server.URL, sa)
+			Expect(func() {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).NotTo(HaveOccurred())
+			}).NotTo(Panic())
+			Expect(calls).To(BeZero())
+
+			updated := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), updated)).To(Succeed())
+			Expect(updated.Annotations).To(BeEmpty())
+			Expect(updated.Finalizers).To(BeEmpty())
+		})
+
+		It("should record the entry ID and finalizer of a ServiceAccount managed by label", func() {
+			var adds atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v1/entries/add" {
+					adds.Add(1)
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "labelled", Namespace: "default",
+				Labels: map[string]string{"spire.omegahome.net/managed": "true"}}}
+			r := newTestReconciler(server.URL, sa)
+			r.Managed = ManagedSelector{Label: "spire.omegahome.net/managed", Value: "true"}
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			for i := 0; i < 2; i++ {
+				Expect(func() {
+					_, err := r.Reconcile(context.Background(), req)
+					Expect(err).NotTo(HaveOccurred())
+				}).NotTo(Panic())
+			}
+
+			Expect(adds.Load()).To(BeEquivalentTo(1))
+			updated := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+			Expect(updated.Annotations).To(HaveKey(EntryHashAnnotation))
+			Expect(updated.Finalizers).To(ContainElement(SpireFinalizer))
+		})
+
+		It("should only log the skip at debug verbosity unless skips are logged", func() {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "default"}}
+			r := newTestReconciler("http://127.0.0.1:0", sa)
+			reconcile := func(verbosity int) []string {
+				var lines []string
+				logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{Verbosity: verbosity})
+				_, err := r.Reconcile(log.IntoContext(context.Background(), logger),
+					ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).NotTo(HaveOccurred())
+				return lines
+			}
+			skipped := ContainElement(ContainSubstring("ServiceAccount is not managed by SPIRE"))
+
+			Expect(reconcile(0)).NotTo(skipped)
+			Expect(reconcile(1)).To(skipped)
+			r.LogSkipped = true
+			Expect(reconcile(0)).To(skipped)
+		})
+	})
+
+	Context("When a managed ServiceAccount is ignored", func() {
+		It("should not call the SPIRE API", func() {
+			var calls atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls.Add(1)
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("spire-registrar-controller-manager", "spire-registrar-system")
+			r := newTestReconciler(server.URL, sa)
+			r.IgnoredServiceAccounts = map[types.NamespacedName]bool{client.ObjectKeyFromObject(sa): true}
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(calls.Load()).To(BeZero())
+
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		})
+	})
+
+	Context("When finalizers are disabled", func() {
+		It("should register without a finalizer and delete the entry when the ServiceAccount is deleted", func() {
+			var deletes atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v1/entries/delete" {
+					deletes.Add(1)
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			r.DisableFinalizers = true
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+			Expect(sa.Finalizers).To(BeEmpty())
+
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			r.deletedServiceAccountHandler().Delete(context.Background(), event.DeleteEvent{Object: sa}, q)
+			Eventually(deletes.Load).Should(BeEquivalentTo(1))
+			Expect(q.Len()).To(BeZero())
+		})
+	})
+
+	Context("When a ServiceAccount is registered for the first time", func() {
+		It("should write the ServiceAccount once", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			var writes atomic.Int64
+			countWrite := func(obj client.Object) {
+				if _, ok := obj.(*corev1.ServiceAccount); ok {
+					writes.Add(1)
+				}
+			}
+			r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+				Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+					countWrite(obj)
+					return c.Update(ctx, obj, opts...)
+				},
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					countWrite(obj)
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			})
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writes.Load()).To(BeEquivalentTo(1))
+
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+			Expect(sa.Annotations).To(HaveKeyWithValue(SyncStatusAnnotation, SyncStatusSynced))
+			Expect(sa.Finalizers).To(ConsistOf(SpireFinalizer))
+		})
+	})
+
+	Context("When other controllers touch a ServiceAccount", func() {
+		It("should not reconcile it again until a field it depends on changes", func() {
+			spire := newFakeSpireServer()
+			defer spire.Close()
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(spire.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			p := r.skipObservedUpdates()
+			update := func(mutate func(*corev1.ServiceAccount)) bool {
+				Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+				updated := sa.DeepCopy()
+				updated.ResourceVersion += "1"
+				mutate(updated)
+				return p.Update(event.UpdateEvent{ObjectOld: sa, ObjectNew: updated})
+			}
+			touch := func(sa *corev1.ServiceAccount) { sa.Annotations["example.com/last-seen"] = "now" }
+
+			Expect(update(touch)).To(BeTrue(), "never reconciled")
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(update(touch)).To(BeTrue(), "registering added the finalizer and entry ID")
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(update(touch)).To(BeFalse())
+			Expect(update(func(sa *corev1.ServiceAccount) {
+				sa.OwnerReferences = []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "owner-uid"}}
+			})).To(BeFalse())
+			Expect(update(func(sa *corev1.ServiceAccount) { sa.Annotations[DNSNamesAnnotation] = "app.example.com" })).To(BeTrue())
+			Expect(update(func(sa *corev1.ServiceAccount) { sa.Labels = map[string]string{"team": "web"} })).To(BeTrue())
+			Expect(update(func(sa *corev1.ServiceAccount) { sa.DeletionTimestamp = &metav1.Time{Time: time.Now()} })).To(BeTrue())
+
+			// A failed reconcile is retried on any update.
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			sa.Annotations[DNSNamesAnnotation] = "app.example.com"
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+			spire.respondWith(http.StatusInternalServerError, `{"message":"datastore unavailable"}`)
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).To(HaveOccurred())
+			Expect(update(touch)).To(BeTrue())
+		})
+	})
+
+	Context("When a ServiceAccount is changed concurrently", func() {
+		It("should retry the conflicting update within the reconcile", func() {
+			var adds atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				adds.Add(1)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			var updates atomic.Int64
+			r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+				Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+					if updates.Add(1) == 1 {
+						// Another controller labels the ServiceAccount first.
+						other := &corev1.ServiceAccount{}
+						Expect(c.Get(ctx, client.ObjectKeyFromObject(obj), other)).To(Succeed())
+						other.Labels = map[string]string{"team": "payments"}
+						Expect(c.Update(ctx, other)).To(Succeed())
+					}
+					return c.Update(ctx, obj, opts...)
+				},
+			})
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updates.Load()).To(BeEquivalentTo(2))
+			Expect(adds.Load()).To(BeEquivalentTo(1))
+
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+			Expect(sa.Labels).To(HaveKeyWithValue("team", "payments"), "the concurrent change should be kept")
+			Expect(sa.Finalizers).To(ConsistOf(SpireFinalizer))
+		})
+	})
+
+	Context("When reconciling many ServiceAccounts concurrently", func() {
+		It("should register each ServiceAccount exactly once", func() {
+			const count, workers = 200, 8
+
+			var creates atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				n := creates.Add(1)
+				_, _ = fmt.Fprintf(w, `{"entryID":"entry-%d"}`, n)
+			}))
+			defer server.Close()
+
+			objs := newManagedServiceAccounts(count)
+			r := newTestReconciler(server.URL, objs...)
+
+			elapsed := reconcileConcurrently(r, objs, workers)
+			fmt.Fprintf(GinkgoWriter, "reconciled %d ServiceAccounts with %d workers in %s\n", count, workers, elapsed)
+
+			Expect(creates.Load()).To(BeEquivalentTo(count))
+			saList := &corev1.ServiceAccountList{}
+			Expect(r.List(context.Background(), saList)).To(Succeed())
+			for _, sa := range saList.Items {
+				Expect(sa.Annotations).To(HaveKey(SVIDEntryIDAnnotation), "ServiceAccount %s", sa.Name)
+			}
+		})
+
+		// The experiment backs the guidance of --max-concurrent-reconciles. The fake SPIRE
+		// server answers after a fixed latency and serves a limited number of requests at
+		// a time, queueing the rest, as a SPIRE server bounded by its datastore does.
+		It("should scale throughput with workers up to the concurrency of the SPIRE server", func() {
+			const count, capacity = 100, 8
+			const latency = 2 * time.Millisecond
+
+			slots := make(chan struct{}, capacity)
+			var creates atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				time.Sleep(latency)
+				n := creates.Add(1)
+				_, _ = fmt.Fprintf(w, `{"entryID":"entry-%d"}`, n)
+			}))
+			defer server.Close()
+
+			experiment := gmeasure.NewExperiment("Reconcile throughput by MaxConcurrentReconciles")
+			AddReportEntry(experiment.Name, experiment)
+
+			throughput := map[int]float64{}
+			for _, workers := range []int{1, 2, 4, 8, 16, 32} {
+				name := fmt.Sprintf("workers=%d", workers)
+				experiment.Sample(func(int) {
+					objs := newManagedServiceAccounts(count)
+					r := newTestReconciler(server.URL, objs...)
+					elapsed := reconcileConcurrently(r, objs, workers)
+					experiment.RecordValue(name, count/elapsed.Seconds(), gmeasure.Units("ServiceAccounts/s"), gmeasure.Precision(0))
+				}, gmeasure.SamplingConfig{N: 3})
+				throughput[workers] = experiment.GetStats(name).FloatFor(gmeasure.StatMedian)
+			}
+
+			// Up to the server's concurrency, each worker adds throughput. Past about twice
+			// that, which keeps the server busy while workers are in the controller,
+			// requests only queue at the server.
+			Expect(throughput[capacity]).To(BeNumerically(">", 2*throughput[1]))
+			Expect(throughput[4*capacity]).To(BeNumerically("<", 1.5*throughput[2*capacity]))
+		})
+	})
+
+	Context("When the same ServiceAccount is reconciled concurrently", func() {
+		It("should send a single create to the SPIRE API", func() {
+			const reconciles = 5
+
+			var creates atomic.Int64
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				creates.Add(1)
+				<-release
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+			var wg sync.WaitGroup
+			for i := 0; i < reconciles; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					// Reconciles sharing the create may lose the race to update the
+					// ServiceAccount; those are requeued, so only the create count matters.
+					_, _ = r.Reconcile(context.Background(), req)
+				}()
+			}
+			Eventually(creates.Load).Should(BeEquivalentTo(1))
+			// Give the remaining reconciles time to join the in-flight create.
+			time.Sleep(200 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			Expect(creates.Load()).To(BeEquivalentTo(1))
+			updated := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		})
+	})
+
+	Context("When the cluster info ConfigMap changes", func() {
+		It("should enqueue each managed ServiceAccount once after the debounce", func() {
+			unmanaged := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default"}}
+			r := newTestReconciler("http://127.0.0.1:0",
+				newManagedServiceAccount("app", "default"), newManagedServiceAccount("web", "prod"), unmanaged)
+			r.ClusterInfoDebounce = 100 * time.Millisecond
+
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			h := r.clusterInfoHandler()
+			for i := 0; i < 3; i++ {
+				h.Update(context.Background(), event.UpdateEvent{}, q)
+			}
+			Expect(q.Len()).To(BeZero())
+
+			Eventually(q.Len).Should(Equal(2))
+			Consistently(q.Len, 300*time.Millisecond).Should(Equal(2))
+		})
+	})
+
+	Context("When the controller is shutting down", func() {
+		It("should finish in-flight deletions and abandon registrations", func() {
+			var adds, deletes atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/entries/add":
+					adds.Add(1)
+					_, _ = w.Write([]byte(`{"entryID":"entry-new"}`))
+				case "/v1/entries/delete":
+					// Outlive the cancellation of the reconcile context.
+					time.Sleep(200 * time.Millisecond)
+					deletes.Add(1)
+				}
+			}))
+			defer server.Close()
+
+			deleting := newManagedServiceAccount("old", "default")
+			deleting.Annotations[SVIDEntryIDAnnotation] = "entry-old"
+			deleting.Finalizers = []string{SpireFinalizer}
+			deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			creating := newManagedServiceAccount("new", "default")
+			r := newTestReconciler(server.URL, deleting, creating)
+			r.ShutdownGracePeriod = 5 * time.Second
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(deleting)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deletes.Load()).To(BeEquivalentTo(1))
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(deleting), &corev1.ServiceAccount{})).
+				NotTo(Succeed(), "the finalizer should be removed")
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(creating)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(adds.Load()).To(BeZero())
+
+			Expect(r.shutdown.drained.Load()).To(BeEquivalentTo(1))
+			Expect(r.shutdown.abandoned.Load()).To(BeEquivalentTo(1))
+		})
+	})
+
+	Context("When a registered ServiceAccount is deleted", func() {
+		It("should log the entry ID on every line", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("deleted", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-deleted"
+			sa.Finalizers = []string{SpireFinalizer}
+			sa.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			r := newTestReconciler(server.URL, sa)
+
+			var lines []string
+			logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{})
+			_, err := r.Reconcile(log.IntoContext(context.Background(), logger),
+				ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lines).NotTo(BeEmpty())
+			for _, line := range lines {
+				Expect(line).To(ContainSubstring(`"entryID"="entry-deleted"`))
+			}
+		})
+
+		It("should log the deletion message of the SPIRE server and record it in an event", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"message":"deleted 1 entry, 0 skipped"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("deleted", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-deleted"
+			sa.Finalizers = []string{SpireFinalizer}
+			sa.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+
+			var lines []string
+			logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{})
+			_, err := r.Reconcile(log.IntoContext(context.Background(), logger),
+				ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lines).To(ContainElement(And(
+				ContainSubstring(`"msg"="Successfully deleted SPIRE entry"`),
+				ContainSubstring(`"message"="deleted 1 entry, 0 skipped"`),
+			)))
+			Expect(recorder.Events).To(Receive(And(
+				ContainSubstring(EntryDeletedReason),
+				ContainSubstring("deleted 1 entry, 0 skipped"),
+			)))
+		})
+
+		It("should retry a failed finalizer removal without deleting the entry again", func() {
+			var deletes atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if deletes.Add(1) > 1 {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"message":"entry not found"}`))
+				}
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("deleted", "default")
+			sa.UID = "deleted-uid"
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-deleted"
+			sa.Finalizers = []string{SpireFinalizer}
+			sa.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+			var updates atomic.Int32
+			r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+				Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+					if updates.Add(1) == 1 {
+						return apierrors.NewServiceUnavailable("apiserver overloaded")
+					}
+					return c.Update(ctx, obj, opts...)
+				},
+			})
+
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue(), "got %v", err)
+			Expect(deletes.Load()).To(Equal(int32(1)))
+
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deletes.Load()).To(Equal(int32(1)), "the entry was not deleted again")
+			Expect(apierrors.IsNotFound(r.Get(context.Background(), req.NamespacedName, &corev1.ServiceAccount{}))).
+				To(BeTrue(), "the finalizer was removed")
+			Expect(recorder.Events).To(BeEmpty())
+		})
+	})
+
+	Context("When managed ServiceAccounts are selected by label", func() {
+		selector := ManagedSelector{Label: "spire.omega.k8s.io/managed", Value: "true"}
+
+		DescribeTable("ManagedSelector.Matches",
+			func(selector ManagedSelector, annotations, labels map[string]string, managed bool) {
+				sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: annotations, Labels: labels}}
+				Expect(selector.Matches(sa)).To(Equal(managed))
+			},
+			Entry("the annotation without a label selector", ManagedSelector{},
+				map[string]string{ManagedSpireAnnotation: "true"}, nil, true),
+			Entry("a label without a label selector", ManagedSelector{},
+				nil, map[string]string{"spire.omega.k8s.io/managed": "true"}, false),
+			Entry("the label", selector, nil, map[string]string{"spire.omega.k8s.io/managed": "true"}, true),
+			Entry("another label value", selector, nil, map[string]string{"spire.omega.k8s.io/managed": "false"}, false),
+			Entry("the annotation opting out of a labelled ServiceAccount", selector,
+				map[string]string{ManagedSpireAnnotation: "false"}, map[string]string{"spire.omega.k8s.io/managed": "true"}, false),
+			Entry("the annotation without the label", selector,
+				map[string]string{ManagedSpireAnnotation: "true"}, nil, true),
+		)
+
+		It("should parse the label flag", func() {
+			Expect(ParseManagedLabel("spire.omega.k8s.io/managed")).To(Equal(selector))
+			Expect(ParseManagedLabel("team=payments")).To(Equal(ManagedSelector{Label: "team", Value: "payments"}))
+			Expect(ParseManagedLabel("")).To(Equal(ManagedSelector{}))
+			_, err := ParseManagedLabel("bad key=true")
+			Expect(err).To(MatchError(ContainSubstring("invalid label key")))
+			_, err = ParseManagedLabel("team=not valid")
+			Expect(err).To(MatchError(ContainSubstring("invalid label value")))
+		})
+
+		It("should register a labelled ServiceAccount without the annotation", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default",
+				Labels: map[string]string{"spire.omega.k8s.io/managed": "true"}}}
+			r := newTestReconciler(server.URL, sa)
+			r.Managed = selector
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		})
+
+		It("should only pass the events of managed ServiceAccounts", func() {
+			labelled := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app",
+				Labels: map[string]string{"spire.omega.k8s.io/managed": "true"}}}
+			plain := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "plain"}}
+			p := selector.predicate()
+			Expect(p.Create(event.CreateEvent{Object: labelled})).To(BeTrue())
+			Expect(p.Create(event.CreateEvent{Object: plain})).To(BeFalse())
+			Expect(p.Update(event.UpdateEvent{ObjectOld: plain, ObjectNew: labelled})).To(BeTrue())
+			Expect(p.Update(event.UpdateEvent{ObjectOld: plain, ObjectNew: plain})).To(BeFalse())
+		})
+	})
+
+	Context("When a ServiceAccount is paused", func() {
+		It("should neither create nor delete its entry until unpaused", func() {
+			var calls atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls.Add(1)
+				_, _ = w.Write([]byte(`{"entryID":"entry-new"}`))
+			}))
+			defer server.Close()
+
+			creating := newManagedServiceAccount("new", "default")
+			creating.Annotations[PausedAnnotation] = "true"
+			deleting := newManagedServiceAccount("old", "default")
+			deleting.Annotations[PausedAnnotation] = "true"
+			deleting.Annotations[SVIDEntryIDAnnotation] = "entry-old"
+			deleting.Finalizers = []string{SpireFinalizer}
+			deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			r := newTestReconciler(server.URL, creating, deleting)
+
+			for _, sa := range []*corev1.ServiceAccount{creating, deleting} {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(calls.Load()).To(BeZero())
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(creating), creating)).To(Succeed())
+			Expect(creating.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(deleting), deleting)).To(Succeed())
+			Expect(deleting.Finalizers).To(ConsistOf(SpireFinalizer))
+
+			deleting.Annotations[PausedAnnotation] = "false"
+			Expect(r.Update(context.Background(), deleting)).To(Succeed())
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(deleting)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls.Load()).To(BeEquivalentTo(1))
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(deleting), deleting)).NotTo(Succeed())
+		})
+	})
+
+	Context("When a resync is triggered", func() {
+		It("should recreate the entries SPIRE no longer has despite their annotations", func() {
+			var updates, adds atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/entries/update":
+					updates.Add(1)
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"message":"entry not found"}`))
+				case "/v1/entries/add":
+					adds.Add(1)
+					_, _ = w.Write([]byte(`{"entryID":"entry-new"}`))
+				}
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("web", "default")
+			unmanaged := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default"}}
+			r := newTestReconciler(server.URL, sa, unmanaged)
+			r.Resync = NewResyncTrigger()
+			se, err := r.desiredEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-lost"
+			sa.Annotations[EntryHashAnnotation] = hashEntry(se)
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updates.Load()).To(BeZero(), "an up-to-date entry is not verified outside a resync")
+
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			r.resyncHandler().Generic(context.Background(), event.GenericEvent{}, q)
+			Expect(q.Len()).To(Equal(1))
+			item, _ := q.Get()
+			Expect(item).To(Equal(req))
+
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updates.Load()).To(BeEquivalentTo(1))
+			Expect(adds.Load()).To(BeEquivalentTo(1))
+			updated := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), req.NamespacedName, updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-new"))
+
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updates.Load()).To(BeEquivalentTo(1), "the resync is done once reconciled")
+		})
+
+		It("should require the token on the HTTP endpoint and coalesce pending resyncs", func() {
+			t := NewResyncTrigger()
+			t.Token = &BearerToken{Value: "secret"}
+			post := func(token string) int {
+				req := httptest.NewRequest(http.MethodPost, DefaultResyncPath, nil)
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				w := httptest.NewRecorder()
+				t.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			Expect(post("")).To(Equal(http.StatusUnauthorized))
+			Expect(post("wrong")).To(Equal(http.StatusUnauthorized))
+			Expect(post("secret")).To(Equal(http.StatusAccepted))
+			Expect(post("secret")).To(Equal(http.StatusConflict))
+
+			w := httptest.NewRecorder()
+			t.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultResyncPath, nil))
+			Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+
+			<-t.events
+			Expect(post("secret")).To(Equal(http.StatusAccepted))
+		})
+	})
+
+	Context("When annotating the SPIFFE ID", func() {
+		register := func(response string, annotate bool) *corev1.ServiceAccount {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(response))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			r.AnnotateSpiffeID = annotate
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			return sa
+		}
+
+		It("should record the SPIFFE ID reported by the SPIRE API", func() {
+			sa := register(`{"entryID":"entry-1","spiffeID":"spiffe://example.org/workload/app"}`, true)
+			Expect(sa.Annotations).To(HaveKeyWithValue(SpiffeIDAnnotation, "spiffe://example.org/workload/app"))
+		})
+
+		It("should compute the SPIFFE ID when the SPIRE API does not report it", func() {
+			sa := register(`{"entryID":"entry-1"}`, true)
+			Expect(sa.Annotations).To(HaveKeyWithValue(SpiffeIDAnnotation, "spiffe://example.org/ns/default/sa/app"))
+		})
+
+		It("should not annotate the SPIFFE ID unless enabled", func() {
+			sa := register(`{"entryID":"entry-1","spiffeID":"spiffe://example.org/workload/app"}`, false)
+			Expect(sa.Annotations).NotTo(HaveKey(SpiffeIDAnnotation))
+		})
+
+		It("should annotate ServiceAccounts registered before it was enabled", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Fail("an up-to-date entry is not sent to SPIRE")
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			r := newTestReconciler(server.URL, sa)
+			se, err := r.desiredEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			sa.Annotations[EntryHashAnnotation] = hashEntry(se)
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+
+			r.AnnotateSpiffeID = true
+			_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SpiffeIDAnnotation, "spiffe://example.org/ns/default/sa/app"))
+		})
+	})
+
+	Context("When a sync fails repeatedly", func() {
+		It("should collapse identical failures into periodic summaries", func() {
+			var lines []string
+			logger := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{})
+			now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			throttle := &logThrottle{now: func() time.Time { return now }}
+			key := types.NamespacedName{Namespace: "default", Name: "app"}
+			unavailable := errors.New("SPIRE API unavailable")
+
+			for i := 0; i < 5; i++ {
+				throttle.error(logger, time.Minute, key, unavailable, "Failed to create SPIRE entry")
+				now = now.Add(10 * time.Second)
+			}
+			Expect(lines).To(HaveLen(1), "the first occurrence is logged right away")
+
+			throttle.error(logger, time.Minute, key, errors.New("invalid selector"), "Failed to create SPIRE entry")
+			Expect(lines).To(HaveLen(2), "a different error is logged right away")
+
+			now = now.Add(10 * time.Second)
+			throttle.error(logger, time.Minute, key, unavailable, "Failed to create SPIRE entry")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[2]).To(ContainSubstring(`"repeated"=5`))
+
+			throttle.error(logger, time.Minute, key, unavailable, "Failed to create SPIRE entry")
+			throttle.reset(logger, key)
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[3]).To(ContainSubstring(`"unreported"=1`))
+
+			throttle.error(logger, time.Minute, key, unavailable, "Failed to create SPIRE entry")
+			Expect(lines).To(HaveLen(5), "failures after a recovery are logged right away")
+		})
+
+		It("should log the first of the failures of a reconciler", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			r.FailureLogInterval = time.Minute
+
+			var failures int
+			logger := funcr.New(func(prefix, args string) {
+				if strings.Contains(args, "Failed to create SPIRE entry for ServiceAccount") {
+					failures++
+				}
+			}, funcr.Options{})
+			for i := 0; i < 3; i++ {
+				_, err := r.Reconcile(log.IntoContext(context.Background(), logger),
+					ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).To(HaveOccurred())
+			}
+			Expect(failures).To(Equal(1))
+		})
+	})
+
+	Context("When adopting existing SPIRE entries", func() {
+		// reconcileWithEntries reconciles sa against a SPIRE API listing entries and
+		// returns the entry ID annotated on sa and the number of entries created.
+		reconcileWithEntries := func(sa *corev1.ServiceAccount, entries []RegisteredEntry) (string, int64) {
+			var adds atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/entries":
+					Expect(req.URL.Query().Get("cluster")).To(Equal("test-cluster"))
+					_ = json.NewEncoder(w).Encode(SpireEntryListResponse{Entries: entries})
+				case "/v1/entries/add":
+					adds.Add(1)
+					_, _ = w.Write([]byte(`{"entryID":"entry-new"}`))
+				}
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL, sa)
+			r.AdoptExistingEntries = true
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &corev1.ServiceAccount{}
+			Expect(r.Get(context.Background(), client.ObjectKeyFromObject(sa), updated)).To(Succeed())
+			return updated.Annotations[SVIDEntryIDAnnotation], adds.Load()
+		}
+
+		It("should adopt a matching entry instead of creating one", func() {
+			sa := newManagedServiceAccount("web", "default")
+			id, adds := reconcileWithEntries(sa, []RegisteredEntry{
+				{EntryID: "entry-other", SpireEntry: SpireEntry{Namespace: "default", ServiceAccount: "api"}},
+				{EntryID: "entry-manual", SpireEntry: SpireEntry{Namespace: "default", ServiceAccount: "web", TrustDomain: "example.org"}},
+			})
+			Expect(id).To(Equal("entry-manual"))
+			Expect(adds).To(BeZero())
+		})
+
+		It("should create an entry when none matches", func() {
+			sa := newManagedServiceAccount("web", "default")
+			id, adds := reconcileWithEntries(sa, []RegisteredEntry{
+				{EntryID: "entry-pod", SpireEntry: SpireEntry{Namespace: "default", ServiceAccount: "web", Pod: "web-0"}},
+			})
+			Expect(id).To(Equal("entry-new"))
+			Expect(adds).To(BeEquivalentTo(1))
+		})
+
+		DescribeTable("adoptableEntry",
+			func(registered SpireEntry, selectors string, want bool) {
+				desired := SpireEntry{Namespace: "default", ServiceAccount: "web", TrustDomain: "example.org"}
+				if selectors != "" {
+					desired.Selectors = strings.Split(selectors, ",")
+				}
+				Expect(adoptableEntry(registered, desired)).To(Equal(want))
+			},
+			Entry("same ServiceAccount", SpireEntry{Namespace: "default", ServiceAccount: "web"}, "", true),
+			Entry("other namespace", SpireEntry{Namespace: "prod", ServiceAccount: "web"}, "", false),
+			Entry("other trust domain", SpireEntry{Namespace: "default", ServiceAccount: "web", TrustDomain: "other.org"}, "", false),
+			Entry("pod-level entry", SpireEntry{Namespace: "default", ServiceAccount: "web", Pod: "web-0"}, "", false),
+			Entry("same selectors in another order",
+				SpireEntry{Namespace: "default", ServiceAccount: "web", Selectors: []string{"unix:uid:1000", "k8s:ns:default"}},
+				"k8s:ns:default,unix:uid:1000", true),
+			Entry("other selectors",
+				SpireEntry{Namespace: "default", ServiceAccount: "web", Selectors: []string{"unix:uid:1000"}},
+				"unix:uid:0", false),
+		)
+	})
 })
+
+// newManagedServiceAccounts returns count managed ServiceAccounts in the default namespace.
+func newManagedServiceAccounts(count int) []client.Object {
+	var objs []client.Object
+	for i := 0; i < count; i++ {
+		objs = append(objs, newManagedServiceAccount(fmt.Sprintf("sa-%d", i), "default"))
+	}
+	return objs
+}
+
+// reconcileConcurrently reconciles objs with workers in parallel, as the controller
+// does with MaxConcurrentReconciles, and returns how long it took.
+func reconcileConcurrently(r *ServiceAccountReconciler, objs []client.Object, workers int) time.Duration {
+	requests := make(chan ctrl.Request, len(objs))
+	for _, obj := range objs {
+		requests <- ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)}
+	}
+	close(requests)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			for req := range requests {
+				_, err := r.Reconcile(context.Background(), req)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/validate--v1-serviceaccount,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=serviceaccounts,verbs=create;update,versions=v1,name=vserviceaccount.omegahome.net,admissionReviewVersions=v1
+
+// ServiceAccountValidator rejects ServiceAccounts whose SPIRE annotations the
+// reconciler would fail on, so that the error surfaces at admission instead of as
+// a failed sync. It uses the same parsing as the reconciler.
+type ServiceAccountValidator struct{}
+
+var _ admission.CustomValidator = &ServiceAccountValidator{}
+
+// SetupWebhookWithManager registers the validating webhook with the manager's
+// webhook server.
+func (v *ServiceAccountValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.ServiceAccount{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *ServiceAccountValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	sa, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServiceAccount, got %T", obj)
+	}
+	return nil, validateSpireAnnotations(sa, nil)
+}
+
+// ValidateUpdate only checks the annotations changed by the update, so that a
+// ServiceAccount admitted before the webhook existed can still be updated, e.g. by
+// the reconciler recording its sync status.
+func (v *ServiceAccountValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldSA, ok := oldObj.(*corev1.ServiceAccount)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServiceAccount, got %T", oldObj)
+	}
+	sa, ok := newObj.(*corev1.ServiceAccount)
+	if !ok {
+		return nil, fmt.Errorf("expected a ServiceAccount, got %T", newObj)
+	}
+	return nil, validateSpireAnnotations(sa, oldSA)
+}
+
+func (v *ServiceAccountValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// managedFlag checks ManagedSpireAnnotation against the exact values ManagedSelector
+// matches: any other spelling of true would be admitted but not managed.
+func managedFlag(sa *corev1.ServiceAccount) error {
+	if value := sa.Annotations[ManagedSpireAnnotation]; value != "true" && value != "false" {
+		return fmt.Errorf("invalid value %q for annotation %s: must be true or false", value, ManagedSpireAnnotation)
+	}
+	return nil
+}
+
+// validateSpireAnnotations checks the SPIRE annotations of sa. When old is set,
+// annotations with the same value on old are not checked again.
+func validateSpireAnnotations(sa, old *corev1.ServiceAccount) error {
+	checks := []struct {
+		annotation string
+		validate   func() error
+	}{
+		{ManagedSpireAnnotation, func() error { return managedFlag(sa) }},
+		{AdminAnnotation, func() error { _, err := entryFlag(sa, AdminAnnotation); return err }},
+		{DownstreamAnnotation, func() error { _, err := entryFlag(sa, DownstreamAnnotation); return err }},
+		{PausedAnnotation, func() error { _, err := entryFlag(sa, PausedAnnotation); return err }},
+		{X509SvidTTLAnnotation, func() error { _, err := svidTTL(sa, X509SvidTTLAnnotation, 0); return err }},
+		{JWTSvidTTLAnnotation, func() error { _, err := svidTTL(sa, JWTSvidTTLAnnotation, 0); return err }},
+		{SpireTrustDomainAnnotation, func() error { _, err := entryTrustDomain(sa, ""); return err }},
+		{ClusterNameAnnotation, func() error { _, err := entryCluster(sa, ""); return err }},
+		{DNSNamesAnnotation, func() error { _, err := entryDNSNames(sa); return err }},
+		{FederatesWithAnnotation, func() error { _, err := entryFederatesWith(sa, nil); return err }},
+		{SelectorsAnnotation, func() error { _, err := entrySelectors(sa); return err }},
+		{SelectorTemplateAnnotation, func() error { _, err := ParseSelectorTemplate(sa.Annotations[SelectorTemplateAnnotation]); return err }},
+		{HintAnnotation, func() error { _, err := entryHint(sa); return err }},
+	}
+
+	var errs field.ErrorList
+	annotations := field.NewPath("metadata", "annotations")
+	for _, check := range checks {
+		value, exists := sa.Annotations[check.annotation]
+		if !exists {
+			continue
+		}
+		if old != nil {
+			if oldValue, existed := old.Annotations[check.annotation]; existed && oldValue == value {
+				continue
+			}
+		}
+		if err := check.validate(); err != nil {
+			errs = append(errs, field.Invalid(annotations.Key(check.annotation), value, err.Error()))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("ServiceAccount").GroupKind(), sa.Name, errs)
+}
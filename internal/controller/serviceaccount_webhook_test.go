@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var _ = Describe("ServiceAccount webhook", func() {
+	validator := &ServiceAccountValidator{}
+
+	DescribeTable("validating the SPIRE annotations on create",
+		func(annotation, value, message string) {
+			sa := newManagedServiceAccount("web", "default")
+			sa.Annotations[annotation] = value
+			_, err := validator.ValidateCreate(context.Background(), sa)
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "got %v", err)
+			Expect(err.Error()).To(ContainSubstring(annotation))
+			Expect(err.Error()).To(ContainSubstring(message))
+		},
+		Entry("a boolean managed-spire", ManagedSpireAnnotation, "false", ""),
+		Entry("a non-boolean managed-spire", ManagedSpireAnnotation, "yes", "must be true or false"),
+		Entry("a managed-spire true not spelled in lower case", ManagedSpireAnnotation, "True", "must be true or false"),
+		Entry("a numeric managed-spire", ManagedSpireAnnotation, "1", "must be true or false"),
+		Entry("a non-boolean admin flag", AdminAnnotation, "enabled", "must be true or false"),
+		Entry("a negative TTL", X509SvidTTLAnnotation, "-1", "non-negative number of seconds"),
+		Entry("a valid trust domain override", SpireTrustDomainAnnotation, "example.org", ""),
+		Entry("an uppercase trust domain override", SpireTrustDomainAnnotation, "Example.org", "must be lowercase"),
+		Entry("a malformed selector list", SelectorsAnnotation, "unix:uid:1000,k8s", "must be of the form type:value"),
+		Entry("an invalid DNS name", DNSNamesAnnotation, "web_1.example.org", "invalid DNS name"),
+		Entry("a federated trust domain without scheme", FederatesWithAnnotation, "example.org", "spiffe://"),
+		Entry("a hint with spaces", HintAnnotation, "internal api", "must only contain"),
+		Entry("an unparsable selector template", SelectorTemplateAnnotation, "k8s:sa:{{.Name", "unclosed action"),
+	)
+
+	It("should report every invalid annotation", func() {
+		sa := newManagedServiceAccount("web", "default")
+		sa.Annotations[ManagedSpireAnnotation] = "yes"
+		sa.Annotations[SelectorsAnnotation] = "k8s"
+		_, err := validator.ValidateCreate(context.Background(), sa)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(ManagedSpireAnnotation))
+		Expect(err.Error()).To(ContainSubstring(SelectorsAnnotation))
+	})
+
+	It("should only check the annotations changed by an update", func() {
+		old := newManagedServiceAccount("web", "default")
+		old.Annotations[SelectorsAnnotation] = "k8s"
+		sa := old.DeepCopy()
+		sa.Annotations[SyncStatusAnnotation] = SyncStatusFailed
+		_, err := validator.ValidateUpdate(context.Background(), old, sa)
+		Expect(err).NotTo(HaveOccurred())
+
+		sa.Annotations[SelectorsAnnotation] = "unix"
+		_, err = validator.ValidateUpdate(context.Background(), old, sa)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject objects that are not ServiceAccounts", func() {
+		_, err := validator.ValidateCreate(context.Background(), &corev1.Pod{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const DefaultShutdownGracePeriod = 30 * time.Second
+
+// shutdownStats counts the reconciles seen after shutdown began: deletions that were
+// allowed to finish and registrations that were abandoned to be retried on restart.
+type shutdownStats struct {
+	drained   atomic.Int64
+	abandoned atomic.Int64
+}
+
+// withShutdownGrace returns a context that stays valid for grace after ctx is
+// cancelled, so that calls in flight at shutdown can complete.
+func withShutdownGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.AfterFunc(grace, cancel)
+		context.AfterFunc(graceCtx, func() { timer.Stop() })
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// LogShutdownSummary logs how many deletions were drained and how many registrations
+// were abandoned after shutdown began. Call it once the manager has stopped.
+func (r *ServiceAccountReconciler) LogShutdownSummary() {
+	ctrl.Log.WithName("shutdown").Info("ServiceAccount reconciles at shutdown",
+		"drainedDeletions", r.shutdown.drained.Load(),
+		"abandonedRegistrations", r.shutdown.abandoned.Load())
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// entrySpiffeIDPath is the path of the SPIFFE ID of the ServiceAccount of se below
+// its trust domain.
+func entrySpiffeIDPath(se SpireEntry) string {
+	return "/ns/" + se.Namespace + "/sa/" + se.ServiceAccount
+}
+
+// entrySpiffeID is the SPIFFE ID the SPIRE server issues for se.
+func entrySpiffeID(se SpireEntry) string {
+	return "spiffe://" + se.TrustDomain + entrySpiffeIDPath(se)
+}
+
+type spiffeIDKey struct{}
+
+// withSpiffeID returns a context recording the SPIFFE ID the SPIRE API returns for an
+// entry created with it, if any.
+func withSpiffeID(ctx context.Context) (context.Context, *string) {
+	id := new(string)
+	return context.WithValue(ctx, spiffeIDKey{}, id), id
+}
+
+func recordSpiffeID(ctx context.Context, id string) {
+	if recorded, ok := ctx.Value(spiffeIDKey{}).(*string); ok && id != "" {
+		*recorded = id
+	}
+}
+
+// spiffeIDFor returns the SPIFFE ID to annotate sa with: returned, the ID the SPIRE
+// API reported for the entry, else the one computed from the rendered entry. It is
+// empty when the entry cannot be rendered.
+func (r *ServiceAccountReconciler) spiffeIDFor(ctx context.Context, sa *corev1.ServiceAccount, returned string) string {
+	if returned != "" {
+		return returned
+	}
+	se, err := r.desiredEntry(ctx, sa)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to compute SPIFFE ID", "name", sa.Name)
+		return ""
+	}
+	return entrySpiffeID(se)
+}
@@ -3,15 +3,34 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 const (
@@ -23,17 +42,61 @@ const (
 	AdminKubeConfigSecret      = "admin-kubeconfig" // Name of the ConfigMap containing the admin kubeconfig
 )
 
+var (
+	// ErrSpireUnavailable indicates the SPIRE API could not be reached or failed to serve the request.
+	ErrSpireUnavailable = errors.New("SPIRE API unavailable")
+	// ErrEntryNotFound indicates the SPIRE API has no entry matching the request.
+	ErrEntryNotFound = errors.New("SPIRE entry not found")
+	// ErrEntryConflict indicates the SPIRE API rejected the request because of an existing entry.
+	ErrEntryConflict = errors.New("SPIRE entry conflict")
+	// ErrUpdateUnsupported indicates the SPIRE API has no entry update operation, e.g.
+	// it answers the update path with a 404 that does not identify a missing entry.
+	ErrUpdateUnsupported = errors.New("SPIRE API does not support entry updates")
+)
+
 type SpireEntry struct {
-	TrustDomain    string `json:"trustDomain,omitempty"`
-	ServiceAccount string `json:"serviceAccount,omitempty"`
-	Namespace      string `json:"namespace,omitempty"`
-	Cluster        string `json:"cluster,omitempty"`
-	KubeConfig     string `json:"kubeConfig,omitempty"`
+	TrustDomain    string   `json:"trustDomain,omitempty"`
+	ServiceAccount string   `json:"serviceAccount,omitempty"`
+	Namespace      string   `json:"namespace,omitempty"`
+	Cluster        string   `json:"cluster,omitempty"`
+	KubeConfig     string   `json:"kubeConfig,omitempty"`
+	X509SvidTtl    int      `json:"x509SvidTtl,omitempty"`   // X509-SVID lifetime in seconds, server default when zero
+	JwtSvidTtl     int      `json:"jwtSvidTtl,omitempty"`    // JWT-SVID lifetime in seconds, server default when zero
+	DnsNames       []string `json:"dnsNames,omitempty"`      // DNS SANs to include in the X509-SVID
+	FederatesWith  []string `json:"federatesWith,omitempty"` // Federated trust domains, as spiffe:// URIs
+	Pod            string   `json:"pod,omitempty"`           // Pod name for workload-level entries
+	Selectors      []string `json:"selectors,omitempty"`     // Workload selectors as type:value, server derived when empty
+	Admin          bool     `json:"admin,omitempty"`         // Grants the SVID admin privileges on the SPIRE server
+	Downstream     bool     `json:"downstream,omitempty"`    // Allows the SVID holder to act as a downstream SPIRE server
+	Hint           string   `json:"hint,omitempty"`          // Lets workloads holding several SVIDs tell them apart
+	ParentID       string   `json:"parentID,omitempty"`      // SPIFFE ID of the parent of the entry, server default when empty
+
+	KubeConfigEncoding string `json:"kubeConfigEncoding,omitempty"` // KubeConfigEncodingGzip when KubeConfig is compressed
+	ServiceAccountUID  string `json:"serviceAccountUID,omitempty"`  // UID of the ServiceAccount, distinguishes a recreated SA
+	ResourceVersion    string `json:"resourceVersion,omitempty"`    // ResourceVersion of the ServiceAccount when the entry was created
 }
 
 type SpireEntryResponse struct {
 	EntryID string `json:"entryID"`
 	Message string `json:"message"`
+	// SpiffeID is the SPIFFE ID of a created entry, when the API reports it.
+	SpiffeID string `json:"spiffeID,omitempty"`
+	// Selectors are the selectors the server applied to the entry, when the API
+	// reports them; the server may normalize or add to the requested ones.
+	Selectors []string `json:"selectors,omitempty"`
+	// JobID identifies the job of a creation the API accepted with 202 Accepted
+	// rather than completed.
+	JobID string `json:"jobID,omitempty"`
+}
+
+// RegisteredEntry is a SPIRE entry as returned by the list endpoint.
+type RegisteredEntry struct {
+	EntryID string `json:"entryID"`
+	SpireEntry
+}
+
+type SpireEntryListResponse struct {
+	Entries []RegisteredEntry `json:"entries"`
 }
 
 type entryID string
@@ -51,180 +114,1419 @@ func (s *SpireAPI) GetServerURL() string {
 	return s.Server
 }
 
+// Normalize validates the configured server URL and rewrites it in canonical form,
+// with the port folded into the host and trailing slashes removed. It rejects
+// values GetServerURL would turn into a malformed URL, e.g. a missing scheme, a port
+// out of range or a port set both in Server and Port.
+func (s *SpireAPI) Normalize() error {
+	u, err := url.Parse(strings.TrimSpace(s.Server))
+	if err != nil {
+		return fmt.Errorf("invalid SPIRE server URL %q: %w", s.Server, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid SPIRE server URL %q: scheme must be http or https", s.Server)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid SPIRE server URL %q: missing host", s.Server)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid SPIRE server URL %q: must not contain user info, a query or a fragment", s.Server)
+	}
+	if u.Port() != "" {
+		if port, err := strconv.Atoi(u.Port()); err != nil || ValidatePort(port) != nil {
+			return fmt.Errorf("invalid SPIRE server URL %q: port must be between 1 and 65535", s.Server)
+		}
+	}
+	if s.Port != 0 {
+		if err := ValidatePort(s.Port); err != nil {
+			return err
+		}
+		if u.Port() != "" {
+			return fmt.Errorf("invalid SPIRE server URL %q: port %d is also set in the URL", s.Server, s.Port)
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(s.Port))
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	s.Server = u.String()
+	s.Port = 0
+	return nil
+}
+
+// HasURLPort reports whether the Server URL sets a port.
+func (s *SpireAPI) HasURLPort() bool {
+	u, err := url.Parse(strings.TrimSpace(s.Server))
+	return err == nil && u.Port() != ""
+}
+
+// ValidatePort checks that port is a TCP port a SPIRE server can listen on.
+func ValidatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid SPIRE server port %d: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// DefaultSpireAPI returns the SPIRE API endpoint built from APIServer and APIPort.
+func DefaultSpireAPI() SpireAPI {
+	return SpireAPI{
+		Server: fmt.Sprintf("http://%s", APIServer),
+		Port:   APIPort,
+	}
+}
+
+// SpireClient sends entry registrations to the SPIRE registrar API. It is shared by
+// all reconcilers that register workloads.
+type SpireClient struct {
+	Pool       *SpireAPIPool
+	HTTPClient *http.Client
+
+	// Breaker, when set, stops sending requests to servers that keep failing; the
+	// requests then fail right away with ErrCircuitOpen.
+	Breaker *CircuitBreaker
+
+	// Token, when set, is sent as a bearer token on every request.
+	Token *BearerToken
+
+	// Headers are added to every request, e.g. tenant IDs or API keys required by a
+	// gateway in front of the SPIRE API. The values of SensitiveHeaders are never logged.
+	Headers          map[string]string
+	SensitiveHeaders map[string]bool
+
+	// Paths locates the entry operations of the API. When nil, DefaultSpireAPIPaths is used.
+	Paths *SpireAPIPaths
+
+	// CorrelationHeader, when set, carries the ID of the reconcile issuing the request.
+	CorrelationHeader string
+
+	// IdempotencyHeader, when set, carries a key identifying the logical creation on
+	// create requests, see idempotencyKey, so that the server can deduplicate retries.
+	IdempotencyHeader string
+
+	// ContentType and Accept are the media types of request and response bodies, e.g.
+	// a versioned type required by a gateway. Both default to DefaultMediaType.
+	ContentType string
+	Accept      string
+
+	// BatchWindow, when positive, coalesces the entries added within the window into
+	// a single batch registration.
+	BatchWindow time.Duration
+
+	// DryRun logs the rendered entries and target URLs instead of calling the API.
+	DryRun bool
+
+	// KubeConfigEncoding is the wire format of the kubeconfig of sent entries,
+	// KubeConfigEncodingBase64 (the default when empty) or KubeConfigEncodingRaw.
+	KubeConfigEncoding string
+
+	// CompressKubeConfig gzips the kubeconfig of sent entries and marks them with
+	// KubeConfigEncodingGzip. The SPIRE API must support it, so it is off by default.
+	CompressKubeConfig bool
+
+	// OmitKubeConfig leaves the kubeconfig out of sent entries entirely, for SPIRE
+	// servers with their own access to the cluster. The reconcilers then do not read
+	// the kubeconfig Secret at all.
+	OmitKubeConfig bool
+
+	// MaxResponseBytes bounds the response bodies read from the API. Defaults to
+	// DefaultMaxResponseBytes.
+	MaxResponseBytes int64
+
+	// StrictDecoding rejects responses with fields unknown to the client, e.g. to
+	// catch an API version mismatch.
+	StrictDecoding bool
+
+	// Backend, when set, registers the entries instead of the HTTP SPIRE API, e.g. a
+	// GRPCBackend. Dry runs are still handled by the SpireClient; the HTTP-specific
+	// options, such as Pool, Paths and BatchWindow, do not apply.
+	Backend EntryBackend
+
+	// DeleteStyle selects how entries are deleted: DeleteStylePost (the default when
+	// empty) POSTs the entry to the delete path, DeleteStyleREST sends DELETE to the
+	// entry's ID below the base path.
+	DeleteStyle string
+
+	// CreateMethod is the HTTP method of entry creations, POST (the default when
+	// empty) or PUT, sent to the add path.
+	CreateMethod string
+
+	// Upsert sends updates as creations, with the entry ID, for APIs whose creation
+	// call both creates and updates, e.g. PUT /v1/entries. An entry deleted behind
+	// the controller's back is then recreated rather than reported as not found.
+	Upsert bool
+
+	// JobPollInterval is the time between two polls of an asynchronous creation.
+	// JobTimeout bounds the wait for its entry ID or, when the job is polled on later
+	// reconciles, how long it may stay pending before the sync is reported as
+	// failed. They default to DefaultJobPollInterval and DefaultJobTimeout.
+	JobPollInterval time.Duration
+	JobTimeout      time.Duration
+
+	// MaxEntryBytes, when positive, fails entries whose payload exceeds it with
+	// ErrEntryTooLarge before they are sent, e.g. to match the SPIRE server's request
+	// body limit.
+	MaxEntryBytes int
+
+	batchOnce sync.Once
+	batcher   *entryBatcher
+}
+
+// DefaultMediaType is the media type of SPIRE API request and response bodies.
+const DefaultMediaType = "application/json"
+
+// mediaType returns mt, defaulting to DefaultMediaType.
+func mediaType(mt string) string {
+	if mt == "" {
+		return DefaultMediaType
+	}
+	return mt
+}
+
+// NewSpireClient returns a SpireClient failing over between the given SPIRE API endpoints.
+func NewSpireClient(servers ...SpireAPI) *SpireClient {
+	return &SpireClient{
+		Pool:       NewSpireAPIPool(servers...),
+		HTTPClient: defaultSpireHTTPClient,
+	}
+}
+
+// spireClient returns the configured SpireClient, defaulting to DefaultSpireAPI.
+func (r *ServiceAccountReconciler) spireClient() *SpireClient {
+	if r.SpireClient != nil {
+		return r.SpireClient
+	}
+	return NewSpireClient(DefaultSpireAPI())
+}
+
+// LoggableHeaders returns the custom headers with the values of sensitive headers redacted.
+func (c *SpireClient) LoggableHeaders() map[string]string {
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		if c.SensitiveHeaders[name] {
+			value = "[redacted]"
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+func (c *SpireClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultSpireHTTPClient
+}
+
+// creationKey marks the context of an entry creation, see do.
+type creationKey struct{}
+
+// do sends the request to the SPIRE API endpoints of the pool in turn until one
+// answers without a transport error or server error. It returns the response along
+// with the URL of the endpoint that served it, or the last failure. A creation is
+// only sent to the next endpoint when it carries an idempotency key: the failed
+// endpoint may have created the entry before failing, and a retry elsewhere would
+// register a duplicate.
+func (c *SpireClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, string, error) {
+	logger := log.FromContext(ctx)
+	endpoints := c.Pool.Endpoints()
+	if server := pinnedServer(ctx); server != "" {
+		if api, ok := c.Pool.lookup(server); ok {
+			endpoints = []SpireAPI{api}
+		} else {
+			logger.Info("Pinned SPIRE API server is not configured, trying all servers", "server", server)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, "", fmt.Errorf("%w: no SPIRE API servers configured", ErrSpireUnavailable)
+	}
+	if c.Breaker != nil {
+		var err error
+		if endpoints, err = c.Breaker.allowed(endpoints); err != nil {
+			return nil, "", err
+		}
+	}
+	var authorization string
+	if c.Token != nil {
+		token, err := c.Token.Get()
+		if err != nil {
+			return nil, "", err
+		}
+		authorization = "Bearer " + token
+	}
+
+	_, creation := ctx.Value(creationKey{}).(bool)
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	failover := !creation || key != "" && c.IdempotencyHeader != ""
+
+	var apiUrl string
+	for i, api := range endpoints {
+		apiUrl = api.GetServerURL()
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, apiUrl+path, reader)
+		if err != nil {
+			return nil, apiUrl, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", mediaType(c.ContentType))
+		}
+		req.Header.Set("Accept", mediaType(c.Accept))
+		for name, value := range c.Headers {
+			req.Header.Set(name, value)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if c.CorrelationHeader != "" {
+			if reconcileID := crcontroller.ReconcileIDFromContext(ctx); reconcileID != "" {
+				req.Header.Set(c.CorrelationHeader, string(reconcileID))
+			}
+		}
+		if key != "" && c.IdempotencyHeader != "" {
+			req.Header.Set(c.IdempotencyHeader, key)
+		}
+
+		resp, err := c.send(req, apiUrl)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			c.Pool.MarkHealthy(api)
+			if c.Breaker != nil {
+				c.Breaker.success(apiUrl)
+			}
+			recordServedBy(ctx, apiUrl)
+			return resp, apiUrl, nil
+		}
+		if ctx.Err() != nil {
+			return resp, apiUrl, err
+		}
+		c.Pool.MarkFailed(api)
+		if c.Breaker != nil {
+			c.Breaker.failure(apiUrl)
+		}
+		if i == len(endpoints)-1 {
+			return resp, apiUrl, err
+		}
+		if !failover {
+			logger.Info("SPIRE API endpoint failed, not retrying the creation on another server without an idempotency key",
+				"url", apiUrl)
+			return resp, apiUrl, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		logger.Info("SPIRE API endpoint failed, trying next server", "url", apiUrl, "reason", reason)
+	}
+	return nil, apiUrl, nil
+}
+
+// send performs a single SPIRE API request within its own span, propagating the
+// trace context to the server.
+func (c *SpireClient) send(req *http.Request, apiUrl string) (_ *http.Response, err error) {
+	ctx, span := tracer.Start(req.Context(), "SPIRE API "+req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("spire.server", apiUrl),
+			attribute.String("http.method", req.Method),
+			attribute.String("http.target", req.URL.Path),
+		))
+	defer func() { endSpan(span, err) }()
+
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// CreateEntry registers a SPIRE entry for the ServiceAccount. Concurrent calls for
+// the same ServiceAccount share a single request to the SPIRE API, so that rapid
+// repeated events cannot register duplicate entries before the annotation is written.
 func (r *ServiceAccountReconciler) CreateEntry(ctx context.Context, sa *corev1.ServiceAccount) (*entryID, error) {
+	reg, err := r.registerEntry(ctx, sa)
+	return reg.id, err
+}
+
+// registration is the result of registering the entry of a ServiceAccount.
+type registration struct {
+	id     *entryID
+	hash   string
+	server string
+	// spiffeID is the SPIFFE ID reported by the SPIRE API, if any.
+	spiffeID string
+	// trustDomain is the trust domain the entry is registered under.
+	trustDomain string
+	// selectors are the selectors the SPIRE API reports it applied, else the
+	// requested ones.
+	selectors []string
+}
+
+// registerEntry is CreateEntry, returning the registration: the entry ID, the hash of
+// the registered entry and the URL of the SPIRE server holding it, if known. Under
+// withEntryJobs, a creation accepted asynchronously fails with a JobPendingError and
+// a registration without an entry ID.
+func (r *ServiceAccountReconciler) registerEntry(ctx context.Context, sa *corev1.ServiceAccount) (_ registration, err error) {
+	ctx, span := tracer.Start(ctx, "CreateEntry", trace.WithAttributes(objectAttributes("ServiceAccount", sa.Namespace, sa.Name)...))
+	defer func() { endSpan(span, err) }()
+
+	key := client.ObjectKeyFromObject(sa).String()
+	v, err, shared := r.createFlight.Do(key, func() (interface{}, error) {
+		log.FromContext(ctx).Info("Creating SPIRE entry for ServiceAccount", "name", sa.Name, "namespace", sa.Namespace)
+		se, err := r.desiredEntry(ctx, sa)
+		if err != nil {
+			countRegistration("create", se, err)
+			return nil, err
+		}
+		ctx, served := withServedBy(ctx)
+		ctx, spiffeID := withSpiffeID(ctx)
+		ctx, selectors := withAppliedSelectors(ctx, se.Selectors)
+		id, err := r.spireClient().AddEntry(ctx, se)
+		countRegistration("create", se, err)
+		if errors.Is(err, ErrJobPending) {
+			return registration{hash: hashEntry(se), server: *served, trustDomain: se.TrustDomain}, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return registration{id: id, hash: hashEntry(se), server: *served, spiffeID: *spiffeID, trustDomain: se.TrustDomain,
+			selectors: *selectors}, nil
+	})
+	if shared {
+		log.FromContext(ctx).Info("Shared in-flight SPIRE entry creation", "name", sa.Name, "namespace", sa.Namespace)
+	}
+	// A pending creation job is returned along with the registration of its entry.
+	reg, _ := v.(registration)
+	return reg, err
+}
+
+// UpdateEntry updates the SPIRE entry id of the ServiceAccount to the entry rendered
+// from its current annotations and the cluster info, and returns the new entry hash.
+func (r *ServiceAccountReconciler) UpdateEntry(ctx context.Context, sa *corev1.ServiceAccount, id entryID) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "UpdateEntry", trace.WithAttributes(objectAttributes("ServiceAccount", sa.Namespace, sa.Name)...))
+	defer func() { endSpan(span, err) }()
+
+	se, err := r.desiredEntry(ctx, sa)
+	if err != nil {
+		countRegistration("update", se, err)
+		return "", err
+	}
+	ctx = WithSpireServer(ctx, sa.Annotations[SpireServerAnnotation])
+	err = r.spireClient().UpdateEntry(ctx, id, se)
+	countRegistration("update", se, err)
+	if err != nil {
+		return "", err
+	}
+	return hashEntry(se), nil
+}
+
+// desiredEntry renders the SpireEntry of the ServiceAccount from its annotations,
+// the reconciler defaults and the cluster info.
+func (r *ServiceAccountReconciler) desiredEntry(ctx context.Context, sa *corev1.ServiceAccount) (SpireEntry, error) {
 	logger := log.FromContext(ctx)
-	logger.Info("Creating SPIRE entry for ServiceAccount", "name", sa.Name, "namespace", sa.Namespace)
 
 	ClusterConfig, err := r.GetClusterInfo(ctx)
 	if err != nil {
 		logger.Error(err, "Failed to get cluster info from ConfigMap", "namespace", ClusterInfoCmNamespace, "name", ClusterInfoCm)
-		return nil, err
+		return SpireEntry{}, err
 	}
 
 	clusterName := ClusterConfig["clusterName"]
 	if clusterName == nil {
 		logger.Error(fmt.Errorf("clusterName not found"), "Failed to find clusterName in ClusterConfiguration", "namespace", ClusterInfoCmNamespace, "name", ClusterInfoCm)
-		return nil, fmt.Errorf("missing clusterName in configmap")
+		return SpireEntry{}, fmt.Errorf("missing clusterName in configmap")
+	}
+	cluster, err := entryCluster(sa, clusterName.(string))
+	if err != nil {
+		logger.Error(err, "Invalid cluster name annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	var kubeConfigData string
+	if !r.spireClient().OmitKubeConfig {
+		if kubeConfigData, err = entryKubeConfig(ctx, r.Client, &r.kubeConfigs, r.KubeConfigSecrets, cluster, r.RequireKubeConfig); err != nil {
+			return SpireEntry{}, err
+		}
 	}
 
-	kubeConfigData, err := r.GetKubeConfig(ctx)
+	x509SvidTtl, err := svidTTL(sa, X509SvidTTLAnnotation, r.X509SvidTTL)
 	if err != nil {
-		logger.Error(err, "Failed to get kubeconfig. defaulting to empty string")
+		logger.Error(err, "Invalid X509-SVID TTL annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+	jwtSvidTtl, err := svidTTL(sa, JWTSvidTTLAnnotation, r.JWTSvidTTL)
+	if err != nil {
+		logger.Error(err, "Invalid JWT-SVID TTL annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	trustDomain, err := entryTrustDomain(sa, ClusterConfig["trustDomain"].(string))
+	if err != nil {
+		logger.Error(err, "Invalid trust domain annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	dnsNames, err := entryDNSNames(sa)
+	if err != nil {
+		logger.Error(err, "Invalid DNS names annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	federatesWith, err := entryFederatesWith(sa, r.FederatesWith)
+	if err != nil {
+		logger.Error(err, "Invalid federated trust domains", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	selectors, err := entrySelectors(sa)
+	if err != nil {
+		logger.Error(err, "Invalid selectors annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+	if selectors == nil {
+		if selectors, err = entryTemplateSelectors(sa, r.SelectorTemplate); err != nil {
+			// The selectors are then left to the SPIRE server, as without a template.
+			logger.Error(err, "Failed to render the selector template, using the default selectors", "name", sa.Name)
+			selectors = nil
+		}
+	}
+
+	admin, err := entryFlag(sa, AdminAnnotation)
+	if err != nil {
+		logger.Error(err, "Invalid admin annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+	downstream, err := entryFlag(sa, DownstreamAnnotation)
+	if err != nil {
+		logger.Error(err, "Invalid downstream annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+	if admin && downstream {
+		logger.Error(nil, "ServiceAccount requests both admin and downstream privileges, which is unusual", "name", sa.Name)
+	}
+
+	hint, err := entryHint(sa)
+	if err != nil {
+		logger.Error(err, "Invalid hint annotation", "name", sa.Name)
+		return SpireEntry{}, err
+	}
+
+	parentID, err := r.ParentIDs.parentFor(cluster, trustDomain)
+	if err != nil {
+		logger.Error(err, "Invalid parent ID", "name", sa.Name)
+		return SpireEntry{}, err
 	}
 
 	// Create the SpireEntry object based on the ServiceAccount and ConfigMap data
 	se := SpireEntry{
-		TrustDomain:    ClusterConfig["trustDomain"].(string),
+		TrustDomain:    trustDomain,
 		ServiceAccount: sa.Name,
 		Namespace:      sa.Namespace,
-		Cluster:        clusterName.(string),
+		Cluster:        cluster,
 		KubeConfig:     kubeConfigData,
+		X509SvidTtl:    x509SvidTtl,
+		JwtSvidTtl:     jwtSvidTtl,
+		DnsNames:       dnsNames,
+		FederatesWith:  federatesWith,
+		Selectors:      selectors,
+		Admin:          admin,
+		Downstream:     downstream,
+		Hint:           hint,
+		ParentID:       parentID,
+
+		ServiceAccountUID: string(sa.UID),
+		ResourceVersion:   sa.ResourceVersion,
 	}
 
-	api := SpireAPI{
-		Server: fmt.Sprintf("http://%s", APIServer),
-		Port:   APIPort,
+	return se, nil
+}
+
+func (r *ServiceAccountReconciler) DeleteEntry(ctx context.Context, sa *corev1.ServiceAccount) (err error) {
+	ctx, span := tracer.Start(ctx, "DeleteEntry", trace.WithAttributes(objectAttributes("ServiceAccount", sa.Namespace, sa.Name)...))
+	defer func() { endSpan(span, err) }()
+
+	logger := log.FromContext(ctx)
+	logger.Info("Deleting SPIRE entry for ServiceAccount", "name", sa.Name, "namespace", sa.Namespace)
+
+	ClusterConfig, err := r.GetClusterInfo(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to get cluster info from ConfigMap", "namespace", ClusterInfoCmNamespace, "name", ClusterInfoCm)
+		countRegistration("delete", SpireEntry{}, err)
+		return err
+	}
+
+	// An invalid override never made it into a registered entry, so the entry to
+	// remove is the one under the cluster trust domain. The trust domain recorded at
+	// registration wins, as it may have changed since.
+	trustDomain, err := entryTrustDomain(sa, ClusterConfig["trustDomain"].(string))
+	if err != nil {
+		logger.Info("Ignoring invalid trust domain annotation for deletion", "name", sa.Name, "error", err.Error())
+		trustDomain = ClusterConfig["trustDomain"].(string)
+	}
+	if recorded := sa.Annotations[EntryTrustDomainAnnotation]; recorded != "" {
+		trustDomain = recorded
+	}
+	cluster, err := entryCluster(sa, ClusterConfig["clusterName"].(string))
+	if err != nil {
+		logger.Info("Ignoring invalid cluster name annotation for deletion", "name", sa.Name, "error", err.Error())
+		cluster = ClusterConfig["clusterName"].(string)
+	}
+
+	se := SpireEntry{
+		TrustDomain:    trustDomain,
+		ServiceAccount: sa.Name,
+		Namespace:      sa.Namespace,
+		Cluster:        cluster,
+		KubeConfig:     "", // Not needed for deletion
+
+		ServiceAccountUID: string(sa.UID), // Lets the server verify it deletes the entry of this SA
+	}
+
+	id, _, err := r.recordedEntryID(ctx, sa)
+	if err != nil {
+		logger.Error(err, "Failed to read SPIRE entry state", "name", sa.Name)
+		countRegistration("delete", se, err)
+		return err
+	}
+	// The entry is deleted on the server it was created on, when recorded.
+	err = r.spireClient().RemoveEntry(WithSpireServer(ctx, sa.Annotations[SpireServerAnnotation]), entryID(id), se)
+	countRegistration("delete", se, err)
+	return err
+}
+
+// AddEntry registers se with the SPIRE server and returns the resulting entry ID.
+func (c *SpireClient) AddEntry(ctx context.Context, se SpireEntry) (*entryID, error) {
+	if c.Backend != nil && !c.DryRun {
+		return c.Backend.AddEntry(ctx, se)
 	}
-	apiUrl := api.GetServerURL()
+	if c.BatchWindow > 0 && !c.DryRun {
+		c.batchOnce.Do(func() {
+			c.batcher = &entryBatcher{client: c, window: c.BatchWindow}
+		})
+		return c.batcher.add(ctx, se)
+	}
+	return c.addEntry(ctx, se)
+}
 
-	logger.Info("SPIRE API URL", "url", apiUrl)
+func (c *SpireClient) addEntry(ctx context.Context, se SpireEntry) (*entryID, error) {
+	logger := log.FromContext(ctx)
 	logger.Info("Creating SPIRE Entry", "entry", se)
 
+	paths := c.apiPaths()
+	method, addPath := c.createMethod(), paths.path(paths.Add)
+	if c.DryRun {
+		eID := entryID(fmt.Sprintf("dry-run-%s-%s", se.Namespace, se.ServiceAccount))
+		logger.Info("Dry run: skipping SPIRE entry creation", "servers", c.Pool.Endpoints(), "method", method, "path", addPath, "entryID", eID)
+		return &eID, nil
+	}
+
+	// The key is taken from the rendered entry, whatever the wire encoding of its kubeconfig.
+	key := idempotencyKey(se)
+	se, err := c.wireEntry(se)
+	if err != nil {
+		logger.Error(err, "Failed to compress kubeconfig")
+		return nil, err
+	}
 	// Marshal the SpireEntry to JSON
 	data, err := json.Marshal(se)
 	if err != nil {
 		logger.Error(err, "Failed to marshal SPIRE entry")
 		return nil, err
 	}
+	if err := c.checkEntrySize(se, data); err != nil {
+		logger.Error(err, "Not sending oversized SPIRE entry")
+		return nil, err
+	}
 	// Send the request to the SPIRE server to create the entry
-	logger.Info("Sending request to SPIRE server", "url", apiUrl, "data", string(data))
-
-	resp, err := http.Post(apiUrl+"/v1/entries/add", "application/json", bytes.NewBuffer(data))
+	logger.Info("Sending request to SPIRE server", "data", string(data), "idempotencyKey", key)
 
+	ctx = context.WithValue(ctx, creationKey{}, true)
+	resp, apiUrl, err := c.do(context.WithValue(ctx, idempotencyKeyKey{}, key), method, addPath, data)
+	if err == nil {
+		logger.Info("SPIRE API URL", "url", apiUrl)
+	}
 	if err != nil {
-		logger.Error(err, "Failed to send request to SPIRE server", "url", "response", apiUrl, resp.Status)
-		return nil, err
+		logger.Error(err, "Failed to send request to SPIRE server", "url", apiUrl)
+		return nil, fmt.Errorf("%w: creating entry via %s: %w", ErrSpireUnavailable, apiUrl, err)
 	}
 
 	defer resp.Body.Close()
 
 	var entry SpireEntryResponse
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := c.readBody(resp)
 	if err != nil {
 		logger.Error(err, "Failed to read response body")
-		return nil, err
+		return nil, fmt.Errorf("%w: reading create response: %w", ErrSpireUnavailable, err)
 	}
-	if err := json.Unmarshal(respBody, &entry); err != nil {
-		logger.Error(err, "Failed to unmarshal response body")
-		return nil, err
+	// Error responses are not always JSON; their raw body is used as the message.
+	if err := c.decodeBody(respBody, &entry); err != nil && (createSucceeded(resp.StatusCode) || resp.StatusCode == http.StatusAccepted) {
+		logger.Error(err, "Failed to unmarshal response body", "status", resp.Status)
+		return nil, malformedResponse("create", resp, respBody, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Error(nil, "SPIRE server returned non-200 status code", "status", resp.Status)
-		return nil, err
+	// An asynchronous API accepts the creation as a job whose entry ID is only known
+	// once it completes.
+	if resp.StatusCode == http.StatusAccepted {
+		if entry.JobID == "" {
+			logger.Error(nil, "SPIRE server accepted the entry without a job ID", "message", entry.Message)
+			return nil, fmt.Errorf("SPIRE server accepted the entry without a job ID: %s", responseMessage(respBody))
+		}
+		job := entry.JobID
+		if pollsEntryJobs(ctx) {
+			logger.Info("SPIRE entry creation accepted, polling the job later", "jobID", job)
+			return nil, &JobPendingError{Server: apiUrl, JobID: job}
+		}
+		logger.Info("SPIRE entry creation accepted, waiting for the job to complete", "jobID", job)
+		if entry, err = c.awaitJob(ctx, apiUrl, job); err != nil {
+			logger.Error(err, "SPIRE entry creation job did not complete", "jobID", job)
+			return nil, err
+		}
+		logger.Info("Successfully created SPIRE entry", "entryID", entry.EntryID, "jobID", job)
+		recordSpiffeID(ctx, entry.SpiffeID)
+		recordAppliedSelectors(ctx, entry.Selectors)
+		eID := entryID(entry.EntryID)
+		return &eID, nil
+	}
+
+	// A retried registration (e.g. after a crash before the entry ID annotation was
+	// written) is reported as a conflict carrying the ID of the existing entry.
+	if isEntryConflict(resp.StatusCode, entry) {
+		if entry.EntryID == "" {
+			logger.Error(nil, "SPIRE entry already exists but no entry ID was returned", "status", resp.Status, "message", entry.Message)
+			return nil, fmt.Errorf("%w: entry already exists but server returned no entry ID: %s: %s", ErrEntryConflict, resp.Status, responseMessage(respBody))
+		}
+		logger.Info("SPIRE entry already exists, using existing entry", "entryID", entry.EntryID)
+		eID := entryID(entry.EntryID)
+		return &eID, nil
+	}
+
+	if !createSucceeded(resp.StatusCode) {
+		logger.Error(nil, "SPIRE server returned non-200 status code", "status", resp.Status, "message", responseMessage(respBody))
+		return nil, statusError("create", resp, respBody)
 	} else {
 		logger.Info("Successfully created SPIRE entry", "entryID", entry.EntryID)
+		recordSpiffeID(ctx, entry.SpiffeID)
+		recordAppliedSelectors(ctx, entry.Selectors)
 
 	}
 	eID := entryID(entry.EntryID)
 	return &eID, nil
 }
 
-func (r *ServiceAccountReconciler) DeleteEntry(ctx context.Context, sa *corev1.ServiceAccount) error {
+// RemoveEntry deletes the SPIRE entry id, matching se. With DeleteStyleREST, the entry
+// is deleted by its ID when known; otherwise se is POSTed to the delete path. The
+// message of the server's response, if any, is logged and recorded in ctx, see
+// withDeleteMessage. ErrEntryNotFound is only returned for a 404 whose body
+// identifies a missing entry.
+func (c *SpireClient) RemoveEntry(ctx context.Context, id entryID, se SpireEntry) error {
 	logger := log.FromContext(ctx)
-	logger.Info("Deleting SPIRE entry for ServiceAccount", "name", sa.Name, "namespace", sa.Namespace)
 
-	ClusterConfig, err := r.GetClusterInfo(ctx)
+	paths := c.apiPaths()
+	method, deletePath := http.MethodPost, paths.path(paths.Delete)
+	if c.DeleteStyle == DeleteStyleREST && id != "" {
+		method, deletePath = http.MethodDelete, joinURLPath(paths.Base, url.PathEscape(string(id)))
+	}
+	if c.DryRun {
+		logger.Info("Dry run: skipping SPIRE entry deletion", "servers", c.Pool.Endpoints(), "method", method, "path", deletePath, "entry", se)
+		return nil
+	}
+	if c.Backend != nil {
+		return c.Backend.RemoveEntry(ctx, id, se)
+	}
+
+	var data []byte
+	if method == http.MethodPost {
+		var err error
+		if data, err = json.Marshal(se); err != nil {
+			logger.Error(err, "Failed to marshal SPIRE entry for deletion")
+			return err
+		}
+	}
+	resp, apiUrl, err := c.do(ctx, method, deletePath, data)
+	if err == nil {
+		logger.Info("SPIRE API URL", "url", apiUrl)
+	}
 	if err != nil {
-		logger.Error(err, "Failed to get cluster info from ConfigMap", "namespace", ClusterInfoCmNamespace, "name", ClusterInfoCm)
-		return err
+		logger.Error(err, "Failed to send delete request to SPIRE server", "url", apiUrl)
+		return fmt.Errorf("%w: deleting entry via %s: %w", ErrSpireUnavailable, apiUrl, err)
 	}
 
-	se := SpireEntry{
-		TrustDomain:    ClusterConfig["trustDomain"].(string),
-		ServiceAccount: sa.Name,
-		Namespace:      sa.Namespace,
-		Cluster:        ClusterConfig["clusterName"].(string),
-		KubeConfig:     "", // Not needed for deletion
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := c.readBody(resp)
+		logger.Error(nil, "SPIRE server returned non-200 status code for deletion", "status", resp.Status, "message", responseMessage(bodyBytes))
+		// An entry already gone releases the finalizer, so a 404 only counts as such
+		// when the body tells the entry is missing: a misconfigured path or an unknown
+		// route also answers 404, and the entry would leak.
+		if resp.StatusCode == http.StatusNotFound && !entryMissingBody(bodyBytes) {
+			return fmt.Errorf("failed to delete SPIRE entry: %s %s answered %s without identifying a missing entry",
+				method, deletePath, resp.Status)
+		}
+		return statusError("delete", resp, bodyBytes)
 	}
 
-	api := SpireAPI{
-		Server: fmt.Sprintf("http://%s", APIServer),
-		Port:   APIPort,
+	// The message may tell what the server deleted, e.g. "deleted 1 entry, 0 skipped".
+	bodyBytes, err := c.readBody(resp)
+	if err != nil {
+		logger.Info("Failed to read SPIRE deletion response", "error", err.Error())
 	}
-	apiUrl := api.GetServerURL()
+	message := deleteMessage(bodyBytes)
+	logger.Info("Successfully deleted SPIRE entry", "message", message)
+	recordDeleteMessage(ctx, message)
+	return nil
+}
 
-	logger.Info("SPIRE API URL", "url", apiUrl)
+type deleteMessageKey struct{}
 
-	data, err := json.Marshal(se)
+// withDeleteMessage returns a context recording the message the SPIRE API returns
+// when it deletes an entry, if any.
+func withDeleteMessage(ctx context.Context) (context.Context, *string) {
+	message := new(string)
+	return context.WithValue(ctx, deleteMessageKey{}, message), message
+}
+
+func recordDeleteMessage(ctx context.Context, message string) {
+	if recorded, ok := ctx.Value(deleteMessageKey{}).(*string); ok && message != "" {
+		*recorded = message
+	}
+}
+
+// deleteMessage returns the message of a successful deletion response: the Message of
+// a JSON body, else the text of the body.
+func deleteMessage(body []byte) string {
+	var resp SpireEntryResponse
+	if err := json.Unmarshal(body, &resp); err == nil {
+		return truncateMessage(resp.Message)
+	}
+	return truncateMessage(string(body))
+}
+
+// UpdateEntry replaces the SPIRE entry id with se. With Upsert, se is sent to the
+// add path with the CreateMethod instead of the update path.
+func (c *SpireClient) UpdateEntry(ctx context.Context, id entryID, se SpireEntry) error {
+	logger := log.FromContext(ctx)
+	logger.Info("Updating SPIRE Entry", "entryID", id, "entry", se)
+
+	paths := c.apiPaths()
+	method, updatePath := http.MethodPost, paths.path(paths.Update)
+	if c.Upsert {
+		method, updatePath = c.createMethod(), paths.path(paths.Add)
+	}
+	if c.DryRun {
+		logger.Info("Dry run: skipping SPIRE entry update", "servers", c.Pool.Endpoints(), "method", method, "path", updatePath, "entryID", id)
+		return nil
+	}
+	if c.Backend != nil {
+		return c.Backend.UpdateEntry(ctx, id, se)
+	}
+
+	se, err := c.wireEntry(se)
 	if err != nil {
-		logger.Error(err, "Failed to marshal SPIRE entry for deletion")
+		logger.Error(err, "Failed to compress kubeconfig")
 		return err
 	}
-	resp, err := http.Post(apiUrl+"/v1/entries/delete", "application/json", bytes.NewBuffer(data))
+	data, err := json.Marshal(RegisteredEntry{EntryID: string(id), SpireEntry: se})
 	if err != nil {
-		logger.Error(err, "Failed deleting entry. spire-api returned a non-200", "url", apiUrl, "response", resp.Status)
+		logger.Error(err, "Failed to marshal SPIRE entry for update")
+		return err
+	}
+	if err := c.checkEntrySize(se, data); err != nil {
+		logger.Error(err, "Not sending oversized SPIRE entry")
 		return err
 	}
+	resp, apiUrl, err := c.do(ctx, method, updatePath, data)
+	if err != nil {
+		logger.Error(err, "Failed to send update request to SPIRE server", "url", apiUrl)
+		return fmt.Errorf("%w: updating entry via %s: %w", ErrSpireUnavailable, apiUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode == http.StatusOK || c.Upsert && createSucceeded(resp.StatusCode)) {
+		bodyBytes, _ := c.readBody(resp)
+		logger.Error(nil, "Failed to update SPIRE entry", "status", resp.Status, "message", responseMessage(bodyBytes))
+		// A server without the update route must not be mistaken for one that lost the
+		// entry, which would register a duplicate.
+		if updateUnsupported(resp.StatusCode, bodyBytes) {
+			return fmt.Errorf("%w: %s %s answered %s", ErrUpdateUnsupported, method, updatePath, resp.Status)
+		}
+		return statusError("update", resp, bodyBytes)
+	}
+
+	logger.Info("Successfully updated SPIRE entry", "entryID", id)
+	// The body of an update response is optional; it may report the applied selectors.
+	if body, err := c.readBody(resp); err == nil {
+		var entry SpireEntryResponse
+		if json.Unmarshal(body, &entry) == nil {
+			recordAppliedSelectors(ctx, entry.Selectors)
+		}
+	}
+	return nil
+}
+
+// updateUnsupported reports whether an update answered with statusCode and body shows
+// that the API has no update operation rather than no such entry.
+func updateUnsupported(statusCode int, body []byte) bool {
+	switch statusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		return !entryMissingBody(body)
+	}
+	return false
+}
+
+// hashEntry returns the SHA-256 of the rendered entry, used to detect whether the
+// registered entry is out of date. List fields are sorted and the ResourceVersion,
+// which changes on every write of the ServiceAccount, is left out.
+func hashEntry(se SpireEntry) string {
+	se.ResourceVersion = ""
+	se.DnsNames = sortedCopy(se.DnsNames)
+	se.FederatesWith = sortedCopy(se.FederatesWith)
+	se.Selectors = sortedCopy(se.Selectors)
 
+	data, _ := json.Marshal(se)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyKeyKey carries the idempotency key of a creation request, see do.
+type idempotencyKeyKey struct{}
+
+// idempotencyKey identifies the logical creation of se: the ServiceAccount UID and the
+// hash of the entry. Retries of the same creation, even after the ServiceAccount was
+// written in between, share the key; a recreated ServiceAccount or a changed entry
+// gets a new one.
+func idempotencyKey(se SpireEntry) string {
+	sum := sha256.Sum256([]byte(se.ServiceAccountUID + "/" + hashEntry(se)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func sortedCopy(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ListEntries returns the SPIRE entries registered for the given cluster.
+func (c *SpireClient) ListEntries(ctx context.Context, cluster string) ([]RegisteredEntry, error) {
+	if c.Backend != nil {
+		return c.Backend.ListEntries(ctx, cluster)
+	}
+	logger := log.FromContext(ctx)
+
+	paths := c.apiPaths()
+	listPath := paths.path(paths.List) + "?" + url.Values{"cluster": []string{cluster}}.Encode()
+	resp, apiUrl, err := c.do(ctx, http.MethodGet, listPath, nil)
+	if err != nil {
+		logger.Error(err, "Failed to list SPIRE entries", "url", apiUrl)
+		return nil, fmt.Errorf("%w: listing entries via %s: %w", ErrSpireUnavailable, apiUrl, err)
+	}
 	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		logger.Error(nil, "SPIRE server returned non-200 status code for deletion", "status", resp.Status)
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		logger.Error(fmt.Errorf("response body: %s", string(bodyBytes)), "Failed to delete SPIRE entry")
-		return fmt.Errorf("failed to delete SPIRE entry: %s", resp.Status)
+		bodyBytes, _ := c.readBody(resp)
+		logger.Error(nil, "SPIRE server returned non-200 status code for list", "status", resp.Status, "message", responseMessage(bodyBytes))
+		return nil, statusError("list", resp, bodyBytes)
 	}
 
-	logger.Info("Successfully deleted SPIRE entry")
-	return nil
+	respBody, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading list response: %w", ErrSpireUnavailable, err)
+	}
+	var list SpireEntryListResponse
+	if err := c.decodeBody(respBody, &list); err != nil {
+		logger.Error(err, "Failed to decode SPIRE entry list", "status", resp.Status)
+		return nil, malformedResponse("list", resp, respBody, err)
+	}
+	return list.Entries, nil
 }
 
 func (r *ServiceAccountReconciler) GetClusterInfo(ctx context.Context) (map[string]interface{}, error) {
+	return readClusterInfo(ctx, r.Client, r.ClusterName)
+}
+
+// GetKubeConfig returns the base64-encoded kubeconfig of the SPIRE entries of cluster.
+func (r *ServiceAccountReconciler) GetKubeConfig(ctx context.Context, cluster string) (string, error) {
+	secret, err := r.KubeConfigSecrets.secretFor(cluster)
+	if err != nil {
+		return "", err
+	}
+	return readKubeConfig(ctx, r.Client, secret, &r.kubeConfigs)
+}
+
+// ClusterNameLookup locates the cluster name, which kubeadm versions and
+// distributions store in different places, and the trust domain of the cluster.
+type ClusterNameLookup struct {
+	// Keys are tried in order after the top-level clusterName of the ClusterConfiguration.
+	// Each is a key of the cluster info ConfigMap data or a dot-separated path into the
+	// ClusterConfiguration, e.g. "clusterInfo.name".
+	Keys []string
+
+	// Default is the cluster name used when none of the keys resolve.
+	Default string
+
+	// Override, when set, is the cluster name of SPIRE entries regardless of the
+	// ConfigMap, e.g. a friendly alias for the cluster.
+	Override string
+
+	// TrustDomain locates the trust domain, by default the SpireTrustDomainAnnotation
+	// of the cluster info ConfigMap.
+	TrustDomain TrustDomainSource
+}
+
+// keys returns the keys tried in order.
+func (l ClusterNameLookup) keys() []string {
+	return append([]string{"clusterName"}, l.Keys...)
+}
+
+// resolve returns the override, else the cluster name from the ConfigMap data and
+// its parsed ClusterConfiguration, or false when no key resolves and there is no
+// default.
+func (l ClusterNameLookup) resolve(data map[string]string, clusterInfo map[string]interface{}) (string, bool) {
+	if l.Override != "" {
+		return l.Override, true
+	}
+	for _, key := range l.keys() {
+		if value := strings.TrimSpace(data[key]); value != "" {
+			return value, true
+		}
+		if value, ok := lookupPath(clusterInfo, key); ok {
+			return value, true
+		}
+	}
+	return l.Default, l.Default != ""
+}
+
+// lookupPath returns the non-empty string at the dot-separated path in doc.
+func lookupPath(doc map[string]interface{}, path string) (string, bool) {
+	var node interface{} = doc
+	for _, field := range strings.Split(path, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		node = m[field]
+	}
+	value, ok := node.(string)
+	return value, ok && value != ""
+}
+
+// readClusterInfo reads the ClusterConfiguration from the cluster info ConfigMap and
+// injects the SPIRE trust domain from its annotation and the cluster name resolved
+// by names.
+func readClusterInfo(ctx context.Context, c client.Reader, names ClusterNameLookup) (_ map[string]interface{}, err error) {
+	ctx, span := tracer.Start(ctx, "GetClusterInfo", trace.WithAttributes(objectAttributes("ConfigMap", ClusterInfoCmNamespace, ClusterInfoCm)...))
+	defer func() { endSpan(span, err) }()
+
 	logger := log.FromContext(ctx)
 	kacm := &corev1.ConfigMap{}
 
-	if err := r.Get(ctx, client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, kacm); err != nil {
+	if err := getWithRetry(ctx, c, client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, kacm); err != nil {
 		logger.Error(err, "Failed to get ConfigMap for cluster info", "namespace", ClusterInfoCmNamespace, "name", ClusterInfoCm)
 		return nil, err
 	}
 
 	// Check if the ConfigMap has the required data
-	if kacm.Data == nil || kacm.Annotations[SpireTrustDomainAnnotation] == "" {
-		logger.Error(fmt.Errorf("invalid ConfigMap"), "missing trust-domain", "ConfigMap", ClusterInfoCm, "namespace", ClusterInfoCmNamespace)
+	trustDomain, err := names.TrustDomain.resolve(ctx, c, kacm)
+	if err != nil {
+		logger.Error(err, "Invalid trust domain", "ConfigMap", ClusterInfoCm, "namespace", ClusterInfoCmNamespace)
+		return nil, err
+	}
+	if kacm.Data == nil {
+		logger.Error(fmt.Errorf("invalid ConfigMap"), "missing data", "ConfigMap", ClusterInfoCm, "namespace", ClusterInfoCmNamespace)
 		return nil, fmt.Errorf("missing required data in ConfigMap %s/%s", ClusterInfoCmNamespace, ClusterInfoCm)
 	}
 
-	trustDomain := kacm.Annotations[SpireTrustDomainAnnotation]
-
-	var clusterInfo map[string]interface{}
-	err := yaml.Unmarshal([]byte(kacm.Data["ClusterConfiguration"]), &clusterInfo)
+	clusterInfo, err := parseClusterConfiguration(kacm.Data["ClusterConfiguration"])
 	if err != nil {
 		logger.Error(err, "Failed to unmarshal cluster info", "message", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("invalid ClusterConfiguration in ConfigMap %s/%s: %w", ClusterInfoCmNamespace, ClusterInfoCm, err)
+	}
+
+	clusterName, ok := names.resolve(kacm.Data, clusterInfo)
+	if !ok {
+		return nil, fmt.Errorf("cluster name not found in ConfigMap %s/%s: tried %s; set --cluster-name to provide one",
+			ClusterInfoCmNamespace, ClusterInfoCm, strings.Join(names.keys(), ", "))
 	}
-	// Inject the trust domain into the clusterInfo map for convenience
+
+	// Inject the trust domain and cluster name into the clusterInfo map for convenience
 	clusterInfo["trustDomain"] = trustDomain
+	clusterInfo["clusterName"] = clusterName
 	return clusterInfo, nil
 }
 
-func (r *ServiceAccountReconciler) GetKubeConfig(ctx context.Context) (string, error) {
+// readKubeConfig returns the base64-encoded kubeconfig from the Secret key. When cache
+// is set, a kubeconfig unchanged since it was last validated is served from it.
+func readKubeConfig(ctx context.Context, c client.Reader, key types.NamespacedName, cache *kubeConfigCache) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "GetKubeConfig", trace.WithAttributes(objectAttributes("Secret", key.Namespace, key.Name)...))
+	defer func() { endSpan(span, err) }()
+
 	logger := log.FromContext(ctx)
-	logger.Info("Getting kubeconfig from Secret")
 	kcSecret := &corev1.Secret{}
 
 	var kubeConfig string
-	if err := r.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: AdminKubeConfigSecret}, kcSecret); err != nil {
-		logger.Error(err, "Failed to get Secret for kubeconfig", "namespace", "kube-system", "name", AdminKubeConfigSecret)
+	if err := getWithRetry(ctx, c, key, kcSecret); err != nil {
+		logger.Error(err, "Failed to get Secret for kubeconfig", "namespace", key.Namespace, "name", key.Name)
 		return "", err
 	}
 
 	if kcSecret.Data == nil || len(kcSecret.Data) == 0 {
-		logger.Error(fmt.Errorf("missing kubeconfig data"), "Failed to find kubeconfig in Secret", "namespace", "kube-system", "name", AdminKubeConfigSecret)
-		return "", fmt.Errorf("missing kubeconfig data in Secret %s/%s", "kube-system", AdminKubeConfigSecret)
+		logger.Error(fmt.Errorf("missing kubeconfig data"), "Failed to find kubeconfig in Secret", "namespace", key.Namespace, "name", key.Name)
+		return "", fmt.Errorf("missing kubeconfig data in Secret %s/%s", key.Namespace, key.Name)
 	} else {
+		if kubeConfig, ok := cache.lookup(key, kcSecret.Data["kubeconfig"]); ok {
+			return kubeConfig, nil
+		}
+		logger.Info("Getting kubeconfig from Secret")
+		// Secret data is delivered decoded; entries carry it base64-encoded until it
+		// is put on the wire in the configured encoding.
+		if err := validateKubeConfig(kcSecret.Data["kubeconfig"]); err != nil {
+			logger.Error(err, "Invalid kubeconfig in Secret", "namespace", key.Namespace, "name", key.Name)
+			return "", fmt.Errorf("invalid kubeconfig in Secret %s/%s: %w", key.Namespace, key.Name, err)
+		}
 		kubeConfig = base64.StdEncoding.EncodeToString(kcSecret.Data["kubeconfig"])
+		cache.store(key, kcSecret.Data["kubeconfig"], kubeConfig)
 		logger.Info("Successfully retrieved kubeconfig")
 		return kubeConfig, nil
 	}
 
 }
+
+// RetryAfterError is returned when the SPIRE API asks the client to back off for a
+// specific duration, e.g. a 429 response carrying a Retry-After header.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// retryAfter returns the back-off requested by the SPIRE API, if err carries one.
+func retryAfter(err error) (time.Duration, bool) {
+	var raErr *RetryAfterError
+	if errors.As(err, &raErr) {
+		return raErr.After, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter parses a Retry-After header value in either delta-seconds or
+// HTTP-date form. It reports false for a missing, invalid or elapsed value.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if after := date.Sub(now); after > 0 {
+			return after, true
+		}
+	}
+	return 0, false
+}
+
+// statusError maps a non-200 SPIRE API response to an error wrapping the matching sentinel.
+func statusError(op string, resp *http.Response, body []byte) error {
+	status := resp.Status
+	if message := responseMessage(body); message != "" {
+		status += ": " + message
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("failed to %s SPIRE entry: %w: %s", op, ErrEntryNotFound, status)
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("failed to %s SPIRE entry: %w: %s", op, ErrEntryConflict, status)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		err := fmt.Errorf("failed to %s SPIRE entry: %w: %s", op, ErrSpireUnavailable, status)
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return &RetryAfterError{Err: err, After: after}
+		}
+		return err
+	default:
+		return fmt.Errorf("failed to %s SPIRE entry: %s", op, status)
+	}
+}
+
+// maxResponseMessage bounds the length of a raw error body surfaced as a message.
+const maxResponseMessage = 256
+
+// responseMessage returns the message of a SPIRE API response body: the code,
+// message and offending fields of a structured error, else the message field of a
+// flat JSON body, else the trimmed raw body, truncated.
+func responseMessage(body []byte) string {
+	if detail, ok := errorDetail(body); ok {
+		return truncateMessage(detail.String())
+	}
+	var resp SpireEntryResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Message != "" {
+		return resp.Message
+	}
+	return truncateMessage(string(body))
+}
+
+// createSucceeded reports whether a creation answered with statusCode succeeded:
+// upsert APIs answer 201 Created for a new entry.
+func createSucceeded(statusCode int) bool {
+	return statusCode == http.StatusOK || statusCode == http.StatusCreated
+}
+
+// isEntryConflict reports whether a create response indicates the entry already exists.
+func isEntryConflict(statusCode int, entry SpireEntryResponse) bool {
+	return statusCode == http.StatusConflict || strings.Contains(strings.ToLower(entry.Message), "already exists")
+}
+
+// svidTTL returns the SVID TTL in seconds for the ServiceAccount, preferring the
+// value of the given annotation over the controller-wide default.
+func svidTTL(sa *corev1.ServiceAccount, annotation string, defaultTTL int) (int, error) {
+	value, exists := sa.Annotations[annotation]
+	if !exists || value == "" {
+		return defaultTTL, nil
+	}
+	ttl, err := strconv.Atoi(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid value %q for annotation %s: must be a non-negative number of seconds", value, annotation)
+	}
+	return ttl, nil
+}
+
+// entryFlag parses a boolean annotation on the ServiceAccount, false when absent.
+func entryFlag(sa *corev1.ServiceAccount, annotation string) (bool, error) {
+	value, exists := sa.Annotations[annotation]
+	if !exists || value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for annotation %s: must be true or false", value, annotation)
+	}
+	return flag, nil
+}
+
+// entryTrustDomain returns the trust domain of the ServiceAccount's entry: the
+// SpireTrustDomainAnnotation on the ServiceAccount when present, else clusterDefault.
+func entryTrustDomain(sa *corev1.ServiceAccount, clusterDefault string) (string, error) {
+	value, exists := sa.Annotations[SpireTrustDomainAnnotation]
+	if !exists {
+		return clusterDefault, nil
+	}
+	if err := validateTrustDomain(value); err != nil {
+		return "", fmt.Errorf("invalid %s annotation %q: %w", SpireTrustDomainAnnotation, value, err)
+	}
+	return value, nil
+}
+
+// entryCluster returns the cluster name of the ServiceAccount's entry: the
+// ClusterNameAnnotation on the ServiceAccount when present, else clusterDefault.
+func entryCluster(sa *corev1.ServiceAccount, clusterDefault string) (string, error) {
+	value, exists := sa.Annotations[ClusterNameAnnotation]
+	if !exists {
+		return clusterDefault, nil
+	}
+	if err := validateClusterName(value); err != nil {
+		return "", fmt.Errorf("invalid %s annotation %q: %w", ClusterNameAnnotation, value, err)
+	}
+	return value, nil
+}
+
+// validateClusterName checks that a cluster name is non-empty and free of
+// whitespace and control characters.
+func validateClusterName(name string) error {
+	if name == "" {
+		return fmt.Errorf("cluster name is empty")
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("cluster name must not contain whitespace or control characters")
+	}
+	return nil
+}
+
+// MaxHintLength is the longest hint accepted, matching the SPIRE server limit.
+const MaxHintLength = 1024
+
+// hintPattern matches the characters allowed in a hint.
+var hintPattern = regexp.MustCompile(`^[A-Za-z0-9._:/-]+$`)
+
+// entryHint returns the hint annotated on the ServiceAccount, or "" when there is none.
+func entryHint(sa *corev1.ServiceAccount) (string, error) {
+	value := strings.TrimSpace(sa.Annotations[HintAnnotation])
+	if value == "" {
+		return "", nil
+	}
+	if len(value) > MaxHintLength {
+		return "", fmt.Errorf("invalid %s annotation: must be at most %d characters", HintAnnotation, MaxHintLength)
+	}
+	if !hintPattern.MatchString(value) {
+		return "", fmt.Errorf("invalid %s annotation %q: must only contain letters, digits, '.', '_', ':', '/' and '-'", HintAnnotation, value)
+	}
+	return value, nil
+}
+
+// entryDNSNames parses the comma-separated DNS names annotation on the ServiceAccount,
+// validating each name and dropping duplicates while preserving order.
+func entryDNSNames(sa *corev1.ServiceAccount) ([]string, error) {
+	value := sa.Annotations[DNSNamesAnnotation]
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			if wcErrs := validation.IsWildcardDNS1123Subdomain(name); len(wcErrs) > 0 {
+				return nil, fmt.Errorf("invalid DNS name %q in annotation %s: %s", name, DNSNamesAnnotation, strings.Join(errs, "; "))
+			}
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// selectorTypePattern matches the type of a selector, e.g. unix or k8s.
+var selectorTypePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// entrySelectors parses the selectors annotation on the ServiceAccount. Each selector
+// is type:value, e.g. unix:uid:1000 or k8s:pod-label:app:web. None leaves the
+// selectors to the SPIRE server.
+func entrySelectors(sa *corev1.ServiceAccount) ([]string, error) {
+	return parseSelectors(sa.Annotations[SelectorsAnnotation], "annotation "+SelectorsAnnotation)
+}
+
+// parseSelectors parses comma or newline separated selectors read from source,
+// dropping duplicates.
+func parseSelectors(value, source string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var selectors []string
+	seen := map[string]bool{}
+	for _, selector := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		selector = strings.TrimSpace(selector)
+		if selector == "" || seen[selector] {
+			continue
+		}
+		if err := validateSelector(selector); err != nil {
+			return nil, fmt.Errorf("invalid selector %q in %s: %w", selector, source, err)
+		}
+		seen[selector] = true
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// validateSelector checks that selector is of the form type:value.
+func validateSelector(selector string) error {
+	selectorType, value, ok := strings.Cut(selector, ":")
+	if !ok {
+		return fmt.Errorf("must be of the form type:value")
+	}
+	if !selectorTypePattern.MatchString(selectorType) {
+		return fmt.Errorf("type %q must only contain letters, digits, '_' and '-'", selectorType)
+	}
+	if value == "" {
+		return fmt.Errorf("value must not be empty")
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("value must not contain whitespace or control characters")
+	}
+	return nil
+}
+
+// entryFederatesWith returns the federated trust domains for the ServiceAccount. The
+// comma-separated annotation takes precedence over the controller-wide default list.
+func entryFederatesWith(sa *corev1.ServiceAccount, defaults []string) ([]string, error) {
+	values := defaults
+	if value, exists := sa.Annotations[FederatesWithAnnotation]; exists {
+		values = strings.Split(value, ",")
+	}
+
+	var domains []string
+	seen := map[string]bool{}
+	for _, td := range values {
+		td = strings.TrimSpace(td)
+		if td == "" || seen[td] {
+			continue
+		}
+		if err := validateTrustDomainURI(td); err != nil {
+			return nil, err
+		}
+		seen[td] = true
+		domains = append(domains, td)
+	}
+	return domains, nil
+}
+
+// validateTrustDomainURI checks that value is a trust domain URI of the form
+// spiffe://<trust-domain>, with no path, port, query or user info.
+func validateTrustDomainURI(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid trust domain URI %q: %w", value, err)
+	}
+	if u.Scheme != "spiffe" || u.Host == "" {
+		return fmt.Errorf("invalid trust domain URI %q: must be of the form spiffe://<trust-domain>", value)
+	}
+	if u.User != nil || u.Port() != "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid trust domain URI %q: must not contain user info, port, path, query or fragment", value)
+	}
+	if err := validateTrustDomain(u.Host); err != nil {
+		return fmt.Errorf("invalid trust domain URI %q: %w", value, err)
+	}
+	return nil
+}
+
+// validateTrustDomain checks a trust domain name against the SPIFFE ID rules: a
+// non-empty name of lowercase letters, digits, dots, dashes and underscores, without
+// a scheme, port or path.
+func validateTrustDomain(td string) error {
+	if td == "" {
+		return fmt.Errorf("trust domain is empty")
+	}
+	if strings.Contains(td, "://") {
+		return fmt.Errorf("trust domain %q must not include a scheme", td)
+	}
+	if len(td) > 255 {
+		return fmt.Errorf("trust domain %q is longer than 255 characters", td)
+	}
+	for _, c := range td {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		case c >= 'A' && c <= 'Z':
+			return fmt.Errorf("trust domain %q must be lowercase", td)
+		default:
+			return fmt.Errorf("trust domain %q contains invalid character %q", td, c)
+		}
+	}
+	return nil
+}
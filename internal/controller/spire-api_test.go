@@ -0,0 +1,1670 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spirev1alpha1 "github.com/shanmugara/spire-registrar/api/v1alpha1"
+)
+
+// testKubeConfig is the admin kubeconfig served by newTestReconciler.
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test-cluster
+  cluster:
+    server: https://api.test-cluster.example.com:6443
+`
+
+// newTestReconciler returns a reconciler backed by a fake client seeded with the
+// cluster info ConfigMap and kubeconfig Secret, talking to the SPIRE API at serverURL.
+func newTestReconciler(serverURL string, objs ...client.Object) *ServiceAccountReconciler {
+	clusterInfo := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ClusterInfoCm,
+			Namespace:   ClusterInfoCmNamespace,
+			Annotations: map[string]string{SpireTrustDomainAnnotation: "example.org"},
+		},
+		Data: map[string]string{"ClusterConfiguration": "clusterName: test-cluster\n"},
+	}
+	kubeConfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: AdminKubeConfigSecret, Namespace: "kube-system"},
+		Data:       map[string][]byte{"kubeconfig": []byte(testKubeConfig)},
+	}
+	objs = append(objs, clusterInfo, kubeConfig)
+
+	return &ServiceAccountReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).
+			WithStatusSubresource(&spirev1alpha1.SpireRegistration{}).Build(),
+		Scheme:      scheme.Scheme,
+		SpireClient: NewSpireClient(SpireAPI{Server: serverURL}),
+	}
+}
+
+// newManagedServiceAccount returns a ServiceAccount carrying the managed annotation.
+func newManagedServiceAccount(name, namespace string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{ManagedSpireAnnotation: "true"},
+		},
+	}
+}
+
+var _ = Describe("SPIRE API", func() {
+	Context("When creating an entry that already exists", func() {
+		It("should return the existing entry ID from a conflict response", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Expect(req.URL.Path).To(Equal("/v1/entries/add"))
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"entryID":"existing-entry","message":"entry already exists"}`))
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			id, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).NotTo(BeNil())
+			Expect(string(*id)).To(Equal("existing-entry"))
+		})
+
+		It("should fail when the conflict response carries no entry ID", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"message":"entry already exists"}`))
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			id, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(HaveOccurred())
+			Expect(id).To(BeNil())
+		})
+	})
+
+	Context("When deleting the entry of a deleted ServiceAccount", func() {
+		newDeletedServiceAccount := func() *corev1.ServiceAccount {
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			sa.Finalizers = []string{SpireFinalizer}
+			sa.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			return sa
+		}
+
+		It("should release the finalizer when SPIRE no longer has the entry", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"message":"entry entry-1 not found"}`))
+			}))
+			defer server.Close()
+
+			sa := newDeletedServiceAccount()
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(r.Get(context.Background(), req.NamespacedName, &corev1.ServiceAccount{}))).To(BeTrue(),
+				"the finalizer should be removed")
+			Expect(recorder.Events).To(Receive(And(
+				ContainSubstring(corev1.EventTypeNormal),
+				ContainSubstring(EntryAlreadyDeletedReason),
+			)))
+		})
+
+		It("should keep the finalizer when the delete path is unknown to the SPIRE API", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				http.NotFound(w, req)
+			}))
+			defer server.Close()
+
+			sa := newDeletedServiceAccount()
+			r := newTestReconciler(server.URL, sa)
+
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).To(MatchError(ContainSubstring("without identifying a missing entry")))
+			Expect(errors.Is(err, ErrEntryNotFound)).To(BeFalse())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+		})
+
+		It("should keep the finalizer when the SPIRE server fails", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			sa := newDeletedServiceAccount()
+			r := newTestReconciler(server.URL, sa)
+
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).To(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+		})
+	})
+
+	Context("When the SPIRE server rejects a request", func() {
+		It("should include the server message in the error and the Warning event", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"message":"invalid selector"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).To(MatchError(ContainSubstring("400 Bad Request: invalid selector")))
+
+			_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).To(MatchError(ContainSubstring("invalid selector")))
+			Expect(recorder.Events).To(Receive(And(
+				ContainSubstring(corev1.EventTypeWarning),
+				ContainSubstring(SyncFailedReason),
+				ContainSubstring("invalid selector"),
+			)))
+		})
+
+		It("should surface a non-JSON error body", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte("upstream registrar unavailable\n"))
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			err := r.DeleteEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(err).To(MatchError(ContainSubstring("upstream registrar unavailable")))
+		})
+
+		It("should surface the code and offending fields of a structured error", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"code":3,"message":"invalid entry",` +
+					`"fields":[{"field":"selectors","message":"must not be empty"},"hint"]}}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).To(MatchError(ContainSubstring(
+				"400 Bad Request: code 3: invalid entry (selectors: must not be empty, hint)")))
+			Expect(recorder.Events).To(Receive(And(
+				ContainSubstring(SyncFailedReason),
+				ContainSubstring("selectors: must not be empty"),
+			)))
+		})
+
+		DescribeTable("should read the message of an error body",
+			func(body, message string) {
+				Expect(responseMessage([]byte(body))).To(Equal(message))
+			},
+			Entry("flat", `{"message":"invalid selector"}`, "invalid selector"),
+			Entry("structured with a symbolic code", `{"error":{"code":"INVALID_ARGUMENT","message":"bad hint"}}`,
+				"code INVALID_ARGUMENT: bad hint"),
+			Entry("structured with fields only", `{"error":{"fields":["dnsNames"]}}`, "(dnsNames)"),
+			Entry("with an empty error object", `{"error":{},"message":"invalid selector"}`, "invalid selector"),
+			Entry("with a string error", `{"error":"denied"}`, `{"error":"denied"}`),
+			Entry("not JSON", "upstream registrar unavailable\n", "upstream registrar unavailable"),
+		)
+
+		It("should report the URL and cause when the SPIRE server cannot be dialed", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			server.Close()
+
+			r := newTestReconciler(server.URL)
+			var err error
+			Expect(func() {
+				err = r.DeleteEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			}).NotTo(Panic())
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(err).To(MatchError(ContainSubstring("deleting entry via " + server.URL)))
+			Expect(err).To(MatchError(ContainSubstring("/v1/entries/delete")))
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			var opErr *net.OpError
+			Expect(errors.As(err, &opErr)).To(BeTrue(), "the dial error is wrapped")
+		})
+	})
+
+	Context("When sending an entry for a ServiceAccount", func() {
+		It("should include the ServiceAccount UID and resourceVersion", func() {
+			var entries []SpireEntry
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				entries = append(entries, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.UID = "5b8f7a8e-0d6c-4c6b-9a53-3a4bd1e0c7a1"
+			sa.ResourceVersion = "42"
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].ServiceAccountUID).To(Equal(string(sa.UID)))
+			Expect(entries[0].ResourceVersion).To(Equal("42"))
+			Expect(entries[1].ServiceAccountUID).To(Equal(string(sa.UID)))
+		})
+
+		It("should send the same idempotency key on every retry of a creation", func() {
+			var keys []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				keys = append(keys, req.Header.Get("Idempotency-Key"))
+				if len(keys) < 3 {
+					// The entry may or may not have been created.
+					w.WriteHeader(http.StatusGatewayTimeout)
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.UID = "5b8f7a8e-0d6c-4c6b-9a53-3a4bd1e0c7a1"
+			r := newTestReconciler(server.URL)
+			r.SpireClient.IdempotencyHeader = "Idempotency-Key"
+			for _, version := range []string{"1", "2"} {
+				sa.ResourceVersion = version
+				_, err := r.CreateEntry(context.Background(), sa)
+				Expect(err).To(MatchError(ErrSpireUnavailable))
+			}
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(3))
+			Expect(keys[0]).NotTo(BeEmpty())
+			Expect(keys).To(HaveEach(keys[0]), "a write of the ServiceAccount does not change the key")
+
+			recreated := sa.DeepCopy()
+			recreated.UID = "0c1e6f4a-7d2b-4f0e-8b1a-2e9d5c3b4a60"
+			_, err = r.CreateEntry(context.Background(), recreated)
+			Expect(err).NotTo(HaveOccurred())
+			sa.Annotations[HintAnnotation] = "frontend"
+			_, err = r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys[3]).NotTo(Equal(keys[0]), "a recreated ServiceAccount gets a new key")
+			Expect(keys[4]).NotTo(Equal(keys[0]), "a changed entry gets a new key")
+
+			r.SpireClient.IdempotencyHeader = ""
+			_, err = r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys[5]).To(BeEmpty(), "the header can be disabled")
+		})
+
+		It("should set the admin and downstream flags from the annotations", func() {
+			var bodies []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var body map[string]interface{}
+				Expect(json.NewDecoder(req.Body).Decode(&body)).To(Succeed())
+				bodies = append(bodies, body)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+			r := newTestReconciler(server.URL)
+
+			plain := newManagedServiceAccount("plain", "default")
+			_, err := r.CreateEntry(context.Background(), plain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bodies[0]).NotTo(HaveKey("admin"))
+			Expect(bodies[0]).NotTo(HaveKey("downstream"))
+
+			privileged := newManagedServiceAccount("privileged", "default")
+			privileged.Annotations[AdminAnnotation] = "true"
+			privileged.Annotations[DownstreamAnnotation] = "true"
+			_, err = r.CreateEntry(context.Background(), privileged)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bodies[1]).To(HaveKeyWithValue("admin", true))
+			Expect(bodies[1]).To(HaveKeyWithValue("downstream", true))
+
+			invalid := newManagedServiceAccount("invalid", "default")
+			invalid.Annotations[AdminAnnotation] = "yes please"
+			_, err = r.CreateEntry(context.Background(), invalid)
+			Expect(err).To(MatchError(ContainSubstring(AdminAnnotation)))
+			Expect(bodies).To(HaveLen(2))
+		})
+	})
+
+	Context("When selectors are annotated on the ServiceAccount", func() {
+		It("should send the parsed selectors in the create payload", func() {
+			var sent []SpireEntry
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				sent = append(sent, se)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SelectorsAnnotation] = "unix:uid:1000, k8s:pod-label:app:web\nunix:uid:1000\n"
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("plain", "default"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sent).To(HaveLen(2))
+			Expect(sent[0].Selectors).To(Equal([]string{"unix:uid:1000", "k8s:pod-label:app:web"}))
+			Expect(sent[1].Selectors).To(BeEmpty())
+		})
+
+		DescribeTable("should reject malformed selectors",
+			func(value string) {
+				sa := newManagedServiceAccount("app", "default")
+				sa.Annotations[SelectorsAnnotation] = value
+				_, err := entrySelectors(sa)
+				Expect(err).To(MatchError(ContainSubstring(SelectorsAnnotation)))
+			},
+			Entry("missing type separator", "uid1000"),
+			Entry("empty type", ":uid:1000"),
+			Entry("invalid type", "un ix:uid:1000"),
+			Entry("empty value", "unix:"),
+			Entry("whitespace in value", "k8s:pod-label:app: web"),
+			Entry("one bad selector among good ones", "unix:uid:1000,bad"),
+		)
+
+		It("should annotate the selectors the SPIRE server applied", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/entries/add":
+					_, _ = w.Write([]byte(`{"entryID":"entry-1",` +
+						`"selectors":["k8s:ns:default","k8s:sa:app","unix:uid:1000"]}`))
+				case "/v1/entries/update":
+					// An update response without selectors leaves the requested ones.
+					_, _ = w.Write([]byte(`{"message":"updated"}`))
+				}
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SelectorsAnnotation] = "unix:uid:1000"
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(AppliedSelectorsAnnotation, "k8s:ns:default,k8s:sa:app,unix:uid:1000"))
+
+			sa.Annotations[SelectorsAnnotation] = "unix:uid:1001"
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(AppliedSelectorsAnnotation, "unix:uid:1001"))
+		})
+	})
+
+	Context("When counting registrations", func() {
+		It("should label them with the trust domain and cluster of the entry", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			created := registrations.WithLabelValues("create", "success", "tenant.example.org", "test-cluster")
+			deleted := registrations.WithLabelValues("delete", "success", "tenant.example.org", "test-cluster")
+			failed := registrations.WithLabelValues("create", "failure", unknownLabel, unknownLabel)
+			before := []float64{testutil.ToFloat64(created), testutil.ToFloat64(deleted), testutil.ToFloat64(failed)}
+
+			r := newTestReconciler(server.URL)
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SpireTrustDomainAnnotation] = "tenant.example.org"
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+
+			invalid := newManagedServiceAccount("invalid", "default")
+			invalid.Annotations[SpireTrustDomainAnnotation] = "spiffe://tenant.example.org"
+			_, err = r.CreateEntry(context.Background(), invalid)
+			Expect(err).To(HaveOccurred())
+
+			Expect(testutil.ToFloat64(created)).To(Equal(before[0] + 1))
+			Expect(testutil.ToFloat64(deleted)).To(Equal(before[1] + 1))
+			Expect(testutil.ToFloat64(failed)).To(Equal(before[2]+1), "an unresolved entry is counted as unknown")
+		})
+
+		It("should record the time of the last successful sync", func() {
+			fail := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if fail {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			Expect(testutil.ToFloat64(lastSuccessfulSync)).To(BeNumerically(">", 0), "the gauge is set at startup")
+			lastSuccessfulSync.Set(0)
+			r := newTestReconciler(server.URL)
+			start := float64(time.Now().Unix())
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			synced := testutil.ToFloat64(lastSuccessfulSync)
+			Expect(synced).To(BeNumerically(">=", start))
+
+			lastSuccessfulSync.Set(1)
+			fail = true
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("other", "default"))
+			Expect(err).To(HaveOccurred())
+			Expect(testutil.ToFloat64(lastSuccessfulSync)).To(Equal(float64(1)), "a failure is not a sync")
+		})
+	})
+
+	Context("When a hint is annotated on the ServiceAccount", func() {
+		It("should send the hint in the create payload only when set", func() {
+			var bodies []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var body map[string]interface{}
+				Expect(json.NewDecoder(req.Body).Decode(&body)).To(Succeed())
+				bodies = append(bodies, body)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[HintAnnotation] = " internal-api "
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("plain", "default"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(bodies).To(HaveLen(2))
+			Expect(bodies[0]).To(HaveKeyWithValue("hint", "internal-api"))
+			Expect(bodies[1]).NotTo(HaveKey("hint"))
+		})
+
+		DescribeTable("should reject invalid hints",
+			func(value string) {
+				sa := newManagedServiceAccount("app", "default")
+				sa.Annotations[HintAnnotation] = value
+				_, err := entryHint(sa)
+				Expect(err).To(MatchError(ContainSubstring(HintAnnotation)))
+			},
+			Entry("whitespace", "internal api"),
+			Entry("quotes", `"api"`),
+			Entry("too long", strings.Repeat("a", MaxHintLength+1)),
+		)
+	})
+
+	Context("When hashing entries", func() {
+		It("should not depend on the order of list fields or the resourceVersion", func() {
+			se := SpireEntry{
+				TrustDomain:    "example.org",
+				ServiceAccount: "app",
+				Namespace:      "default",
+				DnsNames:       []string{"b.example.org", "a.example.org"},
+				FederatesWith:  []string{"spiffe://b.org", "spiffe://a.org"},
+				Selectors:      []string{"k8s:ns:default", "k8s:sa:app"},
+			}
+			reordered := se
+			reordered.DnsNames = []string{"a.example.org", "b.example.org"}
+			reordered.FederatesWith = []string{"spiffe://a.org", "spiffe://b.org"}
+			reordered.Selectors = []string{"k8s:sa:app", "k8s:ns:default"}
+			reordered.ResourceVersion = "42"
+
+			Expect(hashEntry(reordered)).To(Equal(hashEntry(se)))
+			Expect(se.DnsNames).To(Equal([]string{"b.example.org", "a.example.org"}), "input must not be modified")
+
+			changed := se
+			changed.X509SvidTtl = 600
+			Expect(hashEntry(changed)).NotTo(Equal(hashEntry(se)))
+		})
+
+		It("should update the entry only when the rendered entry changes", func() {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.Path)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(context.Background(), req)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(paths).To(Equal([]string{"/v1/entries/add"}))
+
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			sa.Annotations[X509SvidTTLAnnotation] = "600"
+			Expect(r.Update(context.Background(), sa)).To(Succeed())
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(context.Background(), req)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(paths).To(Equal([]string{"/v1/entries/add", "/v1/entries", "/v1/entries/update"}), "the owner of the entry is verified before updating it")
+		})
+
+		It("should register the entry again when SPIRE no longer has it", func() {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.Path)
+				if req.URL.Path == "/v1/entries/update" {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"message":"entry entry-1 not found"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-2"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			sa.Annotations[EntryHashAnnotation] = "stale"
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(paths).To(Equal([]string{"/v1/entries", "/v1/entries/update", "/v1/entries/add"}))
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-2"))
+		})
+
+		It("should register a recreated ServiceAccount carrying the entry ID of its predecessor", func() {
+			var paths []string
+			var removed SpireEntry
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				paths = append(paths, req.URL.Path)
+				switch req.URL.Path {
+				case "/v1/entries":
+					_, _ = w.Write([]byte(`{"entries":[{"entryID":"entry-1","namespace":"default","serviceAccount":"app","serviceAccountUID":"uid-old"}]}`))
+				case "/v1/entries/delete":
+					Expect(json.NewDecoder(req.Body).Decode(&removed)).To(Succeed())
+				default:
+					_, _ = w.Write([]byte(`{"entryID":"entry-2"}`))
+				}
+			}))
+			defer server.Close()
+
+			// The ServiceAccount was deleted and reapplied with the annotations of the
+			// original, but has a new UID.
+			sa := newManagedServiceAccount("app", "default")
+			sa.UID = "uid-new"
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			sa.Annotations[EntryHashAnnotation] = "stale"
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(paths).To(Equal([]string{"/v1/entries", "/v1/entries/delete", "/v1/entries/add"}))
+			Expect(removed.ServiceAccountUID).To(Equal("uid-old"), "only the entry of the previous ServiceAccount is removed")
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-2"))
+		})
+
+		It("should update the entry of a ServiceAccount it was registered for", func() {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.Path)
+				if req.URL.Path == "/v1/entries" {
+					_, _ = w.Write([]byte(`{"entries":[{"entryID":"entry-1","serviceAccountUID":"uid-1"}]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.UID = "uid-1"
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			sa.Annotations[EntryHashAnnotation] = "stale"
+			r := newTestReconciler(server.URL, sa)
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(Equal([]string{"/v1/entries", "/v1/entries/update"}))
+		})
+
+		It("should backfill the hash of an entry registered before hashes were tracked", func() {
+			var calls atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls.Add(1)
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls.Load()).To(BeZero())
+
+			se, err := r.desiredEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(EntryHashAnnotation, hashEntry(se)))
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		})
+
+		It("should not register again when the SPIRE API has no update route", func() {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.Path)
+				if req.URL.Path == "/v1/entries/update" {
+					http.NotFound(w, req)
+					return
+				}
+				_, _ = w.Write([]byte(`{"entries":[]}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			sa.Annotations[EntryHashAnnotation] = "stale"
+			r := newTestReconciler(server.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).To(MatchError(ErrUpdateUnsupported))
+			Expect(paths).To(Equal([]string{"/v1/entries", "/v1/entries/update"}))
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		})
+
+		DescribeTable("should tell a missing entry from a missing route",
+			func(body string, missing bool) {
+				Expect(entryMissingBody([]byte(body))).To(Equal(missing))
+			},
+			Entry("flat message", `{"message":"entry entry-1 not found"}`, true),
+			Entry("structured NotFound code", `{"error":{"code":5,"message":"no such thing"}}`, true),
+			Entry("structured message", `{"error":{"code":"INVALID","message":"Entry does not exist"}}`, true),
+			Entry("bare body", ``, false),
+			Entry("mux not found page", "404 page not found\n", false),
+			Entry("gateway route message", `{"message":"Not Found"}`, false),
+		)
+	})
+
+	Context("When the SPIRE server is rate limiting", func() {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		It("should parse a delta-seconds Retry-After header", func() {
+			after, ok := parseRetryAfter("30", now)
+			Expect(ok).To(BeTrue())
+			Expect(after).To(Equal(30 * time.Second))
+		})
+
+		It("should parse an HTTP-date Retry-After header", func() {
+			after, ok := parseRetryAfter(now.Add(2*time.Minute).Format(http.TimeFormat), now)
+			Expect(ok).To(BeTrue())
+			Expect(after).To(Equal(2 * time.Minute))
+		})
+
+		It("should ignore a missing or invalid Retry-After header", func() {
+			for _, value := range []string{"", "soon", "-5", now.Add(-time.Minute).Format(http.TimeFormat)} {
+				_, ok := parseRetryAfter(value, now)
+				Expect(ok).To(BeFalse(), "value %q", value)
+			}
+		})
+
+		It("should requeue after the Retry-After duration without an error", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Retry-After", "42")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"message":"slow down"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(42 * time.Second))
+
+			r.RequeueJitterFraction = 0.2
+			seen := map[time.Duration]bool{}
+			for i := 0; i < 5; i++ {
+				result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeNumerically("~", 42*time.Second, 8400*time.Millisecond))
+				seen[result.RequeueAfter] = true
+			}
+			Expect(len(seen)).To(BeNumerically(">", 1), "requeues should be spread out")
+		})
+
+		It("should keep jittered delays within the fraction and positive", func() {
+			for i := 0; i < 1000; i++ {
+				Expect(jitter(10*time.Second, 0.2)).To(BeNumerically("~", 10*time.Second, 2*time.Second))
+				Expect(jitter(time.Nanosecond, 0.99)).To(BeNumerically(">", 0))
+			}
+			Expect(jitter(10*time.Second, 0)).To(Equal(10 * time.Second))
+			Expect(jitter(0, 0.2)).To(BeZero())
+		})
+
+		It("should fall back to the default requeue when Retry-After is missing", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"message":"slow down"}`))
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			_, ok := retryAfter(err)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("When reconciles keep failing", func() {
+		It("should back off exponentially up to the cap and reset on success", func() {
+			var failing atomic.Bool
+			failing.Store(true)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("failing", "default")
+			r := newTestReconciler(server.URL, sa)
+			r.MaxRequeueInterval = 8 * time.Second
+			now := time.Now()
+			r.backoff.now = func() time.Time { return now }
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+			for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+				result, err := r.Reconcile(context.Background(), req)
+				Expect(err).NotTo(HaveOccurred(), "the error would make controller-runtime ignore RequeueAfter")
+				Expect(result.RequeueAfter).To(Equal(want))
+				now = now.Add(result.RequeueAfter)
+			}
+
+			// A ServiceAccount that has not failed for a while starts over.
+			now = now.Add(time.Minute)
+			result, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Second))
+			result, _ = r.Reconcile(context.Background(), req)
+			Expect(result.RequeueAfter).To(Equal(2 * time.Second))
+
+			failing.Store(false)
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.backoff.failures).NotTo(HaveKey(req.NamespacedName))
+		})
+
+		It("should return the error when the back-off is disabled", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("failing", "default")
+			r := newTestReconciler(server.URL, sa)
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When normalizing the SPIRE server URL", func() {
+		DescribeTable("SpireAPI.Normalize",
+			func(api SpireAPI, want string) {
+				Expect(api.Normalize()).To(Succeed())
+				Expect(api.GetServerURL()).To(Equal(want))
+			},
+			Entry("plain URL", SpireAPI{Server: "http://spire.example.com"}, "http://spire.example.com"),
+			Entry("trailing slash", SpireAPI{Server: "http://spire.example.com/"}, "http://spire.example.com"),
+			Entry("separate port", SpireAPI{Server: "https://spire.example.com/", Port: 8443}, "https://spire.example.com:8443"),
+			Entry("port in URL", SpireAPI{Server: "http://spire.example.com:8080"}, "http://spire.example.com:8080"),
+			Entry("path prefix", SpireAPI{Server: "http://gateway.example.com/spire//"}, "http://gateway.example.com/spire"),
+		)
+
+		DescribeTable("rejects invalid servers",
+			func(api SpireAPI) {
+				Expect(api.Normalize()).NotTo(Succeed())
+			},
+			Entry("empty", SpireAPI{}),
+			Entry("missing scheme", SpireAPI{Server: "spire.example.com:8080"}),
+			Entry("unsupported scheme", SpireAPI{Server: "ftp://spire.example.com"}),
+			Entry("missing host", SpireAPI{Server: "http://"}),
+			Entry("port set twice", SpireAPI{Server: "http://spire.example.com:8080", Port: 8080}),
+			Entry("query", SpireAPI{Server: "http://spire.example.com?x=1"}),
+		)
+
+		DescribeTable("validates the port range",
+			func(api SpireAPI, valid bool) {
+				if valid {
+					Expect(api.Normalize()).To(Succeed())
+				} else {
+					Expect(api.Normalize()).To(MatchError(ContainSubstring("must be between 1 and 65535")))
+				}
+			},
+			Entry("lowest port", SpireAPI{Server: "http://spire.example.com", Port: 1}, true),
+			Entry("highest port", SpireAPI{Server: "http://spire.example.com", Port: 65535}, true),
+			Entry("negative port", SpireAPI{Server: "http://spire.example.com", Port: -1}, false),
+			Entry("port above range", SpireAPI{Server: "http://spire.example.com", Port: 65536}, false),
+			Entry("lowest port in URL", SpireAPI{Server: "http://spire.example.com:1"}, true),
+			Entry("highest port in URL", SpireAPI{Server: "http://spire.example.com:65535"}, true),
+			Entry("zero port in URL", SpireAPI{Server: "http://spire.example.com:0"}, false),
+			Entry("port above range in URL", SpireAPI{Server: "http://spire.example.com:65536"}, false),
+		)
+
+		It("should report whether the URL sets a port", func() {
+			Expect((&SpireAPI{Server: "http://spire.example.com:8080"}).HasURLPort()).To(BeTrue())
+			Expect((&SpireAPI{Server: "http://spire.example.com", Port: 8080}).HasURLPort()).To(BeFalse())
+			Expect(ValidatePort(0)).To(HaveOccurred())
+		})
+	})
+
+	Context("When the SPIRE API paths are configured", func() {
+		DescribeTable("joinURLPath",
+			func(elems []string, want string) {
+				Expect(joinURLPath(elems...)).To(Equal(want))
+			},
+			Entry("default paths", []string{"/v1/entries", "add"}, "/v1/entries/add"),
+			Entry("missing leading slash", []string{"v2/entries", "add"}, "/v2/entries/add"),
+			Entry("trailing slashes", []string{"/v2/entries/", "/add/"}, "/v2/entries/add"),
+			Entry("repeated slashes", []string{"//api//", "//batch/add"}, "/api/batch/add"),
+			Entry("empty sub-path", []string{"/v1/entries", ""}, "/v1/entries"),
+			Entry("root base path", []string{"/", "add"}, "/add"),
+			Entry("nothing", []string{"", ""}, "/"),
+		)
+
+		It("should send every entry operation below the base path", func() {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				paths = append(paths, req.URL.Path)
+				switch {
+				case req.Method == http.MethodGet:
+					_, _ = w.Write([]byte(`{"entries":[]}`))
+				case req.URL.Path == "/registrar/v2/entries/create":
+					_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+				}
+			}))
+			defer server.Close()
+
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			c.Paths = &SpireAPIPaths{Base: "registrar/v2/entries/", Add: "/create", Delete: "delete", Update: "update"}
+			Expect(c.Paths.SetOperation("list", "list/")).To(Succeed())
+			Expect(c.Paths.SetOperation("get", "get")).NotTo(Succeed())
+
+			ctx := context.Background()
+			_, err := c.AddEntry(ctx, SpireEntry{Namespace: "default", ServiceAccount: "web"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.UpdateEntry(ctx, "entry-1", SpireEntry{Namespace: "default", ServiceAccount: "web"})).To(Succeed())
+			Expect(c.RemoveEntry(ctx, "entry-1", SpireEntry{Namespace: "default", ServiceAccount: "web"})).To(Succeed())
+			_, err = c.ListEntries(ctx, "test-cluster")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(Equal([]string{
+				"/registrar/v2/entries/create",
+				"/registrar/v2/entries/update",
+				"/registrar/v2/entries/delete",
+				"/registrar/v2/entries/list",
+			}))
+		})
+	})
+
+	Context("When deleting entries", func() {
+		type request struct {
+			method, path, authorization string
+			body                        SpireEntry
+		}
+		var requests []request
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			requests = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				r := request{method: req.Method, path: req.URL.Path, authorization: req.Header.Get("Authorization")}
+				if req.Method == http.MethodPost {
+					Expect(json.NewDecoder(req.Body).Decode(&r.body)).To(Succeed())
+				}
+				requests = append(requests, r)
+			}))
+			DeferCleanup(server.Close)
+		})
+
+		newClient := func(style string) *SpireClient {
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			c.Token = &BearerToken{Value: "s3cret"}
+			c.DeleteStyle = style
+			return c
+		}
+		se := SpireEntry{Namespace: "default", ServiceAccount: "web", Cluster: "test-cluster"}
+
+		It("should POST the entry to the delete path by default", func() {
+			Expect(newClient("").RemoveEntry(context.Background(), "entry-1", se)).To(Succeed())
+			Expect(requests).To(Equal([]request{{
+				method: http.MethodPost, path: "/v1/entries/delete", authorization: "Bearer s3cret", body: se,
+			}}))
+		})
+
+		It("should DELETE the entry ID with the rest style", func() {
+			c := newClient(DeleteStyleREST)
+			Expect(c.RemoveEntry(context.Background(), "entry/1", se)).To(Succeed())
+			Expect(requests).To(Equal([]request{{
+				method: http.MethodDelete, path: "/v1/entries/entry/1", authorization: "Bearer s3cret",
+			}}))
+		})
+
+		It("should fall back to POST with the rest style when the entry ID is unknown", func() {
+			Expect(newClient(DeleteStyleREST).RemoveEntry(context.Background(), "", se)).To(Succeed())
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].method).To(Equal(http.MethodPost))
+			Expect(requests[0].path).To(Equal("/v1/entries/delete"))
+		})
+
+		It("should reject unknown delete styles", func() {
+			_, err := ParseDeleteStyle("patch")
+			Expect(err).To(MatchError(ContainSubstring("must be rest or post")))
+		})
+	})
+
+	Context("When configuring the create method", func() {
+		type request struct {
+			method string
+			path   string
+			body   RegisteredEntry
+		}
+		var requests []request
+		var status int
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			requests, status = nil, http.StatusOK
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				r := request{method: req.Method, path: req.URL.Path}
+				Expect(json.NewDecoder(req.Body).Decode(&r.body)).To(Succeed())
+				requests = append(requests, r)
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			DeferCleanup(server.Close)
+		})
+		se := SpireEntry{Namespace: "default", ServiceAccount: "web", Cluster: "test-cluster"}
+
+		It("should POST creations to the add path and updates to the update path by default", func() {
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			id, err := c.AddEntry(context.Background(), se)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*id).To(Equal(entryID("entry-1")))
+			Expect(c.UpdateEntry(context.Background(), "entry-1", se)).To(Succeed())
+
+			Expect(requests).To(Equal([]request{
+				{method: http.MethodPost, path: "/v1/entries/add", body: RegisteredEntry{SpireEntry: se}},
+				{method: http.MethodPost, path: "/v1/entries/update", body: RegisteredEntry{EntryID: "entry-1", SpireEntry: se}},
+			}))
+		})
+
+		It("should create and update entries with the same PUT when upserting", func() {
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			c.CreateMethod, c.Upsert = http.MethodPut, true
+			paths := DefaultSpireAPIPaths()
+			Expect(paths.SetOperation("add", "")).To(Succeed())
+			c.Paths = &paths
+
+			status = http.StatusCreated
+			id, err := c.AddEntry(context.Background(), se)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*id).To(Equal(entryID("entry-1")))
+			status = http.StatusOK
+			Expect(c.UpdateEntry(context.Background(), "entry-1", se)).To(Succeed())
+			status = http.StatusCreated
+			Expect(c.UpdateEntry(context.Background(), "entry-1", se)).To(Succeed(), "an upsert may recreate the entry")
+
+			Expect(requests).To(HaveLen(3))
+			Expect(requests[0]).To(Equal(request{method: http.MethodPut, path: "/v1/entries", body: RegisteredEntry{SpireEntry: se}}))
+			for _, r := range requests[1:] {
+				Expect(r).To(Equal(request{method: http.MethodPut, path: "/v1/entries", body: RegisteredEntry{EntryID: "entry-1", SpireEntry: se}}))
+			}
+		})
+
+		It("should not take 201 Created for a successful update unless upserting", func() {
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			status = http.StatusCreated
+			Expect(c.UpdateEntry(context.Background(), "entry-1", se)).NotTo(Succeed())
+		})
+
+		It("should parse the create method", func() {
+			Expect(ParseCreateMethod("put")).To(Equal(http.MethodPut))
+			Expect(ParseCreateMethod("POST")).To(Equal(http.MethodPost))
+			_, err := ParseCreateMethod("PATCH")
+			Expect(err).To(MatchError(ContainSubstring("must be POST or PUT")))
+		})
+	})
+
+	Context("When the SPIRE API response is unexpected", func() {
+		It("should enforce the response body limit", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entries":[`))
+				for i := 0; i < 1000; i++ {
+					_, _ = w.Write([]byte(`{"entryID":"entry","namespace":"default","serviceAccount":"web"},`))
+				}
+				_, _ = w.Write([]byte(`{}]}`))
+			}))
+			defer server.Close()
+
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			c.MaxResponseBytes = 4096
+			_, err := c.ListEntries(context.Background(), "test-cluster")
+			Expect(err).To(MatchError(ContainSubstring("exceeds 4096 bytes")))
+
+			c.MaxResponseBytes = 0
+			entries, err := c.ListEntries(context.Background(), "test-cluster")
+			Expect(err).NotTo(HaveOccurred(), "the default limit fits the response")
+			Expect(entries).To(HaveLen(1001))
+		})
+
+		It("should reject unknown fields only when decoding strictly", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entryID":"entry-1","parentID":"spiffe://example.org/web"}`))
+			}))
+			defer server.Close()
+
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			id, err := c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "web"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(*id)).To(Equal("entry-1"))
+
+			c.StrictDecoding = true
+			_, err = c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "web"})
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "parentID"`)))
+			Expect(err).To(MatchError(ContainSubstring(`spiffe://example.org/web`)), "the error should show the body")
+		})
+
+		It("should report an HTML page answered with 200 OK as a retryable error", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = w.Write([]byte("<html><body><h1>Bad Gateway</h1>" + strings.Repeat("x", 2*maxResponseMessage) + "</body></html>"))
+			}))
+			defer server.Close()
+
+			c := NewSpireClient(SpireAPI{Server: server.URL})
+			id, err := c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "web"})
+			Expect(id).To(BeNil())
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(err).To(MatchError(ContainSubstring("create answered 200 OK with a malformed body")))
+			Expect(err).To(MatchError(ContainSubstring("<html><body><h1>Bad Gateway</h1>")))
+			Expect(len(err.Error())).To(BeNumerically("<", maxResponseMessage+300), "the body is truncated")
+
+			_, err = c.ListEntries(context.Background(), "test-cluster")
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(err).To(MatchError(ContainSubstring("list answered 200 OK")))
+		})
+
+		It("should not retry a JSON body that does not decode", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entryID":42}`))
+			}))
+			defer server.Close()
+
+			_, err := NewSpireClient(SpireAPI{Server: server.URL}).AddEntry(context.Background(),
+				SpireEntry{Namespace: "default", ServiceAccount: "web"})
+			Expect(err).To(MatchError(ContainSubstring("create answered 200 OK with an unexpected body")))
+			Expect(errors.Is(err, ErrSpireUnavailable)).To(BeFalse())
+		})
+
+		It("should truncate the body quoted in a decoding error", func() {
+			c := NewSpireClient()
+			body := []byte("<html>" + strings.Repeat("x", 2*maxResponseMessage) + "</html>")
+			err := c.decodeBody(body, &SpireEntryListResponse{})
+			Expect(err).To(HaveOccurred())
+			Expect(len(err.Error())).To(BeNumerically("<", maxResponseMessage+200))
+		})
+	})
+
+	Context("When several SPIRE API servers are configured", func() {
+		It("should fail over to the next server and skip the failed one during its cooldown", func() {
+			var downHits, upHits atomic.Int64
+			down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				downHits.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer down.Close()
+			up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				upHits.Add(1)
+				_, _ = w.Write([]byte(`{"entries":[]}`))
+			}))
+			defer up.Close()
+
+			c := NewSpireClient(SpireAPI{Server: down.URL}, SpireAPI{Server: up.URL})
+			for i := 0; i < 2; i++ {
+				_, err := c.ListEntries(context.Background(), "test-cluster")
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(downHits.Load()).To(BeEquivalentTo(1))
+			Expect(upHits.Load()).To(BeEquivalentTo(2))
+		})
+
+		It("should not retry a creation without an idempotency key on another server", func() {
+			var firstHits, secondHits atomic.Int64
+			first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				firstHits.Add(1)
+				// The entry may have been created before the failure.
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			defer first.Close()
+			second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				secondHits.Add(1)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer second.Close()
+
+			r := newTestReconciler(first.URL)
+			r.SpireClient = NewSpireClient(SpireAPI{Server: first.URL}, SpireAPI{Server: second.URL})
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(HaveOccurred())
+			Expect(firstHits.Load()).To(BeEquivalentTo(1))
+			Expect(secondHits.Load()).To(BeZero())
+		})
+
+		It("should retry a creation with an idempotency key on another server", func() {
+			var keys []string
+			first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				keys = append(keys, req.Header.Get("Idempotency-Key"))
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			defer first.Close()
+			second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				keys = append(keys, req.Header.Get("Idempotency-Key"))
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer second.Close()
+
+			c := NewSpireClient(SpireAPI{Server: first.URL}, SpireAPI{Server: second.URL})
+			c.IdempotencyHeader = "Idempotency-Key"
+			id, err := c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "app", ServiceAccountUID: "app-uid"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(*id)).To(Equal("entry-1"))
+			Expect(keys).To(HaveLen(2))
+			Expect(keys[0]).NotTo(BeEmpty())
+			Expect(keys[1]).To(Equal(keys[0]), "the second server can deduplicate the creation")
+		})
+
+		It("should fail over from a server that does not answer in time", func() {
+			release := make(chan struct{})
+			hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				<-release
+			}))
+			defer hung.Close()
+			defer close(release)
+			up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`{"entries":[]}`))
+			}))
+			defer up.Close()
+
+			c := NewSpireClient(SpireAPI{Server: hung.URL}, SpireAPI{Server: up.URL})
+			var err error
+			c.HTTPClient, err = NewSpireHTTPClient("", nil, 100*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = c.ListEntries(context.Background(), "test-cluster")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.HTTPClient.Timeout).To(Equal(100 * time.Millisecond))
+
+			_, err = NewSpireHTTPClient("", nil, -time.Second)
+			Expect(err).To(HaveOccurred())
+			defaulted, err := NewSpireHTTPClient("", nil, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(defaulted.Timeout).To(Equal(DefaultSpireRequestTimeout))
+		})
+
+		It("should delete an entry on the server recorded at creation", func() {
+			var primaryDeletes, secondaryDeletes atomic.Int64
+			var primaryUp atomic.Bool
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if !primaryUp.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				if req.URL.Path == "/v1/entries/delete" {
+					primaryDeletes.Add(1)
+				}
+			}))
+			defer primary.Close()
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/entries/add":
+					_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+				case "/v1/entries/delete":
+					secondaryDeletes.Add(1)
+				}
+			}))
+			defer secondary.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(primary.URL, sa)
+			r.SpireClient = NewSpireClient(SpireAPI{Server: primary.URL}, SpireAPI{Server: secondary.URL})
+			// The primary is cooling down, so the entry is created on the secondary.
+			r.SpireClient.Pool.MarkFailed(SpireAPI{Server: primary.URL})
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SpireServerAnnotation, secondary.URL))
+
+			// The primary is back and preferred by the pool again.
+			primaryUp.Store(true)
+			r.SpireClient.Pool.MarkHealthy(SpireAPI{Server: primary.URL})
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			Expect(secondaryDeletes.Load()).To(BeEquivalentTo(1))
+			Expect(primaryDeletes.Load()).To(BeZero())
+
+			// Without the annotation, or with a server that is not configured, the pool is used.
+			delete(sa.Annotations, SpireServerAnnotation)
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			sa.Annotations[SpireServerAnnotation] = "http://attacker.example.org"
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			Expect(primaryDeletes.Load()).To(BeEquivalentTo(2))
+			Expect(secondaryDeletes.Load()).To(BeEquivalentTo(1))
+		})
+
+		It("should retry a cooling down server when no other server is available", func() {
+			pool := NewSpireAPIPool(SpireAPI{Server: "http://a"}, SpireAPI{Server: "http://b"})
+			pool.MarkFailed(SpireAPI{Server: "http://a"})
+			Expect(pool.Endpoints()).To(Equal([]SpireAPI{{Server: "http://b"}, {Server: "http://a"}}))
+
+			pool.MarkHealthy(SpireAPI{Server: "http://a"})
+			Expect(pool.Endpoints()).To(Equal([]SpireAPI{{Server: "http://a"}, {Server: "http://b"}}))
+		})
+	})
+
+	Context("When a proxy is configured", func() {
+		It("should route SPIRE API requests through the proxy except for no-proxy hosts", func() {
+			c, err := NewSpireHTTPClient("http://proxy.example.org:3128", []string{".internal.example.org"}, 0)
+			Expect(err).NotTo(HaveOccurred())
+			proxy := c.Transport.(*http.Transport).Proxy
+
+			req, _ := http.NewRequest(http.MethodGet, "https://spire.example.org/v1/entries", nil)
+			proxyURL, err := proxy(req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proxyURL).NotTo(BeNil())
+			Expect(proxyURL.Host).To(Equal("proxy.example.org:3128"))
+
+			req, _ = http.NewRequest(http.MethodGet, "http://spire.internal.example.org/v1/entries", nil)
+			proxyURL, err = proxy(req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proxyURL).To(BeNil())
+		})
+	})
+
+	Context("When custom headers are configured", func() {
+		It("should send them on every request and redact sensitive values", func() {
+			var received http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				received = req.Header.Clone()
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			r.SpireClient.Headers = map[string]string{"X-Tenant-Id": "omega", "X-Api-Key": "s3cr3t"}
+			r.SpireClient.SensitiveHeaders = map[string]bool{"X-Api-Key": true}
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(received.Get("X-Tenant-Id")).To(Equal("omega"))
+			Expect(received.Get("X-Api-Key")).To(Equal("s3cr3t"))
+			Expect(r.SpireClient.LoggableHeaders()).To(Equal(map[string]string{"X-Tenant-Id": "omega", "X-Api-Key": "[redacted]"}))
+		})
+	})
+
+	Context("When media types are configured", func() {
+		var received []http.Header
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			received = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				h := req.Header.Clone()
+				h.Set("X-Method", req.Method)
+				received = append(received, h)
+				if req.Method == http.MethodGet {
+					_, _ = w.Write([]byte(`{"entries":[]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should send JSON by default", func() {
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(received).To(HaveLen(1))
+			Expect(received[0].Get("Content-Type")).To(Equal("application/json"))
+			Expect(received[0].Get("Accept")).To(Equal("application/json"))
+		})
+
+		It("should send the configured media types on every request", func() {
+			r := newTestReconciler(server.URL)
+			r.SpireClient.ContentType = "application/vnd.spire.v1+json"
+			r.SpireClient.Accept = "application/vnd.spire.v1+json, application/json;q=0.5"
+			r.SpireClient.DeleteStyle = DeleteStyleREST
+			sa := newManagedServiceAccount("app", "default")
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.SpireClient.ListEntries(context.Background(), "test-cluster")
+			Expect(err).NotTo(HaveOccurred())
+			sa.Annotations[SVIDEntryIDAnnotation] = "entry-1"
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+
+			Expect(received).To(HaveLen(3))
+			for _, h := range received {
+				Expect(h.Get("Accept")).To(Equal("application/vnd.spire.v1+json, application/json;q=0.5"))
+			}
+			Expect(received[0].Get("Content-Type")).To(Equal("application/vnd.spire.v1+json"))
+			Expect(received[1].Get("X-Method")).To(Equal(http.MethodGet))
+			Expect(received[1].Get("Content-Type")).To(BeEmpty(), "bodiless requests have no content type")
+			Expect(received[2].Get("X-Method")).To(Equal(http.MethodDelete))
+			Expect(received[2].Get("Content-Type")).To(BeEmpty())
+		})
+	})
+
+	Context("When the SPIRE API requires a bearer token", func() {
+		It("should send the token from the file and pick up a rotated token", func() {
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				authorization = req.Header.Get("Authorization")
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+			Expect(os.WriteFile(tokenFile, []byte("first\n"), 0o600)).To(Succeed())
+
+			r := newTestReconciler(server.URL)
+			r.SpireClient.Token = &BearerToken{File: tokenFile}
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authorization).To(Equal("Bearer first"))
+
+			Expect(os.WriteFile(tokenFile, []byte("second\n"), 0o600)).To(Succeed())
+			later := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(tokenFile, later, later)).To(Succeed())
+			_, err = r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authorization).To(Equal("Bearer second"))
+		})
+
+		It("should not call the SPIRE API when the token cannot be loaded", func() {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+			}))
+			defer server.Close()
+
+			r := newTestReconciler(server.URL)
+			r.SpireClient.Token = &BearerToken{File: filepath.Join(GinkgoT().TempDir(), "missing")}
+			_, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).To(HaveOccurred())
+			Expect(calls).To(BeZero())
+		})
+	})
+
+	Context("When validating trust domains", func() {
+		DescribeTable("validateTrustDomain",
+			func(td string, valid bool) {
+				err := validateTrustDomain(td)
+				if valid {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(HaveOccurred())
+				}
+			},
+			Entry("simple domain", "example.org", true),
+			Entry("with dashes and underscores", "prod-cluster_01.example.org", true),
+			Entry("single label", "omegaworld", true),
+			Entry("empty", "", false),
+			Entry("with spiffe scheme", "spiffe://example.org", false),
+			Entry("with https scheme", "https://example.org", false),
+			Entry("with path", "example.org/ns/default", false),
+			Entry("with port", "example.org:8443", false),
+			Entry("uppercase", "Example.org", false),
+			Entry("with whitespace", "example .org", false),
+		)
+
+		It("should prefer a valid trust domain annotation on the ServiceAccount", func() {
+			sa := newManagedServiceAccount("app", "default")
+			td, err := entryTrustDomain(sa, "example.org")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(td).To(Equal("example.org"))
+
+			sa.Annotations[SpireTrustDomainAnnotation] = "tenant.example.org"
+			td, err = entryTrustDomain(sa, "example.org")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(td).To(Equal("tenant.example.org"))
+
+			sa.Annotations[SpireTrustDomainAnnotation] = "spiffe://tenant.example.org"
+			_, err = entryTrustDomain(sa, "example.org")
+			Expect(err).To(MatchError(ContainSubstring("must not include a scheme")))
+		})
+
+		It("should use the ServiceAccount trust domain for creation and deletion", func() {
+			var trustDomains []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				trustDomains = append(trustDomains, se.TrustDomain)
+				_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			sa.Annotations[SpireTrustDomainAnnotation] = "tenant.example.org"
+			r := newTestReconciler(server.URL)
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			Expect(trustDomains).To(Equal([]string{"tenant.example.org", "tenant.example.org"}))
+		})
+
+		It("should move the entry to the new trust domain when the cluster info changes", func() {
+			type call struct{ path, trustDomain string }
+			var calls []call
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				if req.Method == http.MethodGet {
+					_, _ = w.Write([]byte(`{"entries":[]}`))
+					return
+				}
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				calls = append(calls, call{req.URL.Path, se.TrustDomain})
+				_, _ = fmt.Fprintf(w, `{"entryID":"entry-%d"}`, len(calls))
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(server.URL, sa)
+			recorder := record.NewFakeRecorder(10)
+			r.Recorder = recorder
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(EntryTrustDomainAnnotation, "example.org"))
+
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, cm)).To(Succeed())
+			cm.Annotations[SpireTrustDomainAnnotation] = "new.example.org"
+			Expect(r.Update(context.Background(), cm)).To(Succeed())
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(calls).To(Equal([]call{
+				{"/v1/entries/add", "example.org"},
+				{"/v1/entries/delete", "example.org"},
+				{"/v1/entries/add", "new.example.org"},
+			}))
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-3"))
+			Expect(sa.Annotations).To(HaveKeyWithValue(EntryTrustDomainAnnotation, "new.example.org"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(TrustDomainChangedReason)))
+
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(HaveLen(3), "the moved entry is up to date")
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			Expect(calls[3]).To(Equal(call{"/v1/entries/delete", "new.example.org"}))
+		})
+
+		It("should reject an invalid trust domain annotation in the cluster info", func() {
+			r := newTestReconciler("http://127.0.0.1:0")
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(context.Background(), client.ObjectKey{Namespace: ClusterInfoCmNamespace, Name: ClusterInfoCm}, cm)).To(Succeed())
+			cm.Annotations[SpireTrustDomainAnnotation] = "spiffe://example.org"
+			Expect(r.Update(context.Background(), cm)).To(Succeed())
+
+			_, err := r.GetClusterInfo(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("must not include a scheme")))
+		})
+	})
+
+	Context("When resolving the cluster name", func() {
+		clusterInfoWith := func(data map[string]string) client.Reader {
+			return fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        ClusterInfoCm,
+					Namespace:   ClusterInfoCmNamespace,
+					Annotations: map[string]string{SpireTrustDomainAnnotation: "example.org"},
+				},
+				Data: data,
+			}).Build()
+		}
+
+		DescribeTable("readClusterInfo",
+			func(data map[string]string, names ClusterNameLookup, want string) {
+				info, err := readClusterInfo(context.Background(), clusterInfoWith(data), names)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info).To(HaveKeyWithValue("clusterName", want))
+			},
+			Entry("kubeadm v1beta3 ClusterConfiguration",
+				map[string]string{"ClusterConfiguration": "apiVersion: kubeadm.k8s.io/v1beta3\n" +
+					"kind: ClusterConfiguration\nclusterName: prod-east\nkubernetesVersion: v1.29.2\n" +
+					"networking:\n  podSubnet: 10.244.0.0/16\n"},
+				ClusterNameLookup{Default: "fallback"}, "prod-east"),
+			Entry("top-level clusterName over the configured keys",
+				map[string]string{"ClusterConfiguration": "clusterName: prod-east\nmetadata:\n  name: other\n"},
+				ClusterNameLookup{Keys: []string{"metadata.name"}}, "prod-east"),
+			Entry("nested path",
+				map[string]string{"ClusterConfiguration": "apiVersion: kubeadm.k8s.io/v1beta4\n" +
+					"kind: ClusterConfiguration\nmetadata:\n  labels:\n    cluster: prod-west\n"},
+				ClusterNameLookup{Keys: []string{"metadata.name", "metadata.labels.cluster"}}, "prod-west"),
+			Entry("separate ConfigMap key",
+				map[string]string{"ClusterConfiguration": "kind: ClusterConfiguration\n", "cluster-name": "edge-01\n"},
+				ClusterNameLookup{Keys: []string{"cluster-name"}}, "edge-01"),
+			Entry("flag default without ClusterConfiguration",
+				map[string]string{"ClusterStatus": "kind: ClusterStatus\n"},
+				ClusterNameLookup{Default: "fallback"}, "fallback"),
+			Entry("override over the ClusterConfiguration",
+				map[string]string{"ClusterConfiguration": "clusterName: prod-east\n"},
+				ClusterNameLookup{Default: "fallback", Override: "east"}, "east"),
+		)
+
+		It("should name the keys it tried when none resolve", func() {
+			_, err := readClusterInfo(context.Background(),
+				clusterInfoWith(map[string]string{"ClusterConfiguration": "clusterName: \"\"\n"}),
+				ClusterNameLookup{Keys: []string{"metadata.name"}})
+			Expect(err).To(MatchError(ContainSubstring("tried clusterName, metadata.name")))
+		})
+
+		It("should prefer the annotation, then the override, then the ConfigMap for the entry cluster", func() {
+			var deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				var se SpireEntry
+				Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+				deleted = append(deleted, se.Cluster)
+			}))
+			defer server.Close()
+
+			sa := newManagedServiceAccount("web", "default")
+			r := newTestReconciler(server.URL, sa)
+			clusterOf := func() string {
+				se, err := r.desiredEntry(context.Background(), sa)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+				Expect(deleted[len(deleted)-1]).To(Equal(se.Cluster), "deletion should match the registered entry")
+				return se.Cluster
+			}
+
+			Expect(clusterOf()).To(Equal("test-cluster"))
+			r.ClusterName.Override = "alias"
+			Expect(clusterOf()).To(Equal("alias"))
+			sa.Annotations[ClusterNameAnnotation] = "team-alias"
+			Expect(clusterOf()).To(Equal("team-alias"))
+
+			sa.Annotations[ClusterNameAnnotation] = "team alias"
+			_, err := r.desiredEntry(context.Background(), sa)
+			Expect(err).To(MatchError(ContainSubstring(ClusterNameAnnotation)))
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// BearerToken supplies the token sent as "Authorization: Bearer" on every SPIRE API
+// request. A token read from File is reloaded whenever the file changes, so rotated
+// tokens, e.g. from a mounted Secret, are picked up without a restart.
+type BearerToken struct {
+	// Value is a static token, used when File is empty.
+	Value string
+	// File is the path of a file holding the token.
+	File string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Get returns the current token, re-reading File if it changed since the last call.
+func (t *BearerToken) Get() (string, error) {
+	if t.File == "" {
+		return t.Value, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.File)
+	if err != nil {
+		return "", fmt.Errorf("reading SPIRE API token file %s: %w", t.File, err)
+	}
+	if t.token != "" && info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return t.token, nil
+	}
+
+	data, err := os.ReadFile(t.File)
+	if err != nil {
+		return "", fmt.Errorf("reading SPIRE API token file %s: %w", t.File, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("SPIRE API token file %s is empty", t.File)
+	}
+	t.token, t.modTime, t.size = token, info.ModTime(), info.Size()
+	return t.token, nil
+}
+
+// String keeps the token value out of logs.
+func (t *BearerToken) String() string {
+	return "[redacted]"
+}
+
+// authorizeRequest checks that req presents token as "Authorization: Bearer", writing
+// an error response when it does not. A nil token authorizes every request.
+func authorizeRequest(w http.ResponseWriter, req *http.Request, token *BearerToken, logger logr.Logger) bool {
+	if token == nil {
+		return true
+	}
+	want, err := token.Get()
+	if err != nil {
+		logger.Error(err, "Failed to load token")
+		http.Error(w, "unable to load token", http.StatusInternalServerError)
+		return false
+	}
+	presented, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(want)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
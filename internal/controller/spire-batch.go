@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/json"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MaxBatchSize caps the number of entries sent in a single batch request; a full
+// batch is flushed without waiting for the batch window to elapse.
+const MaxBatchSize = 100
+
+// ErrBatchUnsupported indicates the SPIRE API has no batch endpoint.
+var ErrBatchUnsupported = errors.New("SPIRE API does not support batch registration")
+
+// SpireEntryBatchRequest is the body of a batch registration.
+type SpireEntryBatchRequest struct {
+	Entries []*SpireEntry `json:"entries"`
+}
+
+// SpireEntryBatchResult is the outcome of a single entry of a batch registration.
+type SpireEntryBatchResult struct {
+	EntryID string `json:"entryID"`
+	Status  int    `json:"status"` // HTTP status the entry would have had on its own
+	Message string `json:"message"`
+}
+
+// SpireEntryBatchResponse lists the results of a batch registration, in request order.
+type SpireEntryBatchResponse struct {
+	Results []SpireEntryBatchResult `json:"results"`
+}
+
+// CreateEntriesBatch registers entries with a single SPIRE API call. It returns one
+// entry ID or error per entry, in order, so that failed entries can be retried
+// individually. Entries exceeding MaxEntryBytes fail with ErrEntryTooLarge without
+// being sent. ErrBatchUnsupported is returned when the server has no batch endpoint.
+func (c *SpireClient) CreateEntriesBatch(ctx context.Context, entries []*SpireEntry) ([]*entryID, []error, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Creating SPIRE entries in batch", "count", len(entries))
+
+	ids := make([]*entryID, len(entries))
+	errs := make([]error, len(entries))
+	wire := make([]*SpireEntry, 0, len(entries))
+	sent := make([]int, 0, len(entries)) // index in entries of each wire entry
+	for i, se := range entries {
+		w, err := c.wireEntry(*se)
+		if err != nil {
+			logger.Error(err, "Failed to compress kubeconfig")
+			return nil, nil, err
+		}
+		if c.MaxEntryBytes > 0 {
+			entryData, err := json.Marshal(w)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := c.checkEntrySize(w, entryData); err != nil {
+				logger.Error(err, "Not sending oversized SPIRE entry")
+				errs[i] = err
+				continue
+			}
+		}
+		wire = append(wire, &w)
+		sent = append(sent, i)
+	}
+	if len(wire) == 0 {
+		return ids, errs, nil
+	}
+	data, err := json.Marshal(SpireEntryBatchRequest{Entries: wire})
+	if err != nil {
+		logger.Error(err, "Failed to marshal SPIRE entry batch")
+		return nil, nil, err
+	}
+	paths := c.apiPaths()
+	resp, apiUrl, err := c.do(context.WithValue(ctx, creationKey{}, true), http.MethodPost, paths.path(paths.BatchAdd), data)
+	if err != nil {
+		logger.Error(err, "Failed to send batch request to SPIRE server", "url", apiUrl)
+		return nil, nil, fmt.Errorf("%w: creating entries via %s: %w", ErrSpireUnavailable, apiUrl, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, nil, fmt.Errorf("%w: %s", ErrBatchUnsupported, resp.Status)
+	default:
+		bodyBytes, _ := c.readBody(resp)
+		return nil, nil, statusError("batch create", resp, bodyBytes)
+	}
+
+	respBody, err := c.readBody(resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: reading batch create response: %w", ErrSpireUnavailable, err)
+	}
+	var batch SpireEntryBatchResponse
+	if err := c.decodeBody(respBody, &batch); err != nil {
+		logger.Error(err, "Failed to unmarshal batch response body", "status", resp.Status)
+		return nil, nil, malformedResponse("batch create", resp, respBody, err)
+	}
+	if len(batch.Results) != len(wire) {
+		return nil, nil, fmt.Errorf("SPIRE batch response has %d results for %d entries", len(batch.Results), len(wire))
+	}
+
+	for j, result := range batch.Results {
+		ids[sent[j]], errs[sent[j]] = batchResultEntry(result)
+	}
+	return ids, errs, nil
+}
+
+// batchResultEntry maps a batch result to the entry ID or error AddEntry would return.
+func batchResultEntry(result SpireEntryBatchResult) (*entryID, error) {
+	if isEntryConflict(result.Status, SpireEntryResponse{EntryID: result.EntryID, Message: result.Message}) {
+		if result.EntryID == "" {
+			return nil, fmt.Errorf("%w: entry already exists but server returned no entry ID", ErrEntryConflict)
+		}
+	} else if result.Status != http.StatusOK {
+		body, _ := json.Marshal(SpireEntryResponse{Message: result.Message})
+		return nil, statusError("create", &http.Response{
+			StatusCode: result.Status,
+			Status:     fmt.Sprintf("%d %s", result.Status, http.StatusText(result.Status)),
+			Header:     http.Header{},
+		}, body)
+	}
+	eID := entryID(result.EntryID)
+	return &eID, nil
+}
+
+// batchFlushTimeout bounds a flush, which runs detached from the reconciles that
+// queued its entries.
+const batchFlushTimeout = time.Minute
+
+// entryBatcher coalesces the entry registrations issued within a window into a
+// single CreateEntriesBatch call, falling back to one call per entry when the
+// SPIRE API has no batch endpoint.
+type entryBatcher struct {
+	client *SpireClient
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []*pendingEntry
+	// created holds, by entry hash, the IDs of the entries created for callers that
+	// had gone by the time the flush completed, so that their retry picks up the entry
+	// rather than registering a duplicate.
+	created     map[string]entryID
+	unsupported atomic.Bool
+}
+
+type pendingEntry struct {
+	entry  SpireEntry
+	key    string
+	result chan pendingResult
+	// gone is set, under the batcher's lock, once the caller stopped waiting.
+	gone bool
+}
+
+type pendingResult struct {
+	id     *entryID
+	err    error
+	server string
+}
+
+// add queues se for the next flush and waits for its result.
+func (b *entryBatcher) add(ctx context.Context, se SpireEntry) (*entryID, error) {
+	key := hashEntry(se)
+	b.mu.Lock()
+	if id, ok := b.created[key]; ok {
+		delete(b.created, key)
+		b.mu.Unlock()
+		log.FromContext(ctx).Info("Using SPIRE entry created by an abandoned registration", "entryID", id)
+		return &id, nil
+	}
+	if b.unsupported.Load() {
+		b.mu.Unlock()
+		return b.client.addEntry(ctx, se)
+	}
+
+	p := &pendingEntry{entry: se, key: key, result: make(chan pendingResult, 1)}
+	b.pending = append(b.pending, p)
+	switch len(b.pending) {
+	case 1:
+		time.AfterFunc(b.window, b.flush)
+	case MaxBatchSize:
+		go b.flush()
+	}
+	b.mu.Unlock()
+
+	select {
+	case res := <-p.result:
+		recordServedBy(ctx, res.server)
+		return res.id, res.err
+	case <-ctx.Done():
+		b.abandon(p)
+		return nil, ctx.Err()
+	}
+}
+
+// abandon marks p as gone: a pending entry is then not sent, and the ID of an entry
+// already created is kept for the retry.
+func (b *entryBatcher) abandon(p *pendingEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.gone = true
+	select {
+	case res := <-p.result:
+		b.keepCreated(p, res)
+	default:
+	}
+}
+
+// deliver hands res to the caller of p, or keeps the created entry ID when the caller
+// has gone.
+func (b *entryBatcher) deliver(p *pendingEntry, res pendingResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.gone {
+		b.keepCreated(p, res)
+		return
+	}
+	p.result <- res
+}
+
+func (b *entryBatcher) keepCreated(p *pendingEntry, res pendingResult) {
+	if res.id == nil || res.err != nil {
+		return
+	}
+	if b.created == nil {
+		b.created = map[string]entryID{}
+	}
+	b.created[p.key] = *res.id
+}
+
+// flush sends the pending entries whose caller is still waiting. It runs detached
+// from the reconciles that queued them, so a cancelled reconcile does not fail the
+// entries of the others, and is bounded by batchFlushTimeout.
+func (b *entryBatcher) flush() {
+	b.mu.Lock()
+	var batch []*pendingEntry
+	for _, p := range b.pending {
+		if !p.gone {
+			batch = append(batch, p)
+		}
+	}
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	logger := ctrl.Log.WithName("spire-batch")
+	baseCtx, cancel := context.WithTimeout(log.IntoContext(context.Background(), logger), batchFlushTimeout)
+	defer cancel()
+
+	if !b.unsupported.Load() {
+		entries := make([]*SpireEntry, len(batch))
+		for i, p := range batch {
+			entries[i] = &p.entry
+		}
+		ctx, served := withServedBy(baseCtx)
+		ids, errs, err := b.client.CreateEntriesBatch(ctx, entries)
+		switch {
+		case err == nil:
+			for i, p := range batch {
+				b.deliver(p, pendingResult{id: ids[i], err: errs[i], server: *served})
+			}
+			return
+		case errors.Is(err, ErrBatchUnsupported):
+			logger.Info("SPIRE API has no batch endpoint, registering entries one by one")
+			b.unsupported.Store(true)
+		default:
+			for _, p := range batch {
+				b.deliver(p, pendingResult{err: err})
+			}
+			return
+		}
+	}
+
+	for _, p := range batch {
+		b.mu.Lock()
+		gone := p.gone
+		b.mu.Unlock()
+		if gone {
+			continue
+		}
+		ctx, served := withServedBy(baseCtx)
+		id, err := b.client.addEntry(ctx, p.entry)
+		b.deliver(p, pendingResult{id: id, err: err, server: *served})
+	}
+}
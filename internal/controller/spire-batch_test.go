@@ -0,0 +1,198 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// addConcurrently adds the entries through c in parallel and returns the results in order.
+func addConcurrently(c *SpireClient, entries []SpireEntry) ([]*entryID, []error) {
+	ids := make([]*entryID, len(entries))
+	errs := make([]error, len(entries))
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = c.AddEntry(context.Background(), entries[i])
+		}(i)
+	}
+	wg.Wait()
+	return ids, errs
+}
+
+var _ = Describe("SPIRE entry batching", func() {
+	entries := []SpireEntry{
+		{ServiceAccount: "app", Namespace: "default"},
+		{ServiceAccount: "web", Namespace: "default"},
+		{ServiceAccount: "bad", Namespace: "default"},
+	}
+
+	It("should register the entries added within the window in one call with per-entry results", func() {
+		var batches, adds atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			if req.URL.Path != "/v1/entries/batch/add" {
+				adds.Add(1)
+				return
+			}
+			batches.Add(1)
+			var batch SpireEntryBatchRequest
+			Expect(json.NewDecoder(req.Body).Decode(&batch)).To(Succeed())
+
+			var resp SpireEntryBatchResponse
+			for _, se := range batch.Entries {
+				if se.ServiceAccount == "bad" {
+					resp.Results = append(resp.Results, SpireEntryBatchResult{Status: http.StatusBadRequest, Message: "invalid selector"})
+					continue
+				}
+				resp.Results = append(resp.Results, SpireEntryBatchResult{Status: http.StatusOK, EntryID: "entry-" + se.ServiceAccount})
+			}
+			Expect(json.NewEncoder(w).Encode(resp)).To(Succeed())
+		}))
+		defer server.Close()
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.BatchWindow = 100 * time.Millisecond
+		ids, errs := addConcurrently(c, entries)
+
+		Expect(batches.Load()).To(BeEquivalentTo(1))
+		Expect(adds.Load()).To(BeZero())
+		for i, se := range entries[:2] {
+			Expect(errs[i]).NotTo(HaveOccurred())
+			Expect(string(*ids[i])).To(Equal("entry-" + se.ServiceAccount))
+		}
+		Expect(errs[2]).To(MatchError(ContainSubstring("invalid selector")))
+	})
+
+	It("should fail oversized entries without sending them", func() {
+		var sent atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			var batch SpireEntryBatchRequest
+			Expect(json.NewDecoder(req.Body).Decode(&batch)).To(Succeed())
+			var resp SpireEntryBatchResponse
+			for _, se := range batch.Entries {
+				sent.Add(1)
+				resp.Results = append(resp.Results, SpireEntryBatchResult{Status: http.StatusOK, EntryID: "entry-" + se.ServiceAccount})
+			}
+			Expect(json.NewEncoder(w).Encode(resp)).To(Succeed())
+		}))
+		defer server.Close()
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.BatchWindow = 100 * time.Millisecond
+		c.MaxEntryBytes = 512
+		large := SpireEntry{ServiceAccount: "large", Namespace: "default", KubeConfig: strings.Repeat("a", 1024)}
+		ids, errs := addConcurrently(c, []SpireEntry{entries[0], large})
+
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(string(*ids[0])).To(Equal("entry-app"))
+		Expect(errs[1]).To(MatchError(ErrEntryTooLarge))
+		Expect(sent.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should fall back to one call per entry when the batch endpoint is unavailable", func() {
+		var batches, adds atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			if req.URL.Path == "/v1/entries/batch/add" {
+				batches.Add(1)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var se SpireEntry
+			Expect(json.NewDecoder(req.Body).Decode(&se)).To(Succeed())
+			adds.Add(1)
+			_, _ = fmt.Fprintf(w, `{"entryID":"entry-%s"}`, se.ServiceAccount)
+		}))
+		defer server.Close()
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.BatchWindow = 100 * time.Millisecond
+		ids, errs := addConcurrently(c, entries)
+		for i, se := range entries {
+			Expect(errs[i]).NotTo(HaveOccurred())
+			Expect(string(*ids[i])).To(Equal("entry-" + se.ServiceAccount))
+		}
+
+		// Later registrations skip the batch endpoint altogether.
+		_, err := c.AddEntry(context.Background(), SpireEntry{ServiceAccount: "late", Namespace: "default"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batches.Load()).To(BeEquivalentTo(1))
+		Expect(adds.Load()).To(BeEquivalentTo(len(entries) + 1))
+	})
+
+	It("should not send the entries of gone callers and keep the IDs created after they left", func() {
+		var batches atomic.Int64
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			batches.Add(1)
+			<-release
+			var batch SpireEntryBatchRequest
+			Expect(json.NewDecoder(req.Body).Decode(&batch)).To(Succeed())
+			var resp SpireEntryBatchResponse
+			for _, se := range batch.Entries {
+				resp.Results = append(resp.Results, SpireEntryBatchResult{Status: http.StatusOK, EntryID: "entry-" + se.ServiceAccount})
+			}
+			Expect(json.NewEncoder(w).Encode(resp)).To(Succeed())
+		}))
+		defer server.Close()
+		defer close(release)
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.BatchWindow = 100 * time.Millisecond
+
+		// The caller is gone before the window elapses: nothing is sent.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := c.AddEntry(ctx, entries[0])
+		cancel()
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Consistently(batches.Load, 200*time.Millisecond).Should(BeZero())
+
+		// The caller leaves while the batch is in flight: its retry gets the created entry.
+		ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_, err = c.AddEntry(ctx, entries[0])
+		cancel()
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(batches.Load()).To(BeEquivalentTo(1))
+		release <- struct{}{}
+		Eventually(func() int {
+			c.batcher.mu.Lock()
+			defer c.batcher.mu.Unlock()
+			return len(c.batcher.created)
+		}).Should(Equal(1))
+
+		id, err := c.AddEntry(context.Background(), entries[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(*id)).To(Equal("entry-app"))
+		Expect(batches.Load()).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const DefaultCircuitOpenDuration = time.Minute
+
+// ErrCircuitOpen indicates requests to a SPIRE API server are not sent because it
+// kept failing. It is returned within a RetryAfterError, so that reconciles requeue
+// until the circuit half-opens instead of failing.
+var ErrCircuitOpen = errors.New("SPIRE API circuit open")
+
+// States of a circuit, as reported by the spire_registrar_spire_api_circuit_state metric.
+const (
+	CircuitClosed   = 0
+	CircuitHalfOpen = 1
+	CircuitOpen     = 2
+)
+
+var circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "spire_registrar_spire_api_circuit_state",
+	Help: "State of the circuit breaker of a SPIRE API server: 0 closed, 1 half-open, 2 open",
+}, []string{"server"})
+
+func init() {
+	metrics.Registry.MustRegister(circuitState)
+}
+
+// CircuitBreaker stops sending requests to a SPIRE API server once FailureThreshold
+// consecutive requests failed with a transport or server error, protecting both the
+// controller and the server during an incident. After OpenDuration, a single probe
+// request is let through: its success closes the circuit, its failure opens it again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    int
+	failures int
+	// openedAt is when the circuit opened or, half-open, when the probe was let through.
+	openedAt time.Time
+}
+
+// allow reports whether a request may be sent to server and, if not, how long the
+// circuit stays open.
+func (b *CircuitBreaker) allow(server string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(server)
+	switch c.state {
+	case CircuitOpen:
+		if remaining := b.openDuration() - time.Since(c.openedAt); remaining > 0 {
+			return false, remaining
+		}
+		c.openedAt = time.Now()
+		b.setState(server, c, CircuitHalfOpen)
+		return true, 0
+	case CircuitHalfOpen:
+		// Only the probe is in flight until it completes. A probe that was never
+		// sent, e.g. because another server answered first, is retried after
+		// OpenDuration.
+		if remaining := b.openDuration() - time.Since(c.openedAt); remaining > 0 {
+			return false, remaining
+		}
+		c.openedAt = time.Now()
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// success closes the circuit of server.
+func (b *CircuitBreaker) success(server string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(server)
+	c.failures = 0
+	b.setState(server, c, CircuitClosed)
+}
+
+// failure counts a failed request to server, opening its circuit at the threshold
+// or when the half-open probe failed.
+func (b *CircuitBreaker) failure(server string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(server)
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= b.FailureThreshold {
+		c.openedAt = time.Now()
+		b.setState(server, c, CircuitOpen)
+	}
+}
+
+// State returns the state of the circuit of server.
+func (b *CircuitBreaker) State(server string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit(server).state
+}
+
+func (b *CircuitBreaker) circuit(server string) *circuit {
+	if b.circuits == nil {
+		b.circuits = map[string]*circuit{}
+	}
+	c, ok := b.circuits[server]
+	if !ok {
+		c = &circuit{}
+		b.circuits[server] = c
+		circuitState.WithLabelValues(server).Set(CircuitClosed)
+	}
+	return c
+}
+
+func (b *CircuitBreaker) setState(server string, c *circuit, state int) {
+	c.state = state
+	circuitState.WithLabelValues(server).Set(float64(state))
+}
+
+func (b *CircuitBreaker) openDuration() time.Duration {
+	if b.OpenDuration <= 0 {
+		return DefaultCircuitOpenDuration
+	}
+	return b.OpenDuration
+}
+
+// allowed returns the endpoints whose circuit lets a request through, failing with
+// ErrCircuitOpen, retried once the first circuit half-opens, when there is none.
+func (b *CircuitBreaker) allowed(endpoints []SpireAPI) ([]SpireAPI, error) {
+	allowed := make([]SpireAPI, 0, len(endpoints))
+	var open []string
+	var retryIn time.Duration
+	for _, api := range endpoints {
+		ok, after := b.allow(api.GetServerURL())
+		if ok {
+			allowed = append(allowed, api)
+			continue
+		}
+		open = append(open, api.GetServerURL())
+		if retryIn == 0 || after < retryIn {
+			retryIn = after
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, &RetryAfterError{
+			Err:   fmt.Errorf("%w: %w: %s kept failing", ErrSpireUnavailable, ErrCircuitOpen, strings.Join(open, ", ")),
+			After: retryIn,
+		}
+	}
+	return allowed, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("SPIRE API circuit breaker", func() {
+	var requests atomic.Int64
+	var healthy atomic.Bool
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		requests.Store(0)
+		healthy.Store(false)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"entryID":"entry-1"}`))
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	newClient := func() *SpireClient {
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.Breaker = &CircuitBreaker{FailureThreshold: 2, OpenDuration: 100 * time.Millisecond}
+		return c
+	}
+	se := SpireEntry{Namespace: "default", ServiceAccount: "app", Cluster: "test-cluster"}
+	state := func() float64 { return testutil.ToFloat64(circuitState.WithLabelValues(server.URL)) }
+
+	It("should fail fast while open and close after a successful probe", func() {
+		c := newClient()
+		for i := 0; i < 2; i++ {
+			_, err := c.AddEntry(context.Background(), se)
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(err).NotTo(MatchError(ErrCircuitOpen))
+		}
+		Expect(state()).To(Equal(float64(CircuitOpen)))
+
+		_, err := c.AddEntry(context.Background(), se)
+		Expect(err).To(MatchError(ErrCircuitOpen))
+		Expect(err).To(MatchError(ErrSpireUnavailable))
+		after, ok := retryAfter(err)
+		Expect(ok).To(BeTrue())
+		Expect(after).To(BeNumerically("~", 100*time.Millisecond, 50*time.Millisecond))
+		Expect(requests.Load()).To(BeEquivalentTo(2), "no request is sent while the circuit is open")
+
+		healthy.Store(true)
+		Eventually(func() error {
+			_, err := c.AddEntry(context.Background(), se)
+			return err
+		}).WithPolling(20 * time.Millisecond).Should(Succeed())
+		Expect(requests.Load()).To(BeEquivalentTo(3), "a single probe closes the circuit")
+		Expect(state()).To(Equal(float64(CircuitClosed)))
+	})
+
+	It("should open again when the probe fails", func() {
+		c := newClient()
+		for i := 0; i < 2; i++ {
+			_, _ = c.AddEntry(context.Background(), se)
+		}
+		Expect(c.Breaker.State(server.URL)).To(Equal(CircuitOpen))
+		time.Sleep(100 * time.Millisecond)
+
+		_, err := c.AddEntry(context.Background(), se)
+		Expect(err).NotTo(MatchError(ErrCircuitOpen), "the probe is sent")
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+		Expect(c.Breaker.State(server.URL)).To(Equal(CircuitOpen))
+		_, err = c.AddEntry(context.Background(), se)
+		Expect(err).To(MatchError(ErrCircuitOpen))
+	})
+
+	It("should requeue the reconcile without an error while open", func() {
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(server.URL, sa)
+		r.SpireClient.Breaker = &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Minute}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).To(HaveOccurred())
+		sent := requests.Load()
+		result, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 30*time.Second))
+		Expect(requests.Load()).To(Equal(sent))
+	})
+})
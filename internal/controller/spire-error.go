@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// SpireErrorResponse is the structured error body some SPIRE API front-ends return
+// instead of a flat message, e.g.
+//
+//	{"error": {"code": 3, "message": "invalid entry", "fields": [{"field": "selectors", "message": "empty"}]}}
+type SpireErrorResponse struct {
+	Error *SpireErrorDetail `json:"error"`
+}
+
+// SpireErrorDetail describes why the SPIRE API rejected a request.
+type SpireErrorDetail struct {
+	// Code is the error code, numeric or symbolic depending on the API.
+	Code    SpireErrorCode    `json:"code,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Fields  []SpireFieldError `json:"fields,omitempty"`
+}
+
+// SpireErrorCode is an error code sent either as a JSON number or string.
+type SpireErrorCode string
+
+func (c *SpireErrorCode) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var code string
+		if err := json.Unmarshal(data, &code); err != nil {
+			return err
+		}
+		*c = SpireErrorCode(code)
+		return nil
+	}
+	if string(data) != "null" {
+		*c = SpireErrorCode(data)
+	}
+	return nil
+}
+
+// SpireFieldError names an offending field of the request. The API may send it as
+// an object or as the bare field name.
+type SpireFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message,omitempty"`
+}
+
+func (f *SpireFieldError) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		*f = SpireFieldError{}
+		return json.Unmarshal(data, &f.Field)
+	}
+	type plain SpireFieldError
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// String renders the detail as a message, e.g.
+// "code 3: invalid entry (selectors: empty, hint)".
+func (d *SpireErrorDetail) String() string {
+	var parts []string
+	if d.Code != "" {
+		parts = append(parts, "code "+string(d.Code))
+	}
+	if d.Message != "" {
+		parts = append(parts, d.Message)
+	}
+	message := strings.Join(parts, ": ")
+	if len(d.Fields) == 0 {
+		return message
+	}
+	fields := make([]string, 0, len(d.Fields))
+	for _, f := range d.Fields {
+		if f.Message != "" {
+			fields = append(fields, fmt.Sprintf("%s: %s", f.Field, f.Message))
+			continue
+		}
+		fields = append(fields, f.Field)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s (%s)", message, strings.Join(fields, ", ")))
+}
+
+// errorDetail returns the structured error of a SPIRE API response body, if it
+// has one.
+func errorDetail(body []byte) (*SpireErrorDetail, bool) {
+	var resp SpireErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == nil {
+		return nil, false
+	}
+	if resp.Error.Code == "" && resp.Error.Message == "" && len(resp.Error.Fields) == 0 {
+		return nil, false
+	}
+	return resp.Error, true
+}
+
+// entryMissingBody reports whether the body of a 404 response identifies a missing
+// entry, as opposed to a missing route: a JSON error whose code is NotFound or whose
+// message tells that the entry does not exist. A bare 404, or the "404 page not
+// found" of an unknown path, does not.
+func entryMissingBody(body []byte) bool {
+	var message string
+	if detail, ok := errorDetail(body); ok {
+		switch strings.ToUpper(string(detail.Code)) {
+		case "5", "NOT_FOUND", "NOTFOUND":
+			return true
+		}
+		message = detail.Message
+	} else {
+		var resp SpireEntryResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return false
+		}
+		message = resp.Message
+	}
+	message = strings.ToLower(message)
+	if !strings.Contains(message, "entry") && !strings.Contains(message, "entries") {
+		return false
+	}
+	for _, missing := range []string{"not found", "does not exist", "no such"} {
+		if strings.Contains(message, missing) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeSpireServer is an in-memory SPIRE registrar API. It keeps the registered
+// entries keyed by namespace/name, or answers every request with a canned
+// status and body when one is set.
+type fakeSpireServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	entries map[string]SpireEntry
+	nextID  int
+	status  int
+	body    string
+}
+
+func newFakeSpireServer() *fakeSpireServer {
+	f := &fakeSpireServer{entries: map[string]SpireEntry{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// respondWith makes the server answer every request with status and body.
+func (f *fakeSpireServer) respondWith(status int, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.body = status, body
+}
+
+// registered returns the entry registered for the ServiceAccount, if any.
+func (f *fakeSpireServer) registered(namespace, name string) (SpireEntry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	se, ok := f.entries[namespace+"/"+name]
+	return se, ok
+}
+
+func (f *fakeSpireServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		_, _ = w.Write([]byte(f.body))
+		return
+	}
+
+	var se SpireEntry
+	if err := json.NewDecoder(req.Body).Decode(&se); err != nil {
+		http.Error(w, `{"message":"invalid entry"}`, http.StatusBadRequest)
+		return
+	}
+	key := se.Namespace + "/" + se.ServiceAccount
+	switch req.URL.Path {
+	case "/v1/entries/add":
+		f.nextID++
+		f.entries[key] = se
+		_, _ = fmt.Fprintf(w, `{"entryID":"entry-%d"}`, f.nextID)
+	case "/v1/entries/delete":
+		if _, ok := f.entries[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"entry not found"}`))
+			return
+		}
+		delete(f.entries, key)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Fake SPIRE server", func() {
+	var spire *fakeSpireServer
+
+	BeforeEach(func() {
+		spire = newFakeSpireServer()
+	})
+
+	AfterEach(func() {
+		spire.Close()
+	})
+
+	Context("When creating an entry", func() {
+		It("should return the entry ID on success", func() {
+			r := newTestReconciler(spire.URL)
+			id, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(*id)).To(Equal("entry-1"))
+			_, ok := spire.registered("default", "app")
+			Expect(ok).To(BeTrue())
+		})
+
+		DescribeTable("should fail without an entry ID",
+			func(status int, body string, matchers ...interface{}) {
+				spire.respondWith(status, body)
+				r := newTestReconciler(spire.URL)
+				var (
+					id  *entryID
+					err error
+				)
+				Expect(func() {
+					id, err = r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+				}).NotTo(Panic())
+				Expect(id).To(BeNil())
+				Expect(err).To(HaveOccurred())
+				for _, m := range matchers {
+					Expect(err).To(MatchError(m))
+				}
+			},
+			Entry("on a 4xx", http.StatusBadRequest, `{"message":"invalid selector"}`, ContainSubstring("invalid selector")),
+			Entry("on a 5xx", http.StatusInternalServerError, "boom", ErrSpireUnavailable),
+			Entry("on a malformed success body", http.StatusOK, "{not json"),
+		)
+
+		It("should fail when the server refuses connections", func() {
+			spire.Close()
+			r := newTestReconciler(spire.URL)
+			id, err := r.CreateEntry(context.Background(), newManagedServiceAccount("app", "default"))
+			Expect(id).To(BeNil())
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+		})
+	})
+
+	Context("When deleting an entry", func() {
+		It("should remove the registered entry", func() {
+			r := newTestReconciler(spire.URL)
+			sa := newManagedServiceAccount("app", "default")
+			_, err := r.CreateEntry(context.Background(), sa)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.DeleteEntry(context.Background(), sa)).To(Succeed())
+			_, ok := spire.registered("default", "app")
+			Expect(ok).To(BeFalse())
+		})
+
+		DescribeTable("should surface server errors",
+			func(status int, body string, matcher interface{}) {
+				spire.respondWith(status, body)
+				r := newTestReconciler(spire.URL)
+				var err error
+				Expect(func() {
+					err = r.DeleteEntry(context.Background(), newManagedServiceAccount("app", "default"))
+				}).NotTo(Panic())
+				Expect(err).To(MatchError(matcher))
+			},
+			Entry("on a 4xx", http.StatusBadRequest, `{"message":"invalid entry"}`, ContainSubstring("invalid entry")),
+			Entry("on a 5xx", http.StatusServiceUnavailable, "", ErrSpireUnavailable),
+		)
+
+		It("should ignore the body of a successful response", func() {
+			spire.respondWith(http.StatusOK, "{not json")
+			r := newTestReconciler(spire.URL)
+			Expect(r.DeleteEntry(context.Background(), newManagedServiceAccount("app", "default"))).To(Succeed())
+		})
+	})
+
+	Context("When reconciling a managed ServiceAccount", func() {
+		It("should register it with a finalizer and deregister it on deletion", func() {
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(spire.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+			Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+			_, ok := spire.registered("default", "app")
+			Expect(ok).To(BeTrue())
+
+			Expect(r.Delete(context.Background(), sa)).To(Succeed())
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			_, ok = spire.registered("default", "app")
+			Expect(ok).To(BeFalse())
+			Expect(r.Get(context.Background(), req.NamespacedName, &corev1.ServiceAccount{})).NotTo(Succeed())
+		})
+
+		It("should keep the finalizer while the SPIRE entry cannot be deleted", func() {
+			sa := newManagedServiceAccount("app", "default")
+			r := newTestReconciler(spire.URL, sa)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(r.Delete(context.Background(), sa)).To(Succeed())
+			spire.respondWith(http.StatusInternalServerError, "boom")
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).To(MatchError(ErrSpireUnavailable))
+			Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+			Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+		})
+	})
+})
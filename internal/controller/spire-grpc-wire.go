@@ -0,0 +1,468 @@
+package controller
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages below encode the subset of the SPIRE server Entry API
+// (spire.api.server.entry.v1 and spire.api.types) the GRPCBackend uses, with the
+// field numbers of the SPIRE API SDK protos. Unknown fields are skipped on decode.
+
+// wireMarshaler is a message the wireCodec can send.
+type wireMarshaler interface {
+	marshalWire() []byte
+}
+
+// wireMessage is a message the wireCodec can receive.
+type wireMessage interface {
+	wireMarshaler
+	unmarshalWire(data []byte) error
+}
+
+// wireCodec is the gRPC codec of wireMessages. It is named proto, as the messages
+// are protobuf-encoded.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.marshalWire(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	return m.unmarshalWire(data)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
+
+// spiffeIDMessage is spire.api.types.SPIFFEID.
+type spiffeIDMessage struct {
+	TrustDomain string
+	Path        string
+}
+
+func (m spiffeIDMessage) marshalWire() []byte {
+	var b []byte
+	b = appendString(b, 1, m.TrustDomain)
+	return appendString(b, 2, m.Path)
+}
+
+func (m *spiffeIDMessage) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			m.TrustDomain = string(v.bytes)
+		case 2:
+			m.Path = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// selectorMessage is spire.api.types.Selector.
+type selectorMessage struct {
+	Type  string
+	Value string
+}
+
+func (m selectorMessage) marshalWire() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Type)
+	return appendString(b, 2, m.Value)
+}
+
+func (m *selectorMessage) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			m.Type = string(v.bytes)
+		case 2:
+			m.Value = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// entryMessage is spire.api.types.Entry.
+type entryMessage struct {
+	ID            string
+	SpiffeID      spiffeIDMessage
+	ParentID      spiffeIDMessage
+	Selectors     []selectorMessage
+	X509SvidTTL   int32
+	FederatesWith []string
+	Admin         bool
+	Downstream    bool
+	DNSNames      []string
+	JWTSvidTTL    int32
+	Hint          string
+}
+
+func (m entryMessage) marshalWire() []byte {
+	var b []byte
+	b = appendString(b, 1, m.ID)
+	b = appendMessage(b, 2, m.SpiffeID)
+	b = appendMessage(b, 3, m.ParentID)
+	for _, selector := range m.Selectors {
+		b = appendMessage(b, 4, selector)
+	}
+	b = appendVarint(b, 5, uint64(m.X509SvidTTL))
+	for _, td := range m.FederatesWith {
+		b = appendString(b, 6, td)
+	}
+	b = appendBool(b, 7, m.Admin)
+	b = appendBool(b, 8, m.Downstream)
+	for _, name := range m.DNSNames {
+		b = appendString(b, 10, name)
+	}
+	b = appendVarint(b, 13, uint64(m.JWTSvidTTL))
+	return appendString(b, 14, m.Hint)
+}
+
+func (m *entryMessage) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			m.ID = string(v.bytes)
+		case 2:
+			return m.SpiffeID.unmarshalWire(v.bytes)
+		case 3:
+			return m.ParentID.unmarshalWire(v.bytes)
+		case 4:
+			var selector selectorMessage
+			if err := selector.unmarshalWire(v.bytes); err != nil {
+				return err
+			}
+			m.Selectors = append(m.Selectors, selector)
+		case 5:
+			m.X509SvidTTL = int32(v.varint)
+		case 6:
+			m.FederatesWith = append(m.FederatesWith, string(v.bytes))
+		case 7:
+			m.Admin = v.varint != 0
+		case 8:
+			m.Downstream = v.varint != 0
+		case 10:
+			m.DNSNames = append(m.DNSNames, string(v.bytes))
+		case 13:
+			m.JWTSvidTTL = int32(v.varint)
+		case 14:
+			m.Hint = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// statusMessage is spire.api.types.Status, the per-entry result of a batch call.
+// Code is a gRPC status code.
+type statusMessage struct {
+	Code    int32
+	Message string
+}
+
+func (m statusMessage) marshalWire() []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(m.Code))
+	return appendString(b, 2, m.Message)
+}
+
+func (m *statusMessage) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			m.Code = int32(v.varint)
+		case 2:
+			m.Message = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// batchEntryRequest is BatchCreateEntryRequest and BatchUpdateEntryRequest, whose
+// entries are field 1. An update without an input mask replaces the whole entry.
+type batchEntryRequest struct {
+	Entries []entryMessage
+}
+
+func (m batchEntryRequest) marshalWire() []byte {
+	var b []byte
+	for _, entry := range m.Entries {
+		b = appendMessage(b, 1, entry)
+	}
+	return b
+}
+
+func (m *batchEntryRequest) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		if num != 1 {
+			return nil
+		}
+		var entry entryMessage
+		if err := entry.unmarshalWire(v.bytes); err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, entry)
+		return nil
+	})
+}
+
+// entryResult is the Result of BatchCreateEntryResponse and BatchUpdateEntryResponse.
+type entryResult struct {
+	Status statusMessage
+	Entry  entryMessage
+}
+
+func (m entryResult) marshalWire() []byte {
+	var b []byte
+	b = appendMessage(b, 1, m.Status)
+	return appendMessage(b, 2, m.Entry)
+}
+
+func (m *entryResult) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			return m.Status.unmarshalWire(v.bytes)
+		case 2:
+			return m.Entry.unmarshalWire(v.bytes)
+		}
+		return nil
+	})
+}
+
+// batchEntryResponse is BatchCreateEntryResponse and BatchUpdateEntryResponse.
+type batchEntryResponse struct {
+	Results []entryResult
+}
+
+func (m batchEntryResponse) marshalWire() []byte {
+	var b []byte
+	for _, result := range m.Results {
+		b = appendMessage(b, 1, result)
+	}
+	return b
+}
+
+func (m *batchEntryResponse) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		if num != 1 {
+			return nil
+		}
+		var result entryResult
+		if err := result.unmarshalWire(v.bytes); err != nil {
+			return err
+		}
+		m.Results = append(m.Results, result)
+		return nil
+	})
+}
+
+// batchDeleteRequest is BatchDeleteEntryRequest.
+type batchDeleteRequest struct {
+	IDs []string
+}
+
+func (m batchDeleteRequest) marshalWire() []byte {
+	var b []byte
+	for _, id := range m.IDs {
+		b = appendString(b, 1, id)
+	}
+	return b
+}
+
+func (m *batchDeleteRequest) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		if num == 1 {
+			m.IDs = append(m.IDs, string(v.bytes))
+		}
+		return nil
+	})
+}
+
+// deleteResult is the Result of BatchDeleteEntryResponse.
+type deleteResult struct {
+	Status statusMessage
+	ID     string
+}
+
+func (m deleteResult) marshalWire() []byte {
+	var b []byte
+	b = appendMessage(b, 1, m.Status)
+	return appendString(b, 2, m.ID)
+}
+
+func (m *deleteResult) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			return m.Status.unmarshalWire(v.bytes)
+		case 2:
+			m.ID = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// batchDeleteResponse is BatchDeleteEntryResponse.
+type batchDeleteResponse struct {
+	Results []deleteResult
+}
+
+func (m batchDeleteResponse) marshalWire() []byte {
+	var b []byte
+	for _, result := range m.Results {
+		b = appendMessage(b, 1, result)
+	}
+	return b
+}
+
+func (m *batchDeleteResponse) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		if num != 1 {
+			return nil
+		}
+		var result deleteResult
+		if err := result.unmarshalWire(v.bytes); err != nil {
+			return err
+		}
+		m.Results = append(m.Results, result)
+		return nil
+	})
+}
+
+// listEntriesRequest is ListEntriesRequest, without a filter.
+type listEntriesRequest struct {
+	PageSize  int32
+	PageToken string
+}
+
+func (m listEntriesRequest) marshalWire() []byte {
+	var b []byte
+	b = appendVarint(b, 3, uint64(m.PageSize))
+	return appendString(b, 4, m.PageToken)
+}
+
+func (m *listEntriesRequest) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 3:
+			m.PageSize = int32(v.varint)
+		case 4:
+			m.PageToken = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// listEntriesResponse is ListEntriesResponse.
+type listEntriesResponse struct {
+	Entries       []entryMessage
+	NextPageToken string
+}
+
+func (m listEntriesResponse) marshalWire() []byte {
+	var b []byte
+	for _, entry := range m.Entries {
+		b = appendMessage(b, 1, entry)
+	}
+	return appendString(b, 2, m.NextPageToken)
+}
+
+func (m *listEntriesResponse) unmarshalWire(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, v wireValue) error {
+		switch num {
+		case 1:
+			var entry entryMessage
+			if err := entry.unmarshalWire(v.bytes); err != nil {
+				return err
+			}
+			m.Entries = append(m.Entries, entry)
+		case 2:
+			m.NextPageToken = string(v.bytes)
+		}
+		return nil
+	})
+}
+
+// appendString appends a string field, omitted when empty as in proto3.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendVarint appends an integer field, omitted when zero as in proto3.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendVarint(b, num, 1)
+}
+
+// appendMessage appends an embedded message field.
+func appendMessage(b []byte, num protowire.Number, m wireMarshaler) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.marshalWire())
+}
+
+// wireValue is the value of a decoded field: bytes for length-delimited fields,
+// varint for varint fields.
+type wireValue struct {
+	bytes  []byte
+	varint uint64
+}
+
+// consumeFields decodes the fields of a message in turn, skipping fixed-width and
+// group fields, which the Entry API messages do not use.
+func consumeFields(data []byte, field func(num protowire.Number, v wireValue) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var v wireValue
+		switch typ {
+		case protowire.VarintType:
+			v.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			v.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := field(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// The golden messages below are the encodings of the protobuf runtime for the
+// spire.api.types and spire.api.server.entry.v1 messages of the SPIRE API SDK,
+// so that the hand-written wire messages are checked against the SPIRE protos
+// rather than against themselves.
+const (
+	// Selector{type: "k8s", value: "ns:default"}
+	goldenSelector = "0a036b3873120a6e733a64656661756c74"
+	// Entry{id, spiffe_id, parent_id, selectors, x509_svid_ttl: 3600, federates_with,
+	// admin, dns_names, jwt_svid_ttl: 300, hint}
+	goldenEntry = "0a07656e7472792d3112210a0b6578616d706c652e6f726712122f6e732f64656661756c742f73612f617070" +
+		"1a1a0a0b6578616d706c652e6f7267120b2f636c75737465722f633122110a036b3873120a6e733a64656661756c74" +
+		"220d0a036b3873120673613a61707028901c32147370696666653a2f2f706172746e65722e6f72673801520f617070" +
+		"2e64656661756c742e73766368ac027203617070"
+	// Entry{id, spiffe_id, expires_at, revision_number, store_svid, created_at}, the
+	// last four of which the GRPCBackend does not use.
+	goldenEntryUnknownFields = "0a07656e7472792d3212200a0b6578616d706c652e6f726712112f6e732f64656661756c742f73612f6462" +
+		"4880e2cfaa06580760017880b5eda506"
+	// ListEntriesRequest{page_size: 2, page_token: "page-2"}
+	goldenListEntriesRequest = "18022206706167652d32"
+	// ListEntriesResponse{entries: [goldenEntryUnknownFields], next_page_token: "page-3"}
+	goldenListEntriesResponse = "0a3b" + goldenEntryUnknownFields + "1206706167652d33"
+	// ListEntriesResponse{entries: [goldenEntryUnknownFields]}, the last page.
+	goldenListEntriesLastPage = "0a3b" + goldenEntryUnknownFields
+)
+
+func goldenBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
+
+var _ = Describe("SPIRE gRPC wire messages", func() {
+	entry := entryMessage{
+		ID:       "entry-1",
+		SpiffeID: spiffeIDMessage{TrustDomain: "example.org", Path: "/ns/default/sa/app"},
+		ParentID: spiffeIDMessage{TrustDomain: "example.org", Path: "/cluster/c1"},
+		Selectors: []selectorMessage{
+			{Type: "k8s", Value: "ns:default"},
+			{Type: "k8s", Value: "sa:app"},
+		},
+		X509SvidTTL:   3600,
+		FederatesWith: []string{"spiffe://partner.org"},
+		Admin:         true,
+		DNSNames:      []string{"app.default.svc"},
+		JWTSvidTTL:    300,
+		Hint:          "app",
+	}
+	pagedEntry := entryMessage{
+		ID:       "entry-2",
+		SpiffeID: spiffeIDMessage{TrustDomain: "example.org", Path: "/ns/default/sa/db"},
+	}
+
+	It("should encode and decode a Selector as SPIRE does", func() {
+		selector := selectorMessage{Type: "k8s", Value: "ns:default"}
+		Expect(hex.EncodeToString(selector.marshalWire())).To(Equal(goldenSelector))
+
+		var decoded selectorMessage
+		Expect(decoded.unmarshalWire(goldenBytes(goldenSelector))).To(Succeed())
+		Expect(decoded).To(Equal(selector))
+	})
+
+	It("should encode and decode an Entry as SPIRE does", func() {
+		data, err := wireCodec{}.Marshal(entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hex.EncodeToString(data)).To(Equal(goldenEntry))
+
+		var decoded entryMessage
+		Expect(wireCodec{}.Unmarshal(goldenBytes(goldenEntry), &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(entry))
+	})
+
+	It("should skip the Entry fields it does not use", func() {
+		var decoded entryMessage
+		Expect(decoded.unmarshalWire(goldenBytes(goldenEntryUnknownFields))).To(Succeed())
+		Expect(decoded).To(Equal(pagedEntry))
+	})
+
+	It("should page through ListEntries as SPIRE does", func() {
+		req := listEntriesRequest{PageSize: 2, PageToken: "page-2"}
+		Expect(hex.EncodeToString(req.marshalWire())).To(Equal(goldenListEntriesRequest))
+		var decodedReq listEntriesRequest
+		Expect(decodedReq.unmarshalWire(goldenBytes(goldenListEntriesRequest))).To(Succeed())
+		Expect(decodedReq).To(Equal(req))
+
+		var page listEntriesResponse
+		Expect(page.unmarshalWire(goldenBytes(goldenListEntriesResponse))).To(Succeed())
+		Expect(page).To(Equal(listEntriesResponse{Entries: []entryMessage{pagedEntry}, NextPageToken: "page-3"}))
+
+		var last listEntriesResponse
+		Expect(last.unmarshalWire(goldenBytes(goldenListEntriesLastPage))).To(Succeed())
+		Expect(last.NextPageToken).To(BeEmpty())
+		Expect(last.Entries).To(Equal([]entryMessage{pagedEntry}))
+	})
+
+	It("should reject truncated messages", func() {
+		data := goldenBytes(goldenEntry)
+		var decoded entryMessage
+		Expect(decoded.unmarshalWire(data[:len(data)-2])).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultGRPCAddress is the default admin socket of the SPIRE server.
+	DefaultGRPCAddress = "unix:///tmp/spire-server/private/api.sock"
+
+	// DefaultGRPCParentIDPath is the default path of the parent ID of the entries
+	// registered through the gRPC Entry API. {cluster} is replaced with the cluster
+	// name of the entry.
+	DefaultGRPCParentIDPath = "/k8s-workload-registrar/{cluster}/node"
+
+	// grpcEntryMethod prefixes the methods of the SPIRE server Entry API.
+	grpcEntryMethod = "/spire.api.server.entry.v1.Entry/"
+
+	// grpcListPageSize is the page size of ListEntries calls.
+	grpcListPageSize = 500
+)
+
+// EntryBackend registers SPIRE entries. A SpireClient sends entries to the HTTP SPIRE
+// API unless its Backend is set.
+type EntryBackend interface {
+	AddEntry(ctx context.Context, se SpireEntry) (*entryID, error)
+	UpdateEntry(ctx context.Context, id entryID, se SpireEntry) error
+	RemoveEntry(ctx context.Context, id entryID, se SpireEntry) error
+	ListEntries(ctx context.Context, cluster string) ([]RegisteredEntry, error)
+}
+
+// GRPCBackend registers entries with the SPIRE server Entry API over the server's
+// admin socket, for deployments without an HTTP front-end. Entries get the SPIFFE ID
+// spiffe://<trust domain>/ns/<namespace>/sa/<service account> and, unless they set
+// their own selectors, the k8s:ns and k8s:sa selectors (and k8s:pod-name for pod
+// entries). The kubeconfig and ServiceAccount UID of entries have no place in the
+// Entry API and are not sent.
+type GRPCBackend struct {
+	// ParentIDPath is the path of the parent ID of the entries, below their trust
+	// domain; {cluster} is replaced with the cluster name. Defaults to
+	// DefaultGRPCParentIDPath. Clusters mapped in ParentIDs use their parent ID
+	// instead, as do entries carrying a ParentID.
+	ParentIDPath string
+
+	// ParentIDs are the parent IDs of the entries of clusters, as in
+	// ServiceAccountReconciler.ParentIDs.
+	ParentIDs ParentIDs
+
+	address string
+	conn    *grpc.ClientConn
+}
+
+var _ EntryBackend = &GRPCBackend{}
+
+// NewGRPCBackend returns a GRPCBackend for the SPIRE server admin socket at address,
+// a unix:// URL. The connection is established lazily.
+func NewGRPCBackend(address string) (*GRPCBackend, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return nil, fmt.Errorf("SPIRE server gRPC address %q must be a unix:// socket", address)
+	}
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{})))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to SPIRE server at %s: %w", address, err)
+	}
+	return &GRPCBackend{address: address, conn: conn}, nil
+}
+
+// Close closes the connection to the SPIRE server.
+func (b *GRPCBackend) Close() error {
+	return b.conn.Close()
+}
+
+// AddEntry creates se with BatchCreateEntry. An entry that already exists is reported
+// with the ID of the existing entry, as by the HTTP API.
+func (b *GRPCBackend) AddEntry(ctx context.Context, se SpireEntry) (*entryID, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Creating SPIRE Entry", "entry", se, "server", b.address)
+
+	var resp batchEntryResponse
+	req := batchEntryRequest{Entries: []entryMessage{b.entryMessage(se)}}
+	if err := b.invoke(ctx, "BatchCreateEntry", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != 1 {
+		return nil, fmt.Errorf("SPIRE server returned %d results for a single entry", len(resp.Results))
+	}
+	result := resp.Results[0]
+	switch grpccodes.Code(result.Status.Code) {
+	case grpccodes.OK:
+		logger.Info("Successfully created SPIRE entry", "entryID", result.Entry.ID)
+	case grpccodes.AlreadyExists:
+		if result.Entry.ID == "" {
+			return nil, fmt.Errorf("%w: entry already exists but server returned no entry ID: %s", ErrEntryConflict, result.Status.Message)
+		}
+		logger.Info("SPIRE entry already exists, using existing entry", "entryID", result.Entry.ID)
+	default:
+		return nil, resultError("create", result.Status)
+	}
+	id := entryID(result.Entry.ID)
+	return &id, nil
+}
+
+// UpdateEntry replaces the entry id with se using BatchUpdateEntry.
+func (b *GRPCBackend) UpdateEntry(ctx context.Context, id entryID, se SpireEntry) error {
+	log.FromContext(ctx).Info("Updating SPIRE Entry", "entryID", id, "entry", se, "server", b.address)
+
+	entry := b.entryMessage(se)
+	entry.ID = string(id)
+	var resp batchEntryResponse
+	if err := b.invoke(ctx, "BatchUpdateEntry", batchEntryRequest{Entries: []entryMessage{entry}}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Results) != 1 {
+		return fmt.Errorf("SPIRE server returned %d results for a single entry", len(resp.Results))
+	}
+	if grpccodes.Code(resp.Results[0].Status.Code) != grpccodes.OK {
+		return resultError("update", resp.Results[0].Status)
+	}
+	return nil
+}
+
+// RemoveEntry deletes the entry id with BatchDeleteEntry. Without an ID, the entry
+// matching se is looked up first.
+func (b *GRPCBackend) RemoveEntry(ctx context.Context, id entryID, se SpireEntry) error {
+	logger := log.FromContext(ctx)
+	if id == "" {
+		entries, err := b.ListEntries(ctx, se.Cluster)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Namespace == se.Namespace && entry.ServiceAccount == se.ServiceAccount &&
+				entry.Pod == se.Pod && entry.TrustDomain == se.TrustDomain {
+				id = entryID(entry.EntryID)
+				break
+			}
+		}
+		if id == "" {
+			return fmt.Errorf("failed to delete SPIRE entry: %w", ErrEntryNotFound)
+		}
+	}
+	logger.Info("Deleting SPIRE entry", "entryID", id, "server", b.address)
+
+	var resp batchDeleteResponse
+	if err := b.invoke(ctx, "BatchDeleteEntry", batchDeleteRequest{IDs: []string{string(id)}}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Results) != 1 {
+		return fmt.Errorf("SPIRE server returned %d results for a single entry", len(resp.Results))
+	}
+	if grpccodes.Code(resp.Results[0].Status.Code) != grpccodes.OK {
+		return resultError("delete", resp.Results[0].Status)
+	}
+	logger.Info("Successfully deleted SPIRE entry")
+	return nil
+}
+
+// ListEntries returns the entries whose parent ID is that of the cluster, in any
+// trust domain.
+func (b *GRPCBackend) ListEntries(ctx context.Context, cluster string) ([]RegisteredEntry, error) {
+	parentPath := b.parentIDPath(cluster)
+	var entries []RegisteredEntry
+	req := listEntriesRequest{PageSize: grpcListPageSize}
+	for {
+		var resp listEntriesResponse
+		if err := b.invoke(ctx, "ListEntries", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, entry := range resp.Entries {
+			if entry.ParentID.Path == parentPath {
+				entries = append(entries, registeredEntry(entry, cluster))
+			}
+		}
+		if resp.NextPageToken == "" {
+			return entries, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// checkHealth reports whether the SPIRE server socket accepts connections.
+func (b *GRPCBackend) checkHealth(ctx context.Context) error {
+	b.conn.Connect()
+	for state := b.conn.GetState(); state != connectivity.Ready; state = b.conn.GetState() {
+		if !b.conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%w: SPIRE server socket %s is %s", ErrSpireUnavailable, b.address, state)
+		}
+	}
+	return nil
+}
+
+// invoke calls method of the Entry API within its own span. Errors of an unreachable
+// or overloaded server wrap ErrSpireUnavailable.
+func (b *GRPCBackend) invoke(ctx context.Context, method string, req wireMarshaler, resp wireMessage) (err error) {
+	ctx, span := tracer.Start(ctx, "SPIRE gRPC "+method, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	err = b.conn.Invoke(ctx, grpcEntryMethod+method, req, resp)
+	if err == nil {
+		return nil
+	}
+	log.FromContext(ctx).Error(err, "SPIRE server call failed", "method", method, "server", b.address)
+	switch status.Code(err) {
+	case grpccodes.Unavailable, grpccodes.DeadlineExceeded, grpccodes.ResourceExhausted, grpccodes.Aborted:
+		return fmt.Errorf("%w: %s via %s: %w", ErrSpireUnavailable, method, b.address, err)
+	}
+	return fmt.Errorf("%s via %s: %w", method, b.address, err)
+}
+
+// resultError returns the error of a failed entry in a batch result.
+func resultError(op string, st statusMessage) error {
+	code := grpccodes.Code(st.Code)
+	if code == grpccodes.NotFound {
+		return fmt.Errorf("failed to %s SPIRE entry: %w: %s", op, ErrEntryNotFound, st.Message)
+	}
+	return fmt.Errorf("failed to %s SPIRE entry: %s: %s", op, code, st.Message)
+}
+
+// parentIDPath returns the parent ID path of the entries of cluster.
+func (b *GRPCBackend) parentIDPath(cluster string) string {
+	if id, ok := b.ParentIDs[cluster]; ok {
+		return spiffeIDMessageOf(id).Path
+	}
+	path := b.ParentIDPath
+	if path == "" {
+		path = DefaultGRPCParentIDPath
+	}
+	return strings.ReplaceAll(path, "{cluster}", cluster)
+}
+
+// spiffeIDMessageOf splits the validated SPIFFE ID id into its trust domain and path.
+func spiffeIDMessageOf(id string) spiffeIDMessage {
+	trustDomain, path, _ := strings.Cut(strings.TrimPrefix(id, "spiffe://"), "/")
+	return spiffeIDMessage{TrustDomain: trustDomain, Path: "/" + path}
+}
+
+// entryMessage builds the Entry API entry of se. Its parent ID is se.ParentID when
+// set, else derived from ParentIDPath.
+func (b *GRPCBackend) entryMessage(se SpireEntry) entryMessage {
+	entry := entryMessage{
+		SpiffeID:      spiffeIDMessage{TrustDomain: se.TrustDomain, Path: entrySpiffeIDPath(se)},
+		ParentID:      spiffeIDMessage{TrustDomain: se.TrustDomain, Path: b.parentIDPath(se.Cluster)},
+		X509SvidTTL:   int32(se.X509SvidTtl),
+		JWTSvidTTL:    int32(se.JwtSvidTtl),
+		FederatesWith: se.FederatesWith,
+		Admin:         se.Admin,
+		Downstream:    se.Downstream,
+		DNSNames:      se.DnsNames,
+		Hint:          se.Hint,
+	}
+	if se.ParentID != "" {
+		entry.ParentID = spiffeIDMessageOf(se.ParentID)
+	}
+	selectors := se.Selectors
+	if len(selectors) == 0 {
+		selectors = []string{"k8s:ns:" + se.Namespace, "k8s:sa:" + se.ServiceAccount}
+		if se.Pod != "" {
+			selectors = append(selectors, "k8s:pod-name:"+se.Pod)
+		}
+	}
+	for _, selector := range selectors {
+		selectorType, value, _ := strings.Cut(selector, ":")
+		entry.Selectors = append(entry.Selectors, selectorMessage{Type: selectorType, Value: value})
+	}
+	return entry
+}
+
+// registeredEntry converts an Entry API entry of cluster back to a RegisteredEntry.
+// The namespace and service account come from the SPIFFE ID, the pod from the
+// k8s:pod-name selector.
+func registeredEntry(entry entryMessage, cluster string) RegisteredEntry {
+	registered := RegisteredEntry{EntryID: entry.ID, SpireEntry: SpireEntry{
+		TrustDomain:   entry.SpiffeID.TrustDomain,
+		Cluster:       cluster,
+		X509SvidTtl:   int(entry.X509SvidTTL),
+		JwtSvidTtl:    int(entry.JWTSvidTTL),
+		FederatesWith: entry.FederatesWith,
+		Admin:         entry.Admin,
+		Downstream:    entry.Downstream,
+		DnsNames:      entry.DNSNames,
+		Hint:          entry.Hint,
+	}}
+	if parts := strings.Split(entry.SpiffeID.Path, "/"); len(parts) == 5 && parts[1] == "ns" && parts[3] == "sa" {
+		registered.Namespace, registered.ServiceAccount = parts[2], parts[4]
+	}
+	for _, selector := range entry.Selectors {
+		registered.Selectors = append(registered.Selectors, selector.Type+":"+selector.Value)
+		if pod, ok := strings.CutPrefix(selector.Value, "pod-name:"); ok && selector.Type == "k8s" {
+			registered.Pod = pod
+		}
+	}
+	return registered
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeEntryServer serves the SPIRE server Entry API methods used by the GRPCBackend
+// from an in-memory set of entries.
+type fakeEntryServer struct {
+	mu      sync.Mutex
+	entries map[string]entryMessage
+	nextID  int
+	calls   []string
+}
+
+func (s *fakeEntryServer) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, method)
+
+	switch method {
+	case grpcEntryMethod + "BatchCreateEntry":
+		var req batchEntryRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		var resp batchEntryResponse
+		for _, entry := range req.Entries {
+			if existing, ok := s.find(entry); ok {
+				resp.Results = append(resp.Results, entryResult{Status: statusMessage{Code: int32(grpccodes.AlreadyExists)}, Entry: existing})
+				continue
+			}
+			s.nextID++
+			entry.ID = "entry-" + strconv.Itoa(s.nextID)
+			s.entries[entry.ID] = entry
+			resp.Results = append(resp.Results, entryResult{Entry: entry})
+		}
+		return stream.SendMsg(resp)
+	case grpcEntryMethod + "BatchUpdateEntry":
+		var req batchEntryRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		var resp batchEntryResponse
+		for _, entry := range req.Entries {
+			if _, ok := s.entries[entry.ID]; !ok {
+				resp.Results = append(resp.Results, entryResult{Status: statusMessage{Code: int32(grpccodes.NotFound), Message: "entry not found"}})
+				continue
+			}
+			s.entries[entry.ID] = entry
+			resp.Results = append(resp.Results, entryResult{Entry: entry})
+		}
+		return stream.SendMsg(resp)
+	case grpcEntryMethod + "BatchDeleteEntry":
+		var req batchDeleteRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		var resp batchDeleteResponse
+		for _, id := range req.IDs {
+			result := deleteResult{ID: id}
+			if _, ok := s.entries[id]; ok {
+				delete(s.entries, id)
+			} else {
+				result.Status = statusMessage{Code: int32(grpccodes.NotFound), Message: "entry not found"}
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return stream.SendMsg(resp)
+	case grpcEntryMethod + "ListEntries":
+		var req listEntriesRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		// Serve one entry per page to exercise pagination.
+		var resp listEntriesResponse
+		ids := make([]string, 0, len(s.entries))
+		for id := range s.entries {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for i, id := range ids {
+			if id > req.PageToken {
+				resp.Entries = []entryMessage{s.entries[id]}
+				if i < len(ids)-1 {
+					resp.NextPageToken = id
+				}
+				break
+			}
+		}
+		return stream.SendMsg(resp)
+	}
+	return status.Errorf(grpccodes.Unimplemented, "unknown method %s", method)
+}
+
+// find returns the entry with the SPIFFE ID and parent ID of entry.
+func (s *fakeEntryServer) find(entry entryMessage) (entryMessage, bool) {
+	for _, existing := range s.entries {
+		if existing.SpiffeID == entry.SpiffeID && existing.ParentID == entry.ParentID {
+			return existing, true
+		}
+	}
+	return entryMessage{}, false
+}
+
+var _ = Describe("SPIRE gRPC backend", func() {
+	var (
+		fake    *fakeEntryServer
+		backend *GRPCBackend
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		// Unix socket paths are limited in length, so the socket is not placed in the
+		// Ginkgo temporary directory.
+		dir, err := os.MkdirTemp("", "spire")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		socket := filepath.Join(dir, "api.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+
+		fake = &fakeEntryServer{entries: map[string]entryMessage{}}
+		server := grpc.NewServer(grpc.ForceServerCodec(wireCodec{}), grpc.UnknownServiceHandler(fake.handle))
+		go func() { _ = server.Serve(listener) }()
+		DeferCleanup(server.Stop)
+
+		backend, err = NewGRPCBackend("unix://" + socket)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(backend.Close)
+	})
+
+	It("should only connect to unix sockets", func() {
+		_, err := NewGRPCBackend("spire-server:8081")
+		Expect(err).To(MatchError(ContainSubstring("must be a unix:// socket")))
+	})
+
+	It("should register, update and delete the entry of a ServiceAccount", func() {
+		sa := newManagedServiceAccount("app", "default")
+		sa.Annotations[DNSNamesAnnotation] = "app.example.org"
+		r := newTestReconciler("http://unused", sa)
+		r.SpireClient.Backend = backend
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		Expect(fake.entries).To(HaveKeyWithValue("entry-1", entryMessage{
+			ID:        "entry-1",
+			SpiffeID:  spiffeIDMessage{TrustDomain: "example.org", Path: "/ns/default/sa/app"},
+			ParentID:  spiffeIDMessage{TrustDomain: "example.org", Path: "/k8s-workload-registrar/test-cluster/node"},
+			Selectors: []selectorMessage{{Type: "k8s", Value: "ns:default"}, {Type: "k8s", Value: "sa:app"}},
+			DNSNames:  []string{"app.example.org"},
+		}))
+
+		sa.Annotations[X509SvidTTLAnnotation] = "600"
+		Expect(r.Update(ctx, sa)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.entries["entry-1"].X509SvidTTL).To(BeEquivalentTo(600))
+
+		Expect(r.DeleteEntry(ctx, sa)).To(Succeed())
+		Expect(fake.entries).To(BeEmpty())
+		Expect(r.DeleteEntry(ctx, sa)).To(MatchError(ErrEntryNotFound))
+	})
+
+	It("should return the ID of an entry that already exists", func() {
+		se := SpireEntry{TrustDomain: "example.org", Namespace: "default", ServiceAccount: "app", Cluster: "test-cluster"}
+		first, err := backend.AddEntry(ctx, se)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := backend.AddEntry(ctx, se)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*second).To(Equal(*first))
+	})
+
+	It("should list the entries of the cluster across pages", func() {
+		for _, se := range []SpireEntry{
+			{TrustDomain: "example.org", Namespace: "default", ServiceAccount: "app", Cluster: "test-cluster"},
+			{TrustDomain: "example.org", Namespace: "default", ServiceAccount: "web", Cluster: "test-cluster", Pod: "web-0"},
+			{TrustDomain: "example.org", Namespace: "default", ServiceAccount: "app", Cluster: "other-cluster"},
+		} {
+			_, err := backend.AddEntry(ctx, se)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		entries, err := backend.ListEntries(ctx, "test-cluster")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].EntryID).To(Equal("entry-1"))
+		Expect(entries[0].ServiceAccount).To(Equal("app"))
+		Expect(entries[1].Namespace).To(Equal("default"))
+		Expect(entries[1].ServiceAccount).To(Equal("web"))
+		Expect(entries[1].Pod).To(Equal("web-0"))
+		Expect(entries[1].Cluster).To(Equal("test-cluster"))
+
+		Expect(backend.RemoveEntry(ctx, "", entries[1].SpireEntry)).To(Succeed())
+		Expect(fake.entries).NotTo(HaveKey("entry-2"), "an entry without ID is looked up")
+	})
+
+	It("should register the entries of a cluster under its parent ID", func() {
+		parentIDs := ParentIDs{"test-cluster": "spiffe://example.org/agent/test-cluster"}
+		backend.ParentIDs = parentIDs
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler("http://unused", sa)
+		r.SpireClient.Backend = backend
+		r.ParentIDs = parentIDs
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.entries["entry-1"].ParentID).To(Equal(spiffeIDMessage{TrustDomain: "example.org", Path: "/agent/test-cluster"}))
+
+		entries, err := backend.ListEntries(ctx, "test-cluster")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(backend.RemoveEntry(ctx, "", entries[0].SpireEntry)).To(Succeed())
+		Expect(fake.entries).To(BeEmpty())
+	})
+
+	It("should report whether the SPIRE server socket is reachable", func() {
+		c := NewSpireClient(SpireAPI{Server: "http://unused"})
+		c.Backend = backend
+		check := SpireHealthCheck(c, "", 0)
+		Expect(check(httptest.NewRequest(http.MethodGet, "/healthz", nil))).To(Succeed())
+	})
+})
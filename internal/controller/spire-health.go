@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	DefaultSpireHealthPath    = "/v1/healthz"
+	DefaultSpireHealthTimeout = 5 * time.Second
+)
+
+// SpireHealthCheck returns a healthz.Checker that reports an error when none of the
+// SPIRE API servers of c can be reached at path within timeout, or all of them
+// answer with a server error. Probes use the transport of c, including its proxy.
+// With a GRPCBackend, it checks that the SPIRE server socket accepts connections.
+func SpireHealthCheck(c *SpireClient, path string, timeout time.Duration) healthz.Checker {
+	if path == "" {
+		path = DefaultSpireHealthPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if timeout <= 0 {
+		timeout = DefaultSpireHealthTimeout
+	}
+	if backend, ok := c.Backend.(interface{ checkHealth(context.Context) error }); ok {
+		return func(req *http.Request) error {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			return backend.checkHealth(ctx)
+		}
+	}
+	httpClient := &http.Client{Transport: c.httpClient().Transport, Timeout: timeout}
+
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		var errs []error
+		for _, api := range c.Pool.Endpoints() {
+			err := probeSpireAPI(ctx, httpClient, api.GetServerURL()+path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			return fmt.Errorf("no SPIRE API servers configured")
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// CheckSpireAPI runs check once outside of a health endpoint, e.g. to verify at
+// startup that the SPIRE API is reachable.
+func CheckSpireAPI(ctx context.Context, check healthz.Checker) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return err
+	}
+	return check(req)
+}
+
+func probeSpireAPI(ctx context.Context, httpClient *http.Client, probeUrl string) error {
+	probe, err := http.NewRequestWithContext(ctx, http.MethodGet, probeUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(probe)
+	if err != nil {
+		return fmt.Errorf("SPIRE API unreachable at %s: %w", probeUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("SPIRE API unhealthy at %s: %s", probeUrl, resp.Status)
+	}
+	return nil
+}
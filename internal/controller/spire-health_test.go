@@ -0,0 +1,57 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SPIRE API health", func() {
+	It("should succeed when any server is reachable", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			Expect(req.URL.Path).To(Equal(DefaultSpireHealthPath))
+		}))
+		defer server.Close()
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		c := NewSpireClient(SpireAPI{Server: down.URL}, SpireAPI{Server: server.URL})
+		check := SpireHealthCheck(c, "", time.Second)
+		Expect(CheckSpireAPI(context.Background(), check)).To(Succeed())
+	})
+
+	It("should fail when no server is reachable or healthy", func() {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		c := NewSpireClient(SpireAPI{Server: down.URL}, SpireAPI{Server: failing.URL})
+		err := CheckSpireAPI(context.Background(), SpireHealthCheck(c, "", time.Second))
+		Expect(err).To(MatchError(ContainSubstring("unreachable")))
+		Expect(err).To(MatchError(ContainSubstring("503")))
+	})
+})
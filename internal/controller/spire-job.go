@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Defaults of the polling of asynchronous entry creations.
+const (
+	DefaultJobPollInterval = time.Second
+	DefaultJobTimeout      = 30 * time.Second
+)
+
+// States of an asynchronous entry creation job.
+const (
+	JobStatusPending   = "pending"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// ErrJobTimeout indicates an asynchronous entry creation did not complete in time.
+var ErrJobTimeout = errors.New("SPIRE entry creation job timed out")
+
+// ErrJobPending indicates an asynchronous entry creation has no entry ID yet. The
+// error is a *JobPendingError carrying the job to poll.
+var ErrJobPending = errors.New("SPIRE entry creation job is pending")
+
+// ErrJobNotFound indicates the SPIRE server does not know an entry creation job,
+// e.g. because it expired.
+var ErrJobNotFound = errors.New("SPIRE entry creation job not found")
+
+// JobPendingError is returned for an asynchronous entry creation when the caller
+// polls the job itself, see withEntryJobs.
+type JobPendingError struct {
+	// Server is the URL of the SPIRE API server that accepted the creation; the job is
+	// only known to it.
+	Server string
+	JobID  string
+}
+
+func (e *JobPendingError) Error() string {
+	return fmt.Sprintf("%s: job %s on %s", ErrJobPending, e.JobID, e.Server)
+}
+
+func (e *JobPendingError) Is(target error) bool {
+	return target == ErrJobPending
+}
+
+type entryJobsKey struct{}
+
+// withEntryJobs returns a context whose entry creations return a JobPendingError
+// when the SPIRE API accepts them asynchronously, instead of polling the job until
+// it completes. The caller then polls the job with JobEntry, e.g. on its next
+// reconcile, so that a pending job does not hold a worker.
+func withEntryJobs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, entryJobsKey{}, true)
+}
+
+func pollsEntryJobs(ctx context.Context) bool {
+	polls, _ := ctx.Value(entryJobsKey{}).(bool)
+	return polls
+}
+
+// SpireJobResponse is the status of an asynchronous entry creation, as returned by
+// the job status endpoint.
+type SpireJobResponse struct {
+	JobID    string `json:"jobID"`
+	Status   string `json:"status"`
+	EntryID  string `json:"entryID,omitempty"`
+	SpiffeID string `json:"spiffeID,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// JobEntry polls the creation job accepted by server once and returns the ID of its
+// entry. A job still running fails with a JobPendingError, a failed job with its
+// message and a job the server does not know with ErrJobNotFound.
+func (c *SpireClient) JobEntry(ctx context.Context, server, job string) (*entryID, error) {
+	entry, done, err := c.pollJob(ctx, server, job)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		return nil, &JobPendingError{Server: server, JobID: job}
+	}
+	log.FromContext(ctx).Info("SPIRE entry creation job completed", "entryID", entry.EntryID, "jobID", job)
+	recordSpiffeID(ctx, entry.SpiffeID)
+	eID := entryID(entry.EntryID)
+	return &eID, nil
+}
+
+// awaitJob polls the status of the creation job accepted by server until it
+// reports the ID of the entry, fails, or JobTimeout elapses.
+func (c *SpireClient) awaitJob(ctx context.Context, server, job string) (SpireEntryResponse, error) {
+	logger := log.FromContext(ctx).WithValues("jobID", job)
+
+	interval, timeout := c.jobPollInterval(), c.JobTimeout
+	if timeout <= 0 {
+		timeout = DefaultJobTimeout
+	}
+
+	var result SpireEntryResponse
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, false, func(ctx context.Context) (bool, error) {
+		entry, done, err := c.pollJob(ctx, server, job)
+		if errors.Is(err, ErrSpireUnavailable) && ctx.Err() == nil {
+			// The server may be briefly unreachable; the timeout bounds the wait.
+			logger.Info("Failed to poll SPIRE entry creation job, retrying", "error", err.Error())
+			return false, nil
+		}
+		result = entry
+		return done, err
+	})
+	if wait.Interrupted(err) {
+		return result, fmt.Errorf("%w: job %s has no entry ID after %s", ErrJobTimeout, job, timeout)
+	}
+	return result, err
+}
+
+// jobPollInterval returns JobPollInterval, defaulting to DefaultJobPollInterval.
+func (c *SpireClient) jobPollInterval() time.Duration {
+	if c.JobPollInterval <= 0 {
+		return DefaultJobPollInterval
+	}
+	return c.JobPollInterval
+}
+
+// pollJob reads the status of the creation job accepted by server once. done
+// reports whether the job completed with an entry ID.
+func (c *SpireClient) pollJob(ctx context.Context, server, job string) (_ SpireEntryResponse, done bool, _ error) {
+	paths := c.apiPaths()
+	statusPath := joinURLPath(paths.Base, paths.Jobs, url.PathEscape(job))
+	// The job is only known to the server that accepted it.
+	resp, apiUrl, err := c.do(WithSpireServer(ctx, server), http.MethodGet, statusPath, nil)
+	if err != nil {
+		return SpireEntryResponse{}, false, fmt.Errorf("%w: polling job %s via %s: %w", ErrSpireUnavailable, job, apiUrl, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return SpireEntryResponse{}, false, fmt.Errorf("%w: reading job status: %w", ErrSpireUnavailable, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return SpireEntryResponse{}, false, fmt.Errorf("%w: job %s on %s: %s", ErrJobNotFound, job, apiUrl, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return SpireEntryResponse{}, false, statusError("job status", resp, body)
+	}
+	var status SpireJobResponse
+	if err := c.decodeBody(body, &status); err != nil {
+		return SpireEntryResponse{}, false, malformedResponse("job status", resp, body, err)
+	}
+	switch status.Status {
+	case JobStatusSucceeded:
+		if status.EntryID == "" {
+			return SpireEntryResponse{}, false, fmt.Errorf("SPIRE entry creation job %s succeeded without an entry ID", job)
+		}
+		return SpireEntryResponse{EntryID: status.EntryID, SpiffeID: status.SpiffeID, Message: status.Message}, true, nil
+	case JobStatusFailed:
+		return SpireEntryResponse{}, false, fmt.Errorf("SPIRE entry creation job %s failed: %s", job, status.Message)
+	default:
+		log.FromContext(ctx).V(1).Info("SPIRE entry creation job is pending", "jobID", job, "status", status.Status)
+		return SpireEntryResponse{}, false, nil
+	}
+}
+
+// pendingJob is a pending asynchronous entry creation of a ServiceAccount.
+type pendingJob struct {
+	since    time.Time
+	reported bool
+}
+
+// recordEntryJob records the creation job of the entry of sa, accepted by the SPIRE
+// API asynchronously, on sa along with the server holding it, the hash and trust
+// domain of the entry and the finalizer, and requeues sa to poll the job.
+func (r *ServiceAccountReconciler) recordEntryJob(ctx context.Context, sa *corev1.ServiceAccount, pending *JobPendingError, reg registration) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("jobID", pending.JobID)
+	r.pendingJobs.Store(pending.JobID, pendingJob{since: time.Now()})
+	err := r.updateServiceAccount(ctx, sa, func(sa *corev1.ServiceAccount) {
+		if sa.Annotations == nil {
+			sa.Annotations = map[string]string{}
+		}
+		sa.Annotations[EntryJobAnnotation] = pending.JobID
+		sa.Annotations[SpireServerAnnotation] = pending.Server
+		sa.Annotations[EntryHashAnnotation] = reg.hash
+		if reg.trustDomain != "" {
+			sa.Annotations[EntryTrustDomainAnnotation] = reg.trustDomain
+		}
+		if !r.DisableFinalizers {
+			controllerutil.AddFinalizer(sa, SpireFinalizer)
+		}
+	})
+	if err != nil {
+		logger.Error(err, "Failed to record SPIRE entry creation job", "name", sa.Name)
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+	logger.Info("SPIRE entry creation is pending, polling its job", "name", sa.Name, "server", pending.Server)
+	return ctrl.Result{RequeueAfter: r.spireClient().jobPollInterval()}, nil
+}
+
+// reconcileEntryJob polls the creation job recorded on sa. Once the job completes,
+// its entry is persisted like a registered one. A pending job is polled again after
+// JobPollInterval; one pending for longer than JobTimeout is reported as failed, but
+// still polled rather than sent again. A failed or unknown job is forgotten, so that
+// the next reconcile registers the entry again.
+func (r *ServiceAccountReconciler) reconcileEntryJob(ctx context.Context, sa *corev1.ServiceAccount, job string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("jobID", job)
+	ctx = log.IntoContext(ctx, logger)
+	c := r.spireClient()
+	server := sa.Annotations[SpireServerAnnotation]
+
+	spiffeCtx, spiffeID := withSpiffeID(ctx)
+	id, err := c.JobEntry(spiffeCtx, server, job)
+	switch {
+	case err == nil:
+		r.pendingJobs.Delete(job)
+		return r.persistRegistration(ctx, sa, registration{id: id, hash: sa.Annotations[EntryHashAnnotation], server: server,
+			spiffeID: *spiffeID, trustDomain: sa.Annotations[EntryTrustDomainAnnotation]})
+	case errors.Is(err, ErrJobPending):
+		v, _ := r.pendingJobs.LoadOrStore(job, pendingJob{since: time.Now()})
+		pending := v.(pendingJob)
+		timeout := c.JobTimeout
+		if timeout <= 0 {
+			timeout = DefaultJobTimeout
+		}
+		if waited := time.Since(pending.since); waited > timeout && !pending.reported {
+			pending.reported = true
+			r.pendingJobs.Store(job, pending)
+			err := fmt.Errorf("%w: job %s has no entry ID after %s", ErrJobTimeout, job, waited.Round(time.Second))
+			r.recordSyncStatus(ctx, sa, err)
+			r.logFailure(ctx, sa, err, "SPIRE entry creation job is still pending")
+		}
+		return ctrl.Result{RequeueAfter: c.jobPollInterval()}, nil
+	case errors.Is(err, ErrSpireUnavailable):
+		r.recordSyncStatus(ctx, sa, err)
+		if after, ok := retryAfter(err); ok {
+			logger.Info("SPIRE server is rate limiting, backing off", "name", sa.Name, "retryAfter", after)
+			return ctrl.Result{RequeueAfter: jitter(after, r.RequeueJitterFraction)}, nil
+		}
+		r.logFailure(ctx, sa, err, "Failed to poll SPIRE entry creation job")
+		return ctrl.Result{RequeueAfter: 15}, err
+	}
+
+	r.pendingJobs.Delete(job)
+	r.recordSyncStatus(ctx, sa, err)
+	r.logFailure(ctx, sa, err, "SPIRE entry creation job did not create the entry, registering again")
+	if err := r.updateServiceAccount(ctx, sa, func(sa *corev1.ServiceAccount) {
+		delete(sa.Annotations, EntryJobAnnotation)
+		delete(sa.Annotations, SpireServerAnnotation)
+		delete(sa.Annotations, EntryHashAnnotation)
+		delete(sa.Annotations, EntryTrustDomainAnnotation)
+	}); err != nil {
+		logger.Error(err, "Failed to forget SPIRE entry creation job", "name", sa.Name)
+	}
+	return ctrl.Result{RequeueAfter: 15}, err
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Asynchronous SPIRE entry creation", func() {
+	// newAsyncServer accepts creations as job-1, which reports pending until polled
+	// pendingPolls times and then succeeds with entry-1.
+	newAsyncServer := func(pendingPolls int64) (*httptest.Server, *atomic.Int64, *atomic.Int64) {
+		var adds, polls atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/v1/entries/add":
+				adds.Add(1)
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"jobID":"job-1","message":"queued"}`))
+			case "/v1/entries/jobs/job-1":
+				if polls.Add(1) <= pendingPolls {
+					_, _ = w.Write([]byte(`{"jobID":"job-1","status":"pending"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"jobID":"job-1","status":"succeeded","entryID":"entry-1"}`))
+			case "/v1/entries":
+				_, _ = w.Write([]byte(`{"entries":[]}`))
+			default:
+				http.NotFound(w, req)
+			}
+		}))
+		DeferCleanup(server.Close)
+		return server, &adds, &polls
+	}
+
+	It("should record the job and annotate the ServiceAccount once a later poll has an entry ID", func() {
+		server, adds, polls := newAsyncServer(1)
+
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(server.URL, sa)
+		r.SpireClient.JobPollInterval = 10 * time.Millisecond
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+		result, err := r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(10 * time.Millisecond))
+		Expect(polls.Load()).To(BeZero(), "the reconcile does not wait for the job")
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(EntryJobAnnotation, "job-1"))
+		Expect(sa.Annotations).To(HaveKeyWithValue(SpireServerAnnotation, server.URL))
+		Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		Expect(sa.Finalizers).To(ContainElement(SpireFinalizer))
+
+		result, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(10 * time.Millisecond))
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(polls.Load()).To(BeEquivalentTo(2))
+		Expect(adds.Load()).To(BeEquivalentTo(1))
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).To(HaveKeyWithValue(SVIDEntryIDAnnotation, "entry-1"))
+		Expect(sa.Annotations).NotTo(HaveKey(EntryJobAnnotation))
+	})
+
+	It("should report a job pending past the timeout without sending the creation again", func() {
+		server, adds, polls := newAsyncServer(1 << 30)
+
+		sa := newManagedServiceAccount("app", "default")
+		r := newTestReconciler(server.URL, sa)
+		r.SpireClient.JobPollInterval, r.SpireClient.JobTimeout = 10*time.Millisecond, time.Nanosecond
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+		for i := 0; i < 3; i++ {
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(adds.Load()).To(BeEquivalentTo(1))
+		Expect(polls.Load()).To(BeEquivalentTo(2))
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).NotTo(HaveKey(SVIDEntryIDAnnotation))
+		Expect(sa.Annotations).To(HaveKeyWithValue(EntryJobAnnotation, "job-1"))
+		Expect(sa.Annotations).To(HaveKeyWithValue(SyncStatusAnnotation, SyncStatusFailed))
+		Expect(sa.Annotations[SyncReasonAnnotation]).To(ContainSubstring(ErrJobTimeout.Error()))
+	})
+
+	It("should register again once the recorded job is unknown", func() {
+		server, adds, _ := newAsyncServer(0)
+
+		sa := newManagedServiceAccount("app", "default")
+		sa.Annotations[EntryJobAnnotation] = "job-expired"
+		sa.Annotations[SpireServerAnnotation] = server.URL
+		r := newTestReconciler(server.URL, sa)
+		r.SpireClient.JobPollInterval = 10 * time.Millisecond
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(sa)}
+		_, err := r.Reconcile(context.Background(), req)
+		Expect(err).To(MatchError(ErrJobNotFound))
+		Expect(r.Get(context.Background(), req.NamespacedName, sa)).To(Succeed())
+		Expect(sa.Annotations).NotTo(HaveKey(EntryJobAnnotation))
+
+		_, err = r.Reconcile(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adds.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should wait for the job of a creation made outside a reconcile", func() {
+		server, _, polls := newAsyncServer(2)
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.JobPollInterval = 10 * time.Millisecond
+		id, err := c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "app"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(*id)).To(Equal("entry-1"))
+		Expect(polls.Load()).To(BeEquivalentTo(3))
+
+		c.JobTimeout = 50 * time.Millisecond
+		server, _, _ = newAsyncServer(1 << 30)
+		c.Pool = NewSpireAPIPool(SpireAPI{Server: server.URL})
+		_, err = c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "app"})
+		Expect(errors.Is(err, ErrJobTimeout)).To(BeTrue(), "got %v", err)
+	})
+
+	It("should fail with the message of a failed job", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/v1/entries/add":
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"jobID":"job-2"}`))
+			case "/v1/entries/jobs/job-2":
+				_, _ = w.Write([]byte(`{"jobID":"job-2","status":"failed","message":"invalid selector"}`))
+			}
+		}))
+		DeferCleanup(server.Close)
+
+		c := NewSpireClient(SpireAPI{Server: server.URL})
+		c.JobPollInterval = 10 * time.Millisecond
+		_, err := c.AddEntry(context.Background(), SpireEntry{Namespace: "default", ServiceAccount: "app"})
+		Expect(err).To(MatchError(ContainSubstring("invalid selector")))
+	})
+})
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultSpireAPIBasePath is the path below which the SPIRE registrar API serves
+// its entry operations.
+const DefaultSpireAPIBasePath = "/v1/entries"
+
+const (
+	// DeleteStylePost deletes an entry by POSTing it to the delete path.
+	DeleteStylePost = "post"
+	// DeleteStyleREST deletes an entry with DELETE on its ID below the base path,
+	// e.g. DELETE /v1/entries/{id}.
+	DeleteStyleREST = "rest"
+)
+
+// ParseDeleteStyle validates a --spire-api-delete-style value.
+func ParseDeleteStyle(style string) (string, error) {
+	switch style {
+	case DeleteStylePost, DeleteStyleREST:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unknown SPIRE API delete style %q: must be rest or post", style)
+	}
+}
+
+// ParseCreateMethod validates a --spire-api-create-method value, POST or PUT, in
+// any case.
+func ParseCreateMethod(method string) (string, error) {
+	switch upper := strings.ToUpper(method); upper {
+	case http.MethodPost, http.MethodPut:
+		return upper, nil
+	default:
+		return "", fmt.Errorf("unknown SPIRE API create method %q: must be POST or PUT", method)
+	}
+}
+
+// SpireAPIPaths locates the entry operations of the SPIRE registrar API: each
+// operation is served at its sub-path below Base.
+type SpireAPIPaths struct {
+	Base     string
+	Add      string
+	Delete   string
+	Update   string
+	List     string
+	BatchAdd string
+	// Jobs is the sub-path of the status of asynchronous creations: a creation
+	// answered with 202 Accepted is polled at Jobs/{jobID}.
+	Jobs string
+}
+
+// DefaultSpireAPIPaths returns the paths of the v1 registrar API, e.g.
+// /v1/entries/add.
+func DefaultSpireAPIPaths() SpireAPIPaths {
+	return SpireAPIPaths{
+		Base:     DefaultSpireAPIBasePath,
+		Add:      "add",
+		Delete:   "delete",
+		Update:   "update",
+		BatchAdd: "batch/add",
+		Jobs:     "jobs",
+	}
+}
+
+// SetOperation overrides the sub-path of an operation: add, delete, update, list,
+// batch-add or jobs.
+func (p *SpireAPIPaths) SetOperation(operation, subPath string) error {
+	switch operation {
+	case "add":
+		p.Add = subPath
+	case "delete":
+		p.Delete = subPath
+	case "update":
+		p.Update = subPath
+	case "list":
+		p.List = subPath
+	case "batch-add":
+		p.BatchAdd = subPath
+	case "jobs":
+		p.Jobs = subPath
+	default:
+		return fmt.Errorf("unknown SPIRE API operation %q: must be add, delete, update, list, batch-add or jobs", operation)
+	}
+	return nil
+}
+
+// path returns the absolute URL path of the operation served at subPath.
+func (p SpireAPIPaths) path(subPath string) string {
+	return joinURLPath(p.Base, subPath)
+}
+
+// createMethod returns the configured method of entry creations, defaulting to POST.
+func (c *SpireClient) createMethod() string {
+	if c.CreateMethod == "" {
+		return http.MethodPost
+	}
+	return c.CreateMethod
+}
+
+// apiPaths returns the configured paths, defaulting to DefaultSpireAPIPaths.
+func (c *SpireClient) apiPaths() SpireAPIPaths {
+	if c.Paths != nil {
+		return *c.Paths
+	}
+	return DefaultSpireAPIPaths()
+}
+
+// joinURLPath joins path elements into an absolute path with single slashes
+// between them, whatever leading and trailing slashes the elements have. Empty
+// elements are skipped.
+func joinURLPath(elems ...string) string {
+	var parts []string
+	for _, elem := range elems {
+		if elem = strings.Trim(elem, "/"); elem != "" {
+			parts = append(parts, elem)
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
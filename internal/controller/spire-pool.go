@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DefaultSpireAPICooldown = 30 * time.Second
+
+// SpireAPIPool is an ordered list of SPIRE API endpoints used for failover. An
+// endpoint that fails is skipped for Cooldown, unless every endpoint is cooling down.
+type SpireAPIPool struct {
+	Servers  []SpireAPI
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	failedAt map[string]time.Time
+}
+
+// NewSpireAPIPool returns a pool over servers with the default cooldown.
+func NewSpireAPIPool(servers ...SpireAPI) *SpireAPIPool {
+	return &SpireAPIPool{
+		Servers:  servers,
+		Cooldown: DefaultSpireAPICooldown,
+	}
+}
+
+// Endpoints returns the endpoints in the order they should be tried: available
+// endpoints in configured order, followed by those still cooling down.
+func (p *SpireAPIPool) Endpoints() []SpireAPI {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	available := make([]SpireAPI, 0, len(p.Servers))
+	var coolingDown []SpireAPI
+	for _, api := range p.Servers {
+		if failedAt, failed := p.failedAt[api.GetServerURL()]; failed && now.Sub(failedAt) < p.Cooldown {
+			coolingDown = append(coolingDown, api)
+			continue
+		}
+		available = append(available, api)
+	}
+	return append(available, coolingDown...)
+}
+
+// MarkFailed starts the cooldown of api.
+func (p *SpireAPIPool) MarkFailed(api SpireAPI) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failedAt == nil {
+		p.failedAt = map[string]time.Time{}
+	}
+	p.failedAt[api.GetServerURL()] = time.Now()
+}
+
+// MarkHealthy clears any cooldown of api.
+func (p *SpireAPIPool) MarkHealthy(api SpireAPI) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.failedAt, api.GetServerURL())
+}
+
+// lookup returns the configured endpoint whose URL is server.
+func (p *SpireAPIPool) lookup(server string) (SpireAPI, bool) {
+	for _, api := range p.Servers {
+		if api.GetServerURL() == server {
+			return api, true
+		}
+	}
+	return SpireAPI{}, false
+}
+
+type pinnedServerKey struct{}
+
+type servedByKey struct{}
+
+// WithSpireServer pins the SPIRE API requests made with the returned context to
+// server, e.g. the server holding an entry, instead of trying the pool in order.
+// Servers that are not in the pool are ignored, so that an annotation cannot send
+// requests, and the API token, elsewhere.
+func WithSpireServer(ctx context.Context, server string) context.Context {
+	if server == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, pinnedServerKey{}, server)
+}
+
+func pinnedServer(ctx context.Context) string {
+	server, _ := ctx.Value(pinnedServerKey{}).(string)
+	return server
+}
+
+// withServedBy returns a context recording the URL of the server that answers the
+// SPIRE API requests made with it.
+func withServedBy(ctx context.Context) (context.Context, *string) {
+	served := new(string)
+	return context.WithValue(ctx, servedByKey{}, served), served
+}
+
+func recordServedBy(ctx context.Context, server string) {
+	if served, ok := ctx.Value(servedByKey{}).(*string); ok {
+		*served = server
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxResponseBytes bounds the SPIRE API response bodies read by a SpireClient.
+const DefaultMaxResponseBytes = 1 << 20
+
+// readBody reads the body of resp, failing once it exceeds MaxResponseBytes rather
+// than buffering an unbounded response.
+func (c *SpireClient) readBody(resp *http.Response) ([]byte, error) {
+	limit := c.MaxResponseBytes
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], fmt.Errorf("SPIRE API response body exceeds %d bytes", limit)
+	}
+	return body, nil
+}
+
+// decodeBody decodes the JSON response body into v, rejecting unknown fields when
+// StrictDecoding is set. Errors carry a truncated snippet of the body.
+func (c *SpireClient) decodeBody(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if c.StrictDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("decoding SPIRE API response %q: %w", truncateMessage(string(body)), err)
+	}
+	return nil
+}
+
+// malformedResponse wraps the error decoding the body of a successful op response
+// with the status. A body that is not JSON at all, e.g. the HTML error page of a
+// proxy answering in place of the SPIRE API, is reported as ErrSpireUnavailable so
+// that the request is retried.
+func malformedResponse(op string, resp *http.Response, body []byte, err error) error {
+	if !json.Valid(body) {
+		return fmt.Errorf("%w: %s answered %s with a malformed body: %w", ErrSpireUnavailable, op, resp.Status, err)
+	}
+	return fmt.Errorf("%s answered %s with an unexpected body: %w", op, resp.Status, err)
+}
+
+// truncateMessage trims message and cuts it to maxResponseMessage bytes.
+func truncateMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) > maxResponseMessage {
+		message = message[:maxResponseMessage] + "..."
+	}
+	return message
+}
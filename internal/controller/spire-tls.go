@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Kinds of a TLSSource, see ParseTLSSource.
+const (
+	TLSSourceSecret    = "secret"
+	TLSSourceConfigMap = "configmap"
+
+	DefaultTLSCAKey   = "ca.crt"
+	DefaultTLSCertKey = corev1.TLSCertKey
+	DefaultTLSKeyKey  = corev1.TLSPrivateKeyKey
+
+	// DefaultTLSReloadInterval is how often the TLS material of the SPIRE API client
+	// is checked for rotation.
+	DefaultTLSReloadInterval = time.Minute
+)
+
+// TLSSource locates PEM data: a file, or a key of a Secret or ConfigMap.
+type TLSSource struct {
+	File string
+
+	// Kind is TLSSourceSecret or TLSSourceConfigMap when the data is read from the
+	// object Object, at Key.
+	Kind   string
+	Object types.NamespacedName
+	Key    string
+}
+
+// ParseTLSSource returns the TLSSource of value: secret:namespace/name[:key],
+// configmap:namespace/name[:key] or else a file path. The key defaults to defaultKey.
+func ParseTLSSource(value, defaultKey string) (TLSSource, error) {
+	kind, ref, found := strings.Cut(value, ":")
+	if !found || (kind != TLSSourceSecret && kind != TLSSourceConfigMap) {
+		return TLSSource{File: value}, nil
+	}
+	ref, key, _ := strings.Cut(ref, ":")
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return TLSSource{}, fmt.Errorf("invalid TLS source %q: must be %s:namespace/name[:key]", value, kind)
+	}
+	if key == "" {
+		key = defaultKey
+	}
+	return TLSSource{Kind: kind, Object: types.NamespacedName{Namespace: namespace, Name: name}, Key: key}, nil
+}
+
+// IsZero reports whether s locates nothing.
+func (s TLSSource) IsZero() bool {
+	return s.File == "" && s.Kind == ""
+}
+
+func (s TLSSource) String() string {
+	if s.Kind == "" {
+		return s.File
+	}
+	return s.Kind + ":" + s.Object.String() + ":" + s.Key
+}
+
+// read returns the data s locates.
+func (s TLSSource) read(ctx context.Context, c client.Reader) ([]byte, error) {
+	var data []byte
+	switch s.Kind {
+	case "":
+		var err error
+		if data, err = os.ReadFile(s.File); err != nil {
+			return nil, err
+		}
+	case TLSSourceSecret:
+		secret := &corev1.Secret{}
+		if err := getWithRetry(ctx, c, s.Object, secret); err != nil {
+			return nil, fmt.Errorf("reading Secret %s: %w", s.Object, err)
+		}
+		data = secret.Data[s.Key]
+	case TLSSourceConfigMap:
+		cm := &corev1.ConfigMap{}
+		if err := getWithRetry(ctx, c, s.Object, cm); err != nil {
+			return nil, fmt.Errorf("reading ConfigMap %s: %w", s.Object, err)
+		}
+		data = []byte(cm.Data[s.Key])
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%s is empty", s)
+	}
+	return data, nil
+}
+
+var _ manager.LeaderElectionRunnable = &SpireTLS{}
+var _ http.RoundTripper = &SpireTLS{}
+
+// SpireTLS is the transport of the SPIRE API client when it verifies the servers
+// against a CA bundle or presents a client certificate. The material is read from
+// files or from Secrets and ConfigMaps, and checked for rotation every
+// ReloadInterval; on a change, later requests use a new transport with the new
+// material, so that rotated certificates are picked up without a restart.
+type SpireTLS struct {
+	// CA is the PEM bundle of the CAs trusted to verify the SPIRE servers. When
+	// unset, the system roots are used.
+	CA TLSSource
+	// Cert and Key are the PEM client certificate and private key, if any.
+	Cert TLSSource
+	Key  TLSSource
+
+	// Reader reads the Secrets and ConfigMaps, e.g. the manager's API reader, so
+	// that Secrets are not cached cluster-wide.
+	Reader client.Reader
+
+	// ReloadInterval is the time between two checks for rotated material. Defaults
+	// to DefaultTLSReloadInterval.
+	ReloadInterval time.Duration
+
+	base    *http.Transport
+	mu      sync.Mutex
+	sum     [sha256.Size]byte
+	current atomic.Pointer[http.Transport]
+}
+
+// Wrap makes t the transport of c, configuring clones of the transport of c with the
+// TLS material. The material is loaded once, so that invalid material fails early.
+func (t *SpireTLS) Wrap(ctx context.Context, c *http.Client) error {
+	if t.Cert.IsZero() != t.Key.IsZero() {
+		return fmt.Errorf("the SPIRE API client certificate and key must be set together")
+	}
+	if t.Key.Kind == TLSSourceConfigMap {
+		return fmt.Errorf("the SPIRE API client key must not be read from a ConfigMap, use a Secret")
+	}
+	base, ok := c.Transport.(*http.Transport)
+	if !ok || base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t.base = base
+	if _, err := t.Reload(ctx); err != nil {
+		return err
+	}
+	c.Transport = t
+	return nil
+}
+
+// RoundTrip sends req with the current TLS material.
+func (t *SpireTLS) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(req)
+}
+
+// Reload reads the TLS material and, when it changed, replaces the transport. It
+// reports whether it did. The previous transport is kept when the material cannot
+// be read or is invalid.
+func (t *SpireTLS) Reload(ctx context.Context) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ca, cert, key []byte
+	var err error
+	if !t.CA.IsZero() {
+		if ca, err = t.CA.read(ctx, t.Reader); err != nil {
+			return false, fmt.Errorf("reading SPIRE API CA bundle: %w", err)
+		}
+	}
+	if !t.Cert.IsZero() {
+		if cert, err = t.Cert.read(ctx, t.Reader); err != nil {
+			return false, fmt.Errorf("reading SPIRE API client certificate: %w", err)
+		}
+		if key, err = t.Key.read(ctx, t.Reader); err != nil {
+			return false, fmt.Errorf("reading SPIRE API client key: %w", err)
+		}
+	}
+	sum := sha256.Sum256(bytes.Join([][]byte{ca, cert, key}, []byte{0}))
+	if t.current.Load() != nil && sum == t.sum {
+		return false, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca != nil {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return false, fmt.Errorf("SPIRE API CA bundle %s holds no PEM certificate", t.CA)
+		}
+	}
+	if cert != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return false, fmt.Errorf("invalid SPIRE API client certificate %s: %w", t.Cert, err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	transport := t.base.Clone()
+	transport.TLSClientConfig = config
+	if previous := t.current.Swap(transport); previous != nil {
+		previous.CloseIdleConnections()
+	}
+	t.sum = sum
+	return true, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every replica sends
+// requests, so every replica reloads the material.
+func (t *SpireTLS) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reloads the TLS material every ReloadInterval until ctx is cancelled. It
+// implements manager.Runnable.
+func (t *SpireTLS) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("spire-tls")
+	interval := t.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultTLSReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reloaded, err := t.Reload(ctx)
+			if err != nil {
+				logger.Error(err, "Failed to reload SPIRE API TLS material, keeping the previous one")
+				continue
+			}
+			if reloaded {
+				logger.Info("Reloaded SPIRE API TLS material", "ca", t.CA.String(), "cert", t.Cert.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1 and its PEM
+// certificate and key.
+func newTestCertificate(name string) (tls.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).NotTo(HaveOccurred())
+	return pair, certPEM, keyPEM
+}
+
+// newTestTLSServer returns a server presenting cert, configured by configure.
+func newTestTLSServer(cert tls.Certificate, configure func(*tls.Config)) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if configure != nil {
+		configure(server.TLS)
+	}
+	server.StartTLS()
+	return server
+}
+
+var _ = Describe("SPIRE API TLS", func() {
+	get := func(c *http.Client, url string) error {
+		resp, err := c.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	It("should parse files, Secrets and ConfigMaps", func() {
+		s, err := ParseTLSSource("/etc/spire/ca.pem", DefaultTLSCAKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal(TLSSource{File: "/etc/spire/ca.pem"}))
+
+		s, err = ParseTLSSource("configmap:spire/bundle", DefaultTLSCAKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal(TLSSource{Kind: TLSSourceConfigMap, Object: types.NamespacedName{Namespace: "spire", Name: "bundle"},
+			Key: DefaultTLSCAKey}))
+
+		s, err = ParseTLSSource("secret:spire/client:cert.pem", DefaultTLSCertKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(Equal(TLSSource{Kind: TLSSourceSecret, Object: types.NamespacedName{Namespace: "spire", Name: "client"},
+			Key: "cert.pem"}))
+
+		_, err = ParseTLSSource("secret:client", DefaultTLSCertKey)
+		Expect(err).To(MatchError(ContainSubstring("must be secret:namespace/name[:key]")))
+	})
+
+	It("should pick up a CA bundle swapped in its ConfigMap", func() {
+		oldCert, oldPEM, _ := newTestCertificate("old")
+		newCert, newPEM, _ := newTestCertificate("new")
+		oldServer := newTestTLSServer(oldCert, nil)
+		defer oldServer.Close()
+		newServer := newTestTLSServer(newCert, nil)
+		defer newServer.Close()
+
+		bundle := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "spire", Name: "bundle"},
+			Data:       map[string]string{DefaultTLSCAKey: string(oldPEM)},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(bundle).Build()
+		source, err := ParseTLSSource("configmap:spire/bundle", DefaultTLSCAKey)
+		Expect(err).NotTo(HaveOccurred())
+		t := &SpireTLS{CA: source, Reader: c}
+		httpClient, err := NewSpireHTTPClient("", nil, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.Wrap(context.Background(), httpClient)).To(Succeed())
+
+		Expect(get(httpClient, oldServer.URL)).To(Succeed())
+		Expect(get(httpClient, newServer.URL)).NotTo(Succeed())
+		reloaded, err := t.Reload(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse(), "the bundle did not change")
+
+		bundle.Data[DefaultTLSCAKey] = string(newPEM)
+		Expect(c.Update(context.Background(), bundle)).To(Succeed())
+		reloaded, err = t.Reload(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(get(httpClient, newServer.URL)).To(Succeed())
+		Expect(get(httpClient, oldServer.URL)).NotTo(Succeed())
+
+		// Invalid material is not swapped in.
+		bundle.Data[DefaultTLSCAKey] = "not a certificate"
+		Expect(c.Update(context.Background(), bundle)).To(Succeed())
+		_, err = t.Reload(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("holds no PEM certificate")))
+		Expect(get(httpClient, newServer.URL)).To(Succeed())
+	})
+
+	It("should present the client certificate of a Secret and verify against a CA file", func() {
+		serverCert, serverPEM, _ := newTestCertificate("server")
+		_, clientPEM, clientKeyPEM := newTestCertificate("client")
+		clientCAs := x509.NewCertPool()
+		Expect(clientCAs.AppendCertsFromPEM(clientPEM)).To(BeTrue())
+		server := newTestTLSServer(serverCert, func(config *tls.Config) {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+			config.ClientCAs = clientCAs
+		})
+		defer server.Close()
+
+		caFile := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+		Expect(os.WriteFile(caFile, serverPEM, 0o600)).To(Succeed())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "spire", Name: "client"},
+			Data:       map[string][]byte{corev1.TLSCertKey: clientPEM, corev1.TLSPrivateKeyKey: clientKeyPEM},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+		ref := types.NamespacedName{Namespace: "spire", Name: "client"}
+		t := &SpireTLS{
+			CA:     TLSSource{File: caFile},
+			Cert:   TLSSource{Kind: TLSSourceSecret, Object: ref, Key: DefaultTLSCertKey},
+			Key:    TLSSource{Kind: TLSSourceSecret, Object: ref, Key: DefaultTLSKeyKey},
+			Reader: c,
+		}
+		httpClient := &http.Client{}
+		Expect(t.Wrap(context.Background(), httpClient)).To(Succeed())
+		Expect(get(httpClient, server.URL)).To(Succeed())
+	})
+
+	It("should reject a client key without a certificate or from a ConfigMap", func() {
+		key := TLSSource{Kind: TLSSourceConfigMap, Object: types.NamespacedName{Namespace: "spire", Name: "client"}, Key: DefaultTLSKeyKey}
+		var c client.Reader = fake.NewClientBuilder().Build()
+		Expect((&SpireTLS{Key: key, Reader: c}).Wrap(context.Background(), &http.Client{})).
+			To(MatchError(ContainSubstring("must be set together")))
+		Expect((&SpireTLS{Cert: TLSSource{File: "tls.crt"}, Key: key, Reader: c}).Wrap(context.Background(), &http.Client{})).
+			To(MatchError(ContainSubstring("must not be read from a ConfigMap")))
+	})
+
+	It("should reload on every replica", func() {
+		Expect((&SpireTLS{}).NeedLeaderElection()).To(BeFalse())
+	})
+})
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// DefaultSpireRequestTimeout bounds a single SPIRE API request, so that a hung server
+// fails the attempt and the next server is tried.
+const DefaultSpireRequestTimeout = 30 * time.Second
+
+// defaultSpireHTTPClient is the HTTP client of SpireClients not given one.
+var defaultSpireHTTPClient = &http.Client{Timeout: DefaultSpireRequestTimeout}
+
+// NewSpireHTTPClient returns the HTTP client used for SPIRE API requests, each bounded
+// by timeout, or DefaultSpireRequestTimeout when zero. Requests go through proxyURL
+// when set, and otherwise through the proxy configured by the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables. Hosts matching an entry of noProxy,
+// in NO_PROXY syntax, are always reached directly.
+func NewSpireHTTPClient(proxyURL string, noProxy []string, timeout time.Duration) (*http.Client, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid SPIRE API request timeout %s: must not be negative", timeout)
+	}
+	if timeout == 0 {
+		timeout = DefaultSpireRequestTimeout
+	}
+	config := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		if _, err := url.Parse(proxyURL); err != nil {
+			return nil, fmt.Errorf("invalid SPIRE API proxy URL %q: %w", proxyURL, err)
+		}
+		config.HTTPProxy = proxyURL
+		config.HTTPSProxy = proxyURL
+	}
+	if len(noProxy) > 0 {
+		config.NoProxy = strings.Join(append(noProxy, config.NoProxy), ",")
+	}
+
+	proxyFunc := config.ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
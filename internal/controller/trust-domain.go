@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Sources of the trust domain, see ParseTrustDomainSource.
+const (
+	TrustDomainSourceAnnotation = "annotation"
+	TrustDomainSourceConfigMap  = "configmap"
+
+	DefaultTrustDomainConfigMap = "spire-config"
+	DefaultTrustDomainKey       = "trustDomain"
+)
+
+// TrustDomainSource locates the trust domain of the SPIRE entries. By default it is
+// the SpireTrustDomainAnnotation of the cluster info ConfigMap, which kubeadm
+// manages and may rewrite on upgrade.
+type TrustDomainSource struct {
+	// ConfigMap, when set, holds the trust domain in its Key. It takes precedence
+	// over the annotation, which remains the fallback while the ConfigMap or the key
+	// is missing.
+	ConfigMap types.NamespacedName
+	Key       string
+}
+
+// ParseTrustDomainSource returns the TrustDomainSource of source, annotation or
+// configmap. The configmap source reads key of the ConfigMap configMap, given as
+// namespace/name.
+func ParseTrustDomainSource(source, configMap, key string) (TrustDomainSource, error) {
+	switch source {
+	case "", TrustDomainSourceAnnotation:
+		return TrustDomainSource{}, nil
+	case TrustDomainSourceConfigMap:
+		namespace, name, ok := strings.Cut(configMap, "/")
+		if !ok || namespace == "" || name == "" {
+			return TrustDomainSource{}, fmt.Errorf("invalid trust domain ConfigMap %q: must be namespace/name", configMap)
+		}
+		if key == "" {
+			key = DefaultTrustDomainKey
+		}
+		return TrustDomainSource{ConfigMap: types.NamespacedName{Namespace: namespace, Name: name}, Key: key}, nil
+	default:
+		return TrustDomainSource{}, fmt.Errorf("unknown trust domain source %q: must be %s or %s",
+			source, TrustDomainSourceAnnotation, TrustDomainSourceConfigMap)
+	}
+}
+
+// resolve returns the trust domain from the ConfigMap, if any, else from the
+// annotation of clusterInfo.
+func (s TrustDomainSource) resolve(ctx context.Context, c client.Reader, clusterInfo *corev1.ConfigMap) (string, error) {
+	if s.ConfigMap.Name != "" {
+		cm := &corev1.ConfigMap{}
+		err := getWithRetry(ctx, c, s.ConfigMap, cm)
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("reading trust domain ConfigMap %s: %w", s.ConfigMap, err)
+		}
+		if trustDomain := strings.TrimSpace(cm.Data[s.Key]); trustDomain != "" {
+			if err := validateTrustDomain(trustDomain); err != nil {
+				return "", fmt.Errorf("invalid key %s of ConfigMap %s: %w", s.Key, s.ConfigMap, err)
+			}
+			return trustDomain, nil
+		}
+		log.FromContext(ctx).V(1).Info("Trust domain ConfigMap has none, using the annotation",
+			"ConfigMap", s.ConfigMap.String(), "key", s.Key, "notFound", apierrors.IsNotFound(err))
+	}
+
+	trustDomain := clusterInfo.Annotations[SpireTrustDomainAnnotation]
+	if trustDomain == "" {
+		if s.ConfigMap.Name != "" {
+			return "", fmt.Errorf("missing key %s in ConfigMap %s and %s annotation on ConfigMap %s/%s",
+				s.Key, s.ConfigMap, SpireTrustDomainAnnotation, ClusterInfoCmNamespace, ClusterInfoCm)
+		}
+		return "", fmt.Errorf("missing %s annotation on ConfigMap %s/%s", SpireTrustDomainAnnotation, ClusterInfoCmNamespace, ClusterInfoCm)
+	}
+	if err := validateTrustDomain(trustDomain); err != nil {
+		return "", fmt.Errorf("invalid %s annotation on ConfigMap %s/%s: %w", SpireTrustDomainAnnotation, ClusterInfoCmNamespace, ClusterInfoCm, err)
+	}
+	return trustDomain, nil
+}